@@ -2,20 +2,41 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
-	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/auth/apikey"
+	"github.com/jason0730/claude-code-demo/internal/auth/authcode"
+	"github.com/jason0730/claude-code-demo/internal/auth/certauth"
+	"github.com/jason0730/claude-code-demo/internal/auth/client"
+	"github.com/jason0730/claude-code-demo/internal/auth/dpop"
+	"github.com/jason0730/claude-code-demo/internal/auth/federation"
+	"github.com/jason0730/claude-code-demo/internal/auth/identity"
 	authjwt "github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/auth/ldap"
+	"github.com/jason0730/claude-code-demo/internal/auth/lockout"
+	"github.com/jason0730/claude-code-demo/internal/auth/mfa"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/auth/passhash"
+	"github.com/jason0730/claude-code-demo/internal/auth/refresh"
+	"github.com/jason0730/claude-code-demo/internal/auth/revocation"
+	"github.com/jason0730/claude-code-demo/internal/auth/session"
+	"github.com/jason0730/claude-code-demo/internal/auth/webauthn"
+	"github.com/jason0730/claude-code-demo/internal/authz/abac"
 	authzmw "github.com/jason0730/claude-code-demo/internal/authz/middleware"
 	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
 	"github.com/jason0730/claude-code-demo/internal/config"
 	"github.com/jason0730/claude-code-demo/internal/handler"
+	"github.com/jason0730/claude-code-demo/internal/mail"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -28,43 +49,222 @@ func main() {
 
 	log.Info("Starting API Server...")
 
+	if err := cfg.Validate(); err != nil {
+		log.WithError(err).Fatal("Invalid configuration")
+	}
+
 	// 初始化组件
-	tokenManager := authjwt.NewTokenManager(&cfg.Auth)
-	rbacManager := rbac.NewRBACManager()
+	tokenManager, err := authjwt.NewTokenManager(&cfg.Auth)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize token manager")
+	}
+	log.WithField("algorithm", tokenManager.Algorithm()).Info("Token manager initialized")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tokenManager.WatchKeyDir(ctx)
+
+	roleStore, err := newRoleStore(&cfg.RBAC)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize role store")
+	}
+	rbacManager := rbac.NewRBACManager(roleStore)
+	if err := rbacManager.Reload(ctx); err != nil {
+		log.WithError(err).Fatal("Failed to load roles")
+	}
+	go rbacManager.Watch(ctx, cfg.RBAC.ReloadInterval)
+
+	policyLocation, err := time.LoadLocation(cfg.ABAC.Timezone)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid access policy time zone")
+	}
+	policyEngine, err := abac.NewEngine(cfg.ABAC.PolicyPath, policyLocation, rbacManager)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load access policies")
+	}
+	if cfg.ABAC.PolicyPath != "" {
+		log.WithFields(log.Fields{
+			"path":     cfg.ABAC.PolicyPath,
+			"rules":    policyEngine.Rules(),
+			"timezone": cfg.ABAC.Timezone,
+		}).Info("Access policies loaded")
+	}
+	go policyEngine.Watch(ctx, cfg.ABAC.ReloadInterval)
+
+	refreshStore, err := newRefreshStore(&cfg.Auth)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize refresh token store")
+	}
+	sessionStore, err := newSessionStore(&cfg.Auth)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize session store")
+	}
+	refreshManager := refresh.NewManager(refreshStore, sessionStore)
+	revocationStore, err := newRevocationStore(&cfg.Auth)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize revocation store")
+	}
+
+	clientRegistry, err := client.LoadStaticRegistry(cfg.OAuth.ClientsFile)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load OAuth client registry")
+	}
+	authCodeStore, err := newAuthCodeStore(&cfg.OAuth)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize authorization code store")
+	}
+
+	federationService, err := newFederationService(cfg)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize federated identity providers")
+	}
+
+	hasher, err := passhash.NewHasher(&cfg.Password)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid password hashing configuration")
+	}
+	localUsers, err := newLocalUserStore(cfg, hasher)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize local user store")
+	}
+	users, err := newIdentityChain(cfg, hasher, localUsers, federationService)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize identity backends")
+	}
+
+	apiKeyStore, err := newAPIKeyStore(&cfg.APIKey)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize API key store")
+	}
+	apiKeyService := apikey.NewService(apiKeyStore, &cfg.APIKey)
+
+	certMapper, err := certauth.LoadMapper(cfg.MTLS.IdentitiesFile)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load client certificate identities")
+	}
+
+	dpopReplays, err := newDPoPReplayCache(&cfg.DPoP)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize DPoP replay cache")
+	}
+	dpopVerifier := dpop.NewVerifier(&cfg.DPoP, cfg.OAuth.Issuer, dpopReplays)
 
 	// 初始化中间件
-	authMiddleware := authmw.NewAuthMiddleware(tokenManager)
-	authzMiddleware := authzmw.NewAuthzMiddleware(rbacManager)
+	authMiddleware := authmw.NewAuthMiddleware(tokenManager, revocationStore, apiKeyService, certMapper, dpopVerifier, users)
+	authzMiddleware := authzmw.NewAuthzMiddleware(rbacManager, policyEngine)
 
 	// 初始化处理器
-	authHandler := handler.NewAuthHandler(tokenManager)
-	userHandler := handler.NewUserHandler()
-	resourceHandler := handler.NewResourceHandler()
+	mfaStore, err := newMFAStore(&cfg.MFA)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize MFA store")
+	}
+	mfaService := mfa.NewService(mfaStore, cfg.MFA.Issuer, cfg.MFA.RecoveryCodes)
+	webauthnStore, err := newWebAuthnStore(&cfg.WebAuthn)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize WebAuthn store")
+	}
+	webauthnService := webauthn.NewService(webauthnStore, &cfg.WebAuthn)
+
+	loginGuard, err := lockout.NewGuard(&cfg.Lockout)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize login lockout store")
+	}
+	authHandler := handler.NewAuthHandler(
+		tokenManager,
+		refreshManager,
+		revocationStore,
+		users,
+		users,
+		federationService,
+		loginGuard,
+		mfaService,
+		webauthnService,
+		&cfg.MFA,
+		&cfg.MTLS,
+		dpopVerifier,
+	)
+	mailer, err := mail.New(&cfg.Mail)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize mailer")
+	}
+	if cfg.Mail.Driver == "log" && cfg.Server.Environment == config.EnvironmentProduction {
+		log.Warn("MAIL_DRIVER=log writes password reset links to the log; configure SMTP in production")
+	}
+	accountHandler := handler.NewAccountHandler(
+		&cfg.Account,
+		cfg.OAuth.Issuer,
+		cfg.Mail.AppName,
+		localUsers,
+		mailer,
+		authHandler,
+		apiKeyService,
+	)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService, rbacManager)
+	roleHandler := handler.NewRoleHandler(rbacManager)
+	userHandler := handler.NewUserHandler(users, rbacManager, policyEngine)
+	resourceHandler := handler.NewResourceHandler(rbacManager, policyEngine)
 	healthHandler := handler.NewHealthHandler()
+	keyHandler := handler.NewKeyHandler(tokenManager)
+	oauthHandler := handler.NewOAuthHandler(
+		&cfg.OAuth,
+		tokenManager,
+		refreshManager,
+		revocationStore,
+		clientRegistry,
+		authCodeStore,
+		authHandler,
+		rbacManager,
+	)
 
 	// 创建路由
 	router := setupRouter(
 		authMiddleware,
 		authzMiddleware,
 		authHandler,
+		accountHandler,
+		apiKeyHandler,
+		roleHandler,
 		userHandler,
 		resourceHandler,
 		healthHandler,
+		keyHandler,
+		oauthHandler,
 	)
 
+	trustedProxies, err := parseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid TRUSTED_PROXIES")
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid TLS configuration")
+	}
+
 	// 创建 HTTP 服务器
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	srv := &http.Server{
 		Addr:         addr,
-		Handler:      router,
+		Handler:      realIPMiddleware(trustedProxies)(router),
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
+		TLSConfig:    tlsConfig,
 	}
 
 	// 启动服务器
 	go func() {
-		log.WithField("address", addr).Info("Server listening")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.WithFields(log.Fields{
+			"address":     addr,
+			"tls":         tlsConfig != nil,
+			"client_auth": cfg.MTLS.ClientAuth,
+		}).Info("Server listening")
+		var err error
+		if tlsConfig != nil {
+			err = srv.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.WithError(err).Fatal("Failed to start server")
 		}
 	}()
@@ -78,9 +278,14 @@ func setupRouter(
 	authMw *authmw.AuthMiddleware,
 	authzMw *authzmw.AuthzMiddleware,
 	authHandler *handler.AuthHandler,
+	accountHandler *handler.AccountHandler,
+	apiKeyHandler *handler.APIKeyHandler,
+	roleHandler *handler.RoleHandler,
 	userHandler *handler.UserHandler,
 	resourceHandler *handler.ResourceHandler,
 	healthHandler *handler.HealthHandler,
+	keyHandler *handler.KeyHandler,
+	oauthHandler *handler.OAuthHandler,
 ) *mux.Router {
 	router := mux.NewRouter()
 
@@ -92,17 +297,77 @@ func setupRouter(
 	router.HandleFunc("/ready", healthHandler.Ready).Methods("GET")
 	router.HandleFunc("/metrics", healthHandler.Metrics).Methods("GET")
 
+	// 公钥发布端点（无需认证）
+	router.HandleFunc("/.well-known/jwks.json", keyHandler.JWKS).Methods("GET")
+
+	// OpenID Connect 端点
+	router.HandleFunc("/.well-known/openid-configuration", oauthHandler.Discovery).Methods("GET")
+	router.HandleFunc("/oauth/authorize", oauthHandler.Authorize).Methods("GET", "POST")
+	router.Handle("/userinfo", authMw.Authenticate(http.HandlerFunc(oauthHandler.UserInfo))).Methods("GET", "POST")
+
+	// OAuth 2.0 端点（客户端凭证认证）
+	router.HandleFunc("/oauth/token", oauthHandler.Token).Methods("POST")
+	router.HandleFunc("/oauth/introspect", oauthHandler.Introspect).Methods("POST")
+	router.HandleFunc("/oauth/revoke", oauthHandler.Revoke).Methods("POST")
+
+	// 邮件链接打开的账户页面
+	router.HandleFunc("/account/reset-password", accountHandler.ResetPasswordPage).Methods("GET", "POST")
+	router.HandleFunc("/account/verify-email", accountHandler.VerifyEmailPage).Methods("GET", "POST")
+
 	// API 路由
 	api := router.PathPrefix("/api/v1").Subrouter()
 
 	// 认证端点（无需认证）
 	api.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
 	api.HandleFunc("/auth/refresh", authHandler.Refresh).Methods("POST")
+	api.HandleFunc("/auth/providers", authHandler.ListProviders).Methods("GET")
+	api.HandleFunc("/auth/federated/{provider}/login", authHandler.FederatedLogin).Methods("GET")
+	api.HandleFunc("/auth/federated/{provider}/callback", authHandler.FederatedCallback).Methods("GET")
+	api.HandleFunc("/auth/mfa/verify", authHandler.VerifyMFA).Methods("POST")
+	api.HandleFunc("/auth/mfa/enroll", authHandler.EnrollMFA).Methods("POST")
+	api.HandleFunc("/auth/mfa/enroll/confirm", authHandler.ConfirmMFAEnrollment).Methods("POST")
+	api.HandleFunc("/auth/webauthn/login/begin", authHandler.BeginWebAuthnLogin).Methods("POST")
+	api.HandleFunc("/auth/webauthn/login/finish", authHandler.FinishWebAuthnLogin).Methods("POST")
+	api.HandleFunc("/auth/webauthn/register/begin", authHandler.EnrollWebAuthn).Methods("POST")
+	api.HandleFunc("/auth/webauthn/register/finish", authHandler.ConfirmWebAuthnEnrollment).Methods("POST")
+	api.HandleFunc("/auth/password/forgot", accountHandler.ForgotPassword).Methods("POST")
+	api.HandleFunc("/auth/password/reset", accountHandler.ResetPassword).Methods("POST")
+	api.HandleFunc("/auth/email/verify", accountHandler.VerifyEmail).Methods("POST")
 
 	// 需要认证的端点
 	authenticated := api.PathPrefix("").Subrouter()
 	authenticated.Use(authMw.Authenticate)
 
+	// 账户和安全设置只接受交互式登录签发的令牌，个人访问令牌不能访问
+	interactive := authenticated.PathPrefix("").Subrouter()
+	interactive.Use(authMw.RejectAPIKeys)
+
+	// 登出端点
+	interactive.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
+	interactive.HandleFunc("/auth/logout-all", authHandler.LogoutAll).Methods("POST")
+
+	// 会话管理
+	interactive.HandleFunc("/me/sessions", authHandler.ListSessions).Methods("GET")
+	interactive.HandleFunc("/me/sessions/{id}", authHandler.RevokeSession).Methods("DELETE")
+
+	// 多因素认证
+	interactive.HandleFunc("/me/mfa", authHandler.GetMFAStatus).Methods("GET")
+	interactive.HandleFunc("/me/mfa", authHandler.DisableMFA).Methods("DELETE")
+	interactive.HandleFunc("/me/mfa/totp", authHandler.BeginMFA).Methods("POST")
+	interactive.HandleFunc("/me/mfa/totp/confirm", authHandler.ConfirmMFA).Methods("POST")
+	interactive.HandleFunc("/me/webauthn/credentials", authHandler.ListWebAuthnCredentials).Methods("GET")
+	interactive.HandleFunc("/me/webauthn/credentials/{id}", authHandler.DeleteWebAuthnCredential).Methods("DELETE")
+	interactive.HandleFunc("/me/webauthn/register/begin", authHandler.BeginWebAuthnRegistration).Methods("POST")
+	interactive.HandleFunc("/me/webauthn/register/finish", authHandler.FinishWebAuthnRegistration).Methods("POST")
+
+	// 个人访问令牌
+	interactive.HandleFunc("/me/tokens", apiKeyHandler.ListKeys).Methods("GET")
+	interactive.HandleFunc("/me/tokens", apiKeyHandler.CreateKey).Methods("POST")
+	interactive.HandleFunc("/me/tokens/{id}", apiKeyHandler.RevokeKey).Methods("DELETE")
+
+	// 邮箱验证
+	interactive.HandleFunc("/me/email/verification", accountHandler.SendVerification).Methods("POST")
+
 	// 用户端点
 	authenticated.Handle("/users",
 		authzMw.RequirePermission(rbac.PermissionUserList)(
@@ -110,8 +375,9 @@ func setupRouter(
 		),
 	).Methods("GET")
 
+	// 对象级授权在处理器中加载用户后进行：只能读取自己的信息，除非可以列出全部用户
 	authenticated.Handle("/users/{id}",
-		authzMw.RequireAnyRole(rbac.RoleAdmin, rbac.RoleUser)(
+		authzMw.RequirePermission(rbac.PermissionUserRead)(
 			http.HandlerFunc(userHandler.GetUser),
 		),
 	).Methods("GET")
@@ -129,9 +395,355 @@ func setupRouter(
 		),
 	).Methods("POST")
 
+	// 修改和删除只允许资源所有者或管理员，由处理器在加载资源后检查
+	authenticated.Handle("/resources/{id}",
+		authzMw.RequirePermission(rbac.PermissionResourceRead)(
+			http.HandlerFunc(resourceHandler.GetResource),
+		),
+	).Methods("GET")
+
+	authenticated.Handle("/resources/{id}",
+		authzMw.RequirePermission(rbac.PermissionResourceWrite)(
+			http.HandlerFunc(resourceHandler.UpdateResource),
+		),
+	).Methods("PUT")
+
+	authenticated.Handle("/resources/{id}",
+		authzMw.RequirePermission(rbac.PermissionResourceDelete)(
+			http.HandlerFunc(resourceHandler.DeleteResource),
+		),
+	).Methods("DELETE")
+
+	// 管理端点
+	authenticated.Handle("/admin/keys",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(keyHandler.ListKeys),
+		),
+	).Methods("GET")
+
+	authenticated.Handle("/admin/users/{id}/logout",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(authHandler.LogoutUser),
+		),
+	).Methods("POST")
+
+	authenticated.Handle("/admin/users/{id}/sessions",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(authHandler.ListUserSessions),
+		),
+	).Methods("GET")
+
+	authenticated.Handle("/admin/users/{id}/sessions/{session}",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(authHandler.RevokeUserSession),
+		),
+	).Methods("DELETE")
+
+	authenticated.Handle("/admin/keys/rotate",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(keyHandler.RotateKey),
+		),
+	).Methods("POST")
+
+	authenticated.Handle("/admin/users/{id}/mfa",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(authHandler.ResetMFA),
+		),
+	).Methods("DELETE")
+
+	authenticated.Handle("/admin/lockouts",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(authHandler.ListLockouts),
+		),
+	).Methods("GET")
+
+	authenticated.Handle("/admin/lockouts/{scope}/{key}",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(authHandler.Unlock),
+		),
+	).Methods("DELETE")
+
+	authenticated.Handle("/admin/roles",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(roleHandler.ListRoles),
+		),
+	).Methods("GET")
+
+	authenticated.Handle("/admin/roles",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(roleHandler.CreateRole),
+		),
+	).Methods("POST")
+
+	authenticated.Handle("/admin/roles/{role}",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(roleHandler.GetRole),
+		),
+	).Methods("GET")
+
+	authenticated.Handle("/admin/roles/{role}",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(roleHandler.UpdateRole),
+		),
+	).Methods("PUT")
+
+	authenticated.Handle("/admin/roles/{role}",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(roleHandler.DeleteRole),
+		),
+	).Methods("DELETE")
+
+	authenticated.Handle("/admin/roles/{role}/permissions",
+		authzMw.RequireRole(rbac.RoleAdmin)(
+			http.HandlerFunc(roleHandler.ExplainRole),
+		),
+	).Methods("GET")
+
 	return router
 }
 
+// newTLSConfig 根据配置创建服务端 TLS 配置，未配置证书时返回 nil（明文 HTTP，通常由网关终止 TLS）
+//
+// 配置 TLS_CLIENT_CA_FILE 后按 TLS_CLIENT_AUTH 请求客户端证书，出示的证书必须由这些 CA 签发，
+// 校验失败的握手直接被拒绝。
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.Server.TLSCertFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.MTLS.ClientCAFile == "" || cfg.MTLS.ClientAuth == "none" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(cfg.MTLS.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.MTLS.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+
+	if cfg.MTLS.ClientAuth == "required" {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// newRefreshStore 根据配置创建刷新令牌存储
+func newRefreshStore(cfg *config.AuthConfig) (refresh.Store, error) {
+	if cfg.RefreshStorePath != "" {
+		return refresh.NewFileStore(cfg.RefreshStorePath)
+	}
+	return refresh.NewMemoryStore(), nil
+}
+
+// newSessionStore 根据配置创建会话存储
+func newSessionStore(cfg *config.AuthConfig) (session.Store, error) {
+	if cfg.SessionStorePath != "" {
+		return session.NewFileStore(cfg.SessionStorePath)
+	}
+	return session.NewMemoryStore(), nil
+}
+
+// newRevocationStore 根据配置创建访问令牌吊销列表
+func newRevocationStore(cfg *config.AuthConfig) (revocation.Store, error) {
+	if cfg.RevocationStorePath != "" {
+		return revocation.NewFileStore(cfg.RevocationStorePath)
+	}
+	return revocation.NewMemoryStore(), nil
+}
+
+// newAuthCodeStore 根据配置创建授权码存储
+func newAuthCodeStore(cfg *config.OAuthConfig) (authcode.Store, error) {
+	if cfg.AuthCodeStorePath != "" {
+		return authcode.NewFileStore(cfg.AuthCodeStorePath)
+	}
+	return authcode.NewMemoryStore(), nil
+}
+
+// newDPoPReplayCache 根据配置创建 DPoP 重放缓存
+func newDPoPReplayCache(cfg *config.DPoPConfig) (dpop.ReplayCache, error) {
+	if cfg.ReplayStorePath != "" {
+		return dpop.NewFileReplayCache(cfg.ReplayStorePath)
+	}
+	return dpop.NewMemoryReplayCache(), nil
+}
+
+// newAPIKeyStore 根据配置创建个人访问令牌存储
+func newAPIKeyStore(cfg *config.APIKeyConfig) (apikey.Store, error) {
+	if cfg.StorePath != "" {
+		return apikey.NewFileStore(cfg.StorePath)
+	}
+	return apikey.NewMemoryStore(), nil
+}
+
+// newRoleStore 根据配置创建自定义角色存储
+func newRoleStore(cfg *config.RBACConfig) (rbac.Store, error) {
+	if cfg.RoleStorePath != "" {
+		return rbac.NewFileStore(cfg.RoleStorePath)
+	}
+	return rbac.NewMemoryStore(), nil
+}
+
+// newMFAStore 根据配置创建 MFA 登记存储
+func newMFAStore(cfg *config.MFAConfig) (mfa.Store, error) {
+	if cfg.StorePath != "" {
+		return mfa.NewFileStore(cfg.StorePath)
+	}
+	return mfa.NewMemoryStore(), nil
+}
+
+// newWebAuthnStore 根据配置创建 WebAuthn 凭证存储
+func newWebAuthnStore(cfg *config.WebAuthnConfig) (webauthn.Store, error) {
+	if cfg.StorePath != "" {
+		return webauthn.NewFileStore(cfg.StorePath)
+	}
+	return webauthn.NewMemoryStore(), nil
+}
+
+// newLocalUserStore 创建本地用户库，非生产环境下为空库写入演示用户
+func newLocalUserStore(cfg *config.Config, hasher *passhash.Hasher) (identity.Store, error) {
+	var store identity.Store = identity.NewMemoryStore(hasher)
+	if cfg.Auth.UserStorePath != "" {
+		fileStore, err := identity.NewFileStore(cfg.Auth.UserStorePath, hasher)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+
+	if cfg.Server.Environment != config.EnvironmentProduction {
+		if err := seedDemoUsers(store, hasher); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// seedDemoUsers 用户库为空时写入演示用户（仅用于本地开发）
+func seedDemoUsers(store identity.Store, hasher *passhash.Hasher) error {
+	ctx := context.Background()
+	existing, err := store.ListUsers(ctx)
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	now := time.Now()
+	for _, record := range []*identity.Record{
+		{ID: "1", Username: "admin", Email: "admin@example.com", Password: "admin123", Roles: []string{"admin"}},
+		{ID: "2", Username: "editor", Email: "editor@example.com", Password: "editor123", Roles: []string{"editor"}},
+		{ID: "3", Username: "viewer", Email: "viewer@example.com", Password: "viewer123", Roles: []string{"viewer"}},
+	} {
+		hash, err := hasher.Hash(record.Password)
+		if err != nil {
+			return err
+		}
+		record.Password = hash
+		record.CreatedAt, record.UpdatedAt = now, now
+		if err := store.SaveUser(ctx, record); err != nil {
+			return err
+		}
+	}
+
+	log.Warn("Seeded demo users (admin, editor, viewer); do not use in production")
+	return nil
+}
+
+// newIdentityChain 按 AUTH_BACKENDS 的顺序组合认证后端，联合登录用户只参与按 ID 查找
+func newIdentityChain(cfg *config.Config, hasher *passhash.Hasher, local identity.Backend, federationService *federation.Service) (*identity.Chain, error) {
+	var backends []identity.Backend
+	for _, name := range cfg.Auth.Backends {
+		switch name {
+		case "local":
+			backends = append(backends, local)
+		case "file":
+			if cfg.Auth.UsersFile == "" {
+				continue
+			}
+			store, err := identity.LoadStaticStore(cfg.Auth.UsersFile, hasher)
+			if err != nil {
+				return nil, err
+			}
+			backends = append(backends, store)
+		case "ldap":
+			if cfg.LDAP.URL == "" {
+				continue
+			}
+			authenticator, err := ldap.NewAuthenticator(&cfg.LDAP)
+			if err != nil {
+				return nil, err
+			}
+			backends = append(backends, authenticator)
+			log.WithFields(log.Fields{
+				"url":       cfg.LDAP.URL,
+				"start_tls": cfg.LDAP.StartTLS,
+			}).Info("LDAP authentication enabled")
+		default:
+			return nil, fmt.Errorf("unknown authentication backend %q", name)
+		}
+	}
+	backends = append(backends, federationService)
+
+	names := make([]string, 0, len(backends))
+	for _, b := range backends {
+		names = append(names, b.Name())
+	}
+	log.WithField("backends", names).Info("Identity backends configured")
+
+	return identity.NewChain(backends...), nil
+}
+
+// newFederationService 根据配置创建联合登录服务
+func newFederationService(cfg *config.Config) (*federation.Service, error) {
+	providers, err := federation.LoadProviders(cfg.Federation.ProvidersFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var states federation.StateStore = federation.NewMemoryStateStore()
+	if cfg.Federation.StateStorePath != "" {
+		states, err = federation.NewFileStateStore(cfg.Federation.StateStorePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var users federation.UserStore = federation.NewMemoryUserStore()
+	if cfg.Federation.UsersPath != "" {
+		users, err = federation.NewFileUserStore(cfg.Federation.UsersPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	service, err := federation.NewService(
+		providers,
+		cfg.OAuth.Issuer,
+		states,
+		users,
+		cfg.Federation.StateExpiration,
+		&http.Client{Timeout: cfg.Federation.HTTPTimeout},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range service.Providers() {
+		log.WithFields(log.Fields{
+			"provider": p.Name,
+			"issuer":   p.Issuer,
+		}).Info("Federated identity provider configured")
+	}
+	return service, nil
+}
+
 // setupLogger 配置日志
 func setupLogger(cfg config.LogConfig) {
 	// 设置日志级别
@@ -178,6 +790,74 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// realIPMiddleware 来自可信代理的请求使用 X-Forwarded-For 中的客户端地址作为 RemoteAddr
+//
+// 从右向左跳过可信代理，第一个不可信的地址即为客户端，防止客户端伪造 X-Forwarded-For。
+func realIPMiddleware(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	isTrusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		for _, n := range trusted {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil || len(trusted) == 0 || !isTrusted(host) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var hops []string
+			for _, header := range r.Header.Values("X-Forwarded-For") {
+				for _, hop := range strings.Split(header, ",") {
+					if hop = strings.TrimSpace(hop); hop != "" {
+						hops = append(hops, hop)
+					}
+				}
+			}
+			for i := len(hops) - 1; i >= 0; i-- {
+				if net.ParseIP(hops[i]) == nil {
+					break
+				}
+				r.RemoteAddr = hops[i]
+				if !isTrusted(hops[i]) {
+					break
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// parseTrustedProxies 解析可信代理的 IP 或 CIDR 列表
+func parseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
 // responseWriter 包装 ResponseWriter 以捕获状态码
 type responseWriter struct {
 	http.ResponseWriter
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/passhash"
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+// hash-password 从标准输入读取密码并输出 PHC 格式的哈希，用于编写 USERS_FILE
+//
+// 算法和参数与服务端相同，读取 PASSWORD_HASH_ALGORITHM 等环境变量。
+func main() {
+	cfg := config.Load()
+
+	hasher, err := passhash.NewHasher(&cfg.Password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(os.Stderr, "read password:", err)
+		os.Exit(1)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "password must not be empty")
+		os.Exit(1)
+	}
+
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(hash)
+}
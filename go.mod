@@ -3,10 +3,16 @@ module github.com/jason0730/claude-code-demo
 go 1.21
 
 require (
+	github.com/go-asn1-ber/asn1-ber v1.5.5
+	github.com/go-ldap/ldap/v3 v3.4.6
 	github.com/golang-jwt/jwt/v5 v5.2.0
 	github.com/google/uuid v1.5.0
 	github.com/gorilla/mux v1.8.1
 	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/crypto v0.13.0
 )
 
-require golang.org/x/sys v0.15.0 // indirect
+require (
+	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
@@ -0,0 +1,164 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jason0730/claude-code-demo/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Prefix 个人访问令牌的固定前缀，用于和 JWT 区分，也便于密钥扫描工具识别泄露的令牌
+const Prefix = "pat_"
+
+// displayLength 列表中展示的令牌开头字符数（含前缀）
+const displayLength = len(Prefix) + 6
+
+// touchInterval 最近使用时间的更新间隔，避免每个请求都写存储
+const touchInterval = time.Minute
+
+var (
+	ErrInvalidKey      = errors.New("invalid api key")
+	ErrExpiredKey      = errors.New("api key has expired")
+	ErrTooManyKeys     = errors.New("too many api keys")
+	ErrLifetimeTooLong = errors.New("api key lifetime exceeds the maximum")
+)
+
+// Service 个人访问令牌服务
+type Service struct {
+	store  Store
+	config *config.APIKeyConfig
+}
+
+// NewService 创建个人访问令牌服务
+func NewService(store Store, cfg *config.APIKeyConfig) *Service {
+	return &Service{
+		store:  store,
+		config: cfg,
+	}
+}
+
+// Create 为用户创建令牌，返回记录和明文令牌（明文只返回这一次）
+//
+// lifetime 为 0 时使用默认有效期；超过最长有效期时返回 ErrLifetimeTooLong。
+// 调用方负责确认 permissions 是创建者当前拥有的权限的子集。
+func (s *Service) Create(ctx context.Context, userID, name string, permissions []string, lifetime time.Duration) (*Key, string, error) {
+	if lifetime == 0 {
+		lifetime = s.config.DefaultLifetime
+	}
+	if s.config.MaxLifetime > 0 && (lifetime <= 0 || lifetime > s.config.MaxLifetime) {
+		return nil, "", ErrLifetimeTooLong
+	}
+
+	if s.config.MaxPerUser > 0 {
+		keys, err := s.store.List(ctx, userID)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(keys) >= s.config.MaxPerUser {
+			return nil, "", ErrTooManyKeys
+		}
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	key := &Key{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		Name:        name,
+		Prefix:      token[:displayLength],
+		Hash:        hashToken(token),
+		Permissions: permissions,
+		CreatedAt:   now,
+	}
+	if lifetime > 0 {
+		expiresAt := now.Add(lifetime)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.store.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, token, nil
+}
+
+// Authenticate 校验令牌并记录使用情况，返回令牌记录
+func (s *Service) Authenticate(ctx context.Context, token, ip string) (*Key, error) {
+	if !IsAPIKey(token) {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := s.store.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, ErrExpiredKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval || key.LastUsedIP != ip {
+		// 记录失败不影响本次认证；令牌在查询后被另一个副本吊销时拒绝
+		err := s.store.Touch(ctx, key.ID, now, ip)
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, ErrInvalidKey
+		}
+		if err != nil {
+			log.WithError(err).WithField("key_id", key.ID).Warn("failed to record api key usage")
+		} else {
+			key.LastUsedAt = &now
+			key.LastUsedIP = ip
+		}
+	}
+	return key, nil
+}
+
+// List 列出用户的全部令牌
+func (s *Service) List(ctx context.Context, userID string) ([]*Key, error) {
+	return s.store.List(ctx, userID)
+}
+
+// Revoke 吊销用户的一个令牌，令牌不属于该用户时返回 ErrKeyNotFound
+func (s *Service) Revoke(ctx context.Context, userID, id string) error {
+	return s.store.Delete(ctx, userID, id)
+}
+
+// RevokeAll 吊销用户的全部令牌，用于重置密码等需要切断所有凭证的场景
+func (s *Service) RevokeAll(ctx context.Context, userID string) error {
+	return s.store.DeleteUser(ctx, userID)
+}
+
+// IsAPIKey 判断凭证是否为个人访问令牌（而非 JWT）
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// generateToken 生成带前缀的 256 位随机令牌
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return Prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken 计算令牌哈希；令牌本身是高熵随机值，无需慢哈希
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,219 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+func newTestService(store Store) *Service {
+	return NewService(store, &config.APIKeyConfig{
+		DefaultLifetime: 24 * time.Hour,
+		MaxLifetime:     30 * 24 * time.Hour,
+		MaxPerUser:      2,
+	})
+}
+
+func TestCreateStoresOnlyHash(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	s := newTestService(store)
+
+	key, token, err := s.Create(ctx, "user-1", "ci", []string{"resource:read"}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !IsAPIKey(token) || len(token) != len(Prefix)+43 {
+		t.Fatalf("Create() token = %q, want pat_ and 256 random bits", token)
+	}
+	if key.Prefix != token[:displayLength] {
+		t.Fatalf("Prefix = %q, want %q", key.Prefix, token[:displayLength])
+	}
+
+	// 存储中只有哈希，没有明文令牌
+	stored, err := store.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		t.Fatalf("GetByHash: %v", err)
+	}
+	if stored.Hash == token || strings.Contains(stored.Hash, token[len(Prefix):]) || stored.Hash != hashToken(token) {
+		t.Fatalf("stored hash = %q", stored.Hash)
+	}
+	// 未指定有效期时使用默认有效期
+	if stored.ExpiresAt == nil || stored.ExpiresAt.Sub(stored.CreatedAt) != 24*time.Hour {
+		t.Fatalf("ExpiresAt = %v, want CreatedAt + 24h", stored.ExpiresAt)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(NewMemoryStore())
+
+	created, token, err := s.Create(ctx, "user-1", "ci", []string{"resource:read"}, time.Hour)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	key, err := s.Authenticate(ctx, token, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if key.ID != created.ID || key.UserID != "user-1" || key.LastUsedIP != "192.0.2.1" || key.LastUsedAt == nil {
+		t.Fatalf("Authenticate() = %+v", key)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "unknown token", token: Prefix + strings.Repeat("A", 43)},
+		{name: "token with a changed character", token: token[:len(token)-1] + "x"},
+		{name: "hash instead of token", token: Prefix + hashToken(token)},
+		{name: "missing prefix", token: token[len(Prefix):]},
+		{name: "jwt", token: "eyJhbGciOiJIUzI1NiJ9.e30.sig"},
+		{name: "empty", token: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Authenticate(ctx, tt.token, "192.0.2.1"); !errors.Is(err, ErrInvalidKey) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, ErrInvalidKey)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRejectsExpiredKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	s := newTestService(store)
+
+	key, token, err := s.Create(ctx, "user-1", "ci", []string{"resource:read"}, time.Hour)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	expired := time.Now().Add(-time.Second)
+	store.keys[key.ID].ExpiresAt = &expired
+
+	if _, err := s.Authenticate(ctx, token, "192.0.2.1"); !errors.Is(err, ErrExpiredKey) {
+		t.Fatalf("Authenticate() error = %v, want %v", err, ErrExpiredKey)
+	}
+}
+
+func TestCreateEnforcesLifetime(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		maxLifetime time.Duration
+		lifetime    time.Duration
+		want        error
+		wantExpiry  bool
+	}{
+		{name: "within maximum", maxLifetime: 30 * 24 * time.Hour, lifetime: time.Hour, wantExpiry: true},
+		{name: "at maximum", maxLifetime: 30 * 24 * time.Hour, lifetime: 30 * 24 * time.Hour, wantExpiry: true},
+		{name: "above maximum", maxLifetime: 30 * 24 * time.Hour, lifetime: 30*24*time.Hour + time.Second, want: ErrLifetimeTooLong},
+		{name: "never expires with maximum", maxLifetime: 30 * 24 * time.Hour, lifetime: -1, want: ErrLifetimeTooLong},
+		{name: "never expires without maximum", lifetime: -1},
+		{name: "long lifetime without maximum", lifetime: 10 * 365 * 24 * time.Hour, wantExpiry: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService(NewMemoryStore(), &config.APIKeyConfig{DefaultLifetime: time.Hour, MaxLifetime: tt.maxLifetime})
+			key, _, err := s.Create(ctx, "user-1", "ci", []string{"resource:read"}, tt.lifetime)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Create() error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if (key.ExpiresAt != nil) != tt.wantExpiry {
+				t.Fatalf("ExpiresAt = %v, want expiry %v", key.ExpiresAt, tt.wantExpiry)
+			}
+			if tt.wantExpiry && key.ExpiresAt.Sub(key.CreatedAt) != tt.lifetime {
+				t.Fatalf("lifetime = %v, want %v", key.ExpiresAt.Sub(key.CreatedAt), tt.lifetime)
+			}
+		})
+	}
+}
+
+func TestCreateEnforcesMaxPerUser(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(NewMemoryStore())
+
+	first, _, err := s.Create(ctx, "user-1", "one", []string{"resource:read"}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, _, err := s.Create(ctx, "user-1", "two", []string{"resource:read"}, 0); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, _, err := s.Create(ctx, "user-1", "three", []string{"resource:read"}, 0); !errors.Is(err, ErrTooManyKeys) {
+		t.Fatalf("Create() above the limit error = %v, want %v", err, ErrTooManyKeys)
+	}
+
+	// 限制按用户计算
+	if _, _, err := s.Create(ctx, "user-2", "one", []string{"resource:read"}, 0); err != nil {
+		t.Fatalf("Create for another user: %v", err)
+	}
+
+	// 吊销后可以再创建
+	if err := s.Revoke(ctx, "user-1", first.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, _, err := s.Create(ctx, "user-1", "three", []string{"resource:read"}, 0); err != nil {
+		t.Fatalf("Create after Revoke: %v", err)
+	}
+}
+
+func TestRevokeChecksOwner(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(NewMemoryStore())
+
+	key, token, err := s.Create(ctx, "user-1", "ci", []string{"resource:read"}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// 其他用户不能吊销，也不能确认令牌是否存在
+	if err := s.Revoke(ctx, "user-2", key.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Revoke() by another user error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if _, err := s.Authenticate(ctx, token, "192.0.2.1"); err != nil {
+		t.Fatalf("Authenticate() after rejected Revoke: %v", err)
+	}
+
+	if err := s.Revoke(ctx, "user-1", key.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := s.Authenticate(ctx, token, "192.0.2.1"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Authenticate() after Revoke error = %v, want %v", err, ErrInvalidKey)
+	}
+	if err := s.Revoke(ctx, "user-1", key.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("second Revoke error = %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestRevokeAll(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(NewMemoryStore())
+
+	_, token1, _ := s.Create(ctx, "user-1", "one", []string{"resource:read"}, 0)
+	_, token2, _ := s.Create(ctx, "user-1", "two", []string{"resource:read"}, 0)
+	_, other, _ := s.Create(ctx, "user-2", "one", []string{"resource:read"}, 0)
+
+	if err := s.RevokeAll(ctx, "user-1"); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	for _, token := range []string{token1, token2} {
+		if _, err := s.Authenticate(ctx, token, "192.0.2.1"); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("Authenticate() after RevokeAll error = %v, want %v", err, ErrInvalidKey)
+		}
+	}
+	if _, err := s.Authenticate(ctx, other, "192.0.2.1"); err != nil {
+		t.Fatalf("Authenticate() for another user: %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/filestore"
+)
+
+var ErrKeyNotFound = errors.New("api key not found")
+
+// Key 个人访问令牌记录，只保存令牌的 SHA-256 哈希
+type Key struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"` // 令牌开头的若干字符，用于在列表中辨认令牌
+	Hash        string     `json:"hash"`
+	Permissions []string   `json:"permissions"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // 为空表示永不过期
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP  string     `json:"last_used_ip,omitempty"`
+}
+
+// Store 个人访问令牌存储
+type Store interface {
+	// Create 保存新令牌
+	Create(ctx context.Context, key *Key) error
+
+	// List 列出用户的全部令牌，按创建时间排序
+	List(ctx context.Context, userID string) ([]*Key, error)
+
+	// GetByHash 按令牌哈希查询，不存在时返回 ErrKeyNotFound
+	GetByHash(ctx context.Context, hash string) (*Key, error)
+
+	// Touch 记录令牌的最近使用时间和来源 IP
+	Touch(ctx context.Context, id string, at time.Time, ip string) error
+
+	// Delete 删除用户的一个令牌，令牌不属于该用户时返回 ErrKeyNotFound
+	Delete(ctx context.Context, userID, id string) error
+
+	// DeleteUser 删除用户的全部令牌
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+// MemoryStore 内存个人访问令牌存储
+type MemoryStore struct {
+	mu     sync.Mutex
+	keys   map[string]*Key   // 按 ID 索引
+	byHash map[string]string // 哈希 -> ID
+}
+
+// NewMemoryStore 创建内存个人访问令牌存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys:   make(map[string]*Key),
+		byHash: make(map[string]string),
+	}
+}
+
+// Create 保存新令牌
+func (s *MemoryStore) Create(ctx context.Context, key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.createLocked(key)
+	return nil
+}
+
+// List 列出用户的全部令牌，返回副本
+func (s *MemoryStore) List(ctx context.Context, userID string) ([]*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []*Key{}
+	for _, k := range s.keys {
+		if k.UserID == userID {
+			keys = append(keys, k.clone())
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// GetByHash 按令牌哈希查询，返回副本
+func (s *MemoryStore) GetByHash(ctx context.Context, hash string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.byHash[hash]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return s.keys[id].clone(), nil
+}
+
+// Touch 记录令牌的最近使用时间和来源 IP
+func (s *MemoryStore) Touch(ctx context.Context, id string, at time.Time, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.touchLocked(id, at, ip)
+	return err
+}
+
+// Delete 删除用户的一个令牌
+func (s *MemoryStore) Delete(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.deleteLocked(userID, id)
+	return err
+}
+
+// DeleteUser 删除用户的全部令牌
+func (s *MemoryStore) DeleteUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteUserLocked(userID)
+	return nil
+}
+
+// createLocked 保存令牌副本，调用方需持有锁
+func (s *MemoryStore) createLocked(key *Key) {
+	s.keys[key.ID] = key.clone()
+	s.byHash[key.Hash] = key.ID
+}
+
+// touchLocked 更新最近使用信息并返回原记录，调用方需持有锁
+func (s *MemoryStore) touchLocked(id string, at time.Time, ip string) (*Key, error) {
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	updated := k.clone()
+	updated.LastUsedAt = &at
+	updated.LastUsedIP = ip
+	s.keys[id] = updated
+	return k, nil
+}
+
+// deleteLocked 删除令牌并返回原记录，调用方需持有锁
+func (s *MemoryStore) deleteLocked(userID, id string) (*Key, error) {
+	k, ok := s.keys[id]
+	if !ok || k.UserID != userID {
+		return nil, ErrKeyNotFound
+	}
+	delete(s.keys, id)
+	delete(s.byHash, k.Hash)
+	return k, nil
+}
+
+// deleteUserLocked 删除用户的全部令牌并返回被删除的记录，调用方需持有锁
+func (s *MemoryStore) deleteUserLocked(userID string) []*Key {
+	var removed []*Key
+	for id, k := range s.keys {
+		if k.UserID == userID {
+			removed = append(removed, k)
+			delete(s.keys, id)
+			delete(s.byHash, k.Hash)
+		}
+	}
+	return removed
+}
+
+// FileStore 基于 JSON 文件的个人访问令牌存储，多个副本挂载同一文件时共享令牌
+//
+// 修改持有锁文件读取最新内容、修改后写回，不同副本同时创建或吊销令牌时不会覆盖彼此的修改；
+// 查询只在文件变化后重新读取，在任一副本上吊销的令牌在所有副本上立即失效。
+type FileStore struct {
+	mu     sync.Mutex
+	file   *filestore.File
+	memory *MemoryStore // 文件内容的缓存
+}
+
+// NewFileStore 创建文件个人访问令牌存储，并检查已有文件能否解析
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{file: filestore.NewFile(path), memory: NewMemoryStore()}
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create 保存新令牌并持久化
+func (s *FileStore) Create(ctx context.Context, key *Key) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.Create(ctx, key)
+	})
+}
+
+// List 列出用户的全部令牌，包括其他副本创建的令牌
+func (s *FileStore) List(ctx context.Context, userID string) ([]*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s.memory.List(ctx, userID)
+}
+
+// GetByHash 按令牌哈希查询，其他副本吊销的令牌返回 ErrKeyNotFound
+func (s *FileStore) GetByHash(ctx context.Context, hash string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s.memory.GetByHash(ctx, hash)
+}
+
+// Touch 记录最近使用信息并持久化
+func (s *FileStore) Touch(ctx context.Context, id string, at time.Time, ip string) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.Touch(ctx, id, at, ip)
+	})
+}
+
+// Delete 删除用户的一个令牌并持久化
+func (s *FileStore) Delete(ctx context.Context, userID, id string) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.Delete(ctx, userID, id)
+	})
+}
+
+// DeleteUser 删除用户的全部令牌并持久化
+func (s *FileStore) DeleteUser(ctx context.Context, userID string) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.DeleteUser(ctx, userID)
+	})
+}
+
+// modify 持有锁文件读取最新内容，应用修改后写回；fn 返回错误时不写回
+func (s *FileStore) modify(fn func(*MemoryStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return fmt.Errorf("lock api key store: %w", err)
+	}
+	defer unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return err
+	}
+	if err := fn(s.memory); err != nil {
+		return err
+	}
+	return s.persistLocked()
+}
+
+// refreshLocked 文件变化时重新读取
+func (s *FileStore) refreshLocked() error {
+	data, changed, err := s.file.Read()
+	if err != nil {
+		return fmt.Errorf("read api key store: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	memory := NewMemoryStore()
+	if data != nil {
+		var keys []*Key
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return fmt.Errorf("decode api key store: %w", err)
+		}
+		for _, k := range keys {
+			memory.createLocked(k)
+		}
+	}
+	s.memory = memory
+	return nil
+}
+
+// persistLocked 写回缓存中的全部令牌
+func (s *FileStore) persistLocked() error {
+	s.memory.mu.Lock()
+	keys := make([]*Key, 0, len(s.memory.keys))
+	for _, k := range s.memory.keys {
+		keys = append(keys, k)
+	}
+	data, err := json.Marshal(keys)
+	s.memory.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.file.Write(data); err != nil {
+		return fmt.Errorf("write api key store: %w", err)
+	}
+	return nil
+}
+
+// clone 返回令牌记录的深拷贝
+func (k *Key) clone() *Key {
+	copied := *k
+	copied.Permissions = append([]string(nil), k.Permissions...)
+	if k.ExpiresAt != nil {
+		t := *k.ExpiresAt
+		copied.ExpiresAt = &t
+	}
+	if k.LastUsedAt != nil {
+		t := *k.LastUsedAt
+		copied.LastUsedAt = &t
+	}
+	return &copied
+}
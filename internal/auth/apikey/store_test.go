@@ -0,0 +1,123 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// newFileStores 创建挂载同一文件的两个存储，模拟两个副本
+func newFileStores(t *testing.T) (*FileStore, *FileStore, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+	a, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	b, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return a, b, path
+}
+
+func TestFileStoreSharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	a, b, path := newFileStores(t)
+	replicaA, replicaB := newTestService(a), newTestService(b)
+
+	// b 先读取一次，确认缓存会在另一副本写入后失效
+	if keys, err := b.List(ctx, "user-1"); err != nil || len(keys) != 0 {
+		t.Fatalf("List() = %v, %v, want none", keys, err)
+	}
+
+	key, token, err := replicaA.Create(ctx, "user-1", "ci", []string{"resource:read"}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := replicaB.Authenticate(ctx, token, "192.0.2.1"); err != nil {
+		t.Fatalf("Authenticate() on another replica: %v", err)
+	}
+	// 数量限制计入其他副本创建的令牌
+	if _, _, err := replicaB.Create(ctx, "user-1", "two", []string{"resource:read"}, 0); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, _, err := replicaA.Create(ctx, "user-1", "three", []string{"resource:read"}, 0); !errors.Is(err, ErrTooManyKeys) {
+		t.Fatalf("Create() above the limit error = %v, want %v", err, ErrTooManyKeys)
+	}
+
+	// 在 b 上吊销后，a 立即拒绝
+	if err := replicaB.Revoke(ctx, "user-1", key.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := replicaA.Authenticate(ctx, token, "192.0.2.1"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Authenticate() after Revoke on another replica error = %v, want %v", err, ErrInvalidKey)
+	}
+
+	// 重启后从文件恢复
+	c, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	keys, err := c.List(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Name != "two" {
+		t.Fatalf("List() after restart = %v, want the remaining token", keys)
+	}
+}
+
+func TestFileStoreTouchDoesNotRestoreRevokedKey(t *testing.T) {
+	ctx := context.Background()
+	a, b, _ := newFileStores(t)
+	s := newTestService(a)
+
+	key, token, err := s.Create(ctx, "user-1", "ci", []string{"resource:read"}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := b.Delete(ctx, "user-1", key.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	// 基于过期缓存的使用记录不能把已吊销的令牌写回文件
+	if err := a.Touch(ctx, key.ID, key.CreatedAt, "192.0.2.1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Touch() of a revoked key error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if _, err := newTestService(b).Authenticate(ctx, token, "192.0.2.1"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Authenticate() error = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestFileStoreConcurrentCreateAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	a, b, _ := newFileStores(t)
+
+	// 两个副本同时创建令牌，所有令牌都应保留
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		for j, s := range []*FileStore{a, b} {
+			wg.Add(1)
+			go func(s *FileStore, id string) {
+				defer wg.Done()
+				if err := s.Create(ctx, &Key{ID: id, UserID: "user-1", Hash: "hash-" + id}); err != nil {
+					t.Errorf("Create(%s): %v", id, err)
+				}
+			}(s, fmt.Sprintf("%d-%d", j, i))
+		}
+	}
+	wg.Wait()
+
+	keys, err := b.List(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(keys) != 2*n {
+		t.Fatalf("List() returned %d keys, want %d", len(keys), 2*n)
+	}
+}
@@ -0,0 +1,121 @@
+package authcode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jason0730/claude-code-demo/internal/filestore"
+)
+
+// FileStore 基于 JSON 文件的授权码存储，多个副本挂载同一文件时共享授权码
+//
+// 授权端点和令牌端点可能落在不同副本上；保存和兑换都持有锁文件读取最新内容、修改后写回，
+// 授权码在任一副本兑换后在所有副本上都已删除，并发兑换时只有一次成功。
+type FileStore struct {
+	mu     sync.Mutex
+	file   *filestore.File
+	memory *MemoryStore // 文件内容的缓存
+}
+
+// NewFileStore 创建文件授权码存储，并检查已有文件能否解析
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{file: filestore.NewFile(path), memory: NewMemoryStore()}
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save 保存授权码，同时清理已过期的授权码
+func (s *FileStore) Save(ctx context.Context, code *Code) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.Save(ctx, code)
+	})
+}
+
+// Consume 取出并删除授权码，包括其他副本保存的授权码
+func (s *FileStore) Consume(ctx context.Context, code string) (*Code, error) {
+	var c *Code
+	err := s.modify(func(m *MemoryStore) error {
+		var err error
+		c, err = m.Consume(ctx, code)
+		if errors.Is(err, ErrCodeNotFound) {
+			// 已过期的授权码也已删除，需要写回；对调用方仍然返回不存在
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrCodeNotFound
+	}
+	return c, nil
+}
+
+// modify 持有锁文件读取最新内容，应用修改后写回；fn 返回错误时不写回
+func (s *FileStore) modify(fn func(*MemoryStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return fmt.Errorf("lock authorization code store: %w", err)
+	}
+	defer unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return err
+	}
+	if err := fn(s.memory); err != nil {
+		return err
+	}
+	return s.persistLocked()
+}
+
+// refreshLocked 文件变化时重新读取
+func (s *FileStore) refreshLocked() error {
+	data, changed, err := s.file.Read()
+	if err != nil {
+		return fmt.Errorf("read authorization code store: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	memory := NewMemoryStore()
+	if data != nil {
+		var codes []*Code
+		if err := json.Unmarshal(data, &codes); err != nil {
+			return fmt.Errorf("decode authorization code store: %w", err)
+		}
+		for _, c := range codes {
+			memory.codes[c.Code] = c
+		}
+	}
+	s.memory = memory
+	return nil
+}
+
+// persistLocked 写回缓存中的全部授权码
+func (s *FileStore) persistLocked() error {
+	s.memory.mu.Lock()
+	codes := make([]*Code, 0, len(s.memory.codes))
+	for _, c := range s.memory.codes {
+		codes = append(codes, c)
+	}
+	data, err := json.Marshal(codes)
+	s.memory.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.file.Write(data); err != nil {
+		return fmt.Errorf("write authorization code store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package authcode
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"regexp"
+)
+
+// MethodS256 唯一支持的 PKCE 方法，不支持 plain
+const MethodS256 = "S256"
+
+var (
+	ErrUnsupportedChallengeMethod = errors.New("unsupported code_challenge_method")
+	ErrInvalidChallenge           = errors.New("invalid code_challenge")
+	ErrInvalidVerifier            = errors.New("invalid code_verifier")
+)
+
+// verifierPattern RFC 7636 第 4.1 节：43-128 个非保留字符
+var verifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// ValidateChallenge 校验授权请求中的 code_challenge
+func ValidateChallenge(challenge, method string) error {
+	if method != MethodS256 {
+		return ErrUnsupportedChallengeMethod
+	}
+	// SHA-256 的 base64url 编码固定为 43 个字符
+	if len(challenge) != 43 {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+// VerifyPKCE 校验 code_verifier 与授权请求中的 code_challenge 是否匹配（S256）
+func VerifyPKCE(challenge, method, verifier string) error {
+	if method != MethodS256 {
+		return ErrUnsupportedChallengeMethod
+	}
+	if !verifierPattern.MatchString(verifier) {
+		return ErrInvalidVerifier
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) != 1 {
+		return ErrInvalidVerifier
+	}
+	return nil
+}
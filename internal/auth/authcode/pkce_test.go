@@ -0,0 +1,66 @@
+package authcode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 固定的 code_verifier 及其 S256 code_challenge：BASE64URL(SHA256(verifier))
+const (
+	testVerifier  = "dBjftJeZ4CVP-mJ92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "ngF5GsXcbwljx6u133FFr3Xht9xooA_DuaX_3QwODtc"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		method    string
+		verifier  string
+		want      error
+	}{
+		{name: "matching verifier", challenge: testChallenge, method: MethodS256, verifier: testVerifier},
+		{name: "wrong verifier", challenge: testChallenge, method: MethodS256, verifier: strings.Repeat("a", 43), want: ErrInvalidVerifier},
+		{name: "missing verifier", challenge: testChallenge, method: MethodS256, verifier: "", want: ErrInvalidVerifier},
+		{name: "challenge sent as verifier", challenge: testChallenge, method: MethodS256, verifier: testChallenge, want: ErrInvalidVerifier},
+		{name: "verifier too short", challenge: testChallenge, method: MethodS256, verifier: testVerifier[:42], want: ErrInvalidVerifier},
+		{name: "verifier too long", challenge: testChallenge, method: MethodS256, verifier: strings.Repeat("a", 129), want: ErrInvalidVerifier},
+		{name: "verifier with reserved characters", challenge: testChallenge, method: MethodS256, verifier: testVerifier[:42] + "+", want: ErrInvalidVerifier},
+		{name: "plain method", challenge: testVerifier, method: "plain", verifier: testVerifier, want: ErrUnsupportedChallengeMethod},
+		{name: "missing method", challenge: testChallenge, method: "", verifier: testVerifier, want: ErrUnsupportedChallengeMethod},
+		{name: "lowercase method", challenge: testChallenge, method: "s256", verifier: testVerifier, want: ErrUnsupportedChallengeMethod},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyPKCE(tt.challenge, tt.method, tt.verifier); !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyPKCE() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		method    string
+		want      error
+	}{
+		{name: "s256", challenge: testChallenge, method: MethodS256},
+		{name: "plain", challenge: testVerifier, method: "plain", want: ErrUnsupportedChallengeMethod},
+		{name: "missing method", challenge: testChallenge, method: "", want: ErrUnsupportedChallengeMethod},
+		{name: "missing challenge", challenge: "", method: MethodS256, want: ErrInvalidChallenge},
+		{name: "short challenge", challenge: testChallenge[:42], method: MethodS256, want: ErrInvalidChallenge},
+		{name: "long challenge", challenge: testChallenge + "A", method: MethodS256, want: ErrInvalidChallenge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateChallenge(tt.challenge, tt.method); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateChallenge() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
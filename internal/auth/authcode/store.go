@@ -0,0 +1,94 @@
+package authcode
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCodeNotFound = errors.New("authorization code not found or expired")
+)
+
+// Code 授权码及其绑定的授权请求
+type Code struct {
+	Code                string
+	ClientID            string
+	RedirectURI         string
+	UserID              string
+	Scope               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	AuthTime            time.Time
+	AuthMethods         []string // 登录时使用的认证方式，写入令牌的 amr 声明
+	ExpiresAt           time.Time
+}
+
+// Store 授权码存储，授权码只能兑换一次
+type Store interface {
+	// Save 保存授权码
+	Save(ctx context.Context, code *Code) error
+
+	// Consume 取出并删除授权码，不存在或已过期时返回 ErrCodeNotFound
+	Consume(ctx context.Context, code string) (*Code, error)
+}
+
+// NewCode 生成 256 位随机授权码
+func NewCode() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// MemoryStore 内存授权码存储
+type MemoryStore struct {
+	mu    sync.Mutex
+	codes map[string]*Code
+}
+
+// NewMemoryStore 创建内存授权码存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		codes: make(map[string]*Code),
+	}
+}
+
+// Save 保存授权码，同时清理已过期的授权码
+func (s *MemoryStore) Save(ctx context.Context, code *Code) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, c := range s.codes {
+		if now.After(c.ExpiresAt) {
+			delete(s.codes, k)
+		}
+	}
+
+	stored := *code
+	s.codes[code.Code] = &stored
+	return nil
+}
+
+// Consume 取出并删除授权码
+func (s *MemoryStore) Consume(ctx context.Context, code string) (*Code, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.codes[code]
+	if !ok {
+		return nil, ErrCodeNotFound
+	}
+	delete(s.codes, code)
+
+	if time.Now().After(c.ExpiresAt) {
+		return nil, ErrCodeNotFound
+	}
+	return c, nil
+}
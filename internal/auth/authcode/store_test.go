@@ -0,0 +1,186 @@
+package authcode
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestCode(t *testing.T, ttl time.Duration) *Code {
+	t.Helper()
+
+	id, err := NewCode()
+	if err != nil {
+		t.Fatalf("NewCode: %v", err)
+	}
+	return &Code{
+		Code:                id,
+		ClientID:            "app",
+		RedirectURI:         "https://app.example.com/callback",
+		UserID:              "user-1",
+		Scope:               "openid",
+		CodeChallenge:       testChallenge,
+		CodeChallengeMethod: MethodS256,
+		AuthTime:            time.Now(),
+		ExpiresAt:           time.Now().Add(ttl),
+	}
+}
+
+// newFileStores 创建挂载同一文件的两个存储，模拟两个副本
+func newFileStores(t *testing.T) (*FileStore, *FileStore, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "auth_codes.json")
+	a, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	b, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return a, b, path
+}
+
+func TestNewCode(t *testing.T) {
+	a, err := NewCode()
+	if err != nil {
+		t.Fatalf("NewCode: %v", err)
+	}
+	b, err := NewCode()
+	if err != nil {
+		t.Fatalf("NewCode: %v", err)
+	}
+	// 32 字节的 base64url 编码
+	if len(a) != 43 || a == b {
+		t.Fatalf("NewCode() = %q, %q", a, b)
+	}
+}
+
+func TestStoreSingleUseAndExpiry(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+		"file": func(t *testing.T) Store {
+			s, _, _ := newFileStores(t)
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newStore(t)
+			ctx := context.Background()
+
+			code := newTestCode(t, time.Minute)
+			if err := s.Save(ctx, code); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			got, err := s.Consume(ctx, code.Code)
+			if err != nil {
+				t.Fatalf("Consume: %v", err)
+			}
+			if got.ClientID != code.ClientID || got.RedirectURI != code.RedirectURI || got.CodeChallenge != code.CodeChallenge {
+				t.Fatalf("Consume() = %+v, want %+v", got, code)
+			}
+
+			// 授权码只能兑换一次
+			if _, err := s.Consume(ctx, code.Code); !errors.Is(err, ErrCodeNotFound) {
+				t.Fatalf("second Consume error = %v, want %v", err, ErrCodeNotFound)
+			}
+
+			expired := newTestCode(t, -time.Second)
+			if err := s.Save(ctx, expired); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if _, err := s.Consume(ctx, expired.Code); !errors.Is(err, ErrCodeNotFound) {
+				t.Fatalf("Consume expired error = %v, want %v", err, ErrCodeNotFound)
+			}
+
+			if _, err := s.Consume(ctx, "unknown"); !errors.Is(err, ErrCodeNotFound) {
+				t.Fatalf("Consume unknown error = %v, want %v", err, ErrCodeNotFound)
+			}
+		})
+	}
+}
+
+func TestFileStoreSharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	a, b, path := newFileStores(t)
+
+	// b 先读取一次，确认缓存会在另一副本写入后失效
+	if _, err := b.Consume(ctx, "unknown"); !errors.Is(err, ErrCodeNotFound) {
+		t.Fatalf("Consume error = %v, want %v", err, ErrCodeNotFound)
+	}
+
+	// 授权端点在 a 上签发，令牌端点在 b 上兑换
+	code := newTestCode(t, time.Minute)
+	if err := a.Save(ctx, code); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	pending := newTestCode(t, time.Minute)
+	if err := b.Save(ctx, pending); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := b.Consume(ctx, code.Code); err != nil {
+		t.Fatalf("Consume on another replica: %v", err)
+	}
+	if _, err := a.Consume(ctx, code.Code); !errors.Is(err, ErrCodeNotFound) {
+		t.Fatalf("Consume replayed on the issuing replica error = %v, want %v", err, ErrCodeNotFound)
+	}
+
+	// 重启后从文件恢复
+	c, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if _, err := c.Consume(ctx, pending.Code); err != nil {
+		t.Fatalf("Consume after restart: %v", err)
+	}
+}
+
+func TestFileStoreConcurrentConsumeAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	a, b, _ := newFileStores(t)
+
+	const n = 10
+	codes := make([]*Code, n)
+	for i := range codes {
+		codes[i] = newTestCode(t, time.Minute)
+		if err := a.Save(ctx, codes[i]); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	// 每个授权码同时在两个副本上兑换，只能成功一次
+	var mu sync.Mutex
+	successes := make(map[string]int)
+	var wg sync.WaitGroup
+	for _, code := range codes {
+		for _, s := range []*FileStore{a, b} {
+			wg.Add(1)
+			go func(s *FileStore, id string) {
+				defer wg.Done()
+				_, err := s.Consume(ctx, id)
+				if err != nil && !errors.Is(err, ErrCodeNotFound) {
+					t.Errorf("Consume: %v", err)
+					return
+				}
+				if err == nil {
+					mu.Lock()
+					successes[id]++
+					mu.Unlock()
+				}
+			}(s, code.Code)
+		}
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		if got := successes[code.Code]; got != 1 {
+			t.Errorf("code %s consumed %d times, want 1", code.Code[:8], got)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package certauth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var ErrNoMatchingRule = errors.New("no identity mapping matches client certificate")
+
+// Rule 客户端证书到身份的映射规则
+//
+// 所有非空的匹配字段都必须满足，至少需要一个匹配字段；UserID 和 Service 二选一。
+// 示例：{"uri": "spiffe://mesh.internal/ns/prod/sa/billing", "service": "billing", "roles": ["viewer"]}
+type Rule struct {
+	// 匹配条件
+	Subject    string `json:"subject,omitempty"`     // 完整主题 DN，格式同 x509.Certificate.Subject.String()，如 "CN=billing,O=Example"
+	CommonName string `json:"common_name,omitempty"` // 主题 CN
+	DNSName    string `json:"dns_name,omitempty"`    // SAN 中的 DNS 名称之一
+	URI        string `json:"uri,omitempty"`         // SAN 中的 URI 之一，如 SPIFFE ID
+	Email      string `json:"email,omitempty"`       // SAN 中的邮箱地址之一
+
+	// 映射结果
+	UserID  string   `json:"user_id,omitempty"` // 映射为用户，角色取自用户库
+	Service string   `json:"service,omitempty"` // 映射为服务主体，以此作为 client_id
+	Roles   []string `json:"roles,omitempty"`   // 服务主体的角色
+	Scopes  []string `json:"scopes,omitempty"`  // 非空时进一步限制可用权限，与令牌 scope 相同
+}
+
+// Identity 证书映射得到的身份
+type Identity struct {
+	UserID  string
+	Service string
+	Roles   []string
+	Scopes  []string
+}
+
+// IsService 判断身份是否为服务主体
+func (i *Identity) IsService() bool {
+	return i.Service != ""
+}
+
+// Mapper 按顺序匹配规则，第一条满足的规则决定证书的身份
+type Mapper struct {
+	rules []Rule
+}
+
+// NewMapper 创建证书身份映射
+func NewMapper(rules []Rule) (*Mapper, error) {
+	for i, rule := range rules {
+		if err := validate(rule); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return &Mapper{rules: rules}, nil
+}
+
+// LoadMapper 从 JSON 文件加载映射规则，path 为空时返回没有规则的映射（所有证书都不能作为身份）
+func LoadMapper(path string) (*Mapper, error) {
+	if path == "" {
+		return &Mapper{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read client certificate identities: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("decode client certificate identities: %w", err)
+	}
+
+	m, err := NewMapper(rules)
+	if err != nil {
+		return nil, fmt.Errorf("client certificate identities %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Enabled 判断是否配置了映射规则
+func (m *Mapper) Enabled() bool {
+	return len(m.rules) > 0
+}
+
+// Identify 返回证书对应的身份，没有规则匹配时返回 ErrNoMatchingRule
+//
+// 调用方必须只传入已由 TLS 握手按 CA 校验过的证书。
+func (m *Mapper) Identify(cert *x509.Certificate) (*Identity, error) {
+	for _, rule := range m.rules {
+		if rule.matches(cert) {
+			return &Identity{
+				UserID:  rule.UserID,
+				Service: rule.Service,
+				Roles:   rule.Roles,
+				Scopes:  rule.Scopes,
+			}, nil
+		}
+	}
+	return nil, ErrNoMatchingRule
+}
+
+// matches 判断证书是否满足规则的全部匹配条件
+func (r Rule) matches(cert *x509.Certificate) bool {
+	if r.Subject != "" && cert.Subject.String() != r.Subject {
+		return false
+	}
+	if r.CommonName != "" && cert.Subject.CommonName != r.CommonName {
+		return false
+	}
+	if r.DNSName != "" && !contains(cert.DNSNames, r.DNSName) {
+		return false
+	}
+	if r.Email != "" && !contains(cert.EmailAddresses, r.Email) {
+		return false
+	}
+	if r.URI != "" {
+		found := false
+		for _, u := range cert.URIs {
+			if u.String() == r.URI {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// validate 校验映射规则
+func validate(r Rule) error {
+	if r.Subject == "" && r.CommonName == "" && r.DNSName == "" && r.URI == "" && r.Email == "" {
+		return fmt.Errorf("at least one of subject, common_name, dns_name, uri or email is required")
+	}
+	if (r.UserID == "") == (r.Service == "") {
+		return fmt.Errorf("exactly one of user_id or service is required")
+	}
+	if r.Service != "" && len(r.Roles) == 0 {
+		return fmt.Errorf("service %s: roles are required", r.Service)
+	}
+	return nil
+}
+
+// PeerCertificate 返回请求中已通过 CA 校验的客户端证书，未出示证书时返回 nil
+func PeerCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// Thumbprint 返回证书的 SHA-256 指纹（base64url，无填充），即 RFC 8705 的 x5t#S256
+func Thumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RequestThumbprint 返回请求客户端证书的指纹，未出示证书时返回空字符串
+func RequestThumbprint(r *http.Request) string {
+	cert := PeerCertificate(r)
+	if cert == nil {
+		return ""
+	}
+	return Thumbprint(cert)
+}
+
+// contains 判断切片中是否包含指定值
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
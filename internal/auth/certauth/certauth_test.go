@@ -0,0 +1,212 @@
+package certauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCert 按模板生成自签名证书
+func newTestCert(t *testing.T, tmpl *x509.Certificate) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl.SerialNumber = big.NewInt(1)
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return cert
+}
+
+// newWorkloadCert 生成带 DNS、URI 和邮箱 SAN 的证书
+func newWorkloadCert(t *testing.T) *x509.Certificate {
+	t.Helper()
+
+	spiffe, _ := url.Parse("spiffe://mesh.internal/ns/prod/sa/billing")
+	return newTestCert(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "billing", Organization: []string{"Example"}},
+		DNSNames:       []string{"billing.prod.svc", "billing.internal"},
+		URIs:           []*url.URL{spiffe},
+		EmailAddresses: []string{"billing@example.com"},
+	})
+}
+
+func TestIdentifyMatchesSubjectAndSANs(t *testing.T) {
+	cert := newWorkloadCert(t)
+
+	tests := []struct {
+		name string
+		rule Rule
+		want bool
+	}{
+		{name: "subject", rule: Rule{Subject: "CN=billing,O=Example"}, want: true},
+		{name: "subject mismatch", rule: Rule{Subject: "CN=billing"}},
+		{name: "common name", rule: Rule{CommonName: "billing"}, want: true},
+		{name: "common name mismatch", rule: Rule{CommonName: "Billing"}},
+		{name: "second dns name", rule: Rule{DNSName: "billing.internal"}, want: true},
+		{name: "dns name mismatch", rule: Rule{DNSName: "billing"}},
+		{name: "uri", rule: Rule{URI: "spiffe://mesh.internal/ns/prod/sa/billing"}, want: true},
+		{name: "uri prefix", rule: Rule{URI: "spiffe://mesh.internal/ns/prod"}},
+		{name: "email", rule: Rule{Email: "billing@example.com"}, want: true},
+		{name: "email mismatch", rule: Rule{Email: "ops@example.com"}},
+		{name: "all conditions", rule: Rule{CommonName: "billing", URI: "spiffe://mesh.internal/ns/prod/sa/billing"}, want: true},
+		{name: "one condition fails", rule: Rule{CommonName: "billing", DNSName: "other.prod.svc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			rule.Service = "billing"
+			rule.Roles = []string{"viewer"}
+			m, err := NewMapper([]Rule{rule})
+			if err != nil {
+				t.Fatalf("NewMapper: %v", err)
+			}
+
+			ident, err := m.Identify(cert)
+			if !tt.want {
+				if !errors.Is(err, ErrNoMatchingRule) {
+					t.Fatalf("Identify() = %+v, %v, want %v", ident, err, ErrNoMatchingRule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Identify: %v", err)
+			}
+			if !ident.IsService() || ident.Service != "billing" || len(ident.Roles) != 1 || ident.Roles[0] != "viewer" {
+				t.Fatalf("Identify() = %+v", ident)
+			}
+		})
+	}
+}
+
+func TestIdentifyFirstMatchingRuleWins(t *testing.T) {
+	cert := newWorkloadCert(t)
+	m, err := NewMapper([]Rule{
+		{CommonName: "payments", Service: "payments", Roles: []string{"admin"}},
+		{DNSName: "billing.prod.svc", UserID: "user-1", Scopes: []string{"resource:read"}},
+		{CommonName: "billing", Service: "billing", Roles: []string{"admin"}},
+	})
+	if err != nil {
+		t.Fatalf("NewMapper: %v", err)
+	}
+
+	ident, err := m.Identify(cert)
+	if err != nil {
+		t.Fatalf("Identify: %v", err)
+	}
+	if ident.IsService() || ident.UserID != "user-1" || len(ident.Scopes) != 1 || ident.Scopes[0] != "resource:read" {
+		t.Fatalf("Identify() = %+v, want the user rule", ident)
+	}
+}
+
+func TestNewMapperRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "no match condition", rule: Rule{Service: "billing", Roles: []string{"viewer"}}},
+		{name: "no identity", rule: Rule{CommonName: "billing"}},
+		{name: "user and service", rule: Rule{CommonName: "billing", UserID: "user-1", Service: "billing", Roles: []string{"viewer"}}},
+		{name: "service without roles", rule: Rule{CommonName: "billing", Service: "billing"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewMapper([]Rule{tt.rule}); err == nil {
+				t.Fatal("NewMapper() accepted the rule")
+			}
+		})
+	}
+}
+
+func TestLoadMapper(t *testing.T) {
+	m, err := LoadMapper("")
+	if err != nil || m.Enabled() {
+		t.Fatalf("LoadMapper(\"\") = %v, %v, want a disabled mapper", m, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "identities.json")
+	data := `[{"uri": "spiffe://mesh.internal/ns/prod/sa/billing", "service": "billing", "roles": ["viewer"]}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	m, err = LoadMapper(path)
+	if err != nil {
+		t.Fatalf("LoadMapper: %v", err)
+	}
+	if ident, err := m.Identify(newWorkloadCert(t)); err != nil || ident.Service != "billing" {
+		t.Fatalf("Identify() = %+v, %v", ident, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"service": "billing", "roles": ["viewer"]}]`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := LoadMapper(path); err == nil {
+		t.Fatal("LoadMapper() accepted a rule without match conditions")
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	cert := newWorkloadCert(t)
+
+	// RFC 8705 x5t#S256：证书 DER 的 SHA-256，base64url 编码且不带填充
+	sum := sha256.Sum256(cert.Raw)
+	want := base64.RawURLEncoding.EncodeToString(sum[:])
+	got := Thumbprint(cert)
+	if got != want {
+		t.Fatalf("Thumbprint() = %q, want %q", got, want)
+	}
+	if len(got) != 43 {
+		t.Fatalf("Thumbprint() length = %d, want 43", len(got))
+	}
+	if other := Thumbprint(newWorkloadCert(t)); other == got {
+		t.Fatal("Thumbprint() is the same for different certificates")
+	}
+}
+
+func TestRequestThumbprintUsesVerifiedChain(t *testing.T) {
+	cert := newWorkloadCert(t)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if got := RequestThumbprint(r); got != "" {
+		t.Fatalf("RequestThumbprint() without TLS = %q", got)
+	}
+
+	// 未经 CA 校验的证书不作为身份
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if PeerCertificate(r) != nil || RequestThumbprint(r) != "" {
+		t.Fatal("PeerCertificate() returned an unverified certificate")
+	}
+
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	if PeerCertificate(r) != cert {
+		t.Fatal("PeerCertificate() did not return the verified certificate")
+	}
+	if got := RequestThumbprint(r); got != Thumbprint(cert) {
+		t.Fatalf("RequestThumbprint() = %q, want %q", got, Thumbprint(cert))
+	}
+}
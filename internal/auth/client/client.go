@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrClientNotFound     = errors.New("client not found")
+	ErrInvalidCredentials = errors.New("invalid client credentials")
+	ErrInvalidScope       = errors.New("requested scope not allowed for client")
+)
+
+// 授权类型
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// secretHashPrefix 客户端密钥哈希前缀；客户端密钥为高熵随机串，使用 SHA-256 即可
+const secretHashPrefix = "sha256:"
+
+// Client 已注册的 OAuth 客户端
+type Client struct {
+	ID         string   `json:"client_id"`
+	Name       string   `json:"name"`
+	SecretHash string   `json:"secret_hash"`
+	GrantTypes []string `json:"grant_types,omitempty"` // 允许的授权类型，为空时只能调用内省/吊销端点
+	Scopes     []string `json:"scopes,omitempty"`      // 允许申请的 scope
+	Roles      []string `json:"roles,omitempty"`       // 以服务身份访问时拥有的角色
+
+	RedirectURIs []string `json:"redirect_uris,omitempty"` // 授权码流程允许的回调地址，精确匹配
+	Public       bool     `json:"public,omitempty"`        // 公共客户端（SPA、CLI）没有密钥，必须使用 PKCE
+}
+
+// ValidRedirectURI 判断回调地址是否已注册
+func (c *Client) ValidRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGrant 判断客户端是否允许使用指定授权类型
+func (c *Client) AllowsGrant(grantType string) bool {
+	for _, g := range c.GrantTypes {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantScope 根据请求的 scope 计算授予的 scope；未请求时授予全部允许的 scope
+func (c *Client) GrantScope(requested string) (string, error) {
+	if requested == "" {
+		return strings.Join(c.Scopes, " "), nil
+	}
+
+	allowed := make(map[string]bool, len(c.Scopes))
+	for _, scope := range c.Scopes {
+		allowed[scope] = true
+	}
+
+	scopes := strings.Fields(requested)
+	for _, scope := range scopes {
+		if !allowed[scope] {
+			return "", ErrInvalidScope
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// Registry 客户端注册表
+type Registry interface {
+	// Get 按 client_id 查找客户端
+	Get(ctx context.Context, id string) (*Client, error)
+}
+
+// Authenticate 校验客户端凭证；客户端不存在与密钥错误返回相同错误
+//
+// 公共客户端只需提供 client_id，且不得提供密钥。
+func Authenticate(ctx context.Context, registry Registry, id, secret string) (*Client, error) {
+	c, err := registry.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if c.Public {
+		if secret != "" {
+			return nil, ErrInvalidCredentials
+		}
+		return c, nil
+	}
+	if !VerifySecret(c.SecretHash, secret) {
+		return nil, ErrInvalidCredentials
+	}
+	return c, nil
+}
+
+// HashSecret 计算客户端密钥的存储形式
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return secretHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// VerifySecret 以常量时间比较客户端密钥与存储的哈希
+func VerifySecret(hash, secret string) bool {
+	if !strings.HasPrefix(hash, secretHashPrefix) {
+		return false
+	}
+	expected := HashSecret(secret)
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testRegistry() *StaticRegistry {
+	return NewStaticRegistry([]*Client{
+		{
+			ID:           "app",
+			SecretHash:   HashSecret("app-secret"),
+			GrantTypes:   []string{GrantAuthorizationCode, GrantRefreshToken},
+			Scopes:       []string{"openid", "profile", "resource:read"},
+			RedirectURIs: []string{"https://app.example.com/callback", "http://127.0.0.1:8400/callback"},
+		},
+		{
+			ID:           "spa",
+			Public:       true,
+			GrantTypes:   []string{GrantAuthorizationCode},
+			RedirectURIs: []string{"https://spa.example.com/callback"},
+		},
+	})
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	c, _ := testRegistry().Get(context.Background(), "app")
+
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{uri: "https://app.example.com/callback", want: true},
+		{uri: "http://127.0.0.1:8400/callback", want: true},
+		{uri: ""},
+		{uri: "https://app.example.com/callback/"},
+		{uri: "https://app.example.com/callback?next=/admin"},
+		{uri: "https://app.example.com/callback#x"},
+		{uri: "https://APP.example.com/callback"},
+		{uri: "http://app.example.com/callback"},
+		{uri: "https://app.example.com.evil.test/callback"},
+		{uri: "https://app.example.com/Callback"},
+		{uri: "http://127.0.0.1:8401/callback"},
+	}
+
+	// 回调地址精确匹配，不做前缀、大小写或规范化比较
+	for _, tt := range tests {
+		if got := c.ValidRedirectURI(tt.uri); got != tt.want {
+			t.Errorf("ValidRedirectURI(%q) = %v, want %v", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	registry := testRegistry()
+
+	tests := []struct {
+		name   string
+		id     string
+		secret string
+		want   error
+	}{
+		{name: "confidential client", id: "app", secret: "app-secret"},
+		{name: "wrong secret", id: "app", secret: "wrong", want: ErrInvalidCredentials},
+		{name: "missing secret", id: "app", want: ErrInvalidCredentials},
+		{name: "unknown client", id: "unknown", secret: "app-secret", want: ErrInvalidCredentials},
+		{name: "public client", id: "spa"},
+		{name: "public client with secret", id: "spa", secret: "anything", want: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Authenticate(context.Background(), registry, tt.id, tt.secret)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && c.ID != tt.id {
+				t.Fatalf("Authenticate() = %s, want %s", c.ID, tt.id)
+			}
+		})
+	}
+}
+
+func TestVerifySecret(t *testing.T) {
+	hash := HashSecret("s3cret")
+	if !strings.HasPrefix(hash, secretHashPrefix) {
+		t.Fatalf("HashSecret() = %q, want %s prefix", hash, secretHashPrefix)
+	}
+	if !VerifySecret(hash, "s3cret") {
+		t.Fatal("VerifySecret() rejected the matching secret")
+	}
+	if VerifySecret(hash, "s3cret ") || VerifySecret(hash, "") {
+		t.Fatal("VerifySecret() accepted a different secret")
+	}
+	// 没有前缀的哈希（如误填的明文密钥）不能匹配
+	if VerifySecret(strings.TrimPrefix(hash, secretHashPrefix), "s3cret") || VerifySecret("s3cret", "s3cret") {
+		t.Fatal("VerifySecret() accepted a hash without prefix")
+	}
+}
+
+func TestGrantScope(t *testing.T) {
+	c, _ := testRegistry().Get(context.Background(), "app")
+
+	if got, err := c.GrantScope(""); err != nil || got != "openid profile resource:read" {
+		t.Fatalf("GrantScope(\"\") = %q, %v", got, err)
+	}
+	if got, err := c.GrantScope("openid  resource:read"); err != nil || got != "openid resource:read" {
+		t.Fatalf("GrantScope() = %q, %v", got, err)
+	}
+	if _, err := c.GrantScope("openid resource:write"); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("GrantScope() with disallowed scope error = %v, want %v", err, ErrInvalidScope)
+	}
+}
+
+func TestLoadStaticRegistryValidatesClients(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients string
+		wantErr string
+	}{
+		{name: "valid", clients: `[{"client_id":"app","secret_hash":"sha256:00","grant_types":["authorization_code"],"redirect_uris":["https://app.example.com/callback"]}]`},
+		{name: "missing id", clients: `[{"secret_hash":"sha256:00"}]`, wantErr: "client_id is required"},
+		{name: "confidential without secret", clients: `[{"client_id":"app"}]`, wantErr: "secret_hash is required"},
+		{name: "code grant without redirect uris", clients: `[{"client_id":"spa","public":true,"grant_types":["authorization_code"]}]`, wantErr: "redirect_uris are required"},
+		{name: "public client credentials", clients: `[{"client_id":"spa","public":true,"grant_types":["client_credentials"]}]`, wantErr: "cannot use client_credentials"},
+		{name: "public token exchange", clients: `[{"client_id":"spa","public":true,"grant_types":["urn:ietf:params:oauth:grant-type:token-exchange"]}]`, wantErr: "cannot use token exchange"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "clients.json")
+			if err := os.WriteFile(path, []byte(tt.clients), 0o600); err != nil {
+				t.Fatalf("write clients: %v", err)
+			}
+
+			_, err := LoadStaticRegistry(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadStaticRegistry: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadStaticRegistry() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
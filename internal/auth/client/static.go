@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// StaticRegistry 启动时从 JSON 文件加载的只读客户端注册表
+type StaticRegistry struct {
+	clients map[string]*Client
+}
+
+// NewStaticRegistry 创建静态客户端注册表
+func NewStaticRegistry(clients []*Client) *StaticRegistry {
+	r := &StaticRegistry{
+		clients: make(map[string]*Client, len(clients)),
+	}
+	for _, c := range clients {
+		r.clients[c.ID] = c
+	}
+	return r
+}
+
+// LoadStaticRegistry 从 JSON 文件加载客户端注册表，path 为空时返回空注册表
+func LoadStaticRegistry(path string) (*StaticRegistry, error) {
+	if path == "" {
+		return NewStaticRegistry(nil), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read client registry: %w", err)
+	}
+
+	var clients []*Client
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return nil, fmt.Errorf("decode client registry: %w", err)
+	}
+	for _, c := range clients {
+		if err := validate(c); err != nil {
+			return nil, fmt.Errorf("client registry %s: %w", path, err)
+		}
+	}
+
+	return NewStaticRegistry(clients), nil
+}
+
+// Get 按 client_id 查找客户端
+func (r *StaticRegistry) Get(ctx context.Context, id string) (*Client, error) {
+	c, ok := r.clients[id]
+	if !ok {
+		return nil, ErrClientNotFound
+	}
+	return c, nil
+}
+
+// validate 校验客户端配置
+func validate(c *Client) error {
+	if c.ID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	if c.Public {
+		if c.AllowsGrant(GrantClientCredentials) {
+			return fmt.Errorf("public client %s cannot use client_credentials", c.ID)
+		}
+		if c.AllowsGrant(GrantTokenExchange) {
+			return fmt.Errorf("public client %s cannot use token exchange", c.ID)
+		}
+	} else if c.SecretHash == "" {
+		return fmt.Errorf("client %s: secret_hash is required for confidential clients", c.ID)
+	}
+	if c.AllowsGrant(GrantAuthorizationCode) && len(c.RedirectURIs) == 0 {
+		return fmt.Errorf("client %s: redirect_uris are required for authorization_code", c.ID)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package dpop
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+// Header 携带 DPoP 证明的请求头
+const Header = "DPoP"
+
+// Scheme 绑定 DPoP 的访问令牌使用的 Authorization 方案和 token_type
+const Scheme = "DPoP"
+
+// proofType DPoP 证明头部的 typ
+const proofType = "dpop+jwt"
+
+// SigningAlgorithms 接受的证明签名算法，只允许非对称算法
+var SigningAlgorithms = []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "EdDSA"}
+
+var ErrInvalidProof = errors.New("invalid dpop proof")
+
+// proofClaims DPoP 证明声明（RFC 9449 第 4.2 节）
+type proofClaims struct {
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath,omitempty"` // 访问令牌的 SHA-256，出示访问令牌时必须携带
+	gojwt.RegisteredClaims
+}
+
+// Verifier DPoP 证明校验器
+type Verifier struct {
+	config    *config.DPoPConfig
+	publicURL string // 对外地址，用于在反向代理之后校验 htu
+	replays   ReplayCache
+}
+
+// NewVerifier 创建 DPoP 证明校验器，publicURL 为服务对外的基础地址（通常为 OAuth issuer）
+func NewVerifier(cfg *config.DPoPConfig, publicURL string, replays ReplayCache) *Verifier {
+	return &Verifier{
+		config:    cfg,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		replays:   replays,
+	}
+}
+
+// Present 判断请求是否携带 DPoP 证明
+func Present(r *http.Request) bool {
+	return len(r.Header.Values(Header)) > 0
+}
+
+// Verify 校验请求中的 DPoP 证明并返回证明公钥的 JWK 指纹（cnf.jkt）
+//
+// accessToken 非空时要求证明的 ath 与之匹配（访问受保护资源）；为空时为签发令牌的请求。
+// 每个证明只能使用一次，重放的证明返回 ErrInvalidProof。
+func (v *Verifier) Verify(r *http.Request, accessToken string) (string, error) {
+	values := r.Header.Values(Header)
+	if len(values) != 1 {
+		return "", fmt.Errorf("%w: exactly one DPoP header is required", ErrInvalidProof)
+	}
+
+	var (
+		key    jwt.JWK
+		claims proofClaims
+	)
+	token, err := gojwt.ParseWithClaims(values[0], &claims, func(t *gojwt.Token) (interface{}, error) {
+		if typ, _ := t.Header["typ"].(string); typ != proofType {
+			return nil, errors.New("typ must be dpop+jwt")
+		}
+		raw, err := json.Marshal(t.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		var members map[string]interface{}
+		if err := json.Unmarshal(raw, &members); err != nil || members == nil {
+			return nil, errors.New("jwk header is required")
+		}
+		if _, private := members["d"]; private {
+			return nil, errors.New("jwk must not contain a private key")
+		}
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return nil, err
+		}
+		return key.PublicKey()
+	}, gojwt.WithValidMethods(SigningAlgorithms))
+	if err != nil || !token.Valid {
+		return "", fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return "", fmt.Errorf("%w: jti and iat are required", ErrInvalidProof)
+	}
+	now := time.Now()
+	issuedAt := claims.IssuedAt.Time
+	if issuedAt.Before(now.Add(-v.config.ProofMaxAge)) || issuedAt.After(now.Add(v.config.ClockSkew)) {
+		return "", fmt.Errorf("%w: iat outside the accepted window", ErrInvalidProof)
+	}
+	if claims.HTM != r.Method {
+		return "", fmt.Errorf("%w: htm does not match the request method", ErrInvalidProof)
+	}
+	if !v.matchesURI(r, claims.HTU) {
+		return "", fmt.Errorf("%w: htu does not match the request URI", ErrInvalidProof)
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		expected := base64.RawURLEncoding.EncodeToString(sum[:])
+		if subtle.ConstantTimeCompare([]byte(claims.ATH), []byte(expected)) != 1 {
+			return "", fmt.Errorf("%w: ath does not match the access token", ErrInvalidProof)
+		}
+	}
+
+	jkt, err := key.Thumbprint()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+
+	// 证明在 iat 之后的 ProofMaxAge 内都可能被接受，重放记录保留到那时
+	fresh, err := v.replays.Use(r.Context(), jkt+":"+claims.ID, issuedAt.Add(v.config.ProofMaxAge+v.config.ClockSkew))
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", fmt.Errorf("%w: proof has already been used", ErrInvalidProof)
+	}
+	return jkt, nil
+}
+
+// matchesURI 比较 htu 与请求地址，忽略查询参数和片段（RFC 9449 第 4.3 节）
+//
+// 请求地址按对外地址和请求本身（Host 头与是否 TLS）各计算一次，任一匹配即可。
+func (v *Verifier) matchesURI(r *http.Request, htu string) bool {
+	u, err := url.Parse(htu)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	got := normalizeURI(u)
+
+	if v.publicURL != "" {
+		if public, err := url.Parse(v.publicURL + r.URL.Path); err == nil && normalizeURI(public) == got {
+			return true
+		}
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	direct := &url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}
+	return normalizeURI(direct) == got
+}
+
+// normalizeURI 去掉查询参数和片段，协议和主机名转为小写，并省略默认端口
+func normalizeURI(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	if (scheme == "https" && strings.HasSuffix(host, ":443")) || (scheme == "http" && strings.HasSuffix(host, ":80")) {
+		host = host[:strings.LastIndex(host, ":")]
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return scheme + "://" + host + path
+}
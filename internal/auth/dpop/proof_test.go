@@ -0,0 +1,300 @@
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+const (
+	testPublicURL = "https://api.example.com"
+	testTokenURL  = testPublicURL + "/oauth/token"
+)
+
+// testKey 客户端持有的 DPoP 密钥
+type testKey struct {
+	t   *testing.T
+	key *ecdsa.PrivateKey
+	jwk jwt.JWK
+}
+
+func newTestKey(t *testing.T) *testKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	jwk, err := jwt.NewJWK(&key.PublicKey, "", "")
+	if err != nil {
+		t.Fatalf("NewJWK: %v", err)
+	}
+	jwk.Use = ""
+	return &testKey{t: t, key: key, jwk: jwk}
+}
+
+// thumbprint 公钥的 RFC 7638 指纹
+func (k *testKey) thumbprint() string {
+	jkt, err := jwt.Thumbprint(&k.key.PublicKey)
+	if err != nil {
+		k.t.Fatalf("Thumbprint: %v", err)
+	}
+	return jkt
+}
+
+// proof 签发 DPoP 证明；mutate 可修改声明和头部以构造无效证明
+func (k *testKey) proof(method, uri, accessToken string, mutate func(claims gojwt.MapClaims, header map[string]interface{})) string {
+	claims := gojwt.MapClaims{
+		"jti": uuid.New().String(),
+		"htm": method,
+		"htu": uri,
+		"iat": time.Now().Unix(),
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	token := gojwt.NewWithClaims(gojwt.SigningMethodES256, claims)
+	token.Header["typ"] = proofType
+	token.Header["jwk"] = k.jwk
+	if mutate != nil {
+		mutate(claims, token.Header)
+	}
+
+	signed, err := token.SignedString(k.key)
+	if err != nil {
+		k.t.Fatalf("sign proof: %v", err)
+	}
+	return signed
+}
+
+func newTestVerifier(replays ReplayCache) *Verifier {
+	return NewVerifier(&config.DPoPConfig{ProofMaxAge: 5 * time.Minute, ClockSkew: 30 * time.Second}, testPublicURL, replays)
+}
+
+// request 构造携带证明的请求，proof 为空时不带 DPoP 头
+func request(method, target string, proofs ...string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	for _, p := range proofs {
+		r.Header.Add(Header, p)
+	}
+	return r
+}
+
+func TestVerifyReturnsKeyThumbprint(t *testing.T) {
+	v := newTestVerifier(NewMemoryReplayCache())
+	k := newTestKey(t)
+
+	jkt, err := v.Verify(request(http.MethodPost, testTokenURL, k.proof(http.MethodPost, testTokenURL, "", nil)), "")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if jkt != k.thumbprint() {
+		t.Fatalf("Verify() = %q, want %q", jkt, k.thumbprint())
+	}
+
+	// 访问受保护资源时 ath 绑定访问令牌
+	jkt, err = v.Verify(request(http.MethodGet, testPublicURL+"/api/v1/resources", k.proof(http.MethodGet, testPublicURL+"/api/v1/resources", "access-token", nil)), "access-token")
+	if err != nil || jkt != k.thumbprint() {
+		t.Fatalf("Verify() with ath = %q, %v", jkt, err)
+	}
+}
+
+func TestThumbprintRFC7638(t *testing.T) {
+	// RFC 7638 第 3.1 节的示例
+	key := jwt.JWK{
+		Kty: "RSA",
+		Kid: "2011-04-29",
+		Alg: "RS256",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	got, err := key.Thumbprint()
+	if err != nil {
+		t.Fatalf("Thumbprint: %v", err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Fatalf("Thumbprint() = %q, want %q", got, want)
+	}
+
+	// 指纹只取必需成员，kid、alg 等不影响结果
+	k := newTestKey(t)
+	withKid := k.jwk
+	withKid.Kid, withKid.Alg, withKid.Use = "k1", "ES256", "sig"
+	if a, _ := withKid.Thumbprint(); a != k.thumbprint() {
+		t.Fatalf("Thumbprint() with optional members = %q, want %q", a, k.thumbprint())
+	}
+}
+
+func TestVerifyRejectsInvalidProofs(t *testing.T) {
+	k := newTestKey(t)
+	other := newTestKey(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		accessToken string
+		proof       func() string
+	}{
+		{name: "wrong htm", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodGet, testTokenURL, "", nil)
+		}},
+		{name: "wrong htu path", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, testPublicURL+"/oauth/revoke", "", nil)
+		}},
+		{name: "wrong htu host", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, "https://evil.example.com/oauth/token", "", nil)
+		}},
+		{name: "wrong htu scheme", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, "http://api.example.com/oauth/token", "", nil)
+		}},
+		{name: "relative htu", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, "/oauth/token", "", nil)
+		}},
+		{name: "iat too old", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, testTokenURL, "", func(c gojwt.MapClaims, _ map[string]interface{}) {
+				c["iat"] = time.Now().Add(-6 * time.Minute).Unix()
+			})
+		}},
+		{name: "iat in the future", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, testTokenURL, "", func(c gojwt.MapClaims, _ map[string]interface{}) {
+				c["iat"] = time.Now().Add(time.Minute).Unix()
+			})
+		}},
+		{name: "missing iat", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, testTokenURL, "", func(c gojwt.MapClaims, _ map[string]interface{}) {
+				delete(c, "iat")
+			})
+		}},
+		{name: "missing jti", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, testTokenURL, "", func(c gojwt.MapClaims, _ map[string]interface{}) {
+				delete(c, "jti")
+			})
+		}},
+		{name: "wrong typ", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, testTokenURL, "", func(_ gojwt.MapClaims, h map[string]interface{}) {
+				h["typ"] = "JWT"
+			})
+		}},
+		{name: "missing jwk", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, testTokenURL, "", func(_ gojwt.MapClaims, h map[string]interface{}) {
+				delete(h, "jwk")
+			})
+		}},
+		{name: "private key in jwk", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, testTokenURL, "", func(_ gojwt.MapClaims, h map[string]interface{}) {
+				h["jwk"] = map[string]string{
+					"kty": k.jwk.Kty, "crv": k.jwk.Crv, "x": k.jwk.X, "y": k.jwk.Y,
+					"d": base64.RawURLEncoding.EncodeToString(k.key.D.Bytes()),
+				}
+			})
+		}},
+		{name: "signed by another key", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return k.proof(http.MethodPost, testTokenURL, "", func(_ gojwt.MapClaims, h map[string]interface{}) {
+				h["jwk"] = other.jwk
+			})
+		}},
+		{name: "symmetric algorithm", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			token := gojwt.NewWithClaims(gojwt.SigningMethodHS256, gojwt.MapClaims{
+				"jti": uuid.New().String(), "htm": http.MethodPost, "htu": testTokenURL, "iat": time.Now().Unix(),
+			})
+			token.Header["typ"] = proofType
+			token.Header["jwk"] = map[string]string{"kty": "oct", "k": "c2VjcmV0"}
+			signed, _ := token.SignedString([]byte("secret"))
+			return signed
+		}},
+		{name: "missing ath", method: http.MethodGet, target: testPublicURL + "/api/v1/resources", accessToken: "access-token", proof: func() string {
+			return k.proof(http.MethodGet, testPublicURL+"/api/v1/resources", "", nil)
+		}},
+		{name: "ath of another token", method: http.MethodGet, target: testPublicURL + "/api/v1/resources", accessToken: "access-token", proof: func() string {
+			return k.proof(http.MethodGet, testPublicURL+"/api/v1/resources", "other-token", nil)
+		}},
+		{name: "not a jwt", method: http.MethodPost, target: testTokenURL, proof: func() string {
+			return "not-a-jwt"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVerifier(NewMemoryReplayCache())
+			if _, err := v.Verify(request(tt.method, tt.target, tt.proof()), tt.accessToken); !errors.Is(err, ErrInvalidProof) {
+				t.Fatalf("Verify() error = %v, want %v", err, ErrInvalidProof)
+			}
+		})
+	}
+
+	t.Run("missing header", func(t *testing.T) {
+		v := newTestVerifier(NewMemoryReplayCache())
+		if _, err := v.Verify(request(http.MethodPost, testTokenURL), ""); !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("Verify() error = %v, want %v", err, ErrInvalidProof)
+		}
+	})
+	t.Run("multiple headers", func(t *testing.T) {
+		v := newTestVerifier(NewMemoryReplayCache())
+		r := request(http.MethodPost, testTokenURL, k.proof(http.MethodPost, testTokenURL, "", nil), k.proof(http.MethodPost, testTokenURL, "", nil))
+		if _, err := v.Verify(r, ""); !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("Verify() error = %v, want %v", err, ErrInvalidProof)
+		}
+	})
+}
+
+func TestVerifyMatchesURI(t *testing.T) {
+	k := newTestKey(t)
+
+	tests := []struct {
+		name   string
+		target string
+		htu    string
+	}{
+		{name: "public url", target: "http://10.0.0.5:8080/oauth/token", htu: testTokenURL},
+		{name: "query and fragment ignored", target: testTokenURL + "?a=b", htu: testTokenURL + "?x=y#f"},
+		{name: "default port", target: testTokenURL, htu: "https://api.example.com:443/oauth/token"},
+		{name: "case-insensitive host", target: testTokenURL, htu: "HTTPS://API.Example.com/oauth/token"},
+		{name: "request host", target: "http://internal.svc:8080/oauth/token", htu: "http://internal.svc:8080/oauth/token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVerifier(NewMemoryReplayCache())
+			if _, err := v.Verify(request(http.MethodPost, tt.target, k.proof(http.MethodPost, tt.htu, "", nil)), ""); err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	v := newTestVerifier(NewMemoryReplayCache())
+	k := newTestKey(t)
+
+	proof := k.proof(http.MethodPost, testTokenURL, "", nil)
+	if _, err := v.Verify(request(http.MethodPost, testTokenURL, proof), ""); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, err := v.Verify(request(http.MethodPost, testTokenURL, proof), ""); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("replayed Verify() error = %v, want %v", err, ErrInvalidProof)
+	}
+
+	// 不同公钥使用相同 jti 互不影响
+	other := newTestKey(t)
+	sameJTI := func(claims gojwt.MapClaims, _ map[string]interface{}) { claims["jti"] = "shared-jti" }
+	if _, err := v.Verify(request(http.MethodPost, testTokenURL, k.proof(http.MethodPost, testTokenURL, "", sameJTI)), ""); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, err := v.Verify(request(http.MethodPost, testTokenURL, other.proof(http.MethodPost, testTokenURL, "", sameJTI)), ""); err != nil {
+		t.Fatalf("Verify with the same jti from another key: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package dpop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/filestore"
+)
+
+// pruneInterval 清理过期记录的最短间隔，避免每个请求都遍历缓存
+const pruneInterval = time.Minute
+
+// ReplayCache 已使用的证明 jti 缓存，记录只需保留到证明本身不再被接受为止
+type ReplayCache interface {
+	// Use 记录 jti；jti 已被使用过时返回 false。检查和记录必须是原子的
+	Use(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+}
+
+// MemoryReplayCache 内存重放缓存，多副本部署时每个副本各自记录
+type MemoryReplayCache struct {
+	mu         sync.Mutex
+	seen       map[string]time.Time // jti -> 过期时间
+	lastPruned time.Time
+}
+
+// NewMemoryReplayCache 创建内存重放缓存
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{
+		seen: make(map[string]time.Time),
+	}
+}
+
+// Use 记录 jti，已存在且未过期时返回 false
+func (c *MemoryReplayCache) Use(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastPruned) >= pruneInterval {
+		c.pruneLocked(now)
+	}
+
+	if exp, ok := c.seen[jti]; ok && now.Before(exp) {
+		return false, nil
+	}
+	c.seen[jti] = expiresAt
+	return true, nil
+}
+
+// pruneLocked 清理已过期的记录，调用方需持有锁
+func (c *MemoryReplayCache) pruneLocked(now time.Time) {
+	for jti, expiresAt := range c.seen {
+		if now.After(expiresAt) {
+			delete(c.seen, jti)
+		}
+	}
+	c.lastPruned = now
+}
+
+// FileReplayCache 基于 JSON 文件的重放缓存，多个副本挂载同一文件时共享已使用的 jti
+//
+// 每次记录都持有锁文件读取最新内容、检查并写回，同一证明重放到其他副本时同样被拒绝。
+type FileReplayCache struct {
+	mu     sync.Mutex
+	file   *filestore.File
+	memory *MemoryReplayCache // 文件内容的缓存
+}
+
+// NewFileReplayCache 创建文件重放缓存，并检查已有文件能否解析
+func NewFileReplayCache(path string) (*FileReplayCache, error) {
+	c := &FileReplayCache{file: filestore.NewFile(path), memory: NewMemoryReplayCache()}
+	if err := c.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Use 持有锁文件检查并记录 jti，已被任一副本使用过时返回 false
+func (c *FileReplayCache) Use(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unlock, err := c.file.Lock()
+	if err != nil {
+		return false, fmt.Errorf("lock dpop replay cache: %w", err)
+	}
+	defer unlock()
+
+	if err := c.refreshLocked(); err != nil {
+		return false, err
+	}
+	fresh, err := c.memory.Use(ctx, jti, expiresAt)
+	if err != nil || !fresh {
+		return false, err
+	}
+	return true, c.persistLocked()
+}
+
+// refreshLocked 文件变化时重新读取
+func (c *FileReplayCache) refreshLocked() error {
+	data, changed, err := c.file.Read()
+	if err != nil {
+		return fmt.Errorf("read dpop replay cache: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	memory := NewMemoryReplayCache()
+	if data != nil {
+		if err := json.Unmarshal(data, &memory.seen); err != nil {
+			return fmt.Errorf("decode dpop replay cache: %w", err)
+		}
+	}
+	c.memory = memory
+	return nil
+}
+
+// persistLocked 写回缓存中的记录，过期记录由 Use 定期清理
+func (c *FileReplayCache) persistLocked() error {
+	c.memory.mu.Lock()
+	data, err := json.Marshal(c.memory.seen)
+	c.memory.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := c.file.Write(data); err != nil {
+		return fmt.Errorf("write dpop replay cache: %w", err)
+	}
+	return nil
+}
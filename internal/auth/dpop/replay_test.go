@@ -0,0 +1,126 @@
+package dpop
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryReplayCache(t *testing.T) {
+	c := NewMemoryReplayCache()
+	ctx := context.Background()
+
+	if fresh, err := c.Use(ctx, "jti-1", time.Now().Add(time.Minute)); err != nil || !fresh {
+		t.Fatalf("Use() = %v, %v, want true", fresh, err)
+	}
+	if fresh, _ := c.Use(ctx, "jti-1", time.Now().Add(time.Minute)); fresh {
+		t.Fatal("Use() accepted a used jti")
+	}
+
+	// 过期的记录不再阻止使用，并在清理时删除
+	if fresh, _ := c.Use(ctx, "jti-2", time.Now().Add(-time.Second)); !fresh {
+		t.Fatal("Use() rejected a new jti")
+	}
+	if fresh, _ := c.Use(ctx, "jti-2", time.Now().Add(time.Minute)); !fresh {
+		t.Fatal("Use() rejected a jti whose record expired")
+	}
+	c.pruneLocked(time.Now().Add(2 * time.Minute))
+	if len(c.seen) != 0 {
+		t.Fatalf("records after prune = %v, want none", c.seen)
+	}
+}
+
+func TestFileReplayCacheSharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dpop_replays.json")
+	a, err := NewFileReplayCache(path)
+	if err != nil {
+		t.Fatalf("NewFileReplayCache: %v", err)
+	}
+	b, err := NewFileReplayCache(path)
+	if err != nil {
+		t.Fatalf("NewFileReplayCache: %v", err)
+	}
+
+	if fresh, err := a.Use(ctx, "jti-1", time.Now().Add(time.Minute)); err != nil || !fresh {
+		t.Fatalf("Use() = %v, %v, want true", fresh, err)
+	}
+	if fresh, err := b.Use(ctx, "jti-1", time.Now().Add(time.Minute)); err != nil || fresh {
+		t.Fatalf("Use() on another replica = %v, %v, want false", fresh, err)
+	}
+
+	// 重启后从文件恢复
+	c, err := NewFileReplayCache(path)
+	if err != nil {
+		t.Fatalf("NewFileReplayCache: %v", err)
+	}
+	if fresh, _ := c.Use(ctx, "jti-1", time.Now().Add(time.Minute)); fresh {
+		t.Fatal("Use() after restart accepted a used jti")
+	}
+}
+
+func TestVerifyRejectsReplayOnAnotherReplica(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dpop_replays.json")
+	replicas := make([]*Verifier, 2)
+	for i := range replicas {
+		cache, err := NewFileReplayCache(path)
+		if err != nil {
+			t.Fatalf("NewFileReplayCache: %v", err)
+		}
+		replicas[i] = newTestVerifier(cache)
+	}
+	k := newTestKey(t)
+
+	proof := k.proof(http.MethodPost, testTokenURL, "", nil)
+	if _, err := replicas[0].Verify(request(http.MethodPost, testTokenURL, proof), ""); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, err := replicas[1].Verify(request(http.MethodPost, testTokenURL, proof), ""); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("Verify() replayed on another replica error = %v, want %v", err, ErrInvalidProof)
+	}
+}
+
+func TestFileReplayCacheConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dpop_replays.json")
+	caches := make([]*FileReplayCache, 3)
+	for i := range caches {
+		c, err := NewFileReplayCache(path)
+		if err != nil {
+			t.Fatalf("NewFileReplayCache: %v", err)
+		}
+		caches[i] = c
+	}
+
+	// 同一 jti 同时出示给所有副本，只有一次被接受
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		accepted int
+	)
+	for _, c := range caches {
+		wg.Add(1)
+		go func(c *FileReplayCache) {
+			defer wg.Done()
+			fresh, err := c.Use(ctx, "jti-1", time.Now().Add(time.Minute))
+			if err != nil {
+				t.Errorf("Use: %v", err)
+				return
+			}
+			if fresh {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if accepted != 1 {
+		t.Fatalf("jti accepted %d times, want 1", accepted)
+	}
+}
@@ -0,0 +1,203 @@
+package federation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+)
+
+const testClientID = "api-server"
+
+// authRequest 浏览器在上游授权端点发起的请求中与令牌相关的参数
+type authRequest struct {
+	nonce         string
+	codeChallenge string
+}
+
+// testIssuer 基于 httptest 的上游 OIDC 身份提供方
+//
+// 测试通过 authorize 模拟浏览器完成上游授权并取得授权码，令牌端点按 PKCE 校验授权码后
+// 签发 ID 令牌；idClaims 和 userinfo 决定返回的声明。
+type testIssuer struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu         sync.Mutex
+	keys       map[string]*ecdsa.PrivateKey
+	signingKid string // 签发 ID 令牌使用的密钥，可以不在 JWKS 中
+	published  []string
+	codes      map[string]authRequest
+	jwksHits   int
+
+	metadata map[string]string                       // 为空时返回完整的发现文档
+	idClaims func(claims gojwt.MapClaims)            // 修改默认的 ID 令牌声明
+	userinfo func(sub string) map[string]interface{} // 为空时不提供 UserInfo
+}
+
+// newTestIssuer 启动上游身份提供方，JWKS 中发布密钥 k1
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	iss := &testIssuer{
+		t:     t,
+		keys:  make(map[string]*ecdsa.PrivateKey),
+		codes: make(map[string]authRequest),
+	}
+	iss.addKey("k1", true)
+	iss.signingKid = "k1"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", iss.discovery)
+	mux.HandleFunc("/token", iss.token)
+	mux.HandleFunc("/userinfo", iss.userInfo)
+	mux.HandleFunc("/jwks", iss.jwks)
+	iss.srv = httptest.NewServer(mux)
+	t.Cleanup(iss.srv.Close)
+	return iss
+}
+
+// issuer 签发者地址
+func (iss *testIssuer) issuer() string {
+	return iss.srv.URL
+}
+
+// addKey 生成签名密钥，publish 为 true 时在 JWKS 中发布
+func (iss *testIssuer) addKey(kid string, publish bool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		iss.t.Fatalf("generate key: %v", err)
+	}
+
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	iss.keys[kid] = key
+	if publish {
+		iss.published = append(iss.published, kid)
+	}
+}
+
+// authorize 模拟浏览器访问上游授权地址，返回回调中的授权码和 state
+func (iss *testIssuer) authorize(authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		iss.t.Fatalf("parse authorization URL: %v", err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		iss.t.Fatalf("authorization URL without PKCE: %s", authURL)
+	}
+
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	code = "code-" + query.Get("state")[:8]
+	iss.codes[code] = authRequest{
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	return code, query.Get("state")
+}
+
+func (iss *testIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	md := map[string]string{
+		"issuer":                 iss.issuer(),
+		"authorization_endpoint": iss.issuer() + "/authorize",
+		"token_endpoint":         iss.issuer() + "/token",
+		"userinfo_endpoint":      iss.issuer() + "/userinfo",
+		"jwks_uri":               iss.issuer() + "/jwks",
+	}
+	if iss.metadata != nil {
+		md = iss.metadata
+	}
+	writeJSON(w, md)
+}
+
+func (iss *testIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	iss.mu.Lock()
+	req, ok := iss.codes[r.PostForm.Get("code")]
+	delete(iss.codes, r.PostForm.Get("code"))
+	key := iss.keys[iss.signingKid]
+	kid := iss.signingKid
+	iss.mu.Unlock()
+
+	if !ok || codeChallenge(r.PostForm.Get("code_verifier")) != req.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := gojwt.MapClaims{
+		"iss":                iss.issuer(),
+		"sub":                "user-123",
+		"aud":                testClientID,
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              req.nonce,
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+	}
+	if iss.idClaims != nil {
+		iss.idClaims(claims)
+	}
+	token := gojwt.NewWithClaims(gojwt.SigningMethodES256, claims)
+	token.Header["kid"] = kid
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		iss.t.Errorf("sign id token: %v", err)
+		return
+	}
+
+	writeJSON(w, map[string]string{
+		"access_token": "at-" + r.PostForm.Get("code"),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (iss *testIssuer) userInfo(w http.ResponseWriter, r *http.Request) {
+	if iss.userinfo == nil || !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer at-") {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, iss.userinfo("user-123"))
+}
+
+func (iss *testIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	iss.jwksHits++
+	set := jwt.JWKSet{}
+	for _, kid := range iss.published {
+		jwk, err := jwt.NewJWK(&iss.keys[kid].PublicKey, kid, "ES256")
+		if err != nil {
+			iss.t.Errorf("NewJWK: %v", err)
+			return
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	writeJSON(w, set)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,69 @@
+package federation
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RoleRule 声明到角色的映射规则：声明值等于 Value（或声明为数组且包含 Value）时授予 Roles
+//
+// 示例：{"claim": "groups", "value": "platform-admins", "roles": ["admin"]}
+type RoleRule struct {
+	Claim string   `json:"claim,omitempty"` // 默认使用提供方的 groups_claim
+	Value string   `json:"value"`
+	Roles []string `json:"roles"`
+}
+
+// matches 判断声明是否满足规则，非字符串标量按其文本形式比较
+func (r RoleRule) matches(claims map[string]interface{}) bool {
+	switch v := claims[r.Claim].(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, item := range v {
+			if claimString(item) == r.Value {
+				return true
+			}
+		}
+		return false
+	default:
+		return claimString(v) == r.Value
+	}
+}
+
+// mapRoles 按默认角色和映射规则计算本地角色，结果去重并排序
+func (p *Provider) mapRoles(claims map[string]interface{}) []string {
+	set := make(map[string]bool)
+	for _, role := range p.config.DefaultRoles {
+		set[role] = true
+	}
+	for _, rule := range p.config.RoleRules {
+		if !rule.matches(claims) {
+			continue
+		}
+		for _, role := range rule.Roles {
+			set[role] = true
+		}
+	}
+
+	roles := make([]string, 0, len(set))
+	for role := range set {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// claimString 将声明值转换为字符串
+func claimString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case nil:
+		return ""
+	case float64:
+		return fmt.Sprintf("%g", s)
+	default:
+		return fmt.Sprint(s)
+	}
+}
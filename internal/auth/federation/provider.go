@@ -0,0 +1,395 @@
+package federation
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrProviderNotFound = errors.New("identity provider not found")
+	ErrInvalidIDToken   = errors.New("invalid id token")
+	ErrUpstream         = errors.New("identity provider request failed")
+)
+
+const (
+	// maxResponseSize 上游响应体大小上限
+	maxResponseSize = 1 << 20
+
+	// jwksRefreshInterval 遇到未知 kid 时重新获取 JWKS 的最小间隔
+	jwksRefreshInterval = time.Minute
+
+	// clockSkew 校验令牌时间声明时允许的时钟偏差
+	clockSkew = 30 * time.Second
+)
+
+// idTokenAlgorithms 接受的 ID 令牌签名算法，HS256 使用客户端密钥验证
+var idTokenAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA", "HS256",
+}
+
+// ProviderConfig 上游 OIDC 身份提供方配置
+type ProviderConfig struct {
+	Name            string     `json:"name"`
+	DisplayName     string     `json:"display_name,omitempty"`
+	Issuer          string     `json:"issuer"`
+	ClientID        string     `json:"client_id"`
+	ClientSecret    string     `json:"client_secret,omitempty"`
+	ClientSecretEnv string     `json:"client_secret_env,omitempty"` // 从环境变量读取客户端密钥
+	RedirectURL     string     `json:"redirect_url,omitempty"`      // 为空时由服务的对外地址推导
+	Scopes          []string   `json:"scopes,omitempty"`            // 默认 openid profile email
+	UsernameClaim   string     `json:"username_claim,omitempty"`    // 默认 preferred_username
+	GroupsClaim     string     `json:"groups_claim,omitempty"`      // 默认 groups
+	RoleRules       []RoleRule `json:"role_rules,omitempty"`
+	DefaultRoles    []string   `json:"default_roles,omitempty"` // 所有成功登录的用户都获得的角色
+}
+
+// metadata OIDC 发现文档中用到的字段
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// tokenResponse 上游令牌端点响应
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// Provider 上游 OIDC 身份提供方，发现文档和 JWKS 在首次使用时获取并缓存
+type Provider struct {
+	config     ProviderConfig
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	metadata      *metadata
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// newProvider 校验配置并创建身份提供方
+func newProvider(cfg ProviderConfig, baseURL string, httpClient *http.Client) (*Provider, error) {
+	if cfg.Name == "" || strings.ContainsAny(cfg.Name, "/?#") {
+		return nil, fmt.Errorf("provider name %q is invalid", cfg.Name)
+	}
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("provider %s: issuer and client_id are required", cfg.Name)
+	}
+	if cfg.ClientSecretEnv != "" {
+		cfg.ClientSecret = os.Getenv(cfg.ClientSecretEnv)
+		if cfg.ClientSecret == "" {
+			return nil, fmt.Errorf("provider %s: environment variable %s is empty", cfg.Name, cfg.ClientSecretEnv)
+		}
+	}
+	if cfg.RedirectURL == "" {
+		cfg.RedirectURL = strings.TrimSuffix(baseURL, "/") + "/api/v1/auth/federated/" + cfg.Name + "/callback"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	for i := range cfg.RoleRules {
+		if cfg.RoleRules[i].Claim == "" {
+			cfg.RoleRules[i].Claim = cfg.GroupsClaim
+		}
+		if len(cfg.RoleRules[i].Roles) == 0 {
+			return nil, fmt.Errorf("provider %s: role rule %d has no roles", cfg.Name, i)
+		}
+	}
+
+	return &Provider{
+		config:     cfg,
+		httpClient: httpClient,
+		keys:       make(map[string]crypto.PublicKey),
+	}, nil
+}
+
+// Name 返回身份提供方名称
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// discover 获取并缓存发现文档，失败时下次调用重试
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var md metadata
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, "", &md); err != nil {
+		return nil, err
+	}
+
+	// OIDC Discovery 第 4.3 节：发现文档中的 issuer 必须与配置完全一致
+	if md.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("%w: discovered issuer %q does not match %q", ErrUpstream, md.Issuer, p.config.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document of %s is incomplete", ErrUpstream, p.config.Issuer)
+	}
+
+	p.metadata = &md
+	return p.metadata, nil
+}
+
+// AuthCodeURL 生成上游授权端点地址（授权码流程 + PKCE S256）
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid authorization endpoint: %v", ErrUpstream, err)
+	}
+
+	query := target.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	target.RawQuery = query.Encode()
+
+	return target.String(), nil
+}
+
+// exchange 用授权码向上游令牌端点换取令牌
+func (p *Provider) exchange(ctx context.Context, code, codeVerifier string) (*tokenResponse, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var tokens tokenResponse
+	if err := p.doJSON(req, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrUpstream)
+	}
+	return &tokens, nil
+}
+
+// verifyIDToken 校验 ID 令牌签名、签发者、受众、有效期和 nonce
+func (p *Provider) verifyIDToken(ctx context.Context, raw, nonce string) (gojwt.MapClaims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := gojwt.MapClaims{}
+	_, err = gojwt.ParseWithClaims(raw, claims,
+		func(token *gojwt.Token) (interface{}, error) {
+			if token.Method.Alg() == gojwt.SigningMethodHS256.Alg() {
+				if p.config.ClientSecret == "" {
+					return nil, fmt.Errorf("HS256 id token requires a client secret")
+				}
+				return []byte(p.config.ClientSecret), nil
+			}
+			kid, _ := token.Header["kid"].(string)
+			return p.publicKey(ctx, kid)
+		},
+		gojwt.WithValidMethods(idTokenAlgorithms),
+		gojwt.WithIssuer(md.Issuer),
+		gojwt.WithAudience(p.config.ClientID),
+		gojwt.WithExpirationRequired(),
+		gojwt.WithIssuedAt(),
+		gojwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	// OIDC Core 第 3.1.3.7 节：存在多个受众时 azp 必须是本客户端
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.config.ClientID {
+			return nil, fmt.Errorf("%w: azp mismatch", ErrInvalidIDToken)
+		}
+	}
+
+	return claims, nil
+}
+
+// userInfo 获取 UserInfo 声明，上游未提供 UserInfo 端点时返回 nil
+func (p *Provider) userInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if md.UserinfoEndpoint == "" || accessToken == "" {
+		return nil, nil
+	}
+
+	var info map[string]interface{}
+	if err := p.getJSON(ctx, md.UserinfoEndpoint, accessToken, &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// publicKey 按 kid 查找上游签名公钥，未知 kid 时按限频重新获取 JWKS
+func (p *Provider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKeyLocked(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if err := p.fetchKeysLocked(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := p.lookupKeyLocked(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKeyLocked 查找缓存的公钥；令牌未携带 kid 且只有一个密钥时使用该密钥
+func (p *Provider) lookupKeyLocked(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// fetchKeysLocked 获取上游 JWKS，跳过无法解析或不用于签名的密钥
+func (p *Provider) fetchKeysLocked(ctx context.Context) error {
+	if p.metadata == nil {
+		return fmt.Errorf("%w: discovery not loaded", ErrUpstream)
+	}
+
+	var set jwt.JWKSet
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, "", &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"provider": p.config.Name,
+				"kid":      jwk.Kid,
+			}).Warn("skipping unsupported upstream signing key")
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	return nil
+}
+
+// getJSON 发送 GET 请求并解码 JSON 响应，bearer 不为空时携带访问令牌
+func (p *Provider) getJSON(ctx context.Context, target, bearer string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return p.doJSON(req, v)
+}
+
+// doJSON 发送请求并解码 JSON 响应，非 2xx 状态视为上游错误
+func (p *Provider) doJSON(req *http.Request, v interface{}) error {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstream, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstream, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s %s returned %d: %s", ErrUpstream, req.Method, req.URL.Redacted(), resp.StatusCode, truncate(body, 200))
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%w: decode response from %s: %v", ErrUpstream, req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+// truncate 截断响应体用于日志
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		return string(b[:n]) + "..."
+	}
+	return string(b)
+}
@@ -0,0 +1,282 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNoRoles = errors.New("no local roles mapped for identity")
+)
+
+// userNamespace 由签发者和 sub 推导稳定用户 ID 的 UUID 命名空间
+var userNamespace = uuid.MustParse("8f1d6a3e-4b7c-5e29-9a0d-2c6b1f3e7d45")
+
+// ProviderInfo 对外展示的身份提供方信息
+type ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Issuer      string `json:"issuer"`
+	LoginURL    string `json:"login_url"`
+}
+
+// Identity 已验证的外部身份
+type Identity struct {
+	Provider string
+	Issuer   string
+	Subject  string
+	Claims   map[string]interface{}
+}
+
+// Service 联合登录服务：发起上游授权、处理回调并即时创建本地用户
+type Service struct {
+	providers map[string]*Provider
+	states    StateStore
+	users     UserStore
+	stateTTL  time.Duration
+}
+
+// LoadProviders 从 JSON 文件加载身份提供方配置，path 为空时返回空列表
+func LoadProviders(path string) ([]ProviderConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read identity providers: %w", err)
+	}
+
+	var configs []ProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("decode identity providers: %w", err)
+	}
+	return configs, nil
+}
+
+// NewService 创建联合登录服务，baseURL 为本服务的对外地址，用于推导回调地址
+func NewService(
+	configs []ProviderConfig,
+	baseURL string,
+	states StateStore,
+	users UserStore,
+	stateTTL time.Duration,
+	httpClient *http.Client,
+) (*Service, error) {
+	s := &Service{
+		providers: make(map[string]*Provider, len(configs)),
+		states:    states,
+		users:     users,
+		stateTTL:  stateTTL,
+	}
+
+	for _, cfg := range configs {
+		if _, exists := s.providers[cfg.Name]; exists {
+			return nil, fmt.Errorf("duplicate identity provider %q", cfg.Name)
+		}
+		p, err := newProvider(cfg, baseURL, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		s.providers[cfg.Name] = p
+	}
+
+	return s, nil
+}
+
+// Providers 返回已配置的身份提供方，按名称排序
+func (s *Service) Providers() []ProviderInfo {
+	infos := make([]ProviderInfo, 0, len(s.providers))
+	for _, p := range s.providers {
+		name := p.config.DisplayName
+		if name == "" {
+			name = p.config.Name
+		}
+		infos = append(infos, ProviderInfo{
+			Name:        p.config.Name,
+			DisplayName: name,
+			Issuer:      p.config.Issuer,
+			LoginURL:    "/api/v1/auth/federated/" + p.config.Name + "/login",
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Begin 发起联合登录，返回上游授权地址和用于绑定浏览器的 state
+func (s *Service) Begin(ctx context.Context, providerName string) (string, string, error) {
+	p, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrProviderNotFound
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, codeChallenge(verifier))
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.states.Save(ctx, &State{
+		State:        state,
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(s.stateTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// Complete 处理上游回调：校验 state、兑换授权码、验证 ID 令牌、映射角色并即时创建本地用户
+func (s *Service) Complete(ctx context.Context, providerName, state, code string) (*model.User, *Identity, error) {
+	p, ok := s.providers[providerName]
+	if !ok {
+		return nil, nil, ErrProviderNotFound
+	}
+
+	pending, err := s.states.Consume(ctx, state)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pending.Provider != providerName {
+		return nil, nil, ErrStateNotFound
+	}
+
+	tokens, err := p.exchange(ctx, code, pending.CodeVerifier)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims, err := p.verifyIDToken(ctx, tokens.IDToken, pending.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identity := &Identity{
+		Provider: providerName,
+		Issuer:   p.config.Issuer,
+		Subject:  claims["sub"].(string),
+		Claims:   map[string]interface{}(claims),
+	}
+
+	// 分组等声明可能只出现在 UserInfo 中；ID 令牌中已有的声明优先
+	info, err := p.userInfo(ctx, tokens.AccessToken)
+	if err != nil {
+		log.WithError(err).WithField("provider", providerName).Warn("failed to fetch userinfo, using id token claims only")
+	} else if info != nil {
+		if sub, _ := info["sub"].(string); sub == identity.Subject {
+			for k, v := range info {
+				if _, exists := identity.Claims[k]; !exists {
+					identity.Claims[k] = v
+				}
+			}
+		} else {
+			log.WithField("provider", providerName).Warn("userinfo subject does not match id token, ignoring userinfo")
+		}
+	}
+
+	roles := p.mapRoles(identity.Claims)
+	if len(roles) == 0 {
+		return nil, identity, ErrNoRoles
+	}
+
+	user, err := s.provision(ctx, p, identity, roles)
+	if err != nil {
+		return nil, identity, err
+	}
+	return user, identity, nil
+}
+
+// Name 返回后端名称
+func (s *Service) Name() string {
+	return "federation"
+}
+
+// GetUser 按 ID 查找联合登录即时创建的用户
+func (s *Service) GetUser(ctx context.Context, id string) (*model.User, error) {
+	return s.users.Get(ctx, id)
+}
+
+// provision 即时创建或更新本地用户；角色在每次登录时按最新声明重新计算
+func (s *Service) provision(ctx context.Context, p *Provider, identity *Identity, roles []string) (*model.User, error) {
+	id := uuid.NewSHA1(userNamespace, []byte(identity.Issuer+"\x00"+identity.Subject)).String()
+	now := time.Now()
+
+	user := &model.User{
+		ID:        id,
+		Username:  claimString(identity.Claims[p.config.UsernameClaim]),
+		Email:     claimString(identity.Claims["email"]),
+		Roles:     roles,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if user.Username == "" {
+		user.Username = user.Email
+	}
+	if user.Username == "" {
+		user.Username = identity.Subject
+	}
+
+	existing, err := s.users.Get(ctx, id)
+	switch {
+	case err == nil:
+		user.CreatedAt = existing.CreatedAt
+	case !errors.Is(err, ErrUserNotFound):
+		return nil, err
+	default:
+		log.WithFields(log.Fields{
+			"user_id":  id,
+			"provider": p.config.Name,
+			"subject":  identity.Subject,
+		}).Info("provisioning federated user")
+	}
+
+	if err := s.users.Upsert(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// randomString 生成 256 位随机字符串，用于 state、nonce 和 PKCE verifier
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallenge 计算 PKCE S256 code_challenge
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,352 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+// newTestService 创建连接到上游的联合登录服务；提供方 mock 将 groups 中的 admins 映射为 admin，
+// 提供方 other 使用同一上游，用于校验 state 与提供方绑定
+func newTestService(t *testing.T, iss *testIssuer) *Service {
+	t.Helper()
+
+	return newTestServiceWithStates(t, iss, NewMemoryStateStore())
+}
+
+// newTestServiceWithStates 创建使用指定登录状态存储的联合登录服务
+func newTestServiceWithStates(t *testing.T, iss *testIssuer, states StateStore) *Service {
+	t.Helper()
+
+	configs := []ProviderConfig{
+		{
+			Name:     "mock",
+			Issuer:   iss.issuer(),
+			ClientID: testClientID,
+			RoleRules: []RoleRule{
+				{Value: "admins", Roles: []string{"admin"}},
+			},
+		},
+		{
+			Name:         "other",
+			Issuer:       iss.issuer(),
+			ClientID:     testClientID,
+			DefaultRoles: []string{"viewer"},
+		},
+	}
+	s, err := NewService(configs, "https://api.example.com", states, NewMemoryUserStore(), time.Minute, iss.srv.Client())
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return s
+}
+
+// login 发起登录、模拟上游授权并完成回调
+func login(t *testing.T, s *Service, iss *testIssuer, provider string) (*Identity, []string, error) {
+	t.Helper()
+
+	authURL, _, err := s.Begin(context.Background(), provider)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, state := iss.authorize(authURL)
+	user, identity, err := s.Complete(context.Background(), provider, state, code)
+	if err != nil {
+		return identity, nil, err
+	}
+	return identity, user.Roles, nil
+}
+
+// withGroups 在 ID 令牌中加入 groups 声明
+func withGroups(groups ...interface{}) func(gojwt.MapClaims) {
+	return func(claims gojwt.MapClaims) {
+		claims["groups"] = groups
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	iss := newTestIssuer(t)
+	s := newTestService(t, iss)
+
+	authURL, state, err := s.Begin(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+	query := u.Query()
+	if u.Path != "/authorize" || query.Get("client_id") != testClientID || query.Get("state") != state ||
+		query.Get("redirect_uri") != "https://api.example.com/api/v1/auth/federated/mock/callback" ||
+		query.Get("nonce") == "" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL = %s", authURL)
+	}
+
+	tests := []struct {
+		name     string
+		metadata map[string]string
+	}{
+		{name: "issuer mismatch", metadata: map[string]string{
+			"issuer":                 "https://evil.example.com",
+			"authorization_endpoint": iss.issuer() + "/authorize",
+			"token_endpoint":         iss.issuer() + "/token",
+			"jwks_uri":               iss.issuer() + "/jwks",
+		}},
+		{name: "missing jwks_uri", metadata: map[string]string{
+			"issuer":                 iss.issuer(),
+			"authorization_endpoint": iss.issuer() + "/authorize",
+			"token_endpoint":         iss.issuer() + "/token",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss.metadata = tt.metadata
+			defer func() { iss.metadata = nil }()
+
+			// 使用新服务，避免复用已缓存的发现文档
+			if _, _, err := newTestService(t, iss).Begin(context.Background(), "mock"); !errors.Is(err, ErrUpstream) {
+				t.Fatalf("Begin error = %v, want %v", err, ErrUpstream)
+			}
+		})
+	}
+}
+
+func TestJWKSKeyLookup(t *testing.T) {
+	iss := newTestIssuer(t)
+	s := newTestService(t, iss)
+	iss.idClaims = withGroups("admins")
+
+	if _, _, err := login(t, s, iss, "mock"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	// 未发布的密钥签名的令牌被拒绝，且一分钟内不会因未知 kid 反复请求 JWKS
+	iss.addKey("rogue", false)
+	iss.signingKid = "rogue"
+	for i := 0; i < 2; i++ {
+		if _, _, err := login(t, s, iss, "mock"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Fatalf("login with unpublished key error = %v, want %v", err, ErrInvalidIDToken)
+		}
+	}
+	if iss.jwksHits != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", iss.jwksHits)
+	}
+
+	// 上游轮换密钥后，超过刷新间隔时按新 kid 重新获取 JWKS
+	iss.addKey("k2", true)
+	iss.signingKid = "k2"
+	s.providers["mock"].keysFetchedAt = time.Now().Add(-2 * jwksRefreshInterval)
+	if _, _, err := login(t, s, iss, "mock"); err != nil {
+		t.Fatalf("login after key rotation: %v", err)
+	}
+	if iss.jwksHits != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", iss.jwksHits)
+	}
+}
+
+func TestCompleteRejectsStateMismatch(t *testing.T) {
+	iss := newTestIssuer(t)
+	s := newTestService(t, iss)
+	ctx := context.Background()
+
+	if _, _, err := s.Complete(ctx, "mock", "unknown-state", "code"); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("unknown state error = %v, want %v", err, ErrStateNotFound)
+	}
+
+	// 为 mock 发起的登录不能在 other 的回调中完成，且 state 已被消耗
+	authURL, _, err := s.Begin(ctx, "mock")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, state := iss.authorize(authURL)
+	if _, _, err := s.Complete(ctx, "other", state, code); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("state of another provider error = %v, want %v", err, ErrStateNotFound)
+	}
+	if _, _, err := s.Complete(ctx, "mock", state, code); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("consumed state error = %v, want %v", err, ErrStateNotFound)
+	}
+
+	// 同一 state 只能完成一次
+	iss.idClaims = withGroups("admins")
+	authURL, _, err = s.Begin(ctx, "mock")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, state = iss.authorize(authURL)
+	if _, _, err := s.Complete(ctx, "mock", state, code); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if _, _, err := s.Complete(ctx, "mock", state, code); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("replayed state error = %v, want %v", err, ErrStateNotFound)
+	}
+}
+
+func TestLoginAcrossReplicas(t *testing.T) {
+	iss := newTestIssuer(t)
+	path := filepath.Join(t.TempDir(), "login_states.json")
+	replicas := make([]*Service, 2)
+	for i := range replicas {
+		states, err := NewFileStateStore(path)
+		if err != nil {
+			t.Fatalf("NewFileStateStore: %v", err)
+		}
+		replicas[i] = newTestServiceWithStates(t, iss, states)
+	}
+	iss.idClaims = withGroups("admins")
+	ctx := context.Background()
+
+	// 在一个副本上发起登录，上游回调落在另一个副本
+	authURL, _, err := replicas[0].Begin(ctx, "mock")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, state := iss.authorize(authURL)
+	if _, _, err := replicas[1].Complete(ctx, "mock", state, code); err != nil {
+		t.Fatalf("Complete on another replica: %v", err)
+	}
+
+	// 回调重放到发起登录的副本时 state 已被消耗
+	if _, _, err := replicas[0].Complete(ctx, "mock", state, code); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("replayed state error = %v, want %v", err, ErrStateNotFound)
+	}
+}
+
+func TestVerifyIDTokenClaims(t *testing.T) {
+	iss := newTestIssuer(t)
+	s := newTestService(t, iss)
+
+	tests := []struct {
+		name    string
+		mutate  func(gojwt.MapClaims)
+		wantErr error
+	}{
+		{name: "valid", mutate: func(c gojwt.MapClaims) {}},
+		{name: "nonce mismatch", mutate: func(c gojwt.MapClaims) { c["nonce"] = "replayed-nonce" }, wantErr: ErrInvalidIDToken},
+		{name: "missing nonce", mutate: func(c gojwt.MapClaims) { delete(c, "nonce") }, wantErr: ErrInvalidIDToken},
+		{name: "other audience", mutate: func(c gojwt.MapClaims) { c["aud"] = "other-client" }, wantErr: ErrInvalidIDToken},
+		{
+			name:    "multiple audiences without azp",
+			mutate:  func(c gojwt.MapClaims) { c["aud"] = []string{testClientID, "other-client"} },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "multiple audiences with other azp",
+			mutate: func(c gojwt.MapClaims) {
+				c["aud"] = []string{testClientID, "other-client"}
+				c["azp"] = "other-client"
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "multiple audiences with own azp",
+			mutate: func(c gojwt.MapClaims) {
+				c["aud"] = []string{testClientID, "other-client"}
+				c["azp"] = testClientID
+			},
+		},
+		{name: "other issuer", mutate: func(c gojwt.MapClaims) { c["iss"] = "https://evil.example.com" }, wantErr: ErrInvalidIDToken},
+		{name: "expired", mutate: func(c gojwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: ErrInvalidIDToken},
+		{name: "missing sub", mutate: func(c gojwt.MapClaims) { delete(c, "sub") }, wantErr: ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss.idClaims = func(c gojwt.MapClaims) {
+				c["groups"] = []string{"admins"}
+				tt.mutate(c)
+			}
+			_, _, err := login(t, s, iss, "mock")
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("login: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("login error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserInfoSubjectMismatch(t *testing.T) {
+	iss := newTestIssuer(t)
+	s := newTestService(t, iss)
+
+	// 分组只出现在 UserInfo 中
+	iss.userinfo = func(sub string) map[string]interface{} {
+		return map[string]interface{}{"sub": sub, "groups": []string{"admins"}}
+	}
+	if _, roles, err := login(t, s, iss, "mock"); err != nil || !reflect.DeepEqual(roles, []string{"admin"}) {
+		t.Fatalf("login with matching userinfo = %v, %v", roles, err)
+	}
+
+	// UserInfo 的 sub 与 ID 令牌不一致时整体忽略，不能借此获得角色
+	iss.userinfo = func(string) map[string]interface{} {
+		return map[string]interface{}{"sub": "someone-else", "groups": []string{"admins"}}
+	}
+	identity, _, err := login(t, s, iss, "mock")
+	if !errors.Is(err, ErrNoRoles) {
+		t.Fatalf("login with mismatched userinfo error = %v, want %v", err, ErrNoRoles)
+	}
+	if _, ok := identity.Claims["groups"]; ok {
+		t.Fatal("claims from mismatched userinfo were merged")
+	}
+
+	// ID 令牌中已有的声明优先于 UserInfo
+	iss.idClaims = func(c gojwt.MapClaims) { c["email"] = "alice@example.com" }
+	iss.userinfo = func(sub string) map[string]interface{} {
+		return map[string]interface{}{"sub": sub, "email": "mallory@example.com", "groups": []string{"admins"}}
+	}
+	identity, _, err = login(t, s, iss, "mock")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if identity.Claims["email"] != "alice@example.com" {
+		t.Fatalf("email = %v, want the id token value", identity.Claims["email"])
+	}
+}
+
+func TestClaimRoleMapping(t *testing.T) {
+	p, err := newProvider(ProviderConfig{
+		Name:         "mock",
+		Issuer:       "https://idp.example.com",
+		ClientID:     testClientID,
+		DefaultRoles: []string{"viewer"},
+		RoleRules: []RoleRule{
+			{Value: "admins", Roles: []string{"admin"}},
+			{Claim: "department", Value: "content", Roles: []string{"editor"}},
+			{Claim: "level", Value: "3", Roles: []string{"editor", "auditor"}},
+			{Claim: "email_verified", Value: "true", Roles: []string{"verified"}},
+		},
+	}, "https://api.example.com", nil)
+	if err != nil {
+		t.Fatalf("newProvider: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   []string
+	}{
+		{name: "default only", claims: map[string]interface{}{}, want: []string{"viewer"}},
+		{name: "group in array", claims: map[string]interface{}{"groups": []interface{}{"staff", "admins"}}, want: []string{"admin", "viewer"}},
+		{name: "group as string", claims: map[string]interface{}{"groups": "admins"}, want: []string{"admin", "viewer"}},
+		{name: "group case differs", claims: map[string]interface{}{"groups": []interface{}{"Admins"}}, want: []string{"viewer"}},
+		{name: "custom claim", claims: map[string]interface{}{"department": "content"}, want: []string{"editor", "viewer"}},
+		{name: "numeric claim", claims: map[string]interface{}{"level": float64(3)}, want: []string{"auditor", "editor", "viewer"}},
+		{name: "boolean claim", claims: map[string]interface{}{"email_verified": true}, want: []string{"verified", "viewer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.mapRoles(tt.claims); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("mapRoles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
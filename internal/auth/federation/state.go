@@ -0,0 +1,191 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/filestore"
+)
+
+var (
+	ErrStateNotFound = errors.New("login state not found or expired")
+)
+
+// State 进行中的联合登录请求，回调时用于校验 state、nonce 和 PKCE
+type State struct {
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// StateStore 联合登录状态存储，每个状态只能使用一次
+type StateStore interface {
+	// Save 保存登录状态
+	Save(ctx context.Context, state *State) error
+
+	// Consume 取出并删除登录状态，不存在或已过期时返回 ErrStateNotFound
+	Consume(ctx context.Context, state string) (*State, error)
+}
+
+// MemoryStateStore 内存登录状态存储
+type MemoryStateStore struct {
+	mu     sync.Mutex
+	states map[string]*State
+}
+
+// NewMemoryStateStore 创建内存登录状态存储
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{
+		states: make(map[string]*State),
+	}
+}
+
+// Save 保存登录状态，同时清理已过期的状态
+func (s *MemoryStateStore) Save(ctx context.Context, state *State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, st := range s.states {
+		if now.After(st.ExpiresAt) {
+			delete(s.states, k)
+		}
+	}
+
+	stored := *state
+	s.states[state.State] = &stored
+	return nil
+}
+
+// Consume 取出并删除登录状态
+func (s *MemoryStateStore) Consume(ctx context.Context, state string) (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.states[state]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	delete(s.states, state)
+
+	if time.Now().After(st.ExpiresAt) {
+		return nil, ErrStateNotFound
+	}
+	return st, nil
+}
+
+// FileStateStore 基于 JSON 文件的登录状态存储，多个副本挂载同一文件时共享进行中的登录
+//
+// 发起登录和上游回调可能落在不同副本上；保存和取出都持有锁文件读取最新内容、修改后写回，
+// 状态在任一副本使用后即从文件删除，同一回调并发重放时只有一次成功。
+type FileStateStore struct {
+	mu     sync.Mutex
+	file   *filestore.File
+	memory *MemoryStateStore // 文件内容的缓存
+}
+
+// NewFileStateStore 创建文件登录状态存储，并检查已有文件能否解析
+func NewFileStateStore(path string) (*FileStateStore, error) {
+	s := &FileStateStore{file: filestore.NewFile(path), memory: NewMemoryStateStore()}
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save 保存登录状态，同时清理已过期的状态
+func (s *FileStateStore) Save(ctx context.Context, state *State) error {
+	return s.modify(func(m *MemoryStateStore) error {
+		return m.Save(ctx, state)
+	})
+}
+
+// Consume 取出并删除登录状态，包括其他副本保存的状态
+func (s *FileStateStore) Consume(ctx context.Context, state string) (*State, error) {
+	var st *State
+	err := s.modify(func(m *MemoryStateStore) error {
+		var err error
+		st, err = m.Consume(ctx, state)
+		if errors.Is(err, ErrStateNotFound) {
+			// 已过期的状态也已删除，需要写回；对调用方仍然返回不存在
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return nil, ErrStateNotFound
+	}
+	return st, nil
+}
+
+// modify 持有锁文件读取最新内容，应用修改后写回；fn 返回错误时不写回
+func (s *FileStateStore) modify(fn func(*MemoryStateStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return fmt.Errorf("lock login state store: %w", err)
+	}
+	defer unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return err
+	}
+	if err := fn(s.memory); err != nil {
+		return err
+	}
+	return s.persistLocked()
+}
+
+// refreshLocked 文件变化时重新读取
+func (s *FileStateStore) refreshLocked() error {
+	data, changed, err := s.file.Read()
+	if err != nil {
+		return fmt.Errorf("read login state store: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	memory := NewMemoryStateStore()
+	if data != nil {
+		var states []*State
+		if err := json.Unmarshal(data, &states); err != nil {
+			return fmt.Errorf("decode login state store: %w", err)
+		}
+		for _, st := range states {
+			memory.states[st.State] = st
+		}
+	}
+	s.memory = memory
+	return nil
+}
+
+// persistLocked 写回缓存中的全部登录状态
+func (s *FileStateStore) persistLocked() error {
+	s.memory.mu.Lock()
+	states := make([]*State, 0, len(s.memory.states))
+	for _, st := range s.memory.states {
+		states = append(states, st)
+	}
+	data, err := json.Marshal(states)
+	s.memory.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.file.Write(data); err != nil {
+		return fmt.Errorf("write login state store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestState(state string, ttl time.Duration) *State {
+	return &State{
+		State:        state,
+		Provider:     "mock",
+		Nonce:        "nonce-" + state,
+		CodeVerifier: "verifier-" + state,
+		ExpiresAt:    time.Now().Add(ttl),
+	}
+}
+
+func TestStateStoreSingleUseAndExpiry(t *testing.T) {
+	stores := map[string]func(t *testing.T) StateStore{
+		"memory": func(t *testing.T) StateStore { return NewMemoryStateStore() },
+		"file": func(t *testing.T) StateStore {
+			s, err := NewFileStateStore(filepath.Join(t.TempDir(), "login_states.json"))
+			if err != nil {
+				t.Fatalf("NewFileStateStore: %v", err)
+			}
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newStore(t)
+			ctx := context.Background()
+
+			if err := s.Save(ctx, newTestState("s1", time.Minute)); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			st, err := s.Consume(ctx, "s1")
+			if err != nil {
+				t.Fatalf("Consume: %v", err)
+			}
+			if st.Provider != "mock" || st.Nonce != "nonce-s1" || st.CodeVerifier != "verifier-s1" {
+				t.Fatalf("Consume() = %+v", st)
+			}
+			if _, err := s.Consume(ctx, "s1"); !errors.Is(err, ErrStateNotFound) {
+				t.Fatalf("second Consume error = %v, want %v", err, ErrStateNotFound)
+			}
+
+			if err := s.Save(ctx, newTestState("expired", -time.Second)); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if _, err := s.Consume(ctx, "expired"); !errors.Is(err, ErrStateNotFound) {
+				t.Fatalf("Consume expired error = %v, want %v", err, ErrStateNotFound)
+			}
+		})
+	}
+}
+
+func TestFileStateStoreSharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "login_states.json")
+	a, err := NewFileStateStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStateStore: %v", err)
+	}
+	b, err := NewFileStateStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStateStore: %v", err)
+	}
+
+	if err := a.Save(ctx, newTestState("s1", time.Minute)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := b.Save(ctx, newTestState("s2", time.Minute)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// b 写入时保留 a 保存的状态
+	if _, err := b.Consume(ctx, "s1"); err != nil {
+		t.Fatalf("Consume on another replica: %v", err)
+	}
+	if _, err := a.Consume(ctx, "s1"); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("Consume replayed on another replica error = %v, want %v", err, ErrStateNotFound)
+	}
+	if _, err := a.Consume(ctx, "s2"); err != nil {
+		t.Fatalf("Consume state saved on another replica: %v", err)
+	}
+}
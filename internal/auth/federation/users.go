@@ -0,0 +1,142 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/identity"
+	"github.com/jason0730/claude-code-demo/internal/model"
+)
+
+var (
+	ErrUserNotFound = fmt.Errorf("federation: %w", identity.ErrUserNotFound)
+)
+
+// UserStore 即时创建的联合登录用户存储
+type UserStore interface {
+	// Upsert 创建或更新用户
+	Upsert(ctx context.Context, user *model.User) error
+
+	// Get 按 ID 查找用户，不存在时返回 ErrUserNotFound
+	Get(ctx context.Context, id string) (*model.User, error)
+}
+
+// MemoryUserStore 内存联合登录用户存储
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]*model.User
+}
+
+// NewMemoryUserStore 创建内存联合登录用户存储
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users: make(map[string]*model.User),
+	}
+}
+
+// Upsert 创建或更新用户
+func (s *MemoryUserStore) Upsert(ctx context.Context, user *model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.upsertLocked(user)
+	return nil
+}
+
+// Get 按 ID 查找用户，返回副本
+func (s *MemoryUserStore) Get(ctx context.Context, id string) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	found := *user
+	found.Roles = append([]string(nil), user.Roles...)
+	return &found, nil
+}
+
+// upsertLocked 保存用户副本，调用方需持有写锁
+func (s *MemoryUserStore) upsertLocked(user *model.User) {
+	stored := *user
+	stored.Roles = append([]string(nil), user.Roles...)
+	s.users[user.ID] = &stored
+}
+
+// FileUserStore 基于 JSON 文件持久化的联合登录用户存储，重启后刷新令牌仍能找到用户
+type FileUserStore struct {
+	*MemoryUserStore
+	path string
+}
+
+// NewFileUserStore 创建文件联合登录用户存储，文件存在时加载已有记录
+func NewFileUserStore(path string) (*FileUserStore, error) {
+	s := &FileUserStore{
+		MemoryUserStore: NewMemoryUserStore(),
+		path:            path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read federated user store: %w", err)
+	}
+
+	var users []*model.User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("decode federated user store: %w", err)
+	}
+	for _, user := range users {
+		s.users[user.ID] = user
+	}
+
+	return s, nil
+}
+
+// Upsert 创建或更新用户并持久化
+func (s *FileUserStore) Upsert(ctx context.Context, user *model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.upsertLocked(user)
+	return s.persistLocked()
+}
+
+// persistLocked 先写临时文件再重命名，避免写入中断导致文件损坏
+func (s *FileUserStore) persistLocked() error {
+	users := make([]*model.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+
+	data, err := json.Marshal(users)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write federated user store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write federated user store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write federated user store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("write federated user store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package identity
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// Chain 按顺序组合多个身份后端
+//
+// 认证时依次尝试各后端：用户不存在时继续下一个，第一个认识该用户的后端给出最终结果，
+// 避免同名用户在后续后端中绕过密码校验。后端不可用时无法确定它是否认识该用户，因此直接报告故障，
+// 不再尝试后续后端。
+type Chain struct {
+	authenticators []Authenticator
+	stores         []UserStore
+	listers        []UserLister
+}
+
+// NewChain 创建身份后端链，每个后端按其实现的接口参与认证、查找和列举
+func NewChain(backends ...Backend) *Chain {
+	c := &Chain{}
+	for _, b := range backends {
+		if a, ok := b.(Authenticator); ok {
+			c.authenticators = append(c.authenticators, a)
+		}
+		if s, ok := b.(UserStore); ok {
+			c.stores = append(c.stores, s)
+		}
+		if l, ok := b.(UserLister); ok {
+			c.listers = append(c.listers, l)
+		}
+	}
+	return c
+}
+
+// Name 返回后端名称
+func (c *Chain) Name() string {
+	return "chain"
+}
+
+// Authenticate 依次使用各后端认证，失败时返回 *Failure
+func (c *Chain) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	for _, a := range c.authenticators {
+		user, err := a.Authenticate(ctx, username, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrUserNotFound):
+			continue
+		case errors.Is(err, ErrUnavailable):
+			// 故障的后端可能认识该用户，继续尝试会让后续后端中的同名用户绕过它的密码校验
+			log.WithError(err).WithField("backend", a.Name()).Warn("identity backend unavailable")
+			return nil, &Failure{Backend: a.Name(), Err: err}
+		default:
+			return nil, &Failure{Backend: a.Name(), Err: err}
+		}
+	}
+
+	return nil, &Failure{Backend: c.Name(), Err: ErrUserNotFound}
+}
+
+// GetUser 依次在各后端中按 ID 查找用户，遇到不可用的后端时报告故障
+func (c *Chain) GetUser(ctx context.Context, id string) (*model.User, error) {
+	for _, s := range c.stores {
+		user, err := s.GetUser(ctx, id)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrUserNotFound):
+			continue
+		case errors.Is(err, ErrUnavailable):
+			// 与认证相同，不让后续后端中的同 ID 用户顶替故障后端中的用户
+			log.WithError(err).WithField("backend", s.Name()).Warn("identity backend unavailable")
+			return nil, &Failure{Backend: s.Name(), Err: err}
+		default:
+			return nil, &Failure{Backend: s.Name(), Err: err}
+		}
+	}
+
+	return nil, ErrUserNotFound
+}
+
+// ListUsers 合并所有可列举后端的用户，ID 重复时保留靠前后端的记录
+func (c *Chain) ListUsers(ctx context.Context) ([]*model.User, error) {
+	seen := make(map[string]bool)
+	users := []*model.User{}
+	for _, l := range c.listers {
+		list, err := l.ListUsers(ctx)
+		if err != nil {
+			return nil, &Failure{Backend: l.Name(), Err: err}
+		}
+		for _, user := range list {
+			if seen[user.ID] {
+				continue
+			}
+			seen[user.ID] = true
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
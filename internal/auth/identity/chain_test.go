@@ -0,0 +1,85 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jason0730/claude-code-demo/internal/model"
+)
+
+// fakeBackend 返回固定结果的认证和查找后端
+type fakeBackend struct {
+	name string
+	user *model.User
+	err  error
+}
+
+func (b *fakeBackend) Name() string {
+	return b.name
+}
+
+func (b *fakeBackend) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	return b.user, b.err
+}
+
+func (b *fakeBackend) GetUser(ctx context.Context, id string) (*model.User, error) {
+	return b.user, b.err
+}
+
+func TestChainUnavailableBackendStopsAuthentication(t *testing.T) {
+	chain := NewChain(
+		&fakeBackend{name: "ldap", err: ErrUnavailable},
+		&fakeBackend{name: "local", user: &model.User{ID: "imposter"}},
+	)
+
+	user, err := chain.Authenticate(context.Background(), "alice", "password")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Authenticate error = %v, want ErrUnavailable", err)
+	}
+	if user != nil {
+		t.Fatalf("Authenticate returned user %q from a later backend", user.ID)
+	}
+
+	var failure *Failure
+	if !errors.As(err, &failure) || failure.Backend != "ldap" {
+		t.Fatalf("failure = %v, want backend ldap", err)
+	}
+}
+
+func TestChainUnavailableBackendStopsLookup(t *testing.T) {
+	chain := NewChain(
+		&fakeBackend{name: "ldap", err: ErrUnavailable},
+		&fakeBackend{name: "local", user: &model.User{ID: "1"}},
+	)
+
+	if _, err := chain.GetUser(context.Background(), "1"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("GetUser error = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestChainSkipsBackendsWithoutUser(t *testing.T) {
+	chain := NewChain(
+		&fakeBackend{name: "local", err: ErrUserNotFound},
+		&fakeBackend{name: "ldap", user: &model.User{ID: "ldap-1"}},
+	)
+
+	user, err := chain.Authenticate(context.Background(), "alice", "password")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.ID != "ldap-1" {
+		t.Fatalf("user = %q, want ldap-1", user.ID)
+	}
+}
+
+func TestChainFirstBackendDecides(t *testing.T) {
+	chain := NewChain(
+		&fakeBackend{name: "local", err: ErrInvalidCredentials},
+		&fakeBackend{name: "file", user: &model.User{ID: "2"}},
+	)
+
+	if _, err := chain.Authenticate(context.Background(), "alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate error = %v, want ErrInvalidCredentials", err)
+	}
+}
@@ -0,0 +1,344 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/passhash"
+	"github.com/jason0730/claude-code-demo/internal/filestore"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// FileStore 基于 JSON 文件持久化的本地用户库，多个副本挂载同一文件时共享用户
+//
+// 修改持有锁文件读取最新内容、修改后写回，不同副本同时修改时不会覆盖彼此的修改；
+// 查询只在文件变化后重新读取，在任一副本上创建、修改用户或重置密码后在所有副本上立即生效。
+type FileStore struct {
+	mu     sync.Mutex
+	file   *filestore.File
+	hasher *passhash.Hasher
+	memory *MemoryStore // 文件内容的缓存
+}
+
+// NewFileStore 创建文件本地用户库，文件存在时加载已有用户
+//
+// 文件中仍为明文的密码会在加载时哈希并写回。
+func NewFileStore(path string, hasher *passhash.Hasher) (*FileStore, error) {
+	s := &FileStore{
+		file:   filestore.NewFile(path),
+		hasher: hasher,
+		memory: newMemoryStore("local", hasher),
+	}
+
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return nil, fmt.Errorf("lock user store: %w", err)
+	}
+	defer unlock()
+
+	data, _, err := s.file.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read user store: %w", err)
+	}
+	memory, migrated, err := s.decode(data, true)
+	if err != nil {
+		return nil, err
+	}
+	s.memory = memory
+
+	if migrated > 0 {
+		if err := s.persistLocked(); err != nil {
+			return nil, err
+		}
+		log.WithFields(log.Fields{
+			"path":  path,
+			"count": migrated,
+		}).Warn("hashed plaintext passwords in user store")
+	}
+
+	return s, nil
+}
+
+// Name 返回后端名称
+func (s *FileStore) Name() string {
+	return s.memory.Name()
+}
+
+// Authenticate 校验用户名和密码，必要时升级密码哈希并写回文件
+func (s *FileStore) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	memory, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+
+	record, rehash, err := memory.verify(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if rehash {
+		s.upgradeHash(record, password)
+	}
+	return record.toUser(), nil
+}
+
+// upgradeHash 按当前算法和参数重新哈希密码；失败只记录日志，不影响本次登录
+func (s *FileStore) upgradeHash(record *Record, password string) {
+	logger := hashUpgradeLogger(s.Name(), s.hasher, record)
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		logger.WithError(err).Warn("failed to rehash password")
+		return
+	}
+
+	err = s.modify(func(m *MemoryStore) error {
+		if !m.replaceHash(record, hash) {
+			return ErrStaleStamp
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrStaleStamp):
+		// 校验期间密码已在某个副本上被修改
+	case err != nil:
+		logger.WithError(err).Warn("failed to persist rehashed password")
+	default:
+		logger.Info("password hash upgraded")
+	}
+}
+
+// GetUser 按 ID 查找用户，包括其他副本写入的用户
+func (s *FileStore) GetUser(ctx context.Context, id string) (*model.User, error) {
+	memory, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	return memory.GetUser(ctx, id)
+}
+
+// ListUsers 列出全部用户
+func (s *FileStore) ListUsers(ctx context.Context) ([]*model.User, error) {
+	memory, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	return memory.ListUsers(ctx)
+}
+
+// FindByEmail 按邮箱地址查找用户
+func (s *FileStore) FindByEmail(ctx context.Context, email string) ([]*model.User, error) {
+	memory, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	return memory.FindByEmail(ctx, email)
+}
+
+// PasswordStamp 返回当前密码哈希的摘要
+func (s *FileStore) PasswordStamp(ctx context.Context, id string) (string, error) {
+	memory, err := s.current()
+	if err != nil {
+		return "", err
+	}
+	return memory.PasswordStamp(ctx, id)
+}
+
+// SaveUser 创建或更新用户并持久化
+func (s *FileStore) SaveUser(ctx context.Context, record *Record) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.SaveUser(ctx, record)
+	})
+}
+
+// ResetPassword 哈希并保存新密码，stamp 与文件中的当前密码不符时放弃修改
+func (s *FileStore) ResetPassword(ctx context.Context, id, stamp, password string) error {
+	// 哈希计算耗时较长，在锁外进行
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	return s.modify(func(m *MemoryStore) error {
+		return m.setPassword(id, stamp, hash)
+	})
+}
+
+// VerifyEmail 将当前邮箱标记为已验证并持久化
+func (s *FileStore) VerifyEmail(ctx context.Context, id, email string) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.VerifyEmail(ctx, id, email)
+	})
+}
+
+// current 文件变化时重新读取，返回最新的缓存
+func (s *FileStore) current() (*MemoryStore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s.memory, nil
+}
+
+// modify 持有锁文件读取最新内容，应用修改后写回；fn 返回错误时不写回
+func (s *FileStore) modify(fn func(*MemoryStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return fmt.Errorf("lock user store: %w", err)
+	}
+	defer unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return err
+	}
+	// 在副本上修改，fn 或写回失败时缓存保持与文件一致
+	previous := s.memory
+	s.memory = previous.clone()
+	if err := fn(s.memory); err != nil {
+		s.memory = previous
+		return err
+	}
+	if err := s.persistLocked(); err != nil {
+		s.memory = previous
+		return err
+	}
+	return nil
+}
+
+// refreshLocked 文件变化时重新读取
+func (s *FileStore) refreshLocked() error {
+	data, changed, err := s.file.Read()
+	if err != nil {
+		return fmt.Errorf("read user store: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	memory, _, err := s.decode(data, false)
+	if err != nil {
+		return err
+	}
+	s.memory = memory
+	return nil
+}
+
+// decode 解析用户文件；migrate 为 true 时哈希仍为明文的密码，返回哈希的数量
+func (s *FileStore) decode(data []byte, migrate bool) (*MemoryStore, int, error) {
+	memory := newMemoryStore("local", s.hasher)
+	if data == nil {
+		return memory, 0, nil
+	}
+
+	var records []*Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, 0, fmt.Errorf("decode user store: %w", err)
+	}
+
+	migrated := 0
+	for _, record := range records {
+		if migrate && !passhash.IsHash(record.Password) {
+			hash, err := s.hasher.Hash(record.Password)
+			if err != nil {
+				return nil, 0, fmt.Errorf("user store %s: %s: %w", s.file.Path(), record.Username, err)
+			}
+			record.Password = hash
+			migrated++
+		}
+		if err := memory.saveLocked(record); err != nil {
+			return nil, 0, fmt.Errorf("user store %s: %s: %w", s.file.Path(), record.Username, err)
+		}
+	}
+	return memory, migrated, nil
+}
+
+// persistLocked 写回缓存中的全部用户
+func (s *FileStore) persistLocked() error {
+	s.memory.mu.RLock()
+	records := make([]*Record, 0, len(s.memory.records))
+	for _, record := range s.memory.records {
+		records = append(records, record)
+	}
+	data, err := json.Marshal(records)
+	s.memory.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.file.Write(data); err != nil {
+		return fmt.Errorf("write user store: %w", err)
+	}
+	return nil
+}
+
+// StaticStore 启动时从 JSON 文件加载的只读用户列表
+type StaticStore struct {
+	store *MemoryStore
+}
+
+// LoadStaticStore 从 JSON 文件加载只读用户列表
+//
+// 密码必须是 argon2id 或 bcrypt 哈希；文件只读，过时的哈希不会在登录时升级。
+func LoadStaticStore(path string, hasher *passhash.Hasher) (*StaticStore, error) {
+	records, err := readRecords(path)
+	if err != nil {
+		return nil, err
+	}
+
+	store := newMemoryStore("file", hasher)
+	for _, record := range records {
+		if record.ID == "" || record.Username == "" {
+			return nil, fmt.Errorf("users file %s: id and username are required", path)
+		}
+		if !passhash.IsHash(record.Password) {
+			return nil, fmt.Errorf("users file %s: %s: password must be an argon2id or bcrypt hash", path, record.Username)
+		}
+		if err := store.saveLocked(record); err != nil {
+			return nil, fmt.Errorf("users file %s: %s: %w", path, record.Username, err)
+		}
+	}
+
+	return &StaticStore{store: store}, nil
+}
+
+// Name 返回后端名称
+func (s *StaticStore) Name() string {
+	return s.store.Name()
+}
+
+// Authenticate 校验用户名和密码
+func (s *StaticStore) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	return s.store.Authenticate(ctx, username, password)
+}
+
+// GetUser 按 ID 查找用户
+func (s *StaticStore) GetUser(ctx context.Context, id string) (*model.User, error) {
+	return s.store.GetUser(ctx, id)
+}
+
+// ListUsers 列出全部用户
+func (s *StaticStore) ListUsers(ctx context.Context) ([]*model.User, error) {
+	return s.store.ListUsers(ctx)
+}
+
+// readRecords 读取 JSON 用户记录数组
+func readRecords(path string) ([]*Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read users file: %w", err)
+	}
+
+	var records []*Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("decode users file %s: %w", path, err)
+	}
+	return records, nil
+}
@@ -0,0 +1,219 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/passhash"
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+// newTestHasher 创建开销最低的 argon2id 哈希器，iterations 不同时已有哈希需要升级
+func newTestHasher(t *testing.T, iterations uint32) *passhash.Hasher {
+	t.Helper()
+
+	h, err := passhash.NewHasher(&config.PasswordConfig{
+		Algorithm:         passhash.AlgorithmArgon2id,
+		Argon2Memory:      64,
+		Argon2Iterations:  iterations,
+		Argon2Parallelism: 1,
+	})
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	return h
+}
+
+// newTestRecord 创建带哈希密码的用户记录
+func newTestRecord(t *testing.T, h *passhash.Hasher, id, username, password string) *Record {
+	t.Helper()
+
+	hash, err := h.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return &Record{
+		ID:        id,
+		Username:  username,
+		Email:     username + "@example.com",
+		Password:  hash,
+		Roles:     []string{"viewer"},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+// newFileStores 创建挂载同一文件的两个用户库，模拟两个副本
+func newFileStores(t *testing.T, h *passhash.Hasher) (*FileStore, *FileStore, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "users.json")
+	a, err := NewFileStore(path, h)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	b, err := NewFileStore(path, h)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return a, b, path
+}
+
+func TestFileStoreSharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHasher(t, 1)
+	a, b, path := newFileStores(t, h)
+
+	// b 先读取一次，确认缓存会在另一副本写入后失效
+	if _, err := b.GetUser(ctx, "1"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("GetUser() error = %v, want %v", err, ErrUserNotFound)
+	}
+
+	if err := a.SaveUser(ctx, newTestRecord(t, h, "1", "alice", "old-password")); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+	if user, err := b.Authenticate(ctx, "alice", "old-password"); err != nil || user.ID != "1" {
+		t.Fatalf("Authenticate() on another replica = %v, %v", user, err)
+	}
+	// 用户名唯一性跨副本检查
+	if err := b.SaveUser(ctx, newTestRecord(t, h, "2", "alice", "pw")); !errors.Is(err, ErrUserExists) {
+		t.Fatalf("SaveUser() with a username taken on another replica error = %v, want %v", err, ErrUserExists)
+	}
+
+	// 在 b 上重置密码后，a 立即拒绝旧密码
+	stamp, err := a.PasswordStamp(ctx, "1")
+	if err != nil {
+		t.Fatalf("PasswordStamp: %v", err)
+	}
+	if err := b.ResetPassword(ctx, "1", stamp, "new-password"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if _, err := a.Authenticate(ctx, "alice", "old-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate() with the old password error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := a.Authenticate(ctx, "alice", "new-password"); err != nil {
+		t.Fatalf("Authenticate() with the new password: %v", err)
+	}
+	// 重置链接只能使用一次，即使落在另一个副本
+	if err := a.ResetPassword(ctx, "1", stamp, "other-password"); !errors.Is(err, ErrStaleStamp) {
+		t.Fatalf("ResetPassword() with a used stamp error = %v, want %v", err, ErrStaleStamp)
+	}
+
+	if err := a.VerifyEmail(ctx, "1", "alice@example.com"); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if users, err := b.FindByEmail(ctx, "ALICE@example.com"); err != nil || len(users) != 1 || !users[0].EmailVerified {
+		t.Fatalf("FindByEmail() on another replica = %v, %v", users, err)
+	}
+
+	// 重启后从文件恢复
+	c, err := NewFileStore(path, h)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if _, err := c.Authenticate(ctx, "alice", "new-password"); err != nil {
+		t.Fatalf("Authenticate() after restart: %v", err)
+	}
+}
+
+func TestFileStoreConcurrentSaveAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHasher(t, 1)
+	a, b, _ := newFileStores(t, h)
+
+	// 两个副本同时创建不同的用户，所有用户都应保留
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		for j, s := range []*FileStore{a, b} {
+			record := newTestRecord(t, h, fmt.Sprintf("%d-%d", j, i), fmt.Sprintf("user-%d-%d", j, i), "pw")
+			wg.Add(1)
+			go func(s *FileStore, record *Record) {
+				defer wg.Done()
+				if err := s.SaveUser(ctx, record); err != nil {
+					t.Errorf("SaveUser(%s): %v", record.Username, err)
+				}
+			}(s, record)
+		}
+	}
+	wg.Wait()
+
+	users, err := a.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if len(users) != 2*n {
+		t.Fatalf("ListUsers() returned %d users, want %d", len(users), 2*n)
+	}
+}
+
+func TestFileStoreHashesPlaintextPasswords(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.json")
+	data := `[{"id":"1","username":"alice","password":"plaintext","roles":["viewer"]}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	s, err := NewFileStore(path, newTestHasher(t, 1))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if strings.Contains(string(written), "plaintext") || !strings.Contains(string(written), "$argon2id$") {
+		t.Fatalf("store file = %s, want the password hashed", written)
+	}
+	if _, err := s.Authenticate(ctx, "alice", "plaintext"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+}
+
+func TestFileStoreUpgradesHashAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	old := newTestHasher(t, 1)
+	a, _, path := newFileStores(t, old)
+	if err := a.SaveUser(ctx, newTestRecord(t, old, "1", "alice", "pw")); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+
+	// 按新参数启动的副本登录后升级哈希并写回文件
+	upgraded, err := NewFileStore(path, newTestHasher(t, 2))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if _, err := upgraded.Authenticate(ctx, "alice", "pw"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.Contains(string(written), "t=2") {
+		t.Fatalf("store file = %s, want the hash upgraded", written)
+	}
+
+	// 其他副本读取升级后的哈希，密码仍然有效
+	if _, err := a.Authenticate(ctx, "alice", "pw"); err != nil {
+		t.Fatalf("Authenticate() after upgrade: %v", err)
+	}
+}
+
+func TestNewFileStoreRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := NewFileStore(path, newTestHasher(t, 1)); err == nil {
+		t.Fatal("NewFileStore() accepted a corrupt file")
+	}
+}
@@ -0,0 +1,89 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jason0730/claude-code-demo/internal/model"
+)
+
+// 认证失败原因，仅用于日志和内部判断，客户端统一收到 401
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrNoRoles            = errors.New("user has no roles")
+	ErrUnavailable        = errors.New("identity backend unavailable")
+)
+
+// Backend 身份后端
+type Backend interface {
+	// Name 后端名称，用于日志
+	Name() string
+}
+
+// Authenticator 用户名密码认证后端
+//
+// 用户不存在时返回 ErrUserNotFound，认证链会继续尝试下一个后端；
+// 其他错误表示该后端认识此用户但拒绝了认证。
+type Authenticator interface {
+	Backend
+	Authenticate(ctx context.Context, username, password string) (*model.User, error)
+}
+
+// UserStore 按 ID 查找用户的后端，用户不存在时返回 ErrUserNotFound
+type UserStore interface {
+	Backend
+	GetUser(ctx context.Context, id string) (*model.User, error)
+}
+
+// UserLister 可以列出全部用户的后端
+type UserLister interface {
+	Backend
+	ListUsers(ctx context.Context) ([]*model.User, error)
+}
+
+// Directory 可按 ID 查找并列出用户的后端
+type Directory interface {
+	UserStore
+	UserLister
+}
+
+// Accounts 支持自助找回密码和邮箱验证的用户库
+type Accounts interface {
+	// FindByEmail 按邮箱地址查找用户，不区分大小写；多个账户可以共用一个地址
+	FindByEmail(ctx context.Context, email string) ([]*model.User, error)
+
+	// PasswordStamp 返回当前密码哈希的摘要，密码修改后随之改变，用户不存在时返回 ErrUserNotFound
+	PasswordStamp(ctx context.Context, id string) (string, error)
+
+	// ResetPassword 设置新密码；stamp 与当前密码不符（令牌签发后密码已修改）时返回 ErrStaleStamp
+	ResetPassword(ctx context.Context, id, stamp, password string) error
+
+	// VerifyEmail 将邮箱标记为已验证；用户当前邮箱已不是 email 时返回 ErrEmailChanged
+	VerifyEmail(ctx context.Context, id, email string) error
+}
+
+// Store 可写的本地用户库
+type Store interface {
+	Authenticator
+	Directory
+	Accounts
+	SaveUser(ctx context.Context, record *Record) error
+}
+
+// Failure 认证失败详情，记录由哪个后端以什么原因拒绝
+type Failure struct {
+	Backend string
+	Err     error
+}
+
+// Error 实现 error 接口
+func (f *Failure) Error() string {
+	return fmt.Sprintf("%s: %v", f.Backend, f.Err)
+}
+
+// Unwrap 支持 errors.Is 判断失败原因
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
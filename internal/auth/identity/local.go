@@ -0,0 +1,315 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/passhash"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrUserExists   = errors.New("username already exists")
+	ErrStaleStamp   = errors.New("password changed since token was issued")
+	ErrEmailChanged = errors.New("email changed since token was issued")
+)
+
+// Record 带密码的用户记录，用于本地存储和用户文件
+type Record struct {
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified,omitempty"` // 修改邮箱后自动清除
+	Password      string    `json:"password"`                 // PHC 格式的密码哈希
+	Roles         []string  `json:"roles"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// toUser 转换为不含密码的用户模型
+func (r *Record) toUser() *model.User {
+	return &model.User{
+		ID:            r.ID,
+		Username:      r.Username,
+		Email:         r.Email,
+		EmailVerified: r.EmailVerified,
+		Roles:         append([]string(nil), r.Roles...),
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+	}
+}
+
+// MemoryStore 内存本地用户库
+type MemoryStore struct {
+	name       string
+	hasher     *passhash.Hasher
+	mu         sync.RWMutex
+	records    map[string]*Record // 按 ID 索引
+	byUsername map[string]string  // username -> ID
+
+	// rehash 为 true 时登录成功后将过时的哈希升级为当前算法和参数
+	rehash bool
+}
+
+// NewMemoryStore 创建内存本地用户库
+func NewMemoryStore(hasher *passhash.Hasher) *MemoryStore {
+	s := newMemoryStore("local", hasher)
+	s.rehash = true
+	return s
+}
+
+// newMemoryStore 创建指定名称的内存用户库
+func newMemoryStore(name string, hasher *passhash.Hasher) *MemoryStore {
+	return &MemoryStore{
+		name:       name,
+		hasher:     hasher,
+		records:    make(map[string]*Record),
+		byUsername: make(map[string]string),
+	}
+}
+
+// Name 返回后端名称
+func (s *MemoryStore) Name() string {
+	return s.name
+}
+
+// Authenticate 校验用户名和密码，必要时升级密码哈希
+func (s *MemoryStore) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	record, rehash, err := s.verify(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if rehash && s.rehash {
+		s.upgradeHash(record, password)
+	}
+	return record.toUser(), nil
+}
+
+// verify 校验用户名和密码，返回记录副本以及哈希是否需要按当前配置升级
+func (s *MemoryStore) verify(username, password string) (*Record, bool, error) {
+	// 哈希计算耗时较长，在锁外进行
+	s.mu.RLock()
+	var record Record
+	id, ok := s.byUsername[username]
+	if ok {
+		record = *s.records[id]
+	}
+	s.mu.RUnlock()
+
+	if !ok {
+		// 用户不存在时同样执行一次哈希校验，避免通过响应时间枚举用户名
+		s.hasher.VerifyDummy(password)
+		return nil, false, ErrUserNotFound
+	}
+
+	rehash, err := s.hasher.Verify(password, record.Password)
+	if err != nil {
+		if errors.Is(err, passhash.ErrMismatch) {
+			return nil, false, ErrInvalidCredentials
+		}
+		return nil, false, err
+	}
+	if len(record.Roles) == 0 {
+		return nil, false, ErrNoRoles
+	}
+	return &record, rehash, nil
+}
+
+// upgradeHash 按当前算法和参数重新哈希密码；失败只记录日志，不影响本次登录
+func (s *MemoryStore) upgradeHash(record *Record, password string) {
+	logger := hashUpgradeLogger(s.name, s.hasher, record)
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		logger.WithError(err).Warn("failed to rehash password")
+		return
+	}
+	if s.replaceHash(record, hash) {
+		logger.Info("password hash upgraded")
+	}
+}
+
+// replaceHash 将校验时读到的哈希替换为新哈希；校验期间密码已被修改时放弃并返回 false
+func (s *MemoryStore) replaceHash(record *Record, hash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.records[record.ID]
+	if !ok || current.Password != record.Password {
+		return false
+	}
+	current.Password = hash
+	return true
+}
+
+// hashUpgradeLogger 返回记录哈希升级结果的日志字段
+func hashUpgradeLogger(backend string, hasher *passhash.Hasher, record *Record) *log.Entry {
+	return log.WithFields(log.Fields{
+		"backend":   backend,
+		"user_id":   record.ID,
+		"algorithm": hasher.Algorithm(),
+	})
+}
+
+// GetUser 按 ID 查找用户
+func (s *MemoryStore) GetUser(ctx context.Context, id string) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return record.toUser(), nil
+}
+
+// ListUsers 列出全部用户，按 ID 排序
+func (s *MemoryStore) ListUsers(ctx context.Context) ([]*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]*model.User, 0, len(s.records))
+	for _, record := range s.records {
+		users = append(users, record.toUser())
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// SaveUser 创建或更新用户，用户名不能与其他用户重复
+func (s *MemoryStore) SaveUser(ctx context.Context, record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveLocked(record)
+}
+
+// saveLocked 保存用户记录副本，调用方需持有写锁
+func (s *MemoryStore) saveLocked(record *Record) error {
+	if !passhash.IsHash(record.Password) {
+		return passhash.ErrInvalidHash
+	}
+	if id, ok := s.byUsername[record.Username]; ok && id != record.ID {
+		return ErrUserExists
+	}
+	existing, ok := s.records[record.ID]
+	if ok && existing.Username != record.Username {
+		delete(s.byUsername, existing.Username)
+	}
+
+	stored := *record
+	stored.Roles = append([]string(nil), record.Roles...)
+	if ok && !strings.EqualFold(existing.Email, record.Email) {
+		stored.EmailVerified = false
+	}
+	s.records[record.ID] = &stored
+	s.byUsername[record.Username] = record.ID
+	return nil
+}
+
+// FindByEmail 按邮箱地址查找用户，不区分大小写，按 ID 排序
+func (s *MemoryStore) FindByEmail(ctx context.Context, email string) ([]*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []*model.User
+	for _, record := range s.records {
+		if record.Email != "" && strings.EqualFold(record.Email, email) {
+			users = append(users, record.toUser())
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// PasswordStamp 返回当前密码哈希的摘要
+func (s *MemoryStore) PasswordStamp(ctx context.Context, id string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return passwordStamp(record.Password), nil
+}
+
+// ResetPassword 哈希并保存新密码，stamp 不符时放弃修改
+func (s *MemoryStore) ResetPassword(ctx context.Context, id, stamp, password string) error {
+	// 哈希计算耗时较长，在锁外进行
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	return s.setPassword(id, stamp, hash)
+}
+
+// setPassword 保存已哈希的新密码，stamp 不符时放弃修改
+func (s *MemoryStore) setPassword(id, stamp, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if passwordStamp(record.Password) != stamp {
+		return ErrStaleStamp
+	}
+
+	record.Password = hash
+	record.UpdatedAt = time.Now()
+	return nil
+}
+
+// VerifyEmail 将当前邮箱标记为已验证，已验证时直接返回
+func (s *MemoryStore) VerifyEmail(ctx context.Context, id, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if !strings.EqualFold(record.Email, email) {
+		return ErrEmailChanged
+	}
+	if record.EmailVerified {
+		return nil
+	}
+
+	record.EmailVerified = true
+	record.UpdatedAt = time.Now()
+	return nil
+}
+
+// clone 返回用户库的副本，记录本身按值复制
+func (s *MemoryStore) clone() *MemoryStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c := newMemoryStore(s.name, s.hasher)
+	c.rehash = s.rehash
+	for id, record := range s.records {
+		stored := *record
+		stored.Roles = append([]string(nil), record.Roles...)
+		c.records[id] = &stored
+	}
+	for username, id := range s.byUsername {
+		c.byUsername[username] = id
+	}
+	return c
+}
+
+// passwordStamp 计算密码哈希的摘要，不泄露哈希本身
+func passwordStamp(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
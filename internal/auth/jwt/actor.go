@@ -0,0 +1,24 @@
+package jwt
+
+// Actor 令牌交换签发的委托令牌中的行为方声明（act，RFC 8693 第 4.1 节）
+//
+// 令牌主体（sub）是被代表的用户，Actor 是实际发起请求的一方；
+// 再次交换时原有的行为方嵌套在新行为方的 Actor 中，形成完整的委托链。
+type Actor struct {
+	Subject  string `json:"sub"`
+	ClientID string `json:"client_id,omitempty"`
+	Actor    *Actor `json:"act,omitempty"`
+}
+
+// ActorSubject 返回当前行为方的主体，不是委托令牌时返回空字符串
+func (c *CustomClaims) ActorSubject() string {
+	if c.Actor == nil {
+		return ""
+	}
+	return c.Actor.Subject
+}
+
+// IsDelegated 判断令牌是否由令牌交换签发、代表其他主体行事
+func (c *CustomClaims) IsDelegated() bool {
+	return c.Actor != nil
+}
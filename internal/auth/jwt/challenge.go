@@ -0,0 +1,53 @@
+package jwt
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// typeChallenge 登录质询令牌类型，不能作为访问令牌使用
+const typeChallenge = "challenge+jwt"
+
+// 质询用途
+const (
+	ChallengeMFA       = "mfa"            // 已通过密码认证，需要提交第二因素
+	ChallengeMFAEnroll = "mfa_enrollment" // 角色要求 MFA 但尚未登记，只能用于登记
+
+	ChallengeWebAuthnRegister = "webauthn_registration" // WebAuthn 注册仪式状态
+	ChallengeWebAuthnLogin    = "webauthn_login"        // WebAuthn 认证仪式状态
+)
+
+// ChallengeClaims 登录质询令牌声明，密码认证通过后用于完成第二因素；
+// 也用于在客户端保存 WebAuthn 仪式状态，服务端无需保存会话
+type ChallengeClaims struct {
+	Purpose     string   `json:"purpose"`
+	AuthMethods []string `json:"amr,omitempty"`       // 已完成的认证方式
+	Challenge   string   `json:"challenge,omitempty"` // WebAuthn 仪式的随机质询
+	jwt.RegisteredClaims
+}
+
+// GenerateChallengeToken 签发短期质询令牌；无密码登录的仪式令牌 userID 为空
+func (tm *TokenManager) GenerateChallengeToken(userID string, ttl time.Duration, claims ChallengeClaims) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Issuer:    "api-server",
+		Subject:   userID,
+		ID:        uuid.New().String(),
+	}
+	return tm.sign(&claims, typeChallenge)
+}
+
+// ValidateChallengeToken 验证质询令牌
+func (tm *TokenManager) ValidateChallengeToken(tokenString string) (*ChallengeClaims, error) {
+	claims := &ChallengeClaims{}
+	if err := tm.parse(tokenString, claims, typeChallenge); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
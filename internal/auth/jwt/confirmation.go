@@ -0,0 +1,26 @@
+package jwt
+
+// Confirmation 令牌的持有证明声明（cnf），令牌只能由持有对应密钥的客户端使用
+type Confirmation struct {
+	// X5TS256 客户端证书的 SHA-256 指纹（RFC 8705 证书绑定的访问令牌）
+	X5TS256 string `json:"x5t#S256,omitempty"`
+
+	// JKT DPoP 证明公钥的 JWK SHA-256 指纹（RFC 9449）
+	JKT string `json:"jkt,omitempty"`
+}
+
+// CertThumbprint 返回绑定的证书指纹，未绑定时返回空字符串
+func (c *Confirmation) CertThumbprint() string {
+	if c == nil {
+		return ""
+	}
+	return c.X5TS256
+}
+
+// KeyThumbprint 返回绑定的 DPoP 公钥指纹，未绑定时返回空字符串
+func (c *Confirmation) KeyThumbprint() string {
+	if c == nil {
+		return ""
+	}
+	return c.JKT
+}
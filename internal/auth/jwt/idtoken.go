@@ -0,0 +1,70 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jason0730/claude-code-demo/internal/model"
+)
+
+// typeIDToken ID 令牌类型；与访问令牌类型不同，ValidateToken 不接受 ID 令牌，
+// 收到 ID 令牌的依赖方不能用它调用 API（OIDC 客户端库不校验 typ）
+const typeIDToken = "id_token+jwt"
+
+// IDTokenClaims OpenID Connect ID 令牌声明
+type IDTokenClaims struct {
+	Nonce             string   `json:"nonce,omitempty"`
+	AuthTime          int64    `json:"auth_time,omitempty"`
+	AuthMethods       []string `json:"amr,omitempty"`
+	AccessTokenHash   string   `json:"at_hash,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	EmailVerified     *bool    `json:"email_verified,omitempty"`
+	Roles             []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateIDToken 为用户签发 ID 令牌，issuer 为 OIDC 发现文档中的签发者，受众为客户端
+//
+// accessToken 非空时写入 at_hash，哈希算法与 ID 令牌签名算法一致。
+func (tm *TokenManager) GenerateIDToken(user *model.User, issuer, clientID, accessToken string, claims IDTokenClaims) (string, error) {
+	key, err := tm.keys.active()
+	if err != nil {
+		return "", err
+	}
+
+	if accessToken != "" {
+		claims.AccessTokenHash = halfHash(key.method.Alg(), accessToken)
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   user.ID,
+		Audience:  jwt.ClaimStrings{clientID},
+		ExpiresAt: jwt.NewNumericDate(now.Add(tm.config.JWTExpiration)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	return signWithKey(key, claims, typeIDToken)
+}
+
+// halfHash 按签名算法的哈希函数计算左半部分哈希（OIDC Core 3.1.3.6）
+func halfHash(alg, value string) string {
+	var sum []byte
+	switch {
+	case strings.HasSuffix(alg, "384"):
+		h := sha512.Sum384([]byte(value))
+		sum = h[:]
+	case strings.HasSuffix(alg, "512"):
+		h := sha512.Sum512([]byte(value))
+		sum = h[:]
+	default:
+		h := sha256.Sum256([]byte(value))
+		sum = h[:]
+	}
+	return encodeSegment(sum[:len(sum)/2])
+}
@@ -0,0 +1,42 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/config"
+	"github.com/jason0730/claude-code-demo/internal/model"
+)
+
+// newTestManager 创建使用 HS256 的令牌管理器
+func newTestManager(t *testing.T) *TokenManager {
+	t.Helper()
+
+	tm, err := NewTokenManager(&config.AuthConfig{
+		JWTSecret:         "test-secret-with-enough-entropy-0123456789",
+		JWTExpiration:     15 * time.Minute,
+		RefreshExpiration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewTokenManager: %v", err)
+	}
+	return tm
+}
+
+func TestIDTokenRejectedAsAccessToken(t *testing.T) {
+	tm := newTestManager(t)
+	user := &model.User{ID: "1", Username: "admin", Roles: []string{"admin"}}
+
+	idToken, err := tm.GenerateIDToken(user, "https://issuer.example", "client", "", IDTokenClaims{Roles: user.Roles})
+	if err != nil {
+		t.Fatalf("GenerateIDToken: %v", err)
+	}
+
+	if _, err := tm.ValidateToken(idToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ValidateToken(id token) error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := tm.ValidateRefreshToken(idToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ValidateRefreshToken(id token) error = %v, want ErrInvalidToken", err)
+	}
+}
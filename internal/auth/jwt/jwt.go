@@ -1,138 +1,485 @@
 package jwt
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/jason0730/claude-code-demo/internal/config"
 	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrExpiredToken = errors.New("token has expired")
+	ErrInvalidToken          = errors.New("invalid token")
+	ErrExpiredToken          = errors.New("token has expired")
+	ErrSigningKeyUnavailable = errors.New("signing key not configured")
+	ErrRotationUnsupported   = errors.New("key rotation requires JWT_KEY_DIR")
 )
 
 // TokenManager JWT 令牌管理器
 type TokenManager struct {
 	config *config.AuthConfig
+	keys   *keySet
 }
 
 // NewTokenManager 创建新的令牌管理器
-func NewTokenManager(cfg *config.AuthConfig) *TokenManager {
-	return &TokenManager{
+//
+// 密钥来源按优先级依次为：JWTKeyDir 目录（支持热轮换）、JWTPrivateKeyPath 私钥、
+// 仅 JWTPublicKeyPath 公钥（只能验证令牌，供下游服务使用）、JWTSecret（HS256）。
+// 非对称密钥的算法由密钥类型决定：RSA → RS256，ECDSA → ES256/ES384/ES512，Ed25519 → EdDSA。
+func NewTokenManager(cfg *config.AuthConfig) (*TokenManager, error) {
+	tm := &TokenManager{
 		config: cfg,
+		keys:   newKeySet(maxDuration(cfg.JWTExpiration, cfg.RefreshExpiration)),
 	}
+
+	switch {
+	case cfg.JWTKeyDir != "":
+		keys, activeID, err := loadKeyDir(cfg.JWTKeyDir)
+		if err != nil {
+			return nil, err
+		}
+		tm.keys.replace(keys, activeID)
+
+	case cfg.JWTPrivateKeyPath != "":
+		signer, err := loadPrivateKey(cfg.JWTPrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.JWTPublicKeyPath != "" {
+			pub, err := loadPublicKey(cfg.JWTPublicKeyPath)
+			if err != nil {
+				return nil, err
+			}
+			if !publicKeysEqual(signer.Public(), pub) {
+				return nil, ErrKeyMismatch
+			}
+		}
+		key, err := newAsymmetricKey(signer, nil)
+		if err != nil {
+			return nil, err
+		}
+		tm.keys.add(key, true)
+
+	case cfg.JWTPublicKeyPath != "":
+		pub, err := loadPublicKey(cfg.JWTPublicKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		key, err := newAsymmetricKey(nil, pub)
+		if err != nil {
+			return nil, err
+		}
+		tm.keys.add(key, true)
+
+	default:
+		tm.keys.add(newHMACKey([]byte(cfg.JWTSecret)), true)
+		// 轮换 JWTSecret 后，旧密钥在保留期内继续用于验证
+		for _, secret := range cfg.JWTPreviousSecrets {
+			tm.keys.add(newHMACKey([]byte(secret)), false)
+		}
+	}
+
+	return tm, nil
+}
+
+// Algorithm 返回当前使用的签名算法
+func (tm *TokenManager) Algorithm() string {
+	for _, info := range tm.keys.infos() {
+		if info.Active {
+			return info.Algorithm
+		}
+	}
+	return ""
 }
 
-// CustomClaims JWT 自定义声明
+// AccessTokenTTL 返回访问令牌有效期
+func (tm *TokenManager) AccessTokenTTL() time.Duration {
+	return tm.config.JWTExpiration
+}
+
+// RefreshTokenTTL 返回刷新令牌有效期
+func (tm *TokenManager) RefreshTokenTTL() time.Duration {
+	return tm.config.RefreshExpiration
+}
+
+// JWKS 返回用于验证令牌的公钥集合
+func (tm *TokenManager) JWKS() JWKSet {
+	return tm.keys.publicKeys()
+}
+
+// Keys 返回所有签名密钥的元数据
+func (tm *TokenManager) Keys() []KeyInfo {
+	return tm.keys.infos()
+}
+
+// RotateKey 生成与当前活动密钥同类型的新密钥并立即启用
+//
+// 只支持 JWTKeyDir：新密钥写入目录，其他副本在下次重新加载时生效，重启后仍然有效。
+// 使用 JWTSecret 或单个密钥文件时新密钥只存在于当前进程，其他副本无法验证它签发的令牌，
+// 因此返回 ErrRotationUnsupported，应通过更换配置轮换。
+// 旧密钥在保留期内继续用于验证，已签发的令牌不会失效。
+func (tm *TokenManager) RotateKey() (KeyInfo, error) {
+	if tm.config.JWTKeyDir == "" {
+		return KeyInfo{}, ErrRotationUnsupported
+	}
+
+	current, err := tm.keys.active()
+	if err != nil {
+		return KeyInfo{}, err
+	}
+
+	key, signer, err := generateKey(current)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+
+	if signer == nil {
+		return KeyInfo{}, ErrRotationUnsupported
+	}
+	data, err := encodePrivateKey(signer)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	path := filepath.Join(tm.config.JWTKeyDir, key.id+".pem")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return KeyInfo{}, fmt.Errorf("write key file: %w", err)
+	}
+	key.source = path
+
+	tm.keys.add(key, true)
+
+	for _, info := range tm.keys.infos() {
+		if info.ID == key.id {
+			return info, nil
+		}
+	}
+	return KeyInfo{}, ErrSigningKeyUnavailable
+}
+
+// ReloadKeys 重新加载 JWTKeyDir 中的密钥，未配置目录时不做任何操作
+func (tm *TokenManager) ReloadKeys() error {
+	if tm.config.JWTKeyDir == "" {
+		return nil
+	}
+
+	keys, activeID, err := loadKeyDir(tm.config.JWTKeyDir)
+	if err != nil {
+		return err
+	}
+	tm.keys.replace(keys, activeID)
+	return nil
+}
+
+// WatchKeyDir 定期重新加载 JWTKeyDir，直到 ctx 取消
+func (tm *TokenManager) WatchKeyDir(ctx context.Context) {
+	if tm.config.JWTKeyDir == "" || tm.config.JWTKeyReloadInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(tm.config.JWTKeyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := tm.ReloadKeys(); err != nil {
+				log.WithError(err).Warn("failed to reload signing keys")
+			}
+		}
+	}
+}
+
+// 令牌类型（JWT 头部 typ），防止访问令牌与刷新令牌混用
+const (
+	typeAccess  = "at+jwt"
+	typeRefresh = "refresh+jwt"
+	typeLegacy  = "JWT" // 引入令牌类型前签发的访问令牌，只在配置的截止时间之前签发的才接受
+)
+
+// CustomClaims JWT 自定义声明，RegisteredClaims.ID（jti）用于吊销单个令牌
 type CustomClaims struct {
-	UserID   string   `json:"user_id"`
-	Username string   `json:"username"`
-	Email    string   `json:"email"`
-	Roles    []string `json:"roles"`
+	UserID       string        `json:"user_id"`
+	Username     string        `json:"username"`
+	Email        string        `json:"email"`
+	Roles        []string      `json:"roles"`
+	SessionID    string        `json:"sid,omitempty"` // 会话 ID，与刷新令牌家族 ID 相同
+	ClientID     string        `json:"client_id,omitempty"`
+	Scope        string        `json:"scope,omitempty"` // 空格分隔；非空时进一步限制角色授予的权限
+	AuthMethods  []string      `json:"amr,omitempty"`   // 登录时使用的认证方式（RFC 8176），如 pwd、otp
+	KeyID        string        `json:"-"`               // 通过个人访问令牌认证时的令牌 ID，不出现在 JWT 中
+	Certificate  bool          `json:"-"`               // 只凭客户端证书认证（未出示令牌），不出现在 JWT 中
+	Confirmation *Confirmation `json:"cnf,omitempty"`   // 绑定的持有证明，为空时为普通 Bearer 令牌
+	Actor        *Actor        `json:"act,omitempty"`   // 令牌交换签发时实际发起请求的一方
+	jwt.RegisteredClaims
+
+	// Raw 令牌中的全部声明（包括上面没有定义的自定义声明），解析令牌时填充，供访问策略使用；不会写入签发的令牌
+	Raw map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON 解析已定义的声明，并保留全部原始声明
+func (c *CustomClaims) UnmarshalJSON(data []byte) error {
+	type plain CustomClaims
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &c.Raw)
+}
+
+// IsService 判断令牌主体是否为服务（客户端凭证授权签发的令牌）
+func (c *CustomClaims) IsService() bool {
+	return c.ClientID != "" && c.ClientID == c.Subject
+}
+
+// IsAPIKey 判断请求是否使用个人访问令牌认证
+func (c *CustomClaims) IsAPIKey() bool {
+	return c.KeyID != ""
+}
+
+// IsCertificate 判断请求是否只凭客户端证书认证；绑定证书的令牌不算
+func (c *CustomClaims) IsCertificate() bool {
+	return c.Certificate
+}
+
+// RefreshClaims 刷新令牌声明，ID（jti）唯一标识令牌，FamilyID 标识同一次登录派生的令牌链
+type RefreshClaims struct {
+	FamilyID     string        `json:"fid"`
+	ClientID     string        `json:"client_id,omitempty"`
+	Scope        string        `json:"scope,omitempty"`
+	AuthMethods  []string      `json:"amr,omitempty"`
+	Confirmation *Confirmation `json:"cnf,omitempty"` // 刷新时必须出示相同的持有证明
 	jwt.RegisteredClaims
 }
 
+// TokenOptions 令牌签发选项，刷新时从原刷新令牌继承
+type TokenOptions struct {
+	FamilyID     string        // 为空时开始新的令牌家族（登录），否则在原家族中轮换（刷新）
+	ClientID     string        // 通过 OAuth 授权签发时的客户端
+	Scope        string        // 授予的 scope
+	AuthMethods  []string      // 登录时使用的认证方式，刷新时沿用
+	Confirmation *Confirmation // 令牌绑定的持有证明，为空时签发普通 Bearer 令牌
+}
+
+// TokenPair 一次签发的访问令牌和刷新令牌
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // 访问令牌有效期（秒）
+	Refresh      *RefreshClaims
+}
+
 // GenerateToken 生成访问令牌和刷新令牌
-func (tm *TokenManager) GenerateToken(user *model.User) (accessToken, refreshToken string, err error) {
+func (tm *TokenManager) GenerateToken(user *model.User, opts TokenOptions) (*TokenPair, error) {
+	if opts.FamilyID == "" {
+		opts.FamilyID = uuid.New().String()
+	}
+
 	// 生成访问令牌
-	accessToken, err = tm.generateAccessToken(user)
+	accessToken, err := tm.generateAccessToken(user, opts)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	// 生成刷新令牌
-	refreshToken, err = tm.generateRefreshToken(user)
+	refreshToken, refreshClaims, err := tm.generateRefreshToken(user, opts)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return accessToken, refreshToken, nil
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(tm.config.JWTExpiration.Seconds()),
+		Refresh:      refreshClaims,
+	}, nil
+}
+
+// GenerateServiceToken 为客户端凭证授权签发访问令牌，主体为客户端本身，不签发刷新令牌
+func (tm *TokenManager) GenerateServiceToken(clientID string, roles []string, scope string, cnf *Confirmation) (string, error) {
+	return tm.GenerateAccessToken(&CustomClaims{
+		UserID:       clientID,
+		Username:     clientID,
+		Roles:        roles,
+		ClientID:     clientID,
+		Scope:        scope,
+		Confirmation: cnf,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: clientID,
+		},
+	})
+}
+
+// GenerateAccessToken 补全时间、签发者和 jti 等标准声明后签发访问令牌
+func (tm *TokenManager) GenerateAccessToken(claims *CustomClaims) (string, error) {
+	now := time.Now()
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(tm.config.JWTExpiration))
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+	claims.Issuer = "api-server"
+	claims.ID = uuid.New().String()
+
+	return tm.sign(claims, typeAccess)
 }
 
 // generateAccessToken 生成访问令牌
-func (tm *TokenManager) generateAccessToken(user *model.User) (string, error) {
+func (tm *TokenManager) generateAccessToken(user *model.User, opts TokenOptions) (string, error) {
+	return tm.GenerateAccessToken(&CustomClaims{
+		UserID:       user.ID,
+		Username:     user.Username,
+		Email:        user.Email,
+		Roles:        user.Roles,
+		SessionID:    opts.FamilyID,
+		ClientID:     opts.ClientID,
+		Scope:        opts.Scope,
+		AuthMethods:  opts.AuthMethods,
+		Confirmation: opts.Confirmation,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: user.ID,
+		},
+	})
+}
+
+// generateRefreshToken 生成刷新令牌
+func (tm *TokenManager) generateRefreshToken(user *model.User, opts TokenOptions) (string, *RefreshClaims, error) {
 	now := time.Now()
-	claims := CustomClaims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Roles:    user.Roles,
+	claims := &RefreshClaims{
+		FamilyID:     opts.FamilyID,
+		ClientID:     opts.ClientID,
+		Scope:        opts.Scope,
+		AuthMethods:  opts.AuthMethods,
+		Confirmation: opts.Confirmation,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(tm.config.JWTExpiration)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tm.config.RefreshExpiration)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "api-server",
 			Subject:   user.ID,
+			ID:        uuid.New().String(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(tm.config.JWTSecret))
+	token, err := tm.sign(claims, typeRefresh)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
 }
 
-// generateRefreshToken 生成刷新令牌
-func (tm *TokenManager) generateRefreshToken(user *model.User) (string, error) {
-	now := time.Now()
-	claims := jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(now.Add(tm.config.RefreshExpiration)),
-		IssuedAt:  jwt.NewNumericDate(now),
-		NotBefore: jwt.NewNumericDate(now),
-		Issuer:    "api-server",
-		Subject:   user.ID,
+// sign 使用活动密钥签发令牌，并在头部写入 kid 和令牌类型
+func (tm *TokenManager) sign(claims jwt.Claims, typ string) (string, error) {
+	key, err := tm.keys.active()
+	if err != nil {
+		return "", err
 	}
+	return signWithKey(key, claims, typ)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(tm.config.JWTSecret))
+// signWithKey 使用指定密钥签发令牌
+func signWithKey(key *signingKey, claims jwt.Claims, typ string) (string, error) {
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	token.Header["typ"] = typ
+	return token.SignedString(key.private)
 }
 
-// ValidateToken 验证令牌
-func (tm *TokenManager) ValidateToken(tokenString string) (*CustomClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// 验证签名方法
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(tm.config.JWTSecret), nil
-	})
+// keyFunc 按 kid 选择验证密钥，并拒绝与密钥不一致的签名算法
+func (tm *TokenManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := tm.keys.lookup(kid)
+	if !ok || token.Method.Alg() != key.method.Alg() {
+		return nil, ErrInvalidToken
+	}
+	return key.public, nil
+}
 
+// parse 解析并验证令牌，要求头部 typ 属于 types 之一
+func (tm *TokenManager) parse(tokenString string, claims jwt.Claims, types ...string) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, tm.keyFunc)
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, ErrExpiredToken
+			return ErrExpiredToken
 		}
-		return nil, ErrInvalidToken
+		return ErrInvalidToken
+	}
+	if !token.Valid {
+		return ErrInvalidToken
 	}
 
-	claims, ok := token.Claims.(*CustomClaims)
-	if !ok || !token.Valid {
-		return nil, ErrInvalidToken
+	typ, _ := token.Header["typ"].(string)
+	for _, t := range types {
+		if typ == t {
+			return nil
+		}
+	}
+	return ErrInvalidToken
+}
+
+// ValidateToken 验证访问令牌
+func (tm *TokenManager) ValidateToken(tokenString string) (*CustomClaims, error) {
+	claims := &CustomClaims{}
+	err := tm.parse(tokenString, claims, typeAccess)
+	if errors.Is(err, ErrInvalidToken) && !tm.config.JWTLegacyTypeCutoff.IsZero() {
+		claims = &CustomClaims{}
+		err = tm.validateLegacy(tokenString, claims)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	return claims, nil
 }
 
+// validateLegacy 验证升级前签发的 typ=JWT 访问令牌：必须在 JWTLegacyTypeCutoff 之前签发且带有 user_id，
+// 截止时间之后签发的 typ=JWT 令牌（如其他用途的令牌）一律拒绝
+func (tm *TokenManager) validateLegacy(tokenString string, claims *CustomClaims) error {
+	if err := tm.parse(tokenString, claims, typeLegacy); err != nil {
+		return err
+	}
+	if claims.IssuedAt == nil || !claims.IssuedAt.Before(tm.config.JWTLegacyTypeCutoff) || claims.UserID == "" {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
 // ValidateRefreshToken 验证刷新令牌
-func (tm *TokenManager) ValidateRefreshToken(tokenString string) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(tm.config.JWTSecret), nil
-	})
+func (tm *TokenManager) ValidateRefreshToken(tokenString string) (*RefreshClaims, error) {
+	claims := &RefreshClaims{}
+	if err := tm.parse(tokenString, claims, typeRefresh); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return "", ErrExpiredToken
-		}
-		return "", ErrInvalidToken
+	return claims, nil
+}
+
+// TimeOf 返回 NumericDate 对应的时间，声明缺失时返回零值
+func TimeOf(d *jwt.NumericDate) time.Time {
+	if d == nil {
+		return time.Time{}
 	}
+	return d.Time
+}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok || !token.Valid {
-		return "", ErrInvalidToken
+// UnixOf 返回 NumericDate 对应的 Unix 时间戳，声明缺失时返回 0
+func UnixOf(d *jwt.NumericDate) int64 {
+	if d == nil {
+		return 0
 	}
+	return d.Unix()
+}
 
-	return claims.Subject, nil
+// maxDuration 返回两个时长中较大的一个
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
 }
@@ -0,0 +1,216 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+// signLegacy 以升级前的 typ=JWT 签发访问令牌
+func signLegacy(t *testing.T, tm *TokenManager, userID string, issuedAt time.Time) string {
+	t.Helper()
+
+	key, err := tm.keys.active()
+	if err != nil {
+		t.Fatalf("active key: %v", err)
+	}
+	token, err := signWithKey(key, &CustomClaims{
+		UserID: userID,
+		Roles:  []string{"admin"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}, typeLegacy)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return token
+}
+
+func TestValidateTokenLegacyType(t *testing.T) {
+	cutoff := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name     string
+		cutoff   time.Time
+		userID   string
+		issuedAt time.Time
+		wantErr  bool
+	}{
+		{name: "no cutoff configured", userID: "1", issuedAt: cutoff.Add(-time.Minute), wantErr: true},
+		{name: "issued before cutoff", cutoff: cutoff, userID: "1", issuedAt: cutoff.Add(-time.Minute)},
+		{name: "issued after cutoff", cutoff: cutoff, userID: "1", issuedAt: cutoff.Add(time.Second), wantErr: true},
+		{name: "missing user_id", cutoff: cutoff, issuedAt: cutoff.Add(-time.Minute), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestManager(t)
+			tm.config.JWTLegacyTypeCutoff = tt.cutoff
+
+			_, err := tm.ValidateToken(signLegacy(t, tm, tt.userID, tt.issuedAt))
+			if tt.wantErr && !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("error = %v, want ErrInvalidToken", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestValidateTokenAccessType(t *testing.T) {
+	tm := newTestManager(t)
+
+	token, err := tm.GenerateServiceToken("svc", []string{"viewer"}, "", nil)
+	if err != nil {
+		t.Fatalf("GenerateServiceToken: %v", err)
+	}
+	claims, err := tm.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.ClientID != "svc" {
+		t.Fatalf("client_id = %q, want svc", claims.ClientID)
+	}
+}
+
+// newKeyDirManager 在新的密钥目录中写入一个 Ed25519 私钥，并创建使用该目录的令牌管理器
+func newKeyDirManager(t *testing.T) (*TokenManager, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	data, err := encodePrivateKey(priv)
+	if err != nil {
+		t.Fatalf("encode key: %v", err)
+	}
+	path := filepath.Join(dir, "initial.pem")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	// 早于轮换生成的密钥，保证按修改时间选出的活动密钥确定
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	return newDirManager(t, dir), dir
+}
+
+// newDirManager 创建使用已有密钥目录的令牌管理器，模拟另一个副本
+func newDirManager(t *testing.T, dir string) *TokenManager {
+	t.Helper()
+
+	tm, err := NewTokenManager(&config.AuthConfig{
+		JWTKeyDir:         dir,
+		JWTExpiration:     15 * time.Minute,
+		RefreshExpiration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewTokenManager: %v", err)
+	}
+	return tm
+}
+
+func TestRotateKeyRequiresKeyDir(t *testing.T) {
+	dir := t.TempDir()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	data, err := encodePrivateKey(priv)
+	if err != nil {
+		t.Fatalf("encode key: %v", err)
+	}
+	keyPath := filepath.Join(dir, "private.pem")
+	if err := os.WriteFile(keyPath, data, 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	fileManager, err := NewTokenManager(&config.AuthConfig{
+		JWTPrivateKeyPath: keyPath,
+		JWTExpiration:     15 * time.Minute,
+		RefreshExpiration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewTokenManager: %v", err)
+	}
+
+	// 只存在于内存的新密钥在重启或其他副本上无法验证，必须拒绝轮换
+	for name, tm := range map[string]*TokenManager{"hmac": newTestManager(t), "private key file": fileManager} {
+		t.Run(name, func(t *testing.T) {
+			before := tm.Keys()
+			if _, err := tm.RotateKey(); !errors.Is(err, ErrRotationUnsupported) {
+				t.Fatalf("RotateKey() error = %v, want %v", err, ErrRotationUnsupported)
+			}
+			if after := tm.Keys(); len(after) != len(before) || after[0].ID != before[0].ID {
+				t.Fatalf("Keys() after failed rotation = %+v, want %+v", after, before)
+			}
+		})
+	}
+}
+
+func TestRotateKeyWritesKeyDir(t *testing.T) {
+	tm, dir := newKeyDirManager(t)
+	replica := newDirManager(t, dir)
+
+	oldToken, err := tm.GenerateServiceToken("svc", []string{"viewer"}, "", nil)
+	if err != nil {
+		t.Fatalf("GenerateServiceToken: %v", err)
+	}
+
+	info, err := tm.RotateKey()
+	if err != nil {
+		t.Fatalf("RotateKey: %v", err)
+	}
+	if !info.Active || !info.CanSign || info.Algorithm != "EdDSA" {
+		t.Fatalf("RotateKey() = %+v", info)
+	}
+	if info.Source != filepath.Join(dir, info.ID+".pem") {
+		t.Fatalf("RotateKey() source = %q, want key file in %s", info.Source, dir)
+	}
+	if _, err := os.Stat(info.Source); err != nil {
+		t.Fatalf("rotated key file: %v", err)
+	}
+
+	newToken, err := tm.GenerateServiceToken("svc", []string{"viewer"}, "", nil)
+	if err != nil {
+		t.Fatalf("GenerateServiceToken: %v", err)
+	}
+	// 旧密钥签发的令牌继续有效
+	if _, err := tm.ValidateToken(oldToken); err != nil {
+		t.Fatalf("ValidateToken() with the retired key: %v", err)
+	}
+
+	// 其他副本重新加载目录后使用并接受新密钥
+	if err := replica.ReloadKeys(); err != nil {
+		t.Fatalf("ReloadKeys: %v", err)
+	}
+	if _, err := replica.ValidateToken(newToken); err != nil {
+		t.Fatalf("ValidateToken() on another replica: %v", err)
+	}
+	if got := replica.Algorithm(); got != "EdDSA" {
+		t.Fatalf("Algorithm() = %q, want EdDSA", got)
+	}
+	for _, k := range replica.Keys() {
+		if k.Active && k.ID != info.ID {
+			t.Fatalf("active key on another replica = %s, want %s", k.ID, info.ID)
+		}
+	}
+
+	// 重启后新密钥仍然存在
+	if _, err := newDirManager(t, dir).ValidateToken(newToken); err != nil {
+		t.Fatalf("ValidateToken() after restart: %v", err)
+	}
+}
@@ -0,0 +1,365 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+// signingKey 单个签名/验证密钥
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	private   interface{} // crypto.Signer 或 HMAC 密钥；为 nil 时只能验证
+	public    interface{} // crypto.PublicKey 或 HMAC 密钥
+	createdAt time.Time
+	retiredAt time.Time // 零值表示仍在使用
+	source    string    // 来源文件，内存生成的密钥为空
+}
+
+// KeyInfo 密钥元数据，不包含密钥材料
+type KeyInfo struct {
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	Active    bool       `json:"active"`
+	CanSign   bool       `json:"can_sign"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Source    string     `json:"source,omitempty"`
+}
+
+// newAsymmetricKey 由私钥或公钥构造签名密钥，kid 为 RFC 7638 JWK 指纹
+func newAsymmetricKey(signer crypto.Signer, pub crypto.PublicKey) (*signingKey, error) {
+	if signer != nil {
+		pub = signer.Public()
+	}
+
+	method, err := signingMethodForKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := Thumbprint(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		id:        kid,
+		method:    method,
+		public:    pub,
+		createdAt: time.Now(),
+	}
+	if signer != nil {
+		key.private = signer
+	}
+	return key, nil
+}
+
+// newHMACKey 由共享密钥构造 HS256 签名密钥
+func newHMACKey(secret []byte) *signingKey {
+	sum := sha256.Sum256(secret)
+	return &signingKey{
+		id:        "hs256-" + hex.EncodeToString(sum[:8]),
+		method:    jwt.SigningMethodHS256,
+		private:   secret,
+		public:    secret,
+		createdAt: time.Now(),
+	}
+}
+
+// keySet 密钥集合：一个活动密钥用于签名，退役密钥在其签发的令牌过期前继续用于验证
+type keySet struct {
+	mu        sync.RWMutex
+	keys      map[string]*signingKey
+	activeID  string
+	retention time.Duration
+}
+
+// newKeySet 创建密钥集合，retention 为退役密钥的保留时长
+func newKeySet(retention time.Duration) *keySet {
+	return &keySet{
+		keys:      make(map[string]*signingKey),
+		retention: retention,
+	}
+}
+
+// active 返回当前用于签名的密钥
+func (ks *keySet) active() (*signingKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.keys[ks.activeID]
+	if !ok || key.private == nil {
+		return nil, ErrSigningKeyUnavailable
+	}
+	active := *key
+	return &active, nil
+}
+
+// lookup 按 kid 查找验证密钥；kid 为空时（轮换前签发的令牌）使用活动密钥
+func (ks *keySet) lookup(kid string) (*signingKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if kid == "" {
+		kid = ks.activeID
+	}
+	key, ok := ks.keys[kid]
+	if !ok || ks.expired(key, time.Now()) {
+		return nil, false
+	}
+	found := *key
+	return &found, true
+}
+
+// add 添加密钥，activate 为 true 时将其设为活动密钥并退役原活动密钥
+func (ks *keySet) add(key *signingKey, activate bool) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if existing, ok := ks.keys[key.id]; ok {
+		key = existing
+	} else {
+		ks.keys[key.id] = key
+	}
+	if activate {
+		ks.activateLocked(key.id)
+	} else if key.id != ks.activeID && key.retiredAt.IsZero() {
+		key.retiredAt = time.Now()
+	}
+}
+
+// replace 用新加载的密钥替换集合
+//
+// 目录中的非活动密钥视为在活动密钥创建时退役；不再出现的密钥从此刻起退役，
+// 两者都在保留期结束后删除。
+func (ks *keySet) replace(keys []*signingKey, activeID string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	rotatedAt := now
+	for _, key := range keys {
+		if key.id == activeID {
+			rotatedAt = key.createdAt
+		}
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		seen[key.id] = true
+		if existing, ok := ks.keys[key.id]; ok {
+			existing.private = key.private
+			existing.source = key.source
+			continue
+		}
+		if key.id != activeID {
+			key.retiredAt = rotatedAt
+			if ks.expired(key, now) {
+				continue
+			}
+		}
+		ks.keys[key.id] = key
+	}
+
+	for id, key := range ks.keys {
+		if seen[id] {
+			continue
+		}
+		if key.retiredAt.IsZero() {
+			key.retiredAt = now
+		}
+		if id == ks.activeID {
+			ks.activeID = ""
+		}
+	}
+
+	if activeID != "" {
+		ks.activateLocked(activeID)
+	}
+	ks.pruneLocked(now)
+}
+
+// activateLocked 切换活动密钥，调用方需持有写锁
+func (ks *keySet) activateLocked(kid string) {
+	if ks.activeID == kid {
+		return
+	}
+
+	now := time.Now()
+	if previous, ok := ks.keys[ks.activeID]; ok && previous.retiredAt.IsZero() {
+		previous.retiredAt = now
+	}
+	key := ks.keys[kid]
+	key.retiredAt = time.Time{}
+	ks.activeID = kid
+
+	log.WithFields(log.Fields{
+		"kid": kid,
+		"alg": key.method.Alg(),
+	}).Info("signing key activated")
+}
+
+// pruneLocked 删除保留期已结束的退役密钥，调用方需持有写锁
+func (ks *keySet) pruneLocked(now time.Time) {
+	for id, key := range ks.keys {
+		if ks.expired(key, now) {
+			delete(ks.keys, id)
+			log.WithField("kid", id).Info("retired signing key removed")
+		}
+	}
+}
+
+// expired 判断退役密钥是否已超过保留期
+func (ks *keySet) expired(key *signingKey, now time.Time) bool {
+	return !key.retiredAt.IsZero() && now.After(key.retiredAt.Add(ks.retention))
+}
+
+// infos 返回所有密钥的元数据，活动密钥排在最前
+func (ks *keySet) infos() []KeyInfo {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	infos := make([]KeyInfo, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		info := KeyInfo{
+			ID:        key.id,
+			Algorithm: key.method.Alg(),
+			Active:    key.id == ks.activeID,
+			CanSign:   key.private != nil,
+			CreatedAt: key.createdAt,
+			Source:    key.source,
+		}
+		if !key.retiredAt.IsZero() {
+			retiredAt := key.retiredAt
+			expiresAt := retiredAt.Add(ks.retention)
+			info.RetiredAt = &retiredAt
+			info.ExpiresAt = &expiresAt
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Active != infos[j].Active {
+			return infos[i].Active
+		}
+		return infos[i].CreatedAt.After(infos[j].CreatedAt)
+	})
+	return infos
+}
+
+// publicKeys 返回所有未过期的非对称公钥，对称密钥永不公开
+func (ks *keySet) publicKeys() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if _, ok := key.public.([]byte); ok || ks.expired(key, now) {
+			continue
+		}
+		jwk, err := NewJWK(key.public, key.id, key.method.Alg())
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// loadKeyDir 加载目录中的所有 PEM 密钥，最新修改的私钥作为活动密钥
+func loadKeyDir(dir string) ([]*signingKey, string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("read key directory: %w", err)
+	}
+
+	var (
+		keys     []*signingKey
+		activeID string
+		newest   time.Time
+	)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		key, err := loadKeyFile(path)
+		if err != nil {
+			log.WithError(err).WithField("path", path).Warn("skipping unreadable key file")
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, "", err
+		}
+		key.createdAt = info.ModTime()
+		key.source = path
+		keys = append(keys, key)
+
+		if key.private != nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+			activeID = key.id
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, "", fmt.Errorf("no keys found in %s", dir)
+	}
+	return keys, activeID, nil
+}
+
+// loadKeyFile 加载单个 PEM 文件，私钥优先，否则作为只验证的公钥
+func loadKeyFile(path string) (*signingKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if signer, err := parsePrivateKey(block); err == nil {
+		return newAsymmetricKey(signer, nil)
+	}
+	pub, err := parsePublicKey(block)
+	if err != nil {
+		return nil, err
+	}
+	return newAsymmetricKey(nil, pub)
+}
+
+// generateKey 生成与给定密钥同类型的新签名密钥
+func generateKey(like *signingKey) (*signingKey, crypto.Signer, error) {
+	if _, ok := like.public.([]byte); ok {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, nil, err
+		}
+		return newHMACKey(secret), nil, nil
+	}
+
+	signer, err := generateKeyLike(like.public)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := newAsymmetricKey(signer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, signer, nil
+}
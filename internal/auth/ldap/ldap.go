@@ -0,0 +1,297 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/jason0730/claude-code-demo/internal/auth/identity"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+	"github.com/jason0730/claude-code-demo/internal/config"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// 错误包装 identity 包中的通用失败原因，便于认证链判断是否继续尝试下一个后端
+var (
+	ErrUserNotFound       = fmt.Errorf("ldap: %w", identity.ErrUserNotFound)
+	ErrAmbiguousUser      = errors.New("ldap: user filter matched multiple entries")
+	ErrInvalidCredentials = fmt.Errorf("ldap: bind rejected: %w", identity.ErrInvalidCredentials)
+	ErrNoRoles            = fmt.Errorf("ldap: no group mapped to a role: %w", identity.ErrNoRoles)
+	ErrUnavailable        = fmt.Errorf("ldap: %w", identity.ErrUnavailable)
+)
+
+// UserIDPrefix LDAP 用户 ID 前缀，ID 为前缀加上用户 ID 属性值
+const UserIDPrefix = "ldap:"
+
+// memberOfAttribute 未配置分组搜索时从用户条目读取的分组属性（AD 和 OpenLDAP memberof overlay）
+const memberOfAttribute = "memberOf"
+
+// Authenticator 通过 LDAP 绑定验证用户名密码，并将分组映射为角色
+type Authenticator struct {
+	cfg        *config.LDAPConfig
+	pool       *pool
+	groupRoles map[string][]rbac.Role // 键为小写的分组 DN 或 CN
+}
+
+// entry 搜索到的用户条目
+type entry struct {
+	dn     string
+	uid    string
+	email  string
+	groups []string
+}
+
+// NewAuthenticator 创建 LDAP 认证器
+func NewAuthenticator(cfg *config.LDAPConfig) (*Authenticator, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("LDAP URL is required")
+	}
+	if cfg.UserBaseDN == "" {
+		return nil, errors.New("LDAP user base DN is required")
+	}
+	if strings.Count(cfg.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("LDAP user filter %q must contain exactly one %%s", cfg.UserFilter)
+	}
+	if cfg.GroupBaseDN != "" && strings.Count(cfg.GroupFilter, "%s") != 1 {
+		return nil, fmt.Errorf("LDAP group filter %q must contain exactly one %%s", cfg.GroupFilter)
+	}
+
+	groupRoles, err := ParseGroupRoleMappings(cfg.GroupRoleMappings)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := newPool(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{
+		cfg:        cfg,
+		pool:       p,
+		groupRoles: groupRoles,
+	}, nil
+}
+
+// ParseGroupRoleMappings 解析分组到角色的映射
+//
+// 格式为分号分隔的 "分组=角色"，分组可以是完整 DN 或 CN，按最后一个等号拆分，例如：
+// "cn=admins,ou=groups,dc=example,dc=com=admin;editors=editor"
+func ParseGroupRoleMappings(s string) (map[string][]rbac.Role, error) {
+	mappings := make(map[string][]rbac.Role)
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		i := strings.LastIndex(item, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid LDAP group role mapping %q", item)
+		}
+		group, role := strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		if group == "" || role == "" {
+			return nil, fmt.Errorf("invalid LDAP group role mapping %q", item)
+		}
+
+		key := strings.ToLower(group)
+		mappings[key] = append(mappings[key], rbac.Role(role))
+	}
+	return mappings, nil
+}
+
+// Authenticate 验证用户名和密码，返回带有映射角色的用户
+func (a *Authenticator) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	// 空密码在 LDAP 中是匿名绑定，服务端会返回成功
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	var found *entry
+	err := a.pool.withConn(ctx, func(c *conn) error {
+		e, err := a.searchUser(c, a.cfg.UserFilter, username)
+		if err != nil {
+			return err
+		}
+
+		bindErr := c.Bind(e.dn, password)
+		// 无论用户绑定是否成功，连接都必须恢复为服务账号身份后才能归还
+		if err := a.pool.bindService(c.Conn); err != nil {
+			c.broken = true
+			if bindErr == nil {
+				return err
+			}
+		}
+		if bindErr != nil {
+			if ldap.IsErrorWithCode(bindErr, ldap.LDAPResultInvalidCredentials) {
+				return ErrInvalidCredentials
+			}
+			return fmt.Errorf("%w: user bind: %w", ErrUnavailable, bindErr)
+		}
+
+		found = e
+		return nil
+	})
+	if err != nil {
+		return nil, a.wrapError(err)
+	}
+
+	return a.toUser(found)
+}
+
+// Name 返回后端名称
+func (a *Authenticator) Name() string {
+	return "ldap"
+}
+
+// GetUser 按用户 ID 查找用户并重新解析角色，用于刷新令牌时获取最新的分组
+func (a *Authenticator) GetUser(ctx context.Context, id string) (*model.User, error) {
+	uid := strings.TrimPrefix(id, UserIDPrefix)
+	if uid == id || uid == "" {
+		return nil, ErrUserNotFound
+	}
+
+	var found *entry
+	err := a.pool.withConn(ctx, func(c *conn) error {
+		e, err := a.searchUser(c, "("+a.cfg.UIDAttribute+"=%s)", uid)
+		if err != nil {
+			return err
+		}
+		found = e
+		return nil
+	})
+	if err != nil {
+		return nil, a.wrapError(err)
+	}
+
+	return a.toUser(found)
+}
+
+// Close 关闭连接池中的空闲连接
+func (a *Authenticator) Close() {
+	a.pool.close()
+}
+
+// searchUser 以服务账号搜索唯一的用户条目并解析其分组
+func (a *Authenticator) searchUser(c *conn, filterTemplate, value string) (*entry, error) {
+	attributes := []string{a.cfg.UIDAttribute, a.cfg.EmailAttribute}
+	if a.cfg.GroupBaseDN == "" {
+		attributes = append(attributes, memberOfAttribute)
+	}
+
+	result, err := c.Search(ldap.NewSearchRequest(
+		a.cfg.UserBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(a.cfg.Timeout/time.Second), false,
+		fmt.Sprintf(filterTemplate, ldap.EscapeFilter(value)),
+		attributes,
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("%w: user search: %w", ErrUnavailable, err)
+	}
+	switch {
+	case result == nil || len(result.Entries) == 0:
+		return nil, ErrUserNotFound
+	case len(result.Entries) > 1:
+		return nil, ErrAmbiguousUser
+	}
+
+	ldapEntry := result.Entries[0]
+	e := &entry{
+		dn:     ldapEntry.DN,
+		uid:    ldapEntry.GetAttributeValue(a.cfg.UIDAttribute),
+		email:  ldapEntry.GetAttributeValue(a.cfg.EmailAttribute),
+		groups: ldapEntry.GetAttributeValues(memberOfAttribute),
+	}
+	if e.uid == "" {
+		return nil, fmt.Errorf("%w: entry %s has no %s attribute", ErrUserNotFound, e.dn, a.cfg.UIDAttribute)
+	}
+
+	if a.cfg.GroupBaseDN != "" {
+		groups, err := c.Search(ldap.NewSearchRequest(
+			a.cfg.GroupBaseDN,
+			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, int(a.cfg.Timeout/time.Second), false,
+			fmt.Sprintf(a.cfg.GroupFilter, ldap.EscapeFilter(e.dn)),
+			[]string{"dn"},
+			nil,
+		))
+		if err != nil {
+			return nil, fmt.Errorf("%w: group search: %w", ErrUnavailable, err)
+		}
+		for _, g := range groups.Entries {
+			e.groups = append(e.groups, g.DN)
+		}
+	}
+
+	return e, nil
+}
+
+// toUser 将条目转换为用户，角色为默认角色加上分组映射的角色
+func (a *Authenticator) toUser(e *entry) (*model.User, error) {
+	roles := a.mapRoles(e.groups)
+	if len(roles) == 0 {
+		log.WithFields(log.Fields{
+			"dn":     e.dn,
+			"groups": e.groups,
+		}).Debug("no LDAP group matched a role mapping")
+		return nil, ErrNoRoles
+	}
+
+	now := time.Now()
+	return &model.User{
+		ID:        UserIDPrefix + e.uid,
+		Username:  e.uid,
+		Email:     e.email,
+		Roles:     roles,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// mapRoles 将分组 DN 映射为角色，分组可按完整 DN 或 CN 匹配（不区分大小写）
+func (a *Authenticator) mapRoles(groups []string) []string {
+	set := make(map[string]bool)
+	for _, role := range a.cfg.DefaultRoles {
+		set[role] = true
+	}
+
+	for _, group := range groups {
+		keys := []string{strings.ToLower(group)}
+		if dn, err := ldap.ParseDN(group); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			keys = append(keys, strings.ToLower(dn.RDNs[0].Attributes[0].Value))
+		}
+		for _, key := range keys {
+			for _, role := range a.groupRoles[key] {
+				set[string(role)] = true
+			}
+		}
+	}
+
+	roles := make([]string, 0, len(set))
+	for role := range set {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// wrapError 将连接层错误统一为 ErrUnavailable，业务错误原样返回
+func (a *Authenticator) wrapError(err error) error {
+	switch {
+	case errors.Is(err, ErrUserNotFound),
+		errors.Is(err, ErrAmbiguousUser),
+		errors.Is(err, ErrInvalidCredentials),
+		errors.Is(err, ErrUnavailable),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
+}
@@ -0,0 +1,230 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+const (
+	serviceDN       = "cn=svc,dc=example,dc=com"
+	servicePassword = "svc-secret"
+	aliceDN         = "uid=alice,ou=people,dc=example,dc=com"
+	bobDN           = "uid=bob,ou=people,dc=example,dc=com"
+	adminsDN        = "cn=admins,ou=groups,dc=example,dc=com"
+	editorsDN       = "cn=editors,ou=groups,dc=example,dc=com"
+)
+
+// testEntries 服务账号、两个用户和两个分组；alice 属于 admins，bob 不属于任何映射的分组
+func testEntries() []testEntry {
+	return []testEntry{
+		{dn: serviceDN, password: servicePassword, attrs: map[string][]string{"cn": {"svc"}}},
+		{dn: aliceDN, password: "alice-pw", attrs: map[string][]string{
+			"uid":      {"alice"},
+			"mail":     {"alice@example.com"},
+			"memberOf": {adminsDN, editorsDN},
+		}},
+		{dn: bobDN, password: "bob-pw", attrs: map[string][]string{
+			"uid":      {"bob"},
+			"memberOf": {"cn=sales,ou=groups,dc=example,dc=com"},
+		}},
+		{dn: adminsDN, attrs: map[string][]string{"cn": {"admins"}, "member": {aliceDN}}},
+		{dn: editorsDN, attrs: map[string][]string{"cn": {"editors"}, "member": {aliceDN}}},
+	}
+}
+
+// testConfig 连接到测试服务端的配置，admins 按完整 DN 映射，editors 按 CN 映射
+func testConfig(url string) *config.LDAPConfig {
+	return &config.LDAPConfig{
+		URL:               url,
+		BindDN:            serviceDN,
+		BindPassword:      servicePassword,
+		UserBaseDN:        "ou=people,dc=example,dc=com",
+		UserFilter:        "(&(uid=%s)(!(uid=svc)))",
+		UIDAttribute:      "uid",
+		EmailAttribute:    "mail",
+		GroupFilter:       "(member=%s)",
+		GroupRoleMappings: adminsDN + "=admin;editors=editor",
+		PoolSize:          2,
+		Timeout:           2 * time.Second,
+	}
+}
+
+func newTestAuthenticator(t *testing.T, cfg *config.LDAPConfig) *Authenticator {
+	t.Helper()
+
+	a, err := NewAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+	t.Cleanup(a.Close)
+	return a
+}
+
+func TestAuthenticateBind(t *testing.T) {
+	srv := newTestServer(t, false, testEntries()...)
+	a := newTestAuthenticator(t, testConfig(srv.url()))
+	ctx := context.Background()
+
+	user, err := a.Authenticate(ctx, "alice", "alice-pw")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.ID != UserIDPrefix+"alice" || user.Email != "alice@example.com" {
+		t.Fatalf("user = %+v", user)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     error
+	}{
+		{name: "wrong password", username: "alice", password: "wrong", want: ErrInvalidCredentials},
+		{name: "unknown user", username: "carol", password: "carol-pw", want: ErrUserNotFound},
+		{name: "filter injection", username: "*", password: "alice-pw", want: ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := a.Authenticate(ctx, tt.username, tt.password); !errors.Is(err, tt.want) {
+				t.Fatalf("Authenticate error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// 用户绑定失败后连接恢复为服务账号身份，后续认证仍能使用同一连接
+	if _, err := a.Authenticate(ctx, "alice", "alice-pw"); err != nil {
+		t.Fatalf("Authenticate after failed bind: %v", err)
+	}
+}
+
+func TestAuthenticateRejectsEmptyPassword(t *testing.T) {
+	srv := newTestServer(t, false, testEntries()...)
+	a := newTestAuthenticator(t, testConfig(srv.url()))
+
+	// 测试服务端与真实服务端一样会接受空密码的绑定（匿名绑定）
+	if _, err := a.Authenticate(context.Background(), "alice", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, dn := range srv.binds {
+		if dn == aliceDN {
+			t.Fatal("empty password was sent to the server as a bind")
+		}
+	}
+}
+
+func TestGroupRoleMapping(t *testing.T) {
+	srv := newTestServer(t, false, testEntries()...)
+	ctx := context.Background()
+
+	memberOf := testConfig(srv.url())
+	groupSearch := testConfig(srv.url())
+	groupSearch.GroupBaseDN = "ou=groups,dc=example,dc=com"
+	withDefault := testConfig(srv.url())
+	withDefault.DefaultRoles = []string{"viewer"}
+
+	tests := []struct {
+		name     string
+		cfg      *config.LDAPConfig
+		username string
+		password string
+		want     []string
+		wantErr  error
+	}{
+		{name: "memberOf", cfg: memberOf, username: "alice", password: "alice-pw", want: []string{"admin", "editor"}},
+		{name: "group search", cfg: groupSearch, username: "alice", password: "alice-pw", want: []string{"admin", "editor"}},
+		{name: "no mapped group", cfg: memberOf, username: "bob", password: "bob-pw", wantErr: ErrNoRoles},
+		{name: "default roles", cfg: withDefault, username: "bob", password: "bob-pw", want: []string{"viewer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuthenticator(t, tt.cfg)
+			user, err := a.Authenticate(ctx, tt.username, tt.password)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if !reflect.DeepEqual(user.Roles, tt.want) {
+				t.Fatalf("roles = %v, want %v", user.Roles, tt.want)
+			}
+		})
+	}
+
+	// 刷新令牌时按 ID 重新解析分组
+	a := newTestAuthenticator(t, groupSearch)
+	user, err := a.GetUser(ctx, UserIDPrefix+"alice")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if !reflect.DeepEqual(user.Roles, []string{"admin", "editor"}) {
+		t.Fatalf("GetUser roles = %v", user.Roles)
+	}
+}
+
+func TestStartTLS(t *testing.T) {
+	srv := newTestServer(t, true, testEntries()...)
+	ctx := context.Background()
+
+	cfg := testConfig(srv.url())
+	cfg.StartTLS = true
+	cfg.CAFile = srv.caFile
+	a := newTestAuthenticator(t, cfg)
+
+	if _, err := a.Authenticate(ctx, "alice", "alice-pw"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	srv.mu.Lock()
+	tlsBinds, binds := srv.tlsBinds, len(srv.binds)
+	srv.mu.Unlock()
+	if tlsBinds != binds {
+		t.Fatalf("%d of %d binds were sent before StartTLS", binds-tlsBinds, binds)
+	}
+
+	// 不信任服务端证书时不能退回明文
+	untrusted := testConfig(srv.url())
+	untrusted.StartTLS = true
+	a = newTestAuthenticator(t, untrusted)
+	if _, err := a.Authenticate(ctx, "alice", "alice-pw"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Authenticate with untrusted certificate error = %v, want %v", err, ErrUnavailable)
+	}
+}
+
+func TestPoolReconnectsAfterServerDropsConnections(t *testing.T) {
+	srv := newTestServer(t, false, testEntries()...)
+	a := newTestAuthenticator(t, testConfig(srv.url()))
+	ctx := context.Background()
+
+	if _, err := a.Authenticate(ctx, "alice", "alice-pw"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got := srv.connections(); got != 1 {
+		t.Fatalf("connections = %d, want 1", got)
+	}
+
+	// 空闲连接被服务端断开后，下一次认证使用新连接完成
+	srv.dropConnections()
+	if _, err := a.Authenticate(ctx, "alice", "alice-pw"); err != nil {
+		t.Fatalf("Authenticate after server dropped connections: %v", err)
+	}
+	if got := srv.connections(); got != 2 {
+		t.Fatalf("connections = %d, want 2", got)
+	}
+
+	// 服务端停止后报告不可用，认证链据此停止
+	srv.close()
+	if _, err := a.Authenticate(ctx, "alice", "alice-pw"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Authenticate with server down error = %v, want %v", err, ErrUnavailable)
+	}
+}
@@ -0,0 +1,204 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+// conn 连接池中的连接；broken 为 true 时归还后直接关闭
+type conn struct {
+	*ldap.Conn
+	reused bool
+	broken bool
+}
+
+// pool LDAP 连接池，连接在归还前始终以服务账号身份绑定
+//
+// slots 限制同时打开的连接总数，idle 缓存空闲连接。
+type pool struct {
+	cfg       *config.LDAPConfig
+	tlsConfig *tls.Config
+	slots     chan struct{}
+	idle      chan *ldap.Conn
+}
+
+// newPool 创建连接池，连接在首次使用时建立
+func newPool(cfg *config.LDAPConfig) (*pool, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse LDAP URL: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read LDAP CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	size := cfg.PoolSize
+	if size < 1 {
+		size = 1
+	}
+
+	return &pool{
+		cfg:       cfg,
+		tlsConfig: tlsConfig,
+		slots:     make(chan struct{}, size),
+		idle:      make(chan *ldap.Conn, size),
+	}, nil
+}
+
+// withConn 从连接池取出连接执行 fn
+//
+// 网络错误或连接被标记为 broken 时关闭连接；复用的空闲连接因服务端超时断开时，
+// 使用新连接重试一次。
+func (p *pool) withConn(ctx context.Context, fn func(c *conn) error) error {
+	for attempt := 0; ; attempt++ {
+		c, err := p.get(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = fn(c)
+		// 服务端断开连接时，请求返回的是连接关闭原因而不是网络错误，需同时检查连接状态
+		lost := err != nil && (isNetworkError(err) || c.IsClosing())
+		if c.broken || lost {
+			p.discard(c)
+			if c.reused && attempt == 0 && lost {
+				continue
+			}
+			return err
+		}
+
+		p.put(c)
+		return err
+	}
+}
+
+// get 获取空闲连接，没有空闲连接时新建，连接数达到上限时等待
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		select {
+		case lc := <-p.idle:
+			if lc.IsClosing() {
+				lc.Close()
+				continue
+			}
+			return &conn{Conn: lc, reused: true}, nil
+		default:
+		}
+
+		lc, err := p.dial()
+		if err != nil {
+			<-p.slots
+			return nil, err
+		}
+		return &conn{Conn: lc}, nil
+	}
+}
+
+// put 归还连接
+func (p *pool) put(c *conn) {
+	select {
+	case p.idle <- c.Conn:
+	default:
+		c.Close()
+	}
+	<-p.slots
+}
+
+// discard 关闭连接并释放名额
+func (p *pool) discard(c *conn) {
+	c.Close()
+	<-p.slots
+}
+
+// dial 建立连接，按配置升级 StartTLS 并以服务账号绑定
+func (p *pool) dial() (*ldap.Conn, error) {
+	lc, err := ldap.DialURL(p.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.cfg.Timeout}),
+		ldap.DialWithTLSConfig(p.tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	lc.SetTimeout(p.cfg.Timeout)
+
+	if p.cfg.StartTLS {
+		if err := lc.StartTLS(p.tlsConfig); err != nil {
+			lc.Close()
+			return nil, fmt.Errorf("%w: starttls: %v", ErrUnavailable, err)
+		}
+	}
+
+	if err := p.bindService(lc); err != nil {
+		lc.Close()
+		return nil, err
+	}
+	return lc, nil
+}
+
+// bindService 以服务账号绑定；未配置服务账号时使用匿名绑定
+func (p *pool) bindService(lc *ldap.Conn) error {
+	var err error
+	if p.cfg.BindDN == "" {
+		err = lc.UnauthenticatedBind("")
+	} else {
+		err = lc.Bind(p.cfg.BindDN, p.cfg.BindPassword)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: service bind: %w", ErrUnavailable, err)
+	}
+	return nil
+}
+
+// close 关闭所有空闲连接
+func (p *pool) close() {
+	for {
+		select {
+		case lc := <-p.idle:
+			lc.Close()
+		default:
+			return
+		}
+	}
+}
+
+// isNetworkError 判断是否为连接层错误；ldap.IsErrorWithCode 不识别包装后的错误，因此使用 errors.As
+func isNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) && ldapErr.ResultCode == ldap.ErrorNetwork {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
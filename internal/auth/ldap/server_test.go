@@ -0,0 +1,314 @@
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// startTLSOID StartTLS 扩展操作（RFC 4511 4.14）
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// testEntry 测试目录中的条目
+type testEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// testServer 进程内的最小 LDAP 服务端，支持简单绑定、搜索、StartTLS 和解绑
+//
+// 与真实服务端一样，空密码的简单绑定按匿名绑定处理并返回成功。
+type testServer struct {
+	t         *testing.T
+	ln        net.Listener
+	entries   []testEntry
+	tlsConfig *tls.Config // 非空时支持 StartTLS
+	caFile    string      // 签发服务端证书的 CA，供客户端校验
+
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	accepted int
+	binds    []string // 成功绑定的 DN，匿名为空字符串
+	tlsBinds int      // 在 TLS 连接上完成的绑定次数
+}
+
+// newTestServer 启动测试服务端，withTLS 为 true 时生成自签名证书并支持 StartTLS
+func newTestServer(t *testing.T, withTLS bool, entries ...testEntry) *testServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &testServer{
+		t:       t,
+		ln:      ln,
+		entries: entries,
+		conns:   make(map[net.Conn]bool),
+	}
+	if withTLS {
+		s.tlsConfig, s.caFile = newTestCertificate(t)
+	}
+	t.Cleanup(s.close)
+
+	go s.acceptLoop()
+	return s
+}
+
+// url 服务端地址
+func (s *testServer) url() string {
+	return "ldap://" + s.ln.Addr().String()
+}
+
+// dropConnections 服务端主动断开所有连接，模拟空闲超时或服务端重启
+func (s *testServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// connections 服务端累计接受的连接数
+func (s *testServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accepted
+}
+
+func (s *testServer) close() {
+	s.ln.Close()
+	s.dropConnections()
+}
+
+func (s *testServer) acceptLoop() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.accepted++
+		s.mu.Unlock()
+
+		go s.serve(c)
+	}
+}
+
+// serve 逐个处理连接上的请求
+func (s *testServer) serve(c net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	secure := false
+	for {
+		packet, err := ber.ReadPacket(c)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := s.bind(dn, password)
+			if code == ldap.LDAPResultSuccess && secure {
+				s.mu.Lock()
+				s.tlsBinds++
+				s.mu.Unlock()
+			}
+			s.write(c, id, ldap.ApplicationBindResponse, code)
+
+		case ldap.ApplicationSearchRequest:
+			base := strings.ToLower(op.Children[0].Data.String())
+			filter := op.Children[6]
+			for _, e := range s.entries {
+				if strings.HasSuffix(strings.ToLower(e.dn), base) && matchFilter(filter, e) {
+					s.writeEntry(c, id, e)
+				}
+			}
+			s.write(c, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+
+		case ldap.ApplicationExtendedRequest:
+			if s.tlsConfig == nil || secure || op.Children[0].Data.String() != startTLSOID {
+				s.write(c, id, ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError)
+				continue
+			}
+			s.write(c, id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess)
+			tc := tls.Server(c, s.tlsConfig)
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.conns[tc] = true
+			s.mu.Unlock()
+			c, secure = tc, true
+
+		case ldap.ApplicationUnbindRequest:
+			return
+
+		default:
+			return
+		}
+	}
+}
+
+// bind 校验简单绑定；空 DN 或空密码为匿名绑定
+func (s *testServer) bind(dn, password string) uint16 {
+	ok := dn == "" || password == ""
+	for _, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) && e.password != "" && e.password == password {
+			ok = true
+		}
+	}
+	if !ok {
+		return ldap.LDAPResultInvalidCredentials
+	}
+
+	s.mu.Lock()
+	s.binds = append(s.binds, dn)
+	s.mu.Unlock()
+	return ldap.LDAPResultSuccess
+}
+
+// write 发送只包含结果码的响应
+func (s *testServer) write(c net.Conn, id int64, tag ber.Tag, code uint16) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	s.send(c, id, op)
+}
+
+// writeEntry 发送搜索结果条目，包含条目的全部属性
+func (s *testServer) writeEntry(c net.Conn, id int64, e testEntry) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range e.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	s.send(c, id, op)
+}
+
+func (s *testServer) send(c net.Conn, id int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	packet.AppendChild(op)
+	c.Write(packet.Bytes())
+}
+
+// matchFilter 评估与、或、非、相等和存在过滤器，属性名和值不区分大小写
+func matchFilter(f *ber.Packet, e testEntry) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, child := range f.Children {
+			if !matchFilter(child, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range f.Children {
+			if matchFilter(child, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchFilter(f.Children[0], e)
+	case ldap.FilterPresent:
+		return len(attrValues(e, f.Data.String())) > 0
+	case ldap.FilterEqualityMatch:
+		want := f.Children[1].Data.String()
+		for _, v := range attrValues(e, f.Children[0].Data.String()) {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// attrValues 按不区分大小写的属性名取值
+func attrValues(e testEntry, name string) []string {
+	for k, v := range e.attrs {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// newTestCertificate 生成 127.0.0.1 的自签名证书，返回服务端 TLS 配置和 CA 文件路径
+func newTestCertificate(t *testing.T) (*tls.Config, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldap.test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}, caFile
+}
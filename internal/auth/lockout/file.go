@@ -0,0 +1,169 @@
+package lockout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 跨副本写入锁的等待时间，以及超过多久视为持有者已崩溃的遗留锁
+const (
+	lockTimeout  = 5 * time.Second
+	lockStaleAge = 30 * time.Second
+)
+
+// fileEntry 共享文件中的失败记录
+type fileEntry struct {
+	Scope       Scope     `json:"scope"`
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// view 读取最新计数后执行 fn
+func (g *Guard) view(fn func(now time.Time)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.path != "" {
+		if err := g.loadLocked(); err != nil {
+			return err
+		}
+	}
+	fn(time.Now())
+	return nil
+}
+
+// update 执行 fn 修改计数；使用共享文件时持有锁文件读取最新内容，修改后写回，
+// 多个副本的检查和计数不会交错
+func (g *Guard) update(fn func(now time.Time)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.path == "" {
+		fn(time.Now())
+		return nil
+	}
+
+	unlock, err := g.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := g.loadLocked(); err != nil {
+		return err
+	}
+	fn(time.Now())
+	return g.persistLocked()
+}
+
+// loadLocked 文件与内存中的计数不一致时重新读取，调用方需持有锁
+func (g *Guard) loadLocked() error {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("read lockout store: %w", err)
+		}
+		if g.loaded != nil {
+			g.entries = make(map[key]*entry)
+			g.loaded = nil
+		}
+		return nil
+	}
+	if g.loaded != nil && os.SameFile(g.loaded, info) &&
+		g.loaded.ModTime().Equal(info.ModTime()) && g.loaded.Size() == info.Size() {
+		return nil
+	}
+
+	data, err := os.ReadFile(g.path)
+	if err != nil {
+		return fmt.Errorf("read lockout store: %w", err)
+	}
+	var list []fileEntry
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("decode lockout store: %w", err)
+	}
+
+	entries := make(map[key]*entry, len(list))
+	for _, e := range list {
+		entries[key{e.Scope, e.Key}] = &entry{
+			failures:    e.Failures,
+			lastFailure: e.LastFailure,
+			lockedUntil: e.LockedUntil,
+		}
+	}
+	g.entries = entries
+	g.loaded = info
+	return nil
+}
+
+// persistLocked 先写临时文件再重命名，避免写入中断导致文件损坏；调用方需持有锁
+func (g *Guard) persistLocked() error {
+	list := make([]fileEntry, 0, len(g.entries))
+	for k, e := range g.entries {
+		list = append(list, fileEntry{
+			Scope:       k.scope,
+			Key:         k.value,
+			Failures:    e.failures,
+			LastFailure: e.lastFailure,
+			LockedUntil: e.lockedUntil,
+		})
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(g.path), filepath.Base(g.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write lockout store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write lockout store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write lockout store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), g.path); err != nil {
+		return fmt.Errorf("write lockout store: %w", err)
+	}
+
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return fmt.Errorf("read lockout store: %w", err)
+	}
+	g.loaded = info
+	return nil
+}
+
+// lockFile 创建锁文件独占写入，返回释放锁的函数；超过 lockStaleAge 的锁文件视为崩溃遗留并删除
+func (g *Guard) lockFile() (func(), error) {
+	lockPath := g.path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("lock lockout store: %w", err)
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > lockStaleAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("lock lockout store: timed out waiting for %s", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,350 @@
+package lockout
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Scope 失败计数的维度
+type Scope string
+
+const (
+	ScopeUser Scope = "user"
+	ScopeIP   Scope = "ip"
+)
+
+// pruneInterval 清理过期记录的最短间隔
+const pruneInterval = time.Minute
+
+// Lock 正在计数或被锁定的用户名/IP
+type Lock struct {
+	Scope       Scope      `json:"scope"`
+	Key         string     `json:"key"`
+	Failures    int        `json:"failures"`
+	LastFailure time.Time  `json:"last_failure"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	RetryAt     *time.Time `json:"retry_at,omitempty"`
+}
+
+// key 计数键
+type key struct {
+	scope Scope
+	value string
+}
+
+// entry 失败记录
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Guard 登录失败限制
+//
+// 按用户名和来源 IP 分别计数：失败次数超过对应的 BackoffAfter 阈值后，下次尝试前需要等待
+// 指数增长的时间；达到上限后临时锁定。用户名不论是否存在都会计数，避免通过锁定行为枚举用户。
+// 每次尝试由 Begin 在同一把锁内检查并预先计为失败，并发请求不能越过阈值。
+// 配置 StorePath 时计数保存在多个副本共享的文件中，否则只在本副本内存中有效。
+type Guard struct {
+	cfg  config.LockoutConfig
+	path string
+
+	mu        sync.Mutex
+	entries   map[key]*entry
+	lastPrune time.Time
+	loaded    os.FileInfo // 当前计数对应的文件信息
+}
+
+// Attempt 一次已预先计为失败的尝试，结束时调用 Succeed、Fail 或 Cancel
+type Attempt struct {
+	g      *Guard
+	keys   []key        // 已计数的键
+	locked map[key]bool // 由本次尝试触发锁定的键
+}
+
+// NewGuard 创建登录失败限制，配置了共享文件时检查已有文件能否解析
+func NewGuard(cfg *config.LockoutConfig) (*Guard, error) {
+	g := &Guard{
+		cfg:     *cfg,
+		path:    cfg.StorePath,
+		entries: make(map[key]*entry),
+	}
+	if err := g.view(func(time.Time) {}); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Begin 检查用户名和来源 IP 是否需要等待，允许时将本次尝试预先计为失败
+//
+// 返回的等待时间大于 0 时不允许尝试，Attempt 为空。检查和计数在同一把锁内完成，
+// 并发的尝试不会都在达到阈值前通过检查。
+func (g *Guard) Begin(username, ip string) (*Attempt, time.Duration, error) {
+	a := &Attempt{g: g, locked: make(map[key]bool)}
+	var wait time.Duration
+	err := g.update(func(now time.Time) {
+		wait = a.chargeLocked(now, ip, key{ScopeIP, ip}, key{ScopeUser, normalize(username)})
+	})
+	if err != nil || wait > 0 {
+		return nil, wait, err
+	}
+	return a, 0, nil
+}
+
+// AddUser 尝试开始时还不知道用户（如无密码登录）时，在确定用户后检查并计数用户名；
+// 需要等待时撤销本次尝试并返回等待时间
+func (a *Attempt) AddUser(username, ip string) (time.Duration, error) {
+	var wait time.Duration
+	err := a.g.update(func(now time.Time) {
+		if wait = a.chargeLocked(now, ip, key{ScopeUser, normalize(username)}); wait > 0 {
+			a.refundLocked(a.keys...)
+		}
+	})
+	return wait, err
+}
+
+// Succeed 尝试成功：清除用户名的失败记录，退回 IP 的预先计数；
+// IP 的既往失败保留，防止撞库时被成功登录重置
+func (a *Attempt) Succeed() {
+	err := a.g.update(func(time.Time) {
+		for _, k := range a.keys {
+			if k.scope == ScopeUser {
+				delete(a.g.entries, k)
+			} else {
+				a.refundLocked(k)
+			}
+		}
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to record successful login attempt")
+	}
+}
+
+// Fail 尝试失败，失败已在 Begin 时计入
+func (a *Attempt) Fail() {}
+
+// Cancel 尝试未能完成验证（如后端不可用），退回预先计入的失败
+func (a *Attempt) Cancel() {
+	err := a.g.update(func(time.Time) {
+		a.refundLocked(a.keys...)
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to cancel login attempt")
+	}
+}
+
+// chargeLocked 所有键都无需等待时逐个计为失败，否则返回最长的等待时间；调用方需持有锁
+func (a *Attempt) chargeLocked(now time.Time, ip string, keys ...key) time.Duration {
+	var wait time.Duration
+	for _, k := range keys {
+		if w := a.g.waitLocked(k, now); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	a.g.pruneLocked(now)
+	for _, k := range keys {
+		limit := a.g.cfg.MaxUserFailures
+		if k.scope == ScopeIP {
+			limit = a.g.cfg.MaxIPFailures
+		}
+		if a.g.failLocked(k, limit, now, ip) {
+			a.locked[k] = true
+		}
+		if k.value != "" {
+			a.keys = append(a.keys, k)
+		}
+	}
+	return 0
+}
+
+// refundLocked 退回本次尝试对各键的计数，并解除由本次尝试触发的锁定；调用方需持有锁
+func (a *Attempt) refundLocked(keys ...key) {
+	for _, k := range keys {
+		e, ok := a.g.entries[k]
+		if !ok {
+			continue
+		}
+		e.failures--
+		if a.locked[k] {
+			e.lockedUntil = time.Time{}
+		}
+		if e.failures <= 0 {
+			delete(a.g.entries, k)
+		}
+	}
+	a.keys = nil
+}
+
+// Succeed 清除用户名的失败记录，用于密码重置等无需经过 Begin 的场景
+func (g *Guard) Succeed(username string) {
+	err := g.update(func(time.Time) {
+		delete(g.entries, key{ScopeUser, normalize(username)})
+	})
+	if err != nil {
+		log.WithError(err).WithField("username", username).Error("failed to clear login failures")
+	}
+}
+
+// Locks 列出仍在计数期内的记录，被锁定的排在前面
+func (g *Guard) Locks() ([]Lock, error) {
+	locks := []Lock{}
+	err := g.view(func(now time.Time) {
+		locks = g.locksLocked(now)
+	})
+	return locks, err
+}
+
+// locksLocked 列出仍在计数期内的记录，调用方需持有锁
+func (g *Guard) locksLocked(now time.Time) []Lock {
+	locks := []Lock{}
+	for k, e := range g.entries {
+		if g.expired(k, e, now) {
+			continue
+		}
+		lock := Lock{
+			Scope:       k.scope,
+			Key:         k.value,
+			Failures:    e.failures,
+			LastFailure: e.lastFailure,
+		}
+		if now.Before(e.lockedUntil) {
+			lockedUntil := e.lockedUntil
+			lock.LockedUntil = &lockedUntil
+		}
+		if wait := g.waitLocked(k, now); wait > 0 {
+			retryAt := now.Add(wait)
+			lock.RetryAt = &retryAt
+		}
+		locks = append(locks, lock)
+	}
+
+	sort.Slice(locks, func(i, j int) bool {
+		if (locks[i].LockedUntil != nil) != (locks[j].LockedUntil != nil) {
+			return locks[i].LockedUntil != nil
+		}
+		if locks[i].Scope != locks[j].Scope {
+			return locks[i].Scope < locks[j].Scope
+		}
+		return locks[i].Key < locks[j].Key
+	})
+	return locks
+}
+
+// Unlock 清除用户名或 IP 的失败记录和锁定，记录不存在时返回 false
+func (g *Guard) Unlock(scope Scope, value string) (bool, error) {
+	if scope == ScopeUser {
+		value = normalize(value)
+	}
+
+	found := false
+	err := g.update(func(time.Time) {
+		k := key{scope, value}
+		if _, found = g.entries[k]; found {
+			delete(g.entries, k)
+		}
+	})
+	return found, err
+}
+
+// waitLocked 计算单个键还需等待的时间，调用方需持有锁
+func (g *Guard) waitLocked(k key, now time.Time) time.Duration {
+	e, ok := g.entries[k]
+	if !ok {
+		return 0
+	}
+	if now.Before(e.lockedUntil) {
+		return e.lockedUntil.Sub(now)
+	}
+	if next := e.lastFailure.Add(g.delay(k.scope, e.failures)); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// failLocked 增加失败计数，本次失败触发锁定时返回 true；调用方需持有锁
+func (g *Guard) failLocked(k key, limit int, now time.Time, ip string) bool {
+	if k.value == "" {
+		return false
+	}
+
+	e, ok := g.entries[k]
+	if !ok || g.expired(k, e, now) {
+		e = &entry{}
+		g.entries[k] = e
+	}
+	e.failures++
+	e.lastFailure = now
+
+	if limit > 0 && e.failures >= limit && e.lockedUntil.IsZero() {
+		e.lockedUntil = now.Add(g.cfg.Duration)
+		log.WithFields(log.Fields{
+			"event":        "login_lockout",
+			"scope":        k.scope,
+			"key":          k.value,
+			"failures":     e.failures,
+			"locked_until": e.lockedUntil.Format(time.RFC3339),
+			"remote_addr":  ip,
+		}).Warn("security event: login locked after repeated failures")
+		return true
+	}
+	return false
+}
+
+// delay 计算失败 failures 次后的等待时间
+func (g *Guard) delay(scope Scope, failures int) time.Duration {
+	after := g.cfg.UserBackoffAfter
+	if scope == ScopeIP {
+		after = g.cfg.IPBackoffAfter
+	}
+
+	n := failures - after
+	if n < 0 || g.cfg.BackoffBase <= 0 {
+		return 0
+	}
+
+	d := g.cfg.BackoffBase
+	for i := 0; i < n && d < g.cfg.BackoffMax; i++ {
+		d *= 2
+	}
+	if g.cfg.BackoffMax > 0 && d > g.cfg.BackoffMax {
+		d = g.cfg.BackoffMax
+	}
+	return d
+}
+
+// expired 判断记录是否已失效：锁定已结束，或未锁定且超过计数窗口
+func (g *Guard) expired(k key, e *entry, now time.Time) bool {
+	if !e.lockedUntil.IsZero() {
+		return !now.Before(e.lockedUntil)
+	}
+	return now.Sub(e.lastFailure) > g.cfg.FailureWindow && !now.Before(e.lastFailure.Add(g.delay(k.scope, e.failures)))
+}
+
+// pruneLocked 定期清理失效记录，调用方需持有锁
+func (g *Guard) pruneLocked(now time.Time) {
+	if now.Sub(g.lastPrune) < pruneInterval {
+		return
+	}
+	g.lastPrune = now
+
+	for k, e := range g.entries {
+		if g.expired(k, e, now) {
+			delete(g.entries, k)
+		}
+	}
+}
+
+// normalize 用户名不区分大小写
+func normalize(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,184 @@
+package lockout
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+// testConfig 不退避、失败 3 次锁定用户名的配置
+func testConfig(path string) *config.LockoutConfig {
+	return &config.LockoutConfig{
+		MaxUserFailures:  3,
+		MaxIPFailures:    100,
+		UserBackoffAfter: 100,
+		IPBackoffAfter:   100,
+		Duration:         time.Minute,
+		FailureWindow:    time.Minute,
+		StorePath:        path,
+	}
+}
+
+func newTestGuard(t *testing.T, path string) *Guard {
+	t.Helper()
+
+	g, err := NewGuard(testConfig(path))
+	if err != nil {
+		t.Fatalf("NewGuard: %v", err)
+	}
+	return g
+}
+
+// failures 返回键的失败次数
+func failures(t *testing.T, g *Guard, scope Scope, value string) int {
+	t.Helper()
+
+	locks, err := g.Locks()
+	if err != nil {
+		t.Fatalf("Locks: %v", err)
+	}
+	for _, l := range locks {
+		if l.Scope == scope && l.Key == value {
+			return l.Failures
+		}
+	}
+	return 0
+}
+
+func TestBeginConcurrentAttemptsCannotExceedLimit(t *testing.T) {
+	g := newTestGuard(t, "")
+
+	const attempts = 50
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt, wait, err := g.Begin("alice", "192.0.2.1")
+			if err != nil {
+				t.Errorf("Begin: %v", err)
+				return
+			}
+			if wait > 0 {
+				return
+			}
+			mu.Lock()
+			allowed++
+			mu.Unlock()
+			attempt.Fail()
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 3 {
+		t.Fatalf("allowed %d concurrent attempts, want 3", allowed)
+	}
+	if _, wait, _ := g.Begin("ALICE", "198.51.100.1"); wait <= 0 {
+		t.Fatal("username not locked after reaching the limit")
+	}
+}
+
+func TestAttemptSucceedAndCancel(t *testing.T) {
+	g := newTestGuard(t, "")
+	ip := "192.0.2.1"
+
+	for i := 0; i < 2; i++ {
+		attempt, _, err := g.Begin("alice", ip)
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		attempt.Fail()
+	}
+
+	// 后端不可用等情况不计入失败
+	attempt, _, _ := g.Begin("alice", ip)
+	attempt.Cancel()
+	if got := failures(t, g, ScopeUser, "alice"); got != 2 {
+		t.Fatalf("user failures after Cancel = %d, want 2", got)
+	}
+
+	// 成功清除用户名计数，IP 只退回本次的预先计数
+	attempt, _, _ = g.Begin("alice", ip)
+	attempt.Succeed()
+	if got := failures(t, g, ScopeUser, "alice"); got != 0 {
+		t.Fatalf("user failures after Succeed = %d, want 0", got)
+	}
+	if got := failures(t, g, ScopeIP, ip); got != 2 {
+		t.Fatalf("ip failures after Succeed = %d, want 2", got)
+	}
+}
+
+func TestAttemptSucceedUndoesOwnLockout(t *testing.T) {
+	g := newTestGuard(t, "")
+
+	for i := 0; i < 2; i++ {
+		attempt, _, _ := g.Begin("alice", "192.0.2.1")
+		attempt.Fail()
+	}
+	// 第三次尝试预先计数时达到上限，成功后不应保持锁定
+	attempt, wait, _ := g.Begin("alice", "192.0.2.1")
+	if wait > 0 {
+		t.Fatalf("third attempt throttled for %s", wait)
+	}
+	attempt.Succeed()
+
+	if _, wait, _ := g.Begin("alice", "192.0.2.1"); wait > 0 {
+		t.Fatalf("still locked after successful attempt: wait %s", wait)
+	}
+}
+
+func TestAddUserChecksLockedUser(t *testing.T) {
+	g := newTestGuard(t, "")
+	for i := 0; i < 3; i++ {
+		attempt, _, _ := g.Begin("alice", "192.0.2.1")
+		attempt.Fail()
+	}
+
+	// 无密码登录开始时不知道用户
+	attempt, wait, err := g.Begin("", "198.51.100.1")
+	if err != nil || wait > 0 {
+		t.Fatalf("Begin = %s, %v", wait, err)
+	}
+	if wait, err := attempt.AddUser("alice", "198.51.100.1"); err != nil || wait <= 0 {
+		t.Fatalf("AddUser = %s, %v, want wait", wait, err)
+	}
+	if got := failures(t, g, ScopeIP, "198.51.100.1"); got != 0 {
+		t.Fatalf("ip failures after throttled AddUser = %d, want 0", got)
+	}
+}
+
+func TestGuardSharedBetweenReplicas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lockout.json")
+	replicas := []*Guard{newTestGuard(t, path), newTestGuard(t, path), newTestGuard(t, path)}
+
+	// 轮流访问各副本，总次数仍受同一上限约束
+	allowed := 0
+	for i := 0; i < 9; i++ {
+		attempt, wait, err := replicas[i%len(replicas)].Begin("alice", "192.0.2.1")
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		if wait == 0 {
+			allowed++
+			attempt.Fail()
+		}
+	}
+	if allowed != 3 {
+		t.Fatalf("allowed %d attempts across replicas, want 3", allowed)
+	}
+
+	found, err := replicas[1].Unlock(ScopeUser, "Alice")
+	if err != nil || !found {
+		t.Fatalf("Unlock = %v, %v", found, err)
+	}
+	if _, wait, _ := replicas[2].Begin("alice", "192.0.2.1"); wait > 0 {
+		t.Fatalf("unlock on one replica not visible on another: wait %s", wait)
+	}
+}
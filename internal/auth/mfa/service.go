@@ -0,0 +1,215 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 认证方式（RFC 8176 amr 取值）
+const (
+	MethodOTP = "otp"
+	// MethodRecovery 使用恢复码完成的第二因素
+	MethodRecovery = "recovery"
+)
+
+var (
+	ErrAlreadyEnabled = errors.New("mfa already enabled")
+	ErrInvalidCode    = errors.New("invalid mfa code")
+)
+
+// recoveryEncoding 恢复码使用小写 base32，去掉易混淆的填充
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Setup 开始登记时返回给用户的 TOTP 密钥
+type Setup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// Status 用户的 MFA 状态
+type Status struct {
+	Enabled                bool       `json:"enabled"`
+	Pending                bool       `json:"pending"` // 已开始登记但尚未确认
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+	ConfirmedAt            *time.Time `json:"confirmed_at,omitempty"`
+}
+
+// Service TOTP 多因素认证服务
+type Service struct {
+	store         Store
+	issuer        string
+	recoveryCodes int
+}
+
+// NewService 创建 MFA 服务，issuer 显示在验证器应用中
+func NewService(store Store, issuer string, recoveryCodes int) *Service {
+	return &Service{
+		store:         store,
+		issuer:        issuer,
+		recoveryCodes: recoveryCodes,
+	}
+}
+
+// Enabled 判断用户是否已启用 MFA
+func (s *Service) Enabled(ctx context.Context, userID string) (bool, error) {
+	e, err := s.store.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotEnrolled) {
+			return false, nil
+		}
+		return false, err
+	}
+	return e.Confirmed, nil
+}
+
+// Status 返回用户的 MFA 状态
+func (s *Service) Status(ctx context.Context, userID string) (*Status, error) {
+	e, err := s.store.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotEnrolled) {
+			return &Status{}, nil
+		}
+		return nil, err
+	}
+	return &Status{
+		Enabled:                e.Confirmed,
+		Pending:                !e.Confirmed,
+		RecoveryCodesRemaining: len(e.RecoveryCodes),
+		ConfirmedAt:            e.ConfirmedAt,
+	}, nil
+}
+
+// Begin 开始登记 TOTP，生成新密钥；未确认的登记会被覆盖，已启用时返回 ErrAlreadyEnabled
+func (s *Service) Begin(ctx context.Context, userID, account string) (*Setup, error) {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrAlreadyEnabled
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.Save(ctx, &Enrollment{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Setup{
+		Secret:          secret,
+		ProvisioningURI: provisioningURI(s.issuer, account, secret),
+	}, nil
+}
+
+// Confirm 用第一个验证码确认登记，启用 MFA 并返回一次性恢复码（只返回这一次）
+func (s *Service) Confirm(ctx context.Context, userID, code string) ([]string, error) {
+	codes, hashes, err := s.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.Update(ctx, userID, func(e *Enrollment) error {
+		if e.Confirmed {
+			return ErrAlreadyEnabled
+		}
+		step, ok := validateTOTP(e.Secret, normalizeCode(code), time.Now())
+		if !ok {
+			return ErrInvalidCode
+		}
+
+		now := time.Now()
+		e.Confirmed = true
+		e.ConfirmedAt = &now
+		e.LastStep = step
+		e.RecoveryCodes = hashes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify 校验 TOTP 验证码或恢复码，返回使用的认证方式
+//
+// 同一时间步的验证码只能使用一次，恢复码使用后失效。
+func (s *Service) Verify(ctx context.Context, userID, code string) (string, error) {
+	code = normalizeCode(code)
+	method := MethodOTP
+
+	err := s.store.Update(ctx, userID, func(e *Enrollment) error {
+		if !e.Confirmed {
+			return ErrNotEnrolled
+		}
+
+		if len(code) == totpDigits {
+			step, ok := validateTOTP(e.Secret, code, time.Now())
+			if !ok || step <= e.LastStep {
+				return ErrInvalidCode
+			}
+			e.LastStep = step
+			return nil
+		}
+
+		method = MethodRecovery
+		hash := hashRecoveryCode(code)
+		for i, stored := range e.RecoveryCodes {
+			if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+				e.RecoveryCodes = append(e.RecoveryCodes[:i], e.RecoveryCodes[i+1:]...)
+				return nil
+			}
+		}
+		return ErrInvalidCode
+	})
+	if err != nil {
+		return "", err
+	}
+	return method, nil
+}
+
+// Disable 删除用户的 MFA 登记
+func (s *Service) Disable(ctx context.Context, userID string) error {
+	return s.store.Delete(ctx, userID)
+}
+
+// newRecoveryCodes 生成恢复码及其哈希
+func (s *Service) newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, s.recoveryCodes)
+	hashes := make([]string, 0, s.recoveryCodes)
+	for i := 0; i < s.recoveryCodes; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeCode 去掉用户输入中的空格和连字符，恢复码不区分大小写
+func normalizeCode(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+	return strings.ToLower(code)
+}
+
+// hashRecoveryCode 恢复码为 50 位随机值，使用 SHA-256 存储即可
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,249 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUserID = "user-1"
+
+// codeAt 计算密钥在当前时间偏移 offset 个时间步时的验证码
+func codeAt(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+
+	key, err := secretEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	return hotp(key, time.Now().Unix()/int64(totpPeriod.Seconds())+offset)
+}
+
+// enroll 完成登记，返回密钥、确认时使用的验证码（上一个时间步）和恢复码
+func enroll(t *testing.T, s *Service) (string, string, []string) {
+	t.Helper()
+
+	ctx := context.Background()
+	setup, err := s.Begin(ctx, testUserID, "alice")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	confirmation := codeAt(t, setup.Secret, -1)
+	codes, err := s.Confirm(ctx, testUserID, confirmation)
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	return setup.Secret, confirmation, codes
+}
+
+func TestServiceEnrollmentLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewMemoryStore(), "Example API", 10)
+
+	if st, err := s.Status(ctx, testUserID); err != nil || st.Enabled || st.Pending {
+		t.Fatalf("Status() before Begin = %+v, %v", st, err)
+	}
+	if _, err := s.Verify(ctx, testUserID, "123456"); !errors.Is(err, ErrNotEnrolled) {
+		t.Fatalf("Verify() before Begin error = %v, want %v", err, ErrNotEnrolled)
+	}
+
+	setup, err := s.Begin(ctx, testUserID, "alice")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if !strings.Contains(setup.ProvisioningURI, "secret="+setup.Secret) {
+		t.Fatalf("ProvisioningURI = %q, want secret %s", setup.ProvisioningURI, setup.Secret)
+	}
+	if st, _ := s.Status(ctx, testUserID); st.Enabled || !st.Pending {
+		t.Fatalf("Status() after Begin = %+v, want pending", st)
+	}
+	// 未确认的登记不能用于登录
+	if _, err := s.Verify(ctx, testUserID, codeAt(t, setup.Secret, 0)); !errors.Is(err, ErrNotEnrolled) {
+		t.Fatalf("Verify() while pending error = %v, want %v", err, ErrNotEnrolled)
+	}
+
+	// 重新开始登记会替换未确认的密钥
+	restarted, err := s.Begin(ctx, testUserID, "alice")
+	if err != nil {
+		t.Fatalf("Begin again: %v", err)
+	}
+	if restarted.Secret == setup.Secret {
+		t.Fatal("Begin() reused the pending secret")
+	}
+	if _, err := s.Confirm(ctx, testUserID, codeAt(t, setup.Secret, 0)); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Confirm() with the replaced secret error = %v, want %v", err, ErrInvalidCode)
+	}
+
+	codes, err := s.Confirm(ctx, testUserID, codeAt(t, restarted.Secret, 0))
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("Confirm() returned %d recovery codes, want 10", len(codes))
+	}
+	st, _ := s.Status(ctx, testUserID)
+	if !st.Enabled || st.Pending || st.RecoveryCodesRemaining != 10 || st.ConfirmedAt == nil {
+		t.Fatalf("Status() after Confirm = %+v", st)
+	}
+
+	// 已启用时不能重新登记或重复确认
+	if _, err := s.Begin(ctx, testUserID, "alice"); !errors.Is(err, ErrAlreadyEnabled) {
+		t.Fatalf("Begin() when enabled error = %v, want %v", err, ErrAlreadyEnabled)
+	}
+	if _, err := s.Confirm(ctx, testUserID, codeAt(t, restarted.Secret, 1)); !errors.Is(err, ErrAlreadyEnabled) {
+		t.Fatalf("Confirm() when enabled error = %v, want %v", err, ErrAlreadyEnabled)
+	}
+
+	if err := s.Disable(ctx, testUserID); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	if enabled, err := s.Enabled(ctx, testUserID); err != nil || enabled {
+		t.Fatalf("Enabled() after Disable = %v, %v", enabled, err)
+	}
+	if _, err := s.Verify(ctx, testUserID, codes[0]); !errors.Is(err, ErrNotEnrolled) {
+		t.Fatalf("Verify() after Disable error = %v, want %v", err, ErrNotEnrolled)
+	}
+	if _, err := s.Begin(ctx, testUserID, "alice"); err != nil {
+		t.Fatalf("Begin after Disable: %v", err)
+	}
+}
+
+func TestConfirmRejectsInvalidCode(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewMemoryStore(), "Example API", 10)
+
+	if _, err := s.Confirm(ctx, testUserID, "123456"); !errors.Is(err, ErrNotEnrolled) {
+		t.Fatalf("Confirm() without Begin error = %v, want %v", err, ErrNotEnrolled)
+	}
+
+	setup, err := s.Begin(ctx, testUserID, "alice")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := s.Confirm(ctx, testUserID, codeAt(t, setup.Secret, 3)); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Confirm() with a code outside the window error = %v, want %v", err, ErrInvalidCode)
+	}
+	if enabled, _ := s.Enabled(ctx, testUserID); enabled {
+		t.Fatal("failed Confirm() enabled mfa")
+	}
+}
+
+func TestVerifyRejectsReusedTimeStep(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewMemoryStore(), "Example API", 10)
+	secret, confirmation, _ := enroll(t, s)
+
+	// 确认时使用的验证码不能再用于登录
+	if _, err := s.Verify(ctx, testUserID, confirmation); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Verify() with the confirmation code error = %v, want %v", err, ErrInvalidCode)
+	}
+
+	code := codeAt(t, secret, 1)
+	method, err := s.Verify(ctx, testUserID, code[:3]+" "+code[3:])
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if method != MethodOTP {
+		t.Fatalf("Verify() method = %q, want %q", method, MethodOTP)
+	}
+	if _, err := s.Verify(ctx, testUserID, code); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Verify() replayed error = %v, want %v", err, ErrInvalidCode)
+	}
+	// 早于最近一次使用的时间步同样拒绝
+	if _, err := s.Verify(ctx, testUserID, codeAt(t, secret, 0)); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Verify() with an earlier step error = %v, want %v", err, ErrInvalidCode)
+	}
+}
+
+func TestVerifyRecoveryCodesSingleUse(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	s := NewService(store, "Example API", 3)
+	_, _, codes := enroll(t, s)
+
+	// 存储中只保存恢复码的哈希
+	e, err := store.Get(ctx, testUserID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(e.RecoveryCodes) != 3 {
+		t.Fatalf("stored %d recovery codes, want 3", len(e.RecoveryCodes))
+	}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("recovery code %q, want xxxxx-xxxxx", code)
+		}
+		if e.RecoveryCodes[i] != hashRecoveryCode(normalizeCode(code)) {
+			t.Fatalf("stored recovery code %d is not the hash of %q", i, code)
+		}
+		for _, stored := range e.RecoveryCodes {
+			if strings.Contains(stored, normalizeCode(code)) {
+				t.Fatalf("stored recovery codes contain %q in plaintext", code)
+			}
+		}
+	}
+
+	// 恢复码不区分大小写，连字符可省略
+	method, err := s.Verify(ctx, testUserID, strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")))
+	if err != nil {
+		t.Fatalf("Verify recovery code: %v", err)
+	}
+	if method != MethodRecovery {
+		t.Fatalf("Verify() method = %q, want %q", method, MethodRecovery)
+	}
+	if _, err := s.Verify(ctx, testUserID, codes[1]); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Verify() with a used recovery code error = %v, want %v", err, ErrInvalidCode)
+	}
+	if _, err := s.Verify(ctx, testUserID, "aaaaa-bbbbb"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Verify() with an unknown recovery code error = %v, want %v", err, ErrInvalidCode)
+	}
+
+	st, _ := s.Status(ctx, testUserID)
+	if st.RecoveryCodesRemaining != 2 {
+		t.Fatalf("RecoveryCodesRemaining = %d, want 2", st.RecoveryCodesRemaining)
+	}
+	// 其余恢复码仍然有效
+	if _, err := s.Verify(ctx, testUserID, codes[0]); err != nil {
+		t.Fatalf("Verify remaining recovery code: %v", err)
+	}
+}
+
+func TestFileStorePersistsEnrollment(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mfa.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	_, confirmation, codes := enroll(t, NewService(store, "Example API", 3))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read store: %v", err)
+	}
+	for _, code := range codes {
+		if strings.Contains(string(data), normalizeCode(code)) {
+			t.Fatalf("store file contains recovery code %q in plaintext", code)
+		}
+	}
+
+	// 重启后登记和已使用的时间步仍然有效
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	s := NewService(reopened, "Example API", 3)
+	if enabled, err := s.Enabled(ctx, testUserID); err != nil || !enabled {
+		t.Fatalf("Enabled() after restart = %v, %v", enabled, err)
+	}
+	if _, err := s.Verify(ctx, testUserID, confirmation); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Verify() with the confirmation code after restart error = %v, want %v", err, ErrInvalidCode)
+	}
+	if _, err := s.Verify(ctx, testUserID, codes[0]); err != nil {
+		t.Fatalf("Verify recovery code after restart: %v", err)
+	}
+}
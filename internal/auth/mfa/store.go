@@ -0,0 +1,241 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotEnrolled = errors.New("mfa not enrolled")
+)
+
+// Enrollment 用户的 TOTP 登记
+type Enrollment struct {
+	UserID        string     `json:"user_id"`
+	Secret        string     `json:"secret"` // base32 TOTP 密钥
+	Confirmed     bool       `json:"confirmed"`
+	RecoveryCodes []string   `json:"recovery_codes,omitempty"` // 未使用的恢复码的 SHA-256
+	LastStep      int64      `json:"last_step"`                // 最近一次使用的时间步，拒绝重放
+	CreatedAt     time.Time  `json:"created_at"`
+	ConfirmedAt   *time.Time `json:"confirmed_at,omitempty"`
+}
+
+// Store MFA 登记存储
+type Store interface {
+	// Get 查询用户的登记，不存在时返回 ErrNotEnrolled
+	Get(ctx context.Context, userID string) (*Enrollment, error)
+
+	// Save 创建或覆盖用户的登记
+	Save(ctx context.Context, enrollment *Enrollment) error
+
+	// Update 原子地修改用户的登记，fn 返回错误时放弃修改；不存在时返回 ErrNotEnrolled
+	Update(ctx context.Context, userID string, fn func(*Enrollment) error) error
+
+	// Delete 删除用户的登记
+	Delete(ctx context.Context, userID string) error
+}
+
+// MemoryStore 内存 MFA 登记存储
+type MemoryStore struct {
+	mu          sync.Mutex
+	enrollments map[string]*Enrollment
+}
+
+// NewMemoryStore 创建内存 MFA 登记存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		enrollments: make(map[string]*Enrollment),
+	}
+}
+
+// Get 查询用户的登记，返回副本
+func (s *MemoryStore) Get(ctx context.Context, userID string) (*Enrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.enrollments[userID]
+	if !ok {
+		return nil, ErrNotEnrolled
+	}
+	return e.clone(), nil
+}
+
+// Save 创建或覆盖用户的登记
+func (s *MemoryStore) Save(ctx context.Context, enrollment *Enrollment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enrollments[enrollment.UserID] = enrollment.clone()
+	return nil
+}
+
+// Update 原子地修改用户的登记
+func (s *MemoryStore) Update(ctx context.Context, userID string, fn func(*Enrollment) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.updateLocked(userID, fn)
+	return err
+}
+
+// Delete 删除用户的登记
+func (s *MemoryStore) Delete(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.enrollments, userID)
+	return nil
+}
+
+// updateLocked 在副本上执行修改，成功后替换原记录，调用方需持有锁
+func (s *MemoryStore) updateLocked(userID string, fn func(*Enrollment) error) (*Enrollment, error) {
+	e, ok := s.enrollments[userID]
+	if !ok {
+		return nil, ErrNotEnrolled
+	}
+
+	updated := e.clone()
+	if err := fn(updated); err != nil {
+		return nil, err
+	}
+	s.enrollments[userID] = updated
+	return e, nil
+}
+
+// FileStore 基于 JSON 文件持久化的 MFA 登记存储
+//
+// 文件中包含 TOTP 密钥，应限制访问权限（0600）。
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore 创建文件 MFA 登记存储，文件存在时加载已有记录
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read mfa store: %w", err)
+	}
+
+	var enrollments []*Enrollment
+	if err := json.Unmarshal(data, &enrollments); err != nil {
+		return nil, fmt.Errorf("decode mfa store: %w", err)
+	}
+	for _, e := range enrollments {
+		s.enrollments[e.UserID] = e
+	}
+
+	return s, nil
+}
+
+// Save 创建或覆盖用户的登记并持久化
+func (s *FileStore) Save(ctx context.Context, enrollment *Enrollment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.enrollments[enrollment.UserID]
+	s.enrollments[enrollment.UserID] = enrollment.clone()
+	if err := s.persistLocked(); err != nil {
+		s.restoreLocked(enrollment.UserID, previous, existed)
+		return err
+	}
+	return nil
+}
+
+// Update 原子地修改用户的登记并持久化
+func (s *FileStore) Update(ctx context.Context, userID string, fn func(*Enrollment) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := s.updateLocked(userID, fn)
+	if err != nil {
+		return err
+	}
+	if err := s.persistLocked(); err != nil {
+		s.restoreLocked(userID, previous, true)
+		return err
+	}
+	return nil
+}
+
+// Delete 删除用户的登记并持久化
+func (s *FileStore) Delete(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.enrollments[userID]
+	if !existed {
+		return nil
+	}
+	delete(s.enrollments, userID)
+	if err := s.persistLocked(); err != nil {
+		s.restoreLocked(userID, previous, true)
+		return err
+	}
+	return nil
+}
+
+// restoreLocked 持久化失败时恢复内存中的原记录，调用方需持有锁
+func (s *FileStore) restoreLocked(userID string, previous *Enrollment, existed bool) {
+	if existed {
+		s.enrollments[userID] = previous
+	} else {
+		delete(s.enrollments, userID)
+	}
+}
+
+// persistLocked 先写临时文件再重命名，避免写入中断导致文件损坏
+func (s *FileStore) persistLocked() error {
+	enrollments := make([]*Enrollment, 0, len(s.enrollments))
+	for _, e := range s.enrollments {
+		enrollments = append(enrollments, e)
+	}
+
+	data, err := json.Marshal(enrollments)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write mfa store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write mfa store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write mfa store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("write mfa store: %w", err)
+	}
+	return nil
+}
+
+// clone 返回登记的深拷贝
+func (e *Enrollment) clone() *Enrollment {
+	c := *e
+	c.RecoveryCodes = append([]string(nil), e.RecoveryCodes...)
+	if e.ConfirmedAt != nil {
+		t := *e.ConfirmedAt
+		c.ConfirmedAt = &t
+	}
+	return &c
+}
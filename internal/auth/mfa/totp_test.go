@@ -0,0 +1,109 @@
+package mfa
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238 附录 B 中 SHA-1 测试向量使用的密钥 "12345678901234567890"
+var rfc6238Secret = secretEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPRFC6238Vectors(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA-1 向量为 8 位，6 位验证码取其末 6 位
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		step, ok := validateTOTP(rfc6238Secret, tt.code, now)
+		if !ok {
+			t.Errorf("validateTOTP(%s) at %d rejected the RFC vector", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / 30; step != want {
+			t.Errorf("validateTOTP(%s) at %d step = %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkewWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / 30
+
+	tests := []struct {
+		name   string
+		offset int64
+		want   bool
+	}{
+		{name: "two steps behind", offset: -2},
+		{name: "one step behind", offset: -1, want: true},
+		{name: "current step", offset: 0, want: true},
+		{name: "one step ahead", offset: 1, want: true},
+		{name: "two steps ahead", offset: 2},
+	}
+
+	key, _ := secretEncoding.DecodeString(rfc6238Secret)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := hotp(key, current+tt.offset)
+			step, ok := validateTOTP(rfc6238Secret, code, now)
+			if ok != tt.want {
+				t.Fatalf("validateTOTP() = %v, want %v", ok, tt.want)
+			}
+			if ok && step != current+tt.offset {
+				t.Fatalf("validateTOTP() step = %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+	}{
+		{name: "wrong code", secret: rfc6238Secret, code: "287083"},
+		{name: "8 digit code", secret: rfc6238Secret, code: "94287082"},
+		{name: "short code", secret: rfc6238Secret, code: "28708"},
+		{name: "empty code", secret: rfc6238Secret, code: ""},
+		{name: "invalid secret", secret: "not base32!", code: "287082"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := validateTOTP(tt.secret, tt.code, now); ok {
+				t.Fatal("validateTOTP() accepted the code")
+			}
+		})
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	raw := provisioningURI("Example API", "alice@example.com", rfc6238Secret)
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Example API:alice@example.com" {
+		t.Fatalf("provisioningURI() = %q", raw)
+	}
+	q := u.Query()
+	if q.Get("secret") != rfc6238Secret || q.Get("issuer") != "Example API" ||
+		q.Get("algorithm") != "SHA1" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Fatalf("provisioningURI() query = %v", q)
+	}
+}
@@ -2,11 +2,20 @@ package middleware
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"strings"
 
+	"github.com/jason0730/claude-code-demo/internal/auth/apikey"
+	"github.com/jason0730/claude-code-demo/internal/auth/certauth"
+	"github.com/jason0730/claude-code-demo/internal/auth/dpop"
+	"github.com/jason0730/claude-code-demo/internal/auth/identity"
 	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/auth/revocation"
 	"github.com/jason0730/claude-code-demo/internal/model"
 	log "github.com/sirupsen/logrus"
 )
@@ -20,12 +29,29 @@ const (
 // AuthMiddleware 认证中间件
 type AuthMiddleware struct {
 	tokenManager *jwt.TokenManager
+	revocations  revocation.Store
+	apiKeys      *apikey.Service
+	certs        *certauth.Mapper
+	dpop         *dpop.Verifier
+	users        identity.UserStore
 }
 
-// NewAuthMiddleware 创建认证中间件
-func NewAuthMiddleware(tokenManager *jwt.TokenManager) *AuthMiddleware {
+// NewAuthMiddleware 创建认证中间件，users 用于查询个人访问令牌和客户端证书所属用户的当前角色
+func NewAuthMiddleware(
+	tokenManager *jwt.TokenManager,
+	revocations revocation.Store,
+	apiKeys *apikey.Service,
+	certs *certauth.Mapper,
+	dpopVerifier *dpop.Verifier,
+	users identity.UserStore,
+) *AuthMiddleware {
 	return &AuthMiddleware{
 		tokenManager: tokenManager,
+		revocations:  revocations,
+		apiKeys:      apiKeys,
+		certs:        certs,
+		dpop:         dpopVerifier,
+		users:        users,
 	}
 }
 
@@ -35,18 +61,30 @@ func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 		// 从请求头获取 token
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
+			// 没有令牌时，已通过校验的客户端证书可以直接作为身份
+			if cert := certauth.PeerCertificate(r); cert != nil && am.certs.Enabled() {
+				am.authenticateCertificate(w, r, next, cert)
+				return
+			}
 			am.respondError(w, http.StatusUnauthorized, "missing authorization header")
 			return
 		}
 
-		// 解析 Bearer Token
+		// 解析 Bearer 或 DPoP 令牌
 		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 || (parts[0] != "Bearer" && !strings.EqualFold(parts[0], dpop.Scheme)) {
 			am.respondError(w, http.StatusUnauthorized, "invalid authorization header format")
 			return
 		}
 
 		tokenString := parts[1]
+		usesDPoP := parts[0] != "Bearer"
+
+		// 个人访问令牌以固定前缀开头，与 JWT 走不同的校验流程
+		if apikey.IsAPIKey(tokenString) && !usesDPoP {
+			am.authenticateAPIKey(w, r, next, tokenString)
+			return
+		}
 
 		// 验证 token
 		claims, err := am.tokenManager.ValidateToken(tokenString)
@@ -56,6 +94,49 @@ func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// 绑定证书的令牌只能由持有该证书的客户端使用（RFC 8705）
+		if bound := claims.Confirmation.CertThumbprint(); bound != "" && certauth.RequestThumbprint(r) != bound {
+			log.WithFields(log.Fields{
+				"user_id": claims.UserID,
+				"jti":     claims.ID,
+			}).Warn("certificate-bound token presented without the bound client certificate")
+			am.respondError(w, http.StatusUnauthorized, "token is bound to a different client certificate")
+			return
+		}
+
+		// 绑定 DPoP 公钥的令牌必须使用 DPoP 方案，并附带由该公钥签名的当次请求证明（RFC 9449）
+		if !am.checkDPoP(w, r, claims, tokenString, usesDPoP) {
+			return
+		}
+
+		// 检查令牌是否已被吊销（登出、会话被删除或强制下线）
+		revoked, err := revocation.IsAccessTokenRevoked(r.Context(), am.revocations, claims.ID, claims.Subject, claims.SessionID, jwt.TimeOf(claims.IssuedAt))
+		if err != nil {
+			log.WithError(err).Error("failed to check token revocation")
+			am.respondError(w, http.StatusUnauthorized, "invalid or expired token")
+			return
+		}
+		if revoked {
+			log.WithFields(log.Fields{
+				"user_id": claims.UserID,
+				"jti":     claims.ID,
+			}).Warn("revoked token rejected")
+			am.respondError(w, http.StatusUnauthorized, "token has been revoked")
+			return
+		}
+
+		// 委托令牌代表其他用户操作，每个请求都记录主体和行为方供审计
+		if claims.IsDelegated() {
+			log.WithFields(log.Fields{
+				"event":     "delegated_request",
+				"user_id":   claims.UserID,
+				"actor":     claims.ActorSubject(),
+				"client_id": claims.ClientID,
+				"method":    r.Method,
+				"path":      r.URL.Path,
+			}).Info("security event: request on behalf of user")
+		}
+
 		// 将 claims 存入 context
 		ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
 
@@ -64,6 +145,195 @@ func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// checkDPoP 校验访问令牌的 DPoP 绑定，失败时写入响应并返回 false
+func (am *AuthMiddleware) checkDPoP(w http.ResponseWriter, r *http.Request, claims *jwt.CustomClaims, token string, usesDPoP bool) bool {
+	bound := claims.Confirmation.KeyThumbprint()
+	fields := log.Fields{
+		"user_id": claims.UserID,
+		"jti":     claims.ID,
+	}
+
+	switch {
+	case bound == "" && !usesDPoP:
+		return true
+	case bound == "":
+		log.WithFields(fields).Warn("unbound token presented with the DPoP scheme")
+		am.respondDPoPError(w, "invalid_token", "token is not DPoP-bound")
+		return false
+	case !usesDPoP:
+		log.WithFields(fields).Warn("DPoP-bound token presented as a bearer token")
+		am.respondDPoPError(w, "invalid_token", "DPoP-bound token must use the DPoP authorization scheme")
+		return false
+	}
+
+	jkt, err := am.dpop.Verify(r, token)
+	if err != nil {
+		if errors.Is(err, dpop.ErrInvalidProof) {
+			log.WithError(err).WithFields(fields).Warn("DPoP proof rejected")
+		} else {
+			log.WithError(err).Error("failed to verify DPoP proof")
+		}
+		am.respondDPoPError(w, "invalid_dpop_proof", "invalid DPoP proof")
+		return false
+	}
+	if jkt != bound {
+		log.WithFields(fields).Warn("DPoP proof signed by a key the token is not bound to")
+		am.respondDPoPError(w, "invalid_dpop_proof", "invalid DPoP proof")
+		return false
+	}
+	return true
+}
+
+// respondDPoPError 返回 401，并按 RFC 9449 在 WWW-Authenticate 中说明错误和接受的算法
+func (am *AuthMiddleware) respondDPoPError(w http.ResponseWriter, code, message string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`DPoP error=%q, algs=%q`, code, strings.Join(dpop.SigningAlgorithms, " ")))
+	am.respondError(w, http.StatusUnauthorized, message)
+}
+
+// authenticateAPIKey 校验个人访问令牌，并以令牌所属用户的身份继续处理请求
+//
+// 角色取自用户当前的角色，令牌上的权限作为 scope 进一步限制，因此用户失去的权限令牌也随之失去。
+func (am *AuthMiddleware) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	key, err := am.apiKeys.Authenticate(r.Context(), token, remoteIP(r))
+	if err != nil {
+		if errors.Is(err, apikey.ErrInvalidKey) || errors.Is(err, apikey.ErrExpiredKey) {
+			log.WithError(err).Warn("api key validation failed")
+		} else {
+			log.WithError(err).Error("failed to validate api key")
+		}
+		am.respondError(w, http.StatusUnauthorized, "invalid or expired token")
+		return
+	}
+
+	user, err := am.users.GetUser(r.Context(), key.UserID)
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			log.WithFields(log.Fields{
+				"user_id": key.UserID,
+				"key_id":  key.ID,
+			}).Warn("api key owner not found")
+		} else {
+			log.WithError(err).WithField("user_id", key.UserID).Error("user lookup failed")
+		}
+		am.respondError(w, http.StatusUnauthorized, "invalid or expired token")
+		return
+	}
+
+	claims := &jwt.CustomClaims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Roles:    user.Roles,
+		Scope:    strings.Join(key.Permissions, " "),
+		KeyID:    key.ID,
+	}
+	claims.Subject = user.ID
+
+	ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// authenticateCertificate 按映射规则将客户端证书识别为用户或服务，并以该身份继续处理请求
+func (am *AuthMiddleware) authenticateCertificate(w http.ResponseWriter, r *http.Request, next http.Handler, cert *x509.Certificate) {
+	ident, err := am.certs.Identify(cert)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"subject": cert.Subject.String(),
+			"serial":  cert.SerialNumber.String(),
+		}).Warn("client certificate is not mapped to an identity")
+		am.respondError(w, http.StatusUnauthorized, "client certificate is not mapped to an identity")
+		return
+	}
+
+	claims := &jwt.CustomClaims{
+		Scope:        strings.Join(ident.Scopes, " "),
+		Certificate:  true,
+		Confirmation: &jwt.Confirmation{X5TS256: certauth.Thumbprint(cert)},
+	}
+	if ident.IsService() {
+		claims.UserID = ident.Service
+		claims.Username = ident.Service
+		claims.ClientID = ident.Service
+		claims.Roles = ident.Roles
+		claims.Subject = ident.Service
+	} else {
+		user, err := am.users.GetUser(r.Context(), ident.UserID)
+		if err != nil {
+			if errors.Is(err, identity.ErrUserNotFound) {
+				log.WithFields(log.Fields{
+					"user_id": ident.UserID,
+					"subject": cert.Subject.String(),
+				}).Warn("client certificate user not found")
+			} else {
+				log.WithError(err).WithField("user_id", ident.UserID).Error("user lookup failed")
+			}
+			am.respondError(w, http.StatusUnauthorized, "client certificate is not mapped to an identity")
+			return
+		}
+		claims.UserID = user.ID
+		claims.Username = user.Username
+		claims.Email = user.Email
+		claims.Roles = user.Roles
+		claims.Subject = user.ID
+	}
+
+	log.WithFields(log.Fields{
+		"subject":   cert.Subject.String(),
+		"user_id":   claims.UserID,
+		"client_id": claims.ClientID,
+	}).Debug("client certificate authenticated")
+
+	ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RejectAPIKeys 只允许交互式登录签发的令牌访问，用于账户安全设置和令牌管理等端点，
+// 避免泄露的个人访问令牌被用来创建新令牌或修改认证方式，
+// 也避免代表用户操作的委托令牌（令牌交换签发）登出会话或修改用户的认证方式；
+// 只凭客户端证书认证的请求同样拒绝，证书映射的是工作负载身份，不代表用户本人在场
+func (am *AuthMiddleware) RejectAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := GetClaims(r.Context())
+		if ok && claims.IsAPIKey() {
+			log.WithFields(log.Fields{
+				"user_id": claims.UserID,
+				"key_id":  claims.KeyID,
+				"path":    r.URL.Path,
+			}).Warn("api key rejected on interactive-only endpoint")
+			am.respondError(w, http.StatusForbidden, "personal access tokens are not accepted here")
+			return
+		}
+		if ok && claims.IsDelegated() {
+			log.WithFields(log.Fields{
+				"user_id": claims.UserID,
+				"actor":   claims.ActorSubject(),
+				"path":    r.URL.Path,
+			}).Warn("delegated token rejected on interactive-only endpoint")
+			am.respondError(w, http.StatusForbidden, "delegated tokens are not accepted here")
+			return
+		}
+		if ok && claims.IsCertificate() {
+			log.WithFields(log.Fields{
+				"user_id":   claims.UserID,
+				"client_id": claims.ClientID,
+				"path":      r.URL.Path,
+			}).Warn("client certificate rejected on interactive-only endpoint")
+			am.respondError(w, http.StatusForbidden, "client certificates without a token are not accepted here")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// remoteIP 返回请求来源 IP，可信代理后的真实地址已由上游中间件写入 RemoteAddr
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // respondError 返回错误响应
 func (am *AuthMiddleware) respondError(w http.ResponseWriter, code int, message string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/certauth"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+)
+
+// newClientCert 生成自签名客户端证书
+func newClientCert(t *testing.T, commonName string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return cert
+}
+
+// okHandler 记录是否被调用并返回 200
+func okHandler(called *bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*called = true
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// serveWithClaims 以指定 claims 调用 RejectAPIKeys，返回状态码和下游是否被调用
+func serveWithClaims(am *AuthMiddleware, claims *jwt.CustomClaims) (int, bool) {
+	var called bool
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/me/tokens", nil)
+	r = r.WithContext(context.WithValue(r.Context(), ClaimsContextKey, claims))
+	w := httptest.NewRecorder()
+	am.RejectAPIKeys(okHandler(&called)).ServeHTTP(w, r)
+	return w.Code, called
+}
+
+func TestCertificateOnlyPrincipalRejectedOnInteractiveEndpoints(t *testing.T) {
+	mapper, err := certauth.NewMapper([]certauth.Rule{
+		{CommonName: "billing", Service: "billing", Roles: []string{"viewer"}},
+	})
+	if err != nil {
+		t.Fatalf("NewMapper: %v", err)
+	}
+	am := NewAuthMiddleware(nil, nil, nil, mapper, nil, nil)
+	cert := newClientCert(t, "billing")
+
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/me/tokens", nil)
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return r
+	}
+
+	// 证书身份可以访问按权限授权的端点
+	var claims *jwt.CustomClaims
+	w := httptest.NewRecorder()
+	am.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = GetClaims(r.Context())
+	})).ServeHTTP(w, newRequest())
+	if w.Code != http.StatusOK || claims == nil {
+		t.Fatalf("Authenticate() status = %d, want 200 with claims", w.Code)
+	}
+	if !claims.IsCertificate() || claims.ClientID != "billing" || claims.Confirmation.CertThumbprint() != certauth.Thumbprint(cert) {
+		t.Fatalf("certificate claims = %+v", claims)
+	}
+
+	// 交互式端点拒绝只凭证书认证的请求
+	var called bool
+	w = httptest.NewRecorder()
+	am.Authenticate(am.RejectAPIKeys(okHandler(&called))).ServeHTTP(w, newRequest())
+	if w.Code != http.StatusForbidden || called {
+		t.Fatalf("RejectAPIKeys() status = %d, called = %v, want 403", w.Code, called)
+	}
+}
+
+func TestRejectAPIKeys(t *testing.T) {
+	am := NewAuthMiddleware(nil, nil, nil, nil, nil, nil)
+
+	tests := []struct {
+		name   string
+		claims *jwt.CustomClaims
+		want   int
+	}{
+		{name: "interactive token", claims: &jwt.CustomClaims{UserID: "user-1"}, want: http.StatusOK},
+		{
+			name:   "certificate-bound token",
+			claims: &jwt.CustomClaims{UserID: "user-1", Confirmation: &jwt.Confirmation{X5TS256: "thumbprint"}},
+			want:   http.StatusOK,
+		},
+		{name: "personal access token", claims: &jwt.CustomClaims{UserID: "user-1", KeyID: "key-1"}, want: http.StatusForbidden},
+		{
+			name:   "delegated token",
+			claims: &jwt.CustomClaims{UserID: "user-1", Actor: &jwt.Actor{Subject: "gateway", ClientID: "gateway"}},
+			want:   http.StatusForbidden,
+		},
+		{name: "certificate only", claims: &jwt.CustomClaims{UserID: "user-1", Certificate: true}, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, called := serveWithClaims(am, tt.claims)
+			if code != tt.want || called != (tt.want == http.StatusOK) {
+				t.Fatalf("RejectAPIKeys() status = %d, called = %v, want %d", code, called, tt.want)
+			}
+		})
+	}
+}
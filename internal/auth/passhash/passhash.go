@@ -0,0 +1,266 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jason0730/claude-code-demo/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 支持的哈希算法
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+
+	// 配置和已有哈希允许的最大开销，防止异常记录在每次校验时耗尽内存或 CPU
+	maxArgon2Memory     = 4 * 1024 * 1024 // KiB
+	maxArgon2Iterations = 64
+	maxArgon2Length     = 64 // 盐和哈希值的最大字节数
+	maxBcryptCost       = 16
+)
+
+var (
+	ErrMismatch         = errors.New("password does not match")
+	ErrInvalidHash      = errors.New("invalid password hash")
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrInvalidParams    = errors.New("invalid password hash parameters")
+)
+
+// Hasher 密码哈希器
+//
+// 新哈希使用配置的算法和参数生成；校验时根据哈希字符串中记录的算法和参数进行，
+// 因此修改配置后已有哈希仍然有效，并在登录成功后按新配置重新哈希。
+type Hasher struct {
+	algorithm  string
+	memory     uint32
+	iterations uint32
+	threads    uint8
+	bcryptCost int
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// NewHasher 创建密码哈希器
+func NewHasher(cfg *config.PasswordConfig) (*Hasher, error) {
+	h := &Hasher{
+		algorithm:  strings.ToLower(cfg.Algorithm),
+		memory:     cfg.Argon2Memory,
+		iterations: cfg.Argon2Iterations,
+		threads:    cfg.Argon2Parallelism,
+		bcryptCost: cfg.BcryptCost,
+	}
+
+	switch h.algorithm {
+	case AlgorithmArgon2id:
+		if !validArgon2Params(h.memory, h.iterations, h.threads) {
+			return nil, fmt.Errorf("argon2id: %w", ErrInvalidParams)
+		}
+	case AlgorithmBcrypt:
+		if h.bcryptCost < bcrypt.MinCost || h.bcryptCost > maxBcryptCost {
+			return nil, fmt.Errorf("bcrypt: %w", ErrInvalidParams)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, cfg.Algorithm)
+	}
+
+	return h, nil
+}
+
+// Algorithm 返回新哈希使用的算法
+func (h *Hasher) Algorithm() string {
+	return h.algorithm
+}
+
+// Hash 使用当前算法和参数生成 PHC 格式的密码哈希
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.iterations, h.memory, h.threads, argon2KeyLength)
+	return encodeArgon2id(argon2Hash{
+		memory:     h.memory,
+		iterations: h.iterations,
+		threads:    h.threads,
+		salt:       salt,
+		key:        key,
+	}), nil
+}
+
+// Verify 校验密码，不匹配时返回 ErrMismatch
+//
+// rehash 为 true 表示哈希使用的算法或参数与当前配置不同，调用方应在登录成功后用 Hash 重新生成。
+func (h *Hasher) Verify(password, encoded string) (rehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$"+AlgorithmArgon2id+"$"):
+		parsed, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		key := argon2.IDKey([]byte(password), parsed.salt, parsed.iterations, parsed.memory, parsed.threads, uint32(len(parsed.key)))
+		if subtle.ConstantTimeCompare(key, parsed.key) != 1 {
+			return false, ErrMismatch
+		}
+		return h.algorithm != AlgorithmArgon2id ||
+			parsed.memory != h.memory ||
+			parsed.iterations != h.iterations ||
+			parsed.threads != h.threads ||
+			len(parsed.key) != argon2KeyLength, nil
+
+	case isBcrypt(encoded):
+		cost, err := bcryptCost(encoded)
+		if err != nil {
+			return false, err
+		}
+		// bcrypt 内部使用常量时间比较
+		if err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, ErrMismatch
+			}
+			return false, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+		}
+		return h.algorithm != AlgorithmBcrypt || cost != h.bcryptCost, nil
+
+	default:
+		return false, ErrInvalidHash
+	}
+}
+
+// VerifyDummy 对固定哈希执行一次校验，用于用户不存在时拉平响应时间，避免枚举用户名
+func (h *Hasher) VerifyDummy(password string) {
+	h.dummyOnce.Do(func() {
+		h.dummy, _ = h.Hash("dummy password for timing equalization")
+	})
+	_, _ = h.Verify(password, h.dummy)
+}
+
+// IsHash 判断字符串是否为支持的密码哈希格式
+func IsHash(encoded string) bool {
+	if isBcrypt(encoded) {
+		_, err := bcryptCost(encoded)
+		return err == nil
+	}
+	_, err := decodeArgon2id(encoded)
+	return err == nil
+}
+
+// isBcrypt 判断是否为 bcrypt 模块化格式（$2a$、$2b$、$2y$）
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+// bcryptCost 解析 bcrypt 哈希的成本因子，超过 maxBcryptCost 的哈希视为无效
+func bcryptCost(encoded string) (int, error) {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	if cost > maxBcryptCost {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidHash, ErrInvalidParams)
+	}
+	return cost, nil
+}
+
+// validArgon2Params 检查 argon2id 参数是否在允许范围内
+func validArgon2Params(memory, iterations uint32, threads uint8) bool {
+	return iterations >= 1 && iterations <= maxArgon2Iterations &&
+		threads >= 1 &&
+		memory >= 8*uint32(threads) && memory <= maxArgon2Memory
+}
+
+// argon2Hash 解析后的 argon2id 哈希
+type argon2Hash struct {
+	memory     uint32
+	iterations uint32
+	threads    uint8
+	salt       []byte
+	key        []byte
+}
+
+// encodeArgon2id 编码为 PHC 字符串：$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func encodeArgon2id(h argon2Hash) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgorithmArgon2id, argon2.Version, h.memory, h.iterations, h.threads,
+		base64.RawStdEncoding.EncodeToString(h.salt),
+		base64.RawStdEncoding.EncodeToString(h.key))
+}
+
+// decodeArgon2id 解析 PHC 格式的 argon2id 哈希
+func decodeArgon2id(encoded string) (argon2Hash, error) {
+	var h argon2Hash
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != AlgorithmArgon2id {
+		return h, ErrInvalidHash
+	}
+
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return h, fmt.Errorf("%w: unsupported argon2 version", ErrInvalidHash)
+	}
+
+	// 参数必须严格按 m、t、p 的顺序出现，数值超出类型范围时报错而不是截断
+	params := strings.Split(parts[3], ",")
+	if len(params) != 3 {
+		return h, fmt.Errorf("%w: bad parameters", ErrInvalidHash)
+	}
+	memory, errM := parseParam(params[0], "m=", 32)
+	iterations, errT := parseParam(params[1], "t=", 32)
+	threads, errP := parseParam(params[2], "p=", 8)
+	if errM != nil || errT != nil || errP != nil {
+		return h, fmt.Errorf("%w: bad parameters", ErrInvalidHash)
+	}
+	h.memory, h.iterations, h.threads = uint32(memory), uint32(iterations), uint8(threads)
+	if !validArgon2Params(h.memory, h.iterations, h.threads) {
+		return h, fmt.Errorf("%w: %v", ErrInvalidHash, ErrInvalidParams)
+	}
+
+	var err error
+	if h.salt, err = decodeArgon2Segment(parts[4]); err != nil || len(h.salt) < 8 {
+		return h, fmt.Errorf("%w: bad salt", ErrInvalidHash)
+	}
+	if h.key, err = decodeArgon2Segment(parts[5]); err != nil || len(h.key) < 16 {
+		return h, fmt.Errorf("%w: bad key", ErrInvalidHash)
+	}
+	return h, nil
+}
+
+// parseParam 解析 name=value 形式的十进制参数，value 必须能放入 bitSize 位无符号整数
+func parseParam(param, name string, bitSize int) (uint64, error) {
+	value, ok := strings.CutPrefix(param, name)
+	if !ok || value == "" || strings.TrimLeft(value, "0123456789") != "" {
+		return 0, ErrInvalidHash
+	}
+	return strconv.ParseUint(value, 10, bitSize)
+}
+
+// decodeArgon2Segment 解码盐或哈希值，超过 maxArgon2Length 字节时返回错误
+func decodeArgon2Segment(segment string) ([]byte, error) {
+	if base64.RawStdEncoding.DecodedLen(len(segment)) > maxArgon2Length {
+		return nil, ErrInvalidHash
+	}
+	return base64.RawStdEncoding.DecodeString(segment)
+}
@@ -0,0 +1,246 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 测试使用最低开销的参数，保证用例运行足够快
+func testConfig() *config.PasswordConfig {
+	return &config.PasswordConfig{
+		Algorithm:         AlgorithmArgon2id,
+		Argon2Memory:      64,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		BcryptCost:        bcrypt.MinCost,
+	}
+}
+
+func newTestHasher(t *testing.T, mutate func(cfg *config.PasswordConfig)) *Hasher {
+	t.Helper()
+
+	cfg := testConfig()
+	if mutate != nil {
+		mutate(cfg)
+	}
+	h, err := NewHasher(cfg)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	return h
+}
+
+func TestHashVerifyRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmArgon2id, AlgorithmBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			h := newTestHasher(t, func(cfg *config.PasswordConfig) { cfg.Algorithm = algorithm })
+
+			encoded, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !IsHash(encoded) {
+				t.Fatalf("IsHash(%q) = false", encoded)
+			}
+			if rehash, err := h.Verify("correct horse", encoded); err != nil || rehash {
+				t.Fatalf("Verify() = %v, %v, want false, nil", rehash, err)
+			}
+			if _, err := h.Verify("correct horse ", encoded); !errors.Is(err, ErrMismatch) {
+				t.Fatalf("Verify() with wrong password error = %v, want %v", err, ErrMismatch)
+			}
+
+			// 每次哈希使用新的盐
+			again, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if again == encoded {
+				t.Fatal("Hash() returned the same hash twice")
+			}
+		})
+	}
+}
+
+func TestVerifyRehash(t *testing.T) {
+	argon := newTestHasher(t, nil)
+	argonHash, err := argon.Hash("pw")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	bcryptHash, err := newTestHasher(t, func(cfg *config.PasswordConfig) { cfg.Algorithm = AlgorithmBcrypt }).Hash("pw")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+		mutate  func(cfg *config.PasswordConfig)
+		want    bool
+	}{
+		{name: "argon2id same params", encoded: argonHash},
+		{name: "argon2id memory changed", encoded: argonHash, mutate: func(cfg *config.PasswordConfig) { cfg.Argon2Memory = 128 }, want: true},
+		{name: "argon2id iterations changed", encoded: argonHash, mutate: func(cfg *config.PasswordConfig) { cfg.Argon2Iterations = 2 }, want: true},
+		{name: "argon2id parallelism changed", encoded: argonHash, mutate: func(cfg *config.PasswordConfig) { cfg.Argon2Parallelism = 2 }, want: true},
+		{name: "argon2id bcrypt cost changed", encoded: argonHash, mutate: func(cfg *config.PasswordConfig) { cfg.BcryptCost = bcrypt.MinCost + 1 }},
+		{name: "argon2id to bcrypt", encoded: argonHash, mutate: func(cfg *config.PasswordConfig) { cfg.Algorithm = AlgorithmBcrypt }, want: true},
+		{name: "bcrypt same cost", encoded: bcryptHash, mutate: func(cfg *config.PasswordConfig) { cfg.Algorithm = AlgorithmBcrypt }},
+		{name: "bcrypt cost changed", encoded: bcryptHash, mutate: func(cfg *config.PasswordConfig) {
+			cfg.Algorithm = AlgorithmBcrypt
+			cfg.BcryptCost = bcrypt.MinCost + 1
+		}, want: true},
+		{name: "bcrypt to argon2id", encoded: bcryptHash, want: true},
+	}
+
+	// 修改配置后已有哈希仍然有效，只是需要重新哈希
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHasher(t, tt.mutate)
+			rehash, err := h.Verify("pw", tt.encoded)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if rehash != tt.want {
+				t.Fatalf("Verify() rehash = %v, want %v", rehash, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgon2idPHCFormat(t *testing.T) {
+	h := newTestHasher(t, nil)
+	encoded, err := h.Hash("pw")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, want PHC argon2id prefix", encoded)
+	}
+
+	parsed, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatalf("decodeArgon2id: %v", err)
+	}
+	if parsed.memory != 64 || parsed.iterations != 1 || parsed.threads != 1 ||
+		len(parsed.salt) != argon2SaltLength || len(parsed.key) != argon2KeyLength {
+		t.Fatalf("decodeArgon2id() = %+v", parsed)
+	}
+	if got := encodeArgon2id(parsed); got != encoded {
+		t.Fatalf("encodeArgon2id() = %q, want %q", got, encoded)
+	}
+}
+
+func TestVerifyRejectsMalformedHashes(t *testing.T) {
+	h := newTestHasher(t, nil)
+	encoded, err := h.Hash("pw")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	parts := strings.Split(encoded, "$")
+	salt, key := parts[4], parts[5]
+	argon := func(version, params, salt, key string) string {
+		return "$argon2id$" + version + "$" + params + "$" + salt + "$" + key
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "empty", encoded: ""},
+		{name: "unknown algorithm", encoded: "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "plaintext", encoded: "pw"},
+		{name: "missing fields", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{name: "extra fields", encoded: encoded + "$x"},
+		{name: "wrong version", encoded: argon("v=16", "m=64,t=1,p=1", salt, key)},
+		{name: "version with trailing data", encoded: argon("v=19x", "m=64,t=1,p=1", salt, key)},
+		{name: "params out of order", encoded: argon("v=19", "t=1,m=64,p=1", salt, key)},
+		{name: "missing param", encoded: argon("v=19", "m=64,t=1", salt, key)},
+		{name: "extra param", encoded: argon("v=19", "m=64,t=1,p=1,x=1", salt, key)},
+		{name: "params with trailing data", encoded: argon("v=19", "m=64,t=1,p=1x", salt, key)},
+		{name: "signed param", encoded: argon("v=19", "m=+64,t=1,p=1", salt, key)},
+		{name: "negative param", encoded: argon("v=19", "m=64,t=-1,p=1", salt, key)},
+		{name: "empty param", encoded: argon("v=19", "m=,t=1,p=1", salt, key)},
+		{name: "zero iterations", encoded: argon("v=19", "m=64,t=0,p=1", salt, key)},
+		{name: "zero threads", encoded: argon("v=19", "m=64,t=1,p=0", salt, key)},
+		{name: "threads overflow uint8", encoded: argon("v=19", "m=64,t=1,p=257", salt, key)},
+		{name: "memory below minimum", encoded: argon("v=19", "m=7,t=1,p=1", salt, key)},
+		{name: "memory above maximum", encoded: argon("v=19", "m=4194305,t=1,p=1", salt, key)},
+		{name: "memory overflow uint32", encoded: argon("v=19", "m=4294967360,t=1,p=1", salt, key)},
+		{name: "iterations above maximum", encoded: argon("v=19", "m=64,t=65,p=1", salt, key)},
+		{name: "iterations overflow uint32", encoded: argon("v=19", "m=64,t=4294967297,p=1", salt, key)},
+		{name: "bad salt encoding", encoded: argon("v=19", "m=64,t=1,p=1", "!!!!"+salt, key)},
+		{name: "short salt", encoded: argon("v=19", "m=64,t=1,p=1", salt[:8], key)},
+		{name: "long salt", encoded: argon("v=19", "m=64,t=1,p=1", strings.Repeat("A", 100), key)},
+		{name: "short key", encoded: argon("v=19", "m=64,t=1,p=1", salt, key[:16])},
+		{name: "long key", encoded: argon("v=19", "m=64,t=1,p=1", salt, strings.Repeat("A", 1<<20))},
+		{name: "bcrypt garbage", encoded: "$2b$10$short"},
+		{name: "bcrypt cost above maximum", encoded: "$2b$31$" + strings.Repeat("a", 53)},
+	}
+
+	// 异常记录必须快速返回 ErrInvalidHash，不能 panic 或按记录中的参数分配资源
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			if _, err := h.Verify("pw", tt.encoded); !errors.Is(err, ErrInvalidHash) {
+				t.Fatalf("Verify() error = %v, want %v", err, ErrInvalidHash)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("Verify() took %v", elapsed)
+			}
+			if IsHash(tt.encoded) {
+				t.Fatal("IsHash() = true")
+			}
+		})
+	}
+}
+
+func TestNewHasherValidatesParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(cfg *config.PasswordConfig)
+		want   error
+	}{
+		{name: "argon2id"},
+		{name: "algorithm is case insensitive", mutate: func(cfg *config.PasswordConfig) { cfg.Algorithm = "Argon2ID" }},
+		{name: "unknown algorithm", mutate: func(cfg *config.PasswordConfig) { cfg.Algorithm = "md5" }, want: ErrUnknownAlgorithm},
+		{name: "zero iterations", mutate: func(cfg *config.PasswordConfig) { cfg.Argon2Iterations = 0 }, want: ErrInvalidParams},
+		{name: "iterations above maximum", mutate: func(cfg *config.PasswordConfig) { cfg.Argon2Iterations = maxArgon2Iterations + 1 }, want: ErrInvalidParams},
+		{name: "zero parallelism", mutate: func(cfg *config.PasswordConfig) { cfg.Argon2Parallelism = 0 }, want: ErrInvalidParams},
+		{name: "memory below 8 per thread", mutate: func(cfg *config.PasswordConfig) { cfg.Argon2Parallelism = 9 }, want: ErrInvalidParams},
+		{name: "memory above maximum", mutate: func(cfg *config.PasswordConfig) { cfg.Argon2Memory = maxArgon2Memory + 1 }, want: ErrInvalidParams},
+		{name: "bcrypt", mutate: func(cfg *config.PasswordConfig) { cfg.Algorithm = AlgorithmBcrypt }},
+		{name: "bcrypt cost below minimum", mutate: func(cfg *config.PasswordConfig) {
+			cfg.Algorithm = AlgorithmBcrypt
+			cfg.BcryptCost = bcrypt.MinCost - 1
+		}, want: ErrInvalidParams},
+		{name: "bcrypt cost above maximum", mutate: func(cfg *config.PasswordConfig) {
+			cfg.Algorithm = AlgorithmBcrypt
+			cfg.BcryptCost = maxBcryptCost + 1
+		}, want: ErrInvalidParams},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			if tt.mutate != nil {
+				tt.mutate(cfg)
+			}
+			if _, err := NewHasher(cfg); !errors.Is(err, tt.want) {
+				t.Fatalf("NewHasher() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDummy(t *testing.T) {
+	h := newTestHasher(t, nil)
+	h.VerifyDummy("pw")
+	if !IsHash(h.dummy) {
+		t.Fatalf("dummy hash %q is not a valid hash", h.dummy)
+	}
+}
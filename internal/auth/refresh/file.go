@@ -0,0 +1,135 @@
+package refresh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/jason0730/claude-code-demo/internal/filestore"
+)
+
+// FileStore 基于 JSON 文件的刷新令牌存储，多个副本挂载同一文件时共享令牌状态
+//
+// 兑换和吊销持有锁文件读取最新内容、修改后写回，令牌在任一副本兑换后在所有副本上都已使用，
+// 重用检测和家族吊销跨副本生效；查询只在文件变化后重新读取。
+type FileStore struct {
+	mu     sync.Mutex
+	file   *filestore.File
+	memory *MemoryStore // 文件内容的缓存
+}
+
+// NewFileStore 创建文件刷新令牌存储，并检查已有文件能否解析
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{file: filestore.NewFile(path), memory: NewMemoryStore()}
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save 记录新签发的刷新令牌
+func (s *FileStore) Save(ctx context.Context, token *Token) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.Save(ctx, token)
+	})
+}
+
+// Get 查询令牌记录，包括其他副本写入的记录
+func (s *FileStore) Get(ctx context.Context, id string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s.memory.Get(ctx, id)
+}
+
+// Use 持有锁文件将令牌标记为已使用，同一令牌在不同副本上并发兑换时只有一次成功
+func (s *FileStore) Use(ctx context.Context, id string) (*Token, error) {
+	var token *Token
+	err := s.modify(func(m *MemoryStore) error {
+		var err error
+		token, err = m.Use(ctx, id)
+		return err
+	})
+	return token, err
+}
+
+// RevokeFamily 删除家族中的所有令牌
+func (s *FileStore) RevokeFamily(ctx context.Context, familyID string) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.RevokeFamily(ctx, familyID)
+	})
+}
+
+// RevokeUser 删除用户的所有令牌
+func (s *FileStore) RevokeUser(ctx context.Context, userID string) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.RevokeUser(ctx, userID)
+	})
+}
+
+// modify 持有锁文件读取最新内容，应用修改后写回；fn 返回错误时不写回
+func (s *FileStore) modify(fn func(*MemoryStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return fmt.Errorf("lock refresh token store: %w", err)
+	}
+	defer unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return err
+	}
+	if err := fn(s.memory); err != nil {
+		return err
+	}
+	return s.persistLocked()
+}
+
+// refreshLocked 文件变化时重新读取
+func (s *FileStore) refreshLocked() error {
+	data, changed, err := s.file.Read()
+	if err != nil {
+		return fmt.Errorf("read refresh token store: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	memory := NewMemoryStore()
+	if data != nil {
+		var tokens []*Token
+		if err := json.Unmarshal(data, &tokens); err != nil {
+			return fmt.Errorf("decode refresh token store: %w", err)
+		}
+		for _, token := range tokens {
+			memory.tokens[token.ID] = token
+		}
+	}
+	s.memory = memory
+	return nil
+}
+
+// persistLocked 写回缓存中的全部令牌
+func (s *FileStore) persistLocked() error {
+	s.memory.mu.Lock()
+	tokens := make([]*Token, 0, len(s.memory.tokens))
+	for _, token := range s.memory.tokens {
+		tokens = append(tokens, token)
+	}
+	data, err := json.Marshal(tokens)
+	s.memory.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.file.Write(data); err != nil {
+		return fmt.Errorf("write refresh token store: %w", err)
+	}
+	return nil
+}
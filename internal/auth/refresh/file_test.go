@@ -0,0 +1,129 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newToken(id, family, user string) *Token {
+	return &Token{
+		ID:        id,
+		FamilyID:  family,
+		UserID:    user,
+		IssuedAt:  time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+// newReplicas 创建挂载同一文件的两个存储，模拟两个副本
+func newReplicas(t *testing.T) (*FileStore, *FileStore, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "refresh_tokens.json")
+	a, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	b, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return a, b, path
+}
+
+func TestFileStoreSharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	a, b, path := newReplicas(t)
+
+	// b 先读取一次，确认缓存会在另一副本写入后失效
+	if _, err := b.Get(ctx, "rt-1"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Get before save error = %v, want %v", err, ErrTokenNotFound)
+	}
+
+	if err := a.Save(ctx, newToken("rt-1", "family-1", "user-1")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := b.Save(ctx, newToken("rt-2", "family-2", "user-1")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// 在 a 上兑换的令牌重放到 b 时被识别为重用
+	if _, err := a.Use(ctx, "rt-1"); err != nil {
+		t.Fatalf("Use: %v", err)
+	}
+	token, err := b.Use(ctx, "rt-1")
+	if !errors.Is(err, ErrTokenReused) || token.FamilyID != "family-1" {
+		t.Fatalf("Use replayed on another replica = %+v, %v, want %v", token, err, ErrTokenReused)
+	}
+
+	// b 写入时保留 a 的家族，反之亦然
+	if _, err := a.Get(ctx, "rt-2"); err != nil {
+		t.Fatalf("Get family saved on another replica: %v", err)
+	}
+
+	// 在 b 上吊销的家族在 a 上立即失效
+	if err := b.RevokeFamily(ctx, "family-2"); err != nil {
+		t.Fatalf("RevokeFamily: %v", err)
+	}
+	if _, err := a.Use(ctx, "rt-2"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Use of family revoked on another replica error = %v, want %v", err, ErrTokenNotFound)
+	}
+
+	// 重启后从文件恢复
+	c, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	token, err = c.Get(ctx, "rt-1")
+	if err != nil || token.UsedAt == nil {
+		t.Fatalf("Get after restart = %+v, %v", token, err)
+	}
+}
+
+func TestFileStoreConcurrentUseAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	a, b, _ := newReplicas(t)
+
+	const tokens = 10
+	for i := 0; i < tokens; i++ {
+		if err := a.Save(ctx, newToken(fmt.Sprintf("rt-%d", i), fmt.Sprintf("family-%d", i), "user-1")); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	// 每个令牌同时在两个副本上兑换，只能成功一次
+	var wg sync.WaitGroup
+	results := make(chan error, 2*tokens)
+	for i := 0; i < tokens; i++ {
+		for _, s := range []*FileStore{a, b} {
+			wg.Add(1)
+			go func(s *FileStore, id string) {
+				defer wg.Done()
+				_, err := s.Use(ctx, id)
+				results <- err
+			}(s, fmt.Sprintf("rt-%d", i))
+		}
+	}
+	wg.Wait()
+	close(results)
+
+	var ok, reused int
+	for err := range results {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, ErrTokenReused):
+			reused++
+		default:
+			t.Fatalf("Use: %v", err)
+		}
+	}
+	if ok != tokens || reused != tokens {
+		t.Fatalf("successful uses = %d, reuses = %d, want %d each", ok, reused, tokens)
+	}
+}
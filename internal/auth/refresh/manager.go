@@ -0,0 +1,129 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/auth/session"
+)
+
+// Manager 刷新令牌管理器：令牌一次性使用，按家族追踪，检测到重用时吊销整个家族
+//
+// 每个令牌家族对应一个会话，会话记录随家族一起创建、更新和删除。
+type Manager struct {
+	store    Store
+	sessions session.Store
+}
+
+// NewManager 创建刷新令牌管理器
+func NewManager(store Store, sessions session.Store) *Manager {
+	return &Manager{
+		store:    store,
+		sessions: sessions,
+	}
+}
+
+// Device 签发令牌的请求来源，记录在会话中
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+// Register 记录新签发的刷新令牌，并创建或更新对应的会话
+func (m *Manager) Register(ctx context.Context, claims *jwt.RefreshClaims, device Device) error {
+	if err := m.store.Save(ctx, &Token{
+		ID:        claims.ID,
+		FamilyID:  claims.FamilyID,
+		UserID:    claims.Subject,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s := &session.Session{
+		ID:          claims.FamilyID,
+		FamilyID:    claims.FamilyID,
+		UserID:      claims.Subject,
+		ClientID:    claims.ClientID,
+		UserAgent:   device.UserAgent,
+		IP:          device.IP,
+		AuthMethods: claims.AuthMethods,
+		CreatedAt:   now,
+		ExpiresAt:   claims.ExpiresAt.Time,
+	}
+
+	// 家族已有会话说明是刷新，保留创建时间并记录刷新时间
+	_, err := m.sessions.Get(ctx, claims.FamilyID)
+	switch {
+	case err == nil:
+		s.LastRefreshedAt = &now
+	case !errors.Is(err, session.ErrSessionNotFound):
+		return err
+	}
+	return m.sessions.Save(ctx, s)
+}
+
+// Redeem 兑换刷新令牌，令牌兑换后即失效
+//
+// 已使用的令牌再次出现说明令牌可能已被窃取，此时吊销整个家族并返回 ErrTokenReused，
+// 合法持有者和攻击者手中的后续令牌都将失效。
+func (m *Manager) Redeem(ctx context.Context, claims *jwt.RefreshClaims) (*Token, error) {
+	token, err := m.store.Use(ctx, claims.ID)
+	if errors.Is(err, ErrTokenReused) {
+		if revokeErr := m.RevokeFamily(ctx, token.FamilyID); revokeErr != nil {
+			return token, revokeErr
+		}
+		return token, ErrTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 防止伪造的家族 ID 与存储记录不一致
+	if token.FamilyID != claims.FamilyID || token.UserID != claims.Subject {
+		return nil, ErrTokenNotFound
+	}
+	return token, nil
+}
+
+// Active 判断刷新令牌是否仍可兑换（已记录、未使用、未吊销）
+func (m *Manager) Active(ctx context.Context, claims *jwt.RefreshClaims) (bool, error) {
+	token, err := m.store.Get(ctx, claims.ID)
+	if errors.Is(err, ErrTokenNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return token.UsedAt == nil && token.FamilyID == claims.FamilyID, nil
+}
+
+// Sessions 列出用户的活跃会话，最近活动的在前
+func (m *Manager) Sessions(ctx context.Context, userID string) ([]*session.Session, error) {
+	return m.sessions.List(ctx, userID)
+}
+
+// Session 查询会话，不存在时返回 session.ErrSessionNotFound
+func (m *Manager) Session(ctx context.Context, id string) (*session.Session, error) {
+	return m.sessions.Get(ctx, id)
+}
+
+// RevokeFamily 吊销一个会话的所有刷新令牌并删除会话
+func (m *Manager) RevokeFamily(ctx context.Context, familyID string) error {
+	if err := m.store.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+	return m.sessions.Delete(ctx, familyID)
+}
+
+// RevokeUser 吊销用户所有会话的刷新令牌并删除会话
+func (m *Manager) RevokeUser(ctx context.Context, userID string) error {
+	if err := m.store.RevokeUser(ctx, userID); err != nil {
+		return err
+	}
+	return m.sessions.DeleteUser(ctx, userID)
+}
@@ -0,0 +1,113 @@
+package refresh
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore 内存刷新令牌存储，进程重启后所有刷新令牌失效
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]*Token
+}
+
+// NewMemoryStore 创建内存刷新令牌存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens: make(map[string]*Token),
+	}
+}
+
+// Save 记录新签发的刷新令牌，同时清理已过期的记录
+func (s *MemoryStore) Save(ctx context.Context, token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveLocked(token)
+	return nil
+}
+
+// Get 查询令牌记录
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok || time.Now().After(token.ExpiresAt) {
+		return nil, ErrTokenNotFound
+	}
+	result := *token
+	return &result, nil
+}
+
+// Use 原子地将令牌标记为已使用
+func (s *MemoryStore) Use(ctx context.Context, id string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.useLocked(id)
+}
+
+// RevokeFamily 删除家族中的所有令牌
+func (s *MemoryStore) RevokeFamily(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeFamilyLocked(familyID)
+	return nil
+}
+
+// RevokeUser 删除用户的所有令牌
+func (s *MemoryStore) RevokeUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeUserLocked(userID)
+	return nil
+}
+
+func (s *MemoryStore) saveLocked(token *Token) {
+	now := time.Now()
+	for id, t := range s.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(s.tokens, id)
+		}
+	}
+
+	stored := *token
+	s.tokens[token.ID] = &stored
+}
+
+func (s *MemoryStore) useLocked(id string) (*Token, error) {
+	token, ok := s.tokens[id]
+	if !ok || time.Now().After(token.ExpiresAt) {
+		return nil, ErrTokenNotFound
+	}
+
+	result := *token
+	if token.UsedAt != nil {
+		return &result, ErrTokenReused
+	}
+
+	now := time.Now()
+	token.UsedAt = &now
+	result.UsedAt = &now
+	return &result, nil
+}
+
+func (s *MemoryStore) revokeFamilyLocked(familyID string) {
+	for id, t := range s.tokens {
+		if t.FamilyID == familyID {
+			delete(s.tokens, id)
+		}
+	}
+}
+
+func (s *MemoryStore) revokeUserLocked(userID string) {
+	for id, t := range s.tokens {
+		if t.UserID == userID {
+			delete(s.tokens, id)
+		}
+	}
+}
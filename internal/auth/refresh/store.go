@@ -0,0 +1,43 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrTokenNotFound = errors.New("refresh token not found")
+	ErrTokenReused   = errors.New("refresh token reused")
+)
+
+// Token 已签发的刷新令牌记录
+type Token struct {
+	ID        string     `json:"id"`
+	FamilyID  string     `json:"family_id"`
+	UserID    string     `json:"user_id"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// Store 刷新令牌存储
+//
+// 吊销令牌家族会删除其中的所有令牌，因此未知令牌与已吊销令牌同样被拒绝。
+type Store interface {
+	// Save 记录新签发的刷新令牌
+	Save(ctx context.Context, token *Token) error
+
+	// Get 查询令牌记录，令牌不存在时返回 ErrTokenNotFound
+	Get(ctx context.Context, id string) (*Token, error)
+
+	// Use 原子地将令牌标记为已使用并返回其记录；
+	// 令牌不存在时返回 ErrTokenNotFound，已被使用时返回记录和 ErrTokenReused
+	Use(ctx context.Context, id string) (*Token, error)
+
+	// RevokeFamily 吊销整个令牌家族
+	RevokeFamily(ctx context.Context, familyID string) error
+
+	// RevokeUser 吊销用户的所有令牌家族
+	RevokeUser(ctx context.Context, userID string) error
+}
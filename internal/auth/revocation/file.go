@@ -0,0 +1,230 @@
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 跨副本写入锁的等待时间，以及超过多久视为持有者已崩溃的遗留锁
+const (
+	lockTimeout  = 5 * time.Second
+	lockStaleAge = 30 * time.Second
+)
+
+// FileStore 基于 JSON 文件的吊销列表，多个副本挂载同一文件时共享吊销记录
+//
+// 检查吊销时只在文件变化后重新读取；吊销操作持有 <path>.lock 锁文件，读取最新内容、
+// 修改后先写临时文件再重命名，不同副本的并发吊销不会互相覆盖。
+type FileStore struct {
+	path string
+
+	mu     sync.Mutex
+	loaded os.FileInfo  // 当前缓存对应的文件信息，文件不存在时为空
+	memory *MemoryStore // 文件内容的缓存
+}
+
+// fileRecords 吊销文件的内容
+type fileRecords struct {
+	Tokens   map[string]time.Time   `json:"tokens"`
+	Subjects map[string]fileSubject `json:"subjects"`
+	Sessions map[string]time.Time   `json:"sessions"`
+}
+
+// fileSubject 主体吊销记录
+type fileSubject struct {
+	RevokedAt time.Time `json:"revoked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewFileStore 创建文件吊销列表，并检查已有文件能否解析
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, memory: NewMemoryStore()}
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// RevokeToken 按 jti 吊销单个令牌
+func (s *FileStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.RevokeToken(ctx, jti, expiresAt)
+	})
+}
+
+// RevokeSubject 吊销主体此前签发的所有令牌
+func (s *FileStore) RevokeSubject(ctx context.Context, subject string, expiresAt time.Time) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.RevokeSubject(ctx, subject, expiresAt)
+	})
+}
+
+// RevokeSession 吊销会话签发的所有访问令牌
+func (s *FileStore) RevokeSession(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.RevokeSession(ctx, sessionID, expiresAt)
+	})
+}
+
+// IsRevoked 检查令牌是否已被吊销，包括其他副本写入的记录
+func (s *FileStore) IsRevoked(ctx context.Context, jti, subject string, issuedAt time.Time) (bool, error) {
+	memory, err := s.current()
+	if err != nil {
+		return false, err
+	}
+	return memory.IsRevoked(ctx, jti, subject, issuedAt)
+}
+
+// IsSessionRevoked 检查会话是否已被吊销，包括其他副本写入的记录
+func (s *FileStore) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	memory, err := s.current()
+	if err != nil {
+		return false, err
+	}
+	return memory.IsSessionRevoked(ctx, sessionID)
+}
+
+// current 文件变化时重新读取，返回最新的缓存
+func (s *FileStore) current() (*MemoryStore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s.memory, nil
+}
+
+// modify 持有锁文件读取最新内容，应用修改后写回
+func (s *FileStore) modify(fn func(*MemoryStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return err
+	}
+	if err := fn(s.memory); err != nil {
+		return err
+	}
+	return s.persistLocked()
+}
+
+// refreshLocked 文件与缓存不一致时重新读取；每次写入都会重命名出新文件，比较文件本身即可发现其他副本的修改
+func (s *FileStore) refreshLocked() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("read revocation store: %w", err)
+		}
+		if s.loaded != nil {
+			s.memory = NewMemoryStore()
+			s.loaded = nil
+		}
+		return nil
+	}
+	if s.loaded != nil && os.SameFile(s.loaded, info) &&
+		s.loaded.ModTime().Equal(info.ModTime()) && s.loaded.Size() == info.Size() {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("read revocation store: %w", err)
+	}
+	var records fileRecords
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("decode revocation store: %w", err)
+	}
+
+	memory := NewMemoryStore()
+	for jti, expiresAt := range records.Tokens {
+		memory.tokens[jti] = expiresAt
+	}
+	for subject, entry := range records.Subjects {
+		memory.subjects[subject] = subjectEntry{revokedAt: entry.RevokedAt, expiresAt: entry.ExpiresAt}
+	}
+	for id, expiresAt := range records.Sessions {
+		memory.sessions[id] = expiresAt
+	}
+	s.memory = memory
+	s.loaded = info
+	return nil
+}
+
+// persistLocked 先写临时文件再重命名，避免写入中断导致文件损坏
+func (s *FileStore) persistLocked() error {
+	s.memory.mu.RLock()
+	records := fileRecords{
+		Tokens:   s.memory.tokens,
+		Subjects: make(map[string]fileSubject, len(s.memory.subjects)),
+		Sessions: s.memory.sessions,
+	}
+	for subject, entry := range s.memory.subjects {
+		records.Subjects[subject] = fileSubject{RevokedAt: entry.revokedAt, ExpiresAt: entry.expiresAt}
+	}
+	data, err := json.Marshal(records)
+	s.memory.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write revocation store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write revocation store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write revocation store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("write revocation store: %w", err)
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("read revocation store: %w", err)
+	}
+	s.loaded = info
+	return nil
+}
+
+// lock 创建锁文件独占写入，返回释放锁的函数；超过 lockStaleAge 的锁文件视为崩溃遗留并删除
+func (s *FileStore) lock() (func(), error) {
+	lockPath := s.path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("lock revocation store: %w", err)
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > lockStaleAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("lock revocation store: timed out waiting for %s", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,107 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileStoreSharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "revocations.json")
+
+	a, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	b, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	issuedAt := time.Now().Add(-time.Minute)
+	expiresAt := time.Now().Add(time.Hour)
+
+	// b 先读取一次，确认缓存会在另一副本写入后失效
+	if revoked, err := b.IsRevoked(ctx, "jti-1", "user-1", issuedAt); err != nil || revoked {
+		t.Fatalf("IsRevoked before revocation = %v, %v", revoked, err)
+	}
+
+	if err := a.RevokeToken(ctx, "jti-1", expiresAt); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if err := a.RevokeSubject(ctx, "user-2", expiresAt); err != nil {
+		t.Fatalf("RevokeSubject: %v", err)
+	}
+	if err := a.RevokeSession(ctx, "session-1", expiresAt); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	if revoked, err := b.IsRevoked(ctx, "jti-1", "user-1", issuedAt); err != nil || !revoked {
+		t.Errorf("token revoked on another replica: IsRevoked = %v, %v", revoked, err)
+	}
+	if revoked, err := b.IsRevoked(ctx, "jti-2", "user-2", issuedAt); err != nil || !revoked {
+		t.Errorf("subject revoked on another replica: IsRevoked = %v, %v", revoked, err)
+	}
+	if revoked, err := b.IsRevoked(ctx, "jti-3", "user-2", time.Now().Add(time.Minute)); err != nil || revoked {
+		t.Errorf("token issued after subject revocation: IsRevoked = %v, %v", revoked, err)
+	}
+	if revoked, err := b.IsSessionRevoked(ctx, "session-1"); err != nil || !revoked {
+		t.Errorf("session revoked on another replica: IsSessionRevoked = %v, %v", revoked, err)
+	}
+
+	// 重启后从文件恢复
+	c, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if revoked, err := c.IsRevoked(ctx, "jti-1", "user-1", issuedAt); err != nil || !revoked {
+		t.Errorf("after restart: IsRevoked = %v, %v", revoked, err)
+	}
+}
+
+func TestFileStoreConcurrentReplicasKeepAllRevocations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "revocations.json")
+	expiresAt := time.Now().Add(time.Hour)
+
+	const replicas, perReplica = 4, 10
+	stores := make([]*FileStore, replicas)
+	for i := range stores {
+		s, err := NewFileStore(path)
+		if err != nil {
+			t.Fatalf("NewFileStore: %v", err)
+		}
+		stores[i] = s
+	}
+
+	var wg sync.WaitGroup
+	for i, s := range stores {
+		wg.Add(1)
+		go func(i int, s *FileStore) {
+			defer wg.Done()
+			for j := 0; j < perReplica; j++ {
+				if err := s.RevokeToken(ctx, fmt.Sprintf("jti-%d-%d", i, j), expiresAt); err != nil {
+					t.Errorf("RevokeToken: %v", err)
+				}
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	check, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	for i := 0; i < replicas; i++ {
+		for j := 0; j < perReplica; j++ {
+			jti := fmt.Sprintf("jti-%d-%d", i, j)
+			if revoked, err := check.IsRevoked(ctx, jti, "", time.Now()); err != nil || !revoked {
+				t.Errorf("%s lost: IsRevoked = %v, %v", jti, revoked, err)
+			}
+		}
+	}
+}
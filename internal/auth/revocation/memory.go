@@ -0,0 +1,112 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// subjectEntry 主体吊销记录
+type subjectEntry struct {
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+// MemoryStore 内存吊销列表
+type MemoryStore struct {
+	mu       sync.RWMutex
+	tokens   map[string]time.Time // jti -> 过期时间
+	subjects map[string]subjectEntry
+	sessions map[string]time.Time // 会话 ID -> 过期时间
+}
+
+// NewMemoryStore 创建内存吊销列表
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens:   make(map[string]time.Time),
+		subjects: make(map[string]subjectEntry),
+		sessions: make(map[string]time.Time),
+	}
+}
+
+// RevokeToken 按 jti 吊销单个令牌
+func (s *MemoryStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(time.Now())
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+// RevokeSubject 吊销主体此前签发的所有令牌
+//
+// JWT 的 iat 精确到秒，因此与吊销操作同一秒内签发的令牌也会被吊销。
+func (s *MemoryStore) RevokeSubject(ctx context.Context, subject string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.pruneLocked(now)
+	s.subjects[subject] = subjectEntry{
+		revokedAt: now.Truncate(time.Second),
+		expiresAt: expiresAt,
+	}
+	return nil
+}
+
+// RevokeSession 吊销会话签发的所有访问令牌
+func (s *MemoryStore) RevokeSession(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(time.Now())
+	s.sessions[sessionID] = expiresAt
+	return nil
+}
+
+// IsRevoked 检查令牌是否已被吊销
+func (s *MemoryStore) IsRevoked(ctx context.Context, jti, subject string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if jti != "" {
+		if _, ok := s.tokens[jti]; ok {
+			return true, nil
+		}
+	}
+
+	entry, ok := s.subjects[subject]
+	if ok && !issuedAt.After(entry.revokedAt) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// IsSessionRevoked 检查会话是否已被吊销
+func (s *MemoryStore) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.sessions[sessionID]
+	return ok, nil
+}
+
+// pruneLocked 清理已过期的记录，调用方需持有写锁
+func (s *MemoryStore) pruneLocked(now time.Time) {
+	for jti, expiresAt := range s.tokens {
+		if now.After(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for subject, entry := range s.subjects {
+		if now.After(entry.expiresAt) {
+			delete(s.subjects, subject)
+		}
+	}
+	for id, expiresAt := range s.sessions {
+		if now.After(expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package revocation
+
+import (
+	"context"
+	"time"
+)
+
+// Store 访问令牌吊销列表
+//
+// 记录只需保留到被吊销令牌的过期时间，过期令牌本身已无法通过验证。
+type Store interface {
+	// RevokeToken 按 jti 吊销单个令牌，记录保留到 expiresAt
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+
+	// RevokeSubject 吊销主体在此刻及之前签发的所有令牌，记录保留到 expiresAt
+	RevokeSubject(ctx context.Context, subject string, expiresAt time.Time) error
+
+	// RevokeSession 吊销会话（刷新令牌家族）签发的所有访问令牌，记录保留到 expiresAt
+	RevokeSession(ctx context.Context, sessionID string, expiresAt time.Time) error
+
+	// IsRevoked 检查令牌是否已被吊销
+	IsRevoked(ctx context.Context, jti, subject string, issuedAt time.Time) (bool, error)
+
+	// IsSessionRevoked 检查会话是否已被吊销
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+// IsAccessTokenRevoked 检查访问令牌本身、其主体或所属会话是否已被吊销
+func IsAccessTokenRevoked(ctx context.Context, s Store, jti, subject, sessionID string, issuedAt time.Time) (bool, error) {
+	revoked, err := s.IsRevoked(ctx, jti, subject, issuedAt)
+	if err != nil || revoked || sessionID == "" {
+		return revoked, err
+	}
+	return s.IsSessionRevoked(ctx, sessionID)
+}
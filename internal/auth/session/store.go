@@ -0,0 +1,289 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/filestore"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session 一次登录产生的会话，对应一个刷新令牌家族
+//
+// 会话在登录时创建，每次刷新时更新最近活动的来源；刷新令牌家族被吊销或过期后会话随之删除。
+type Session struct {
+	ID              string     `json:"id"`
+	FamilyID        string     `json:"refresh_family"` // 刷新令牌家族 ID，目前与会话 ID 相同
+	UserID          string     `json:"user_id"`
+	ClientID        string     `json:"client_id,omitempty"` // 通过 OAuth 授权码登录时的客户端
+	UserAgent       string     `json:"user_agent"`          // 最近一次登录或刷新的 User-Agent
+	IP              string     `json:"ip"`                  // 最近一次登录或刷新的来源 IP
+	AuthMethods     []string   `json:"amr,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastRefreshedAt *time.Time `json:"last_refreshed_at,omitempty"`
+	ExpiresAt       time.Time  `json:"expires_at"` // 当前刷新令牌的过期时间
+}
+
+// Store 会话存储
+type Store interface {
+	// Save 创建会话，会话已存在时更新来源、最近刷新时间和过期时间
+	Save(ctx context.Context, session *Session) error
+
+	// Get 查询会话，不存在或已过期时返回 ErrSessionNotFound
+	Get(ctx context.Context, id string) (*Session, error)
+
+	// List 列出用户未过期的会话，最近活动的在前
+	List(ctx context.Context, userID string) ([]*Session, error)
+
+	// Delete 删除会话，会话不存在时不返回错误
+	Delete(ctx context.Context, id string) error
+
+	// DeleteUser 删除用户的全部会话
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+// MemoryStore 内存会话存储
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewMemoryStore 创建内存会话存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Save 创建或更新会话，同时清理已过期的记录
+func (s *MemoryStore) Save(ctx context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveLocked(session)
+	return nil
+}
+
+// Get 查询会话，返回副本
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionNotFound
+	}
+	return session.clone(), nil
+}
+
+// List 列出用户未过期的会话，返回副本
+func (s *MemoryStore) List(ctx context.Context, userID string) ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	sessions := []*Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID && !now.After(session.ExpiresAt) {
+			sessions = append(sessions, session.clone())
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].lastActive().After(sessions[j].lastActive())
+	})
+	return sessions, nil
+}
+
+// Delete 删除会话
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+// DeleteUser 删除用户的全部会话
+func (s *MemoryStore) DeleteUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteUserLocked(userID)
+	return nil
+}
+
+// saveLocked 保存会话副本；已存在的会话保留创建时间和认证方式，调用方需持有锁
+func (s *MemoryStore) saveLocked(session *Session) {
+	now := time.Now()
+	for id, existing := range s.sessions {
+		if now.After(existing.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+
+	stored := session.clone()
+	if existing, ok := s.sessions[session.ID]; ok {
+		stored.CreatedAt = existing.CreatedAt
+		stored.AuthMethods = existing.AuthMethods
+	}
+	s.sessions[session.ID] = stored
+}
+
+// deleteUserLocked 删除用户的全部会话，调用方需持有锁
+func (s *MemoryStore) deleteUserLocked(userID string) {
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// FileStore 基于 JSON 文件的会话存储，多个副本挂载同一文件时共享会话
+//
+// 修改持有锁文件读取最新内容、修改后写回，不会覆盖其他副本写入的会话；
+// 在任一副本上删除的会话在所有副本上立即消失。查询只在文件变化后重新读取。
+type FileStore struct {
+	mu     sync.Mutex
+	file   *filestore.File
+	memory *MemoryStore // 文件内容的缓存
+}
+
+// NewFileStore 创建文件会话存储，并检查已有文件能否解析
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{file: filestore.NewFile(path), memory: NewMemoryStore()}
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save 创建或更新会话
+func (s *FileStore) Save(ctx context.Context, session *Session) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.Save(ctx, session)
+	})
+}
+
+// Get 查询会话，包括其他副本写入的会话
+func (s *FileStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s.memory.Get(ctx, id)
+}
+
+// List 列出用户未过期的会话，包括其他副本写入的会话
+func (s *FileStore) List(ctx context.Context, userID string) ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s.memory.List(ctx, userID)
+}
+
+// Delete 删除会话
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.Delete(ctx, id)
+	})
+}
+
+// DeleteUser 删除用户的全部会话
+func (s *FileStore) DeleteUser(ctx context.Context, userID string) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.DeleteUser(ctx, userID)
+	})
+}
+
+// modify 持有锁文件读取最新内容，应用修改后写回；fn 返回错误时不写回
+func (s *FileStore) modify(fn func(*MemoryStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return fmt.Errorf("lock session store: %w", err)
+	}
+	defer unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return err
+	}
+	if err := fn(s.memory); err != nil {
+		return err
+	}
+	return s.persistLocked()
+}
+
+// refreshLocked 文件变化时重新读取
+func (s *FileStore) refreshLocked() error {
+	data, changed, err := s.file.Read()
+	if err != nil {
+		return fmt.Errorf("read session store: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	memory := NewMemoryStore()
+	if data != nil {
+		var sessions []*Session
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			return fmt.Errorf("decode session store: %w", err)
+		}
+		for _, session := range sessions {
+			memory.sessions[session.ID] = session
+		}
+	}
+	s.memory = memory
+	return nil
+}
+
+// persistLocked 写回缓存中的全部会话
+func (s *FileStore) persistLocked() error {
+	s.memory.mu.Lock()
+	sessions := make([]*Session, 0, len(s.memory.sessions))
+	for _, session := range s.memory.sessions {
+		sessions = append(sessions, session)
+	}
+	data, err := json.Marshal(sessions)
+	s.memory.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.file.Write(data); err != nil {
+		return fmt.Errorf("write session store: %w", err)
+	}
+	return nil
+}
+
+// lastActive 最近一次登录或刷新的时间
+func (s *Session) lastActive() time.Time {
+	if s.LastRefreshedAt != nil {
+		return *s.LastRefreshedAt
+	}
+	return s.CreatedAt
+}
+
+// clone 返回会话的深拷贝
+func (s *Session) clone() *Session {
+	copied := *s
+	copied.AuthMethods = append([]string(nil), s.AuthMethods...)
+	if s.LastRefreshedAt != nil {
+		t := *s.LastRefreshedAt
+		copied.LastRefreshedAt = &t
+	}
+	return &copied
+}
@@ -0,0 +1,206 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSession(id, userID string, createdAt time.Time) *Session {
+	return &Session{
+		ID:          id,
+		FamilyID:    id,
+		UserID:      userID,
+		UserAgent:   "test",
+		IP:          "192.0.2.1",
+		AuthMethods: []string{"pwd"},
+		CreatedAt:   createdAt,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+}
+
+// newFileStores 创建挂载同一文件的两个存储，模拟两个副本
+func newFileStores(t *testing.T) (*FileStore, *FileStore, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	a, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	b, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return a, b, path
+}
+
+func TestMemoryStoreSaveAndList(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Now()
+
+	if err := s.Save(ctx, newSession("s-1", "user-1", now.Add(-2*time.Hour))); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := s.Save(ctx, newSession("s-2", "user-1", now.Add(-time.Hour))); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := s.Save(ctx, newSession("s-3", "user-2", now)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// 刷新时更新来源，保留创建时间和认证方式
+	refreshed := newSession("s-1", "user-1", now)
+	refreshed.IP = "198.51.100.7"
+	refreshed.AuthMethods = nil
+	refreshed.LastRefreshedAt = &now
+	if err := s.Save(ctx, refreshed); err != nil {
+		t.Fatalf("Save refreshed: %v", err)
+	}
+	got, err := s.Get(ctx, "s-1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.IP != "198.51.100.7" || !got.CreatedAt.Equal(now.Add(-2*time.Hour)) || len(got.AuthMethods) != 1 {
+		t.Fatalf("refreshed session = %+v", got)
+	}
+
+	// 最近活动的在前，只包含该用户的会话
+	sessions, err := s.List(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "s-1" || sessions[1].ID != "s-2" {
+		t.Fatalf("List() = %v, want s-1 then s-2", sessions)
+	}
+
+	// 返回副本，修改不影响存储
+	sessions[0].IP = "changed"
+	if got, _ := s.Get(ctx, "s-1"); got.IP != "198.51.100.7" {
+		t.Fatal("List() returned the stored session instead of a copy")
+	}
+
+	if err := s.DeleteUser(ctx, "user-1"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if sessions, _ := s.List(ctx, "user-1"); len(sessions) != 0 {
+		t.Fatalf("List() after DeleteUser = %v", sessions)
+	}
+	if _, err := s.Get(ctx, "s-3"); err != nil {
+		t.Fatalf("DeleteUser removed another user's session: %v", err)
+	}
+}
+
+func TestMemoryStoreHidesExpiredSessions(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	expired := newSession("s-1", "user-1", time.Now().Add(-2*time.Hour))
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	if err := s.Save(ctx, expired); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := s.Get(ctx, "s-1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Get() of an expired session error = %v, want %v", err, ErrSessionNotFound)
+	}
+	if sessions, _ := s.List(ctx, "user-1"); len(sessions) != 0 {
+		t.Fatalf("List() = %v, want no expired sessions", sessions)
+	}
+}
+
+func TestFileStoreSharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	a, b, path := newFileStores(t)
+
+	// b 先读取一次，确认缓存会在另一副本写入后失效
+	if _, err := b.Get(ctx, "s-1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Get() before save error = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	if err := a.Save(ctx, newSession("s-1", "user-1", time.Now())); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// 基于过期缓存的写入不能覆盖其他副本创建的会话
+	if err := b.Save(ctx, newSession("s-2", "user-1", time.Now())); err != nil {
+		t.Fatalf("Save on another replica: %v", err)
+	}
+	sessions, err := a.List(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("List() returned %d sessions, want 2", len(sessions))
+	}
+
+	// 在 b 上登出的会话在 a 上立即消失
+	if err := b.Delete(ctx, "s-1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := a.Get(ctx, "s-1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Get() of a session deleted on another replica error = %v, want %v", err, ErrSessionNotFound)
+	}
+	if err := a.Delete(ctx, "s-1"); err != nil {
+		t.Fatalf("Delete() of a missing session: %v", err)
+	}
+
+	// 重启后从文件恢复
+	c, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if _, err := c.Get(ctx, "s-2"); err != nil {
+		t.Fatalf("Get() after restart: %v", err)
+	}
+
+	if err := a.DeleteUser(ctx, "user-1"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if sessions, err := b.List(ctx, "user-1"); err != nil || len(sessions) != 0 {
+		t.Fatalf("List() after DeleteUser on another replica = %v, %v", sessions, err)
+	}
+}
+
+func TestFileStoreConcurrentSaveAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	a, b, _ := newFileStores(t)
+
+	// 两个副本同时创建不同的会话，所有会话都应保留
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		for j, s := range []*FileStore{a, b} {
+			wg.Add(1)
+			go func(s *FileStore, id string) {
+				defer wg.Done()
+				if err := s.Save(ctx, newSession(id, "user-1", time.Now())); err != nil {
+					t.Errorf("Save(%s): %v", id, err)
+				}
+			}(s, fmt.Sprintf("s-%d-%d", j, i))
+		}
+	}
+	wg.Wait()
+
+	sessions, err := a.List(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(sessions) != 2*n {
+		t.Fatalf("List() returned %d sessions, want %d", len(sessions), 2*n)
+	}
+}
+
+func TestNewFileStoreRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := NewFileStore(path); err == nil {
+		t.Fatal("NewFileStore() accepted a corrupt file")
+	}
+}
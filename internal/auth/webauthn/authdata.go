@@ -0,0 +1,86 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// 认证器数据标志位（WebAuthn 第 6.1 节）
+const (
+	flagUserPresent     = 0x01
+	flagUserVerified    = 0x04
+	flagBackupEligible  = 0x08
+	flagBackupState     = 0x10
+	flagAttestedData    = 0x40
+	flagExtensionData   = 0x80
+	authDataMinLength   = 37 // rpIdHash(32) + flags(1) + signCount(4)
+	maxCredentialIDSize = 1023
+)
+
+// authenticatorData 解析后的认证器数据
+type authenticatorData struct {
+	raw       []byte
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	// 仅注册时存在（AT 标志）
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte // COSE_Key 原始编码
+}
+
+// parseAuthenticatorData 解析认证器数据，要求没有多余字节
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < authDataMinLength {
+		return nil, errors.New("authenticator data too short")
+	}
+
+	ad := &authenticatorData{
+		raw:       data,
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[authDataMinLength:]
+
+	if ad.has(flagAttestedData) {
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		ad.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen > maxCredentialIDSize || len(rest) < idLen {
+			return nil, errors.New("invalid credential id length")
+		}
+		ad.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		// 公钥长度只能通过解码得知
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		ad.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if ad.has(flagExtensionData) {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data in authenticator data")
+	}
+	return ad, nil
+}
+
+// has 判断标志位是否置位
+func (ad *authenticatorData) has(flag byte) bool {
+	return ad.flags&flag != 0
+}
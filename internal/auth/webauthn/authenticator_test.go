@@ -0,0 +1,157 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+// softAuthenticator 软件实现的 ES256 认证器，生成的响应与浏览器 toJSON() 的结果一致
+//
+// origin 和 rpID 为认证器所在页面的来源和计算 rpIdHash 使用的 RP ID，测试修改它们模拟钓鱼站点；
+// 每次认证前签名计数加一，fixedCount 为 true 时计数始终为 0，模拟不支持计数的认证器。
+type softAuthenticator struct {
+	t          *testing.T
+	key        *ecdsa.PrivateKey
+	credID     []byte
+	userHandle []byte
+	origin     string
+	rpID       string
+	flags      byte
+	signCount  uint32
+	fixedCount bool
+}
+
+// newSoftAuthenticator 创建带用户在场和用户验证标志的认证器
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	credID := make([]byte, 16)
+	if _, err := rand.Read(credID); err != nil {
+		t.Fatalf("generate credential id: %v", err)
+	}
+	return &softAuthenticator{
+		t:      t,
+		key:    key,
+		credID: credID,
+		origin: testOrigin,
+		rpID:   testRPID,
+		flags:  flagUserPresent | flagUserVerified,
+	}
+}
+
+// register 按注册选项创建凭证，返回 "none" 格式的证明
+func (a *softAuthenticator) register(opts *CreationOptions) *RegistrationResponse {
+	handle, err := decode(opts.User.ID)
+	if err != nil {
+		a.t.Fatalf("decode user handle: %v", err)
+	}
+	a.userHandle = handle
+
+	authData := a.authData(a.flags | flagAttestedData)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credID)))
+	authData = append(authData, a.credID...)
+	authData = append(authData, encodeCBOR(cborPairs{
+		{int64(coseKeyType), int64(coseKeyTypeEC2)},
+		{int64(coseAlgorithm), AlgES256},
+		{int64(coseCurve), int64(coseCurveP256)},
+		{int64(coseX), a.key.PublicKey.X.FillBytes(make([]byte, 32))},
+		{int64(coseY), a.key.PublicKey.Y.FillBytes(make([]byte, 32))},
+	})...)
+
+	resp := &RegistrationResponse{ID: encode(a.credID), RawID: encode(a.credID), Type: credentialType}
+	resp.Response.ClientDataJSON = encode(a.clientData(typeCreate, opts.Challenge))
+	resp.Response.AttestationObject = encode(encodeCBOR(cborPairs{
+		{"fmt", "none"},
+		{"attStmt", cborPairs{}},
+		{"authData", authData},
+	}))
+	resp.Response.Transports = []string{"internal"}
+	return resp
+}
+
+// assert 按认证选项签名，签名计数先加一
+func (a *softAuthenticator) assert(opts *RequestOptions) *AssertionResponse {
+	if !a.fixedCount {
+		a.signCount++
+	}
+	authData := a.authData(a.flags)
+	clientData := a.clientData(typeGet, opts.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("sign assertion: %v", err)
+	}
+
+	resp := &AssertionResponse{ID: encode(a.credID), RawID: encode(a.credID), Type: credentialType}
+	resp.Response.ClientDataJSON = encode(clientData)
+	resp.Response.AuthenticatorData = encode(authData)
+	resp.Response.Signature = encode(sig)
+	resp.Response.UserHandle = encode(a.userHandle)
+	return resp
+}
+
+// authData 认证器数据的固定部分：rpIdHash、标志和签名计数
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	data, err := json.Marshal(clientData{Type: typ, Challenge: challenge, Origin: a.origin})
+	if err != nil {
+		a.t.Fatalf("encode client data: %v", err)
+	}
+	return data
+}
+
+// cborPairs 按给定顺序编码的 CBOR 映射
+type cborPairs [][2]interface{}
+
+// encodeCBOR 编码认证器输出所需的 CBOR 子集：整数、字节串、文本串和映射
+func encodeCBOR(v interface{}) []byte {
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return cborHead(cborNegative, uint64(-1-v))
+		}
+		return cborHead(cborUnsigned, uint64(v))
+	case []byte:
+		return append(cborHead(cborBytes, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(cborText, uint64(len(v))), v...)
+	case cborPairs:
+		out := cborHead(cborMap, uint64(len(v)))
+		for _, kv := range v {
+			out = append(out, encodeCBOR(kv[0])...)
+			out = append(out, encodeCBOR(kv[1])...)
+		}
+		return out
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+// cborHead 编码主类型和长度/数值
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
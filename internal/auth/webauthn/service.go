@@ -0,0 +1,587 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// 用户验证要求
+const (
+	UVRequired    = "required"
+	UVPreferred   = "preferred"
+	UVDiscouraged = "discouraged"
+)
+
+// 客户端数据类型
+const (
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+)
+
+const (
+	credentialType = "public-key"
+	challengeSize  = 32
+	maxNameLength  = 64
+)
+
+var (
+	ErrInvalidResponse     = errors.New("invalid webauthn response")
+	ErrSignCountRegression = errors.New("webauthn sign count regression")
+)
+
+// RelyingParty 依赖方信息
+type RelyingParty struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// UserEntity 注册时传给认证器的用户信息，ID 为 base64url 编码的用户句柄
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter 接受的公钥算法
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor 已注册凭证的描述
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection 认证器选择条件
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions 注册选项，对应 PublicKeyCredentialCreationOptionsJSON，
+// 浏览器可直接传给 PublicKeyCredential.parseCreationOptionsFromJSON
+type CreationOptions struct {
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions 认证选项，对应 PublicKeyCredentialRequestOptionsJSON
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse 注册结果，对应 RegistrationResponseJSON（PublicKeyCredential.toJSON()）
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse 认证结果，对应 AuthenticationResponseJSON
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Assertion 验证通过的认证结果
+type Assertion struct {
+	Credential   *Credential
+	UserVerified bool
+}
+
+// clientData 客户端数据（WebAuthn 第 5.8.1 节）
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Service WebAuthn 依赖方服务，负责注册和认证仪式
+//
+// 仪式状态（challenge）由调用方保存，服务本身无状态。
+type Service struct {
+	store    Store
+	cfg      *config.WebAuthnConfig
+	rpIDHash [32]byte
+}
+
+// NewService 创建 WebAuthn 服务
+func NewService(store Store, cfg *config.WebAuthnConfig) *Service {
+	return &Service{
+		store:    store,
+		cfg:      cfg,
+		rpIDHash: sha256.Sum256([]byte(cfg.RPID)),
+	}
+}
+
+// Timeout 仪式有效期，调用方保存仪式状态时使用
+func (s *Service) Timeout() time.Duration {
+	return s.cfg.Timeout
+}
+
+// Credentials 列出用户的凭证
+func (s *Service) Credentials(ctx context.Context, userID string) ([]*Credential, error) {
+	return s.store.List(ctx, userID)
+}
+
+// Enabled 判断用户是否注册了凭证
+func (s *Service) Enabled(ctx context.Context, userID string) (bool, error) {
+	credentials, err := s.store.List(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(credentials) > 0, nil
+}
+
+// Remove 删除用户的一个凭证
+func (s *Service) Remove(ctx context.Context, userID, id string) error {
+	return s.store.Delete(ctx, userID, id)
+}
+
+// RemoveAll 删除用户的全部凭证
+func (s *Service) RemoveAll(ctx context.Context, userID string) error {
+	return s.store.DeleteAll(ctx, userID)
+}
+
+// BeginRegistration 生成注册选项，已注册的凭证列入 excludeCredentials 避免重复注册同一认证器
+func (s *Service) BeginRegistration(ctx context.Context, userID, username string) (*CreationOptions, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.store.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]CredentialParameter, 0, len(supportedAlgorithms))
+	for _, alg := range supportedAlgorithms {
+		params = append(params, CredentialParameter{Type: credentialType, Alg: alg})
+	}
+
+	return &CreationOptions{
+		RP: RelyingParty{ID: s.cfg.RPID, Name: s.cfg.RPName},
+		User: UserEntity{
+			ID:          encode([]byte(userID)),
+			Name:        username,
+			DisplayName: username,
+		},
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            s.cfg.Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(existing),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: s.cfg.UserVerification,
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishRegistration 验证注册结果并保存凭证
+//
+// challenge 为 BeginRegistration 返回的质询，由调用方从仪式状态中取出。
+func (s *Service) FinishRegistration(ctx context.Context, userID, challenge, name string, resp *RegistrationResponse) (*Credential, error) {
+	if resp.Type != credentialType {
+		return nil, invalid("unexpected credential type")
+	}
+
+	rawClientData, err := decode(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, invalid("malformed clientDataJSON")
+	}
+	if err := s.verifyClientData(rawClientData, typeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	rawAttestation, err := decode(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, invalid("malformed attestationObject")
+	}
+	format, authData, attStmt, err := parseAttestationObject(rawAttestation)
+	if err != nil {
+		return nil, invalid(err.Error())
+	}
+
+	if err := s.verifyAuthenticatorData(authData, s.cfg.UserVerification == UVRequired); err != nil {
+		return nil, err
+	}
+	if !authData.has(flagAttestedData) {
+		return nil, invalid("missing attested credential data")
+	}
+	if resp.RawID != "" && resp.RawID != encode(authData.credentialID) {
+		return nil, invalid("credential id mismatch")
+	}
+
+	key, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, invalid(err.Error())
+	}
+
+	clientDataHash := sha256.Sum256(rawClientData)
+	if err := verifyAttestation(format, attStmt, authData, clientDataHash[:], key); err != nil {
+		return nil, invalid(err.Error())
+	}
+
+	credential := &Credential{
+		ID:             encode(authData.credentialID),
+		UserID:         userID,
+		Name:           credentialName(name),
+		PublicKey:      append([]byte(nil), authData.publicKey...),
+		Algorithm:      key.alg,
+		SignCount:      authData.signCount,
+		AAGUID:         formatAAGUID(authData.aaguid),
+		Transports:     resp.Response.Transports,
+		BackupEligible: authData.has(flagBackupEligible),
+		BackupState:    authData.has(flagBackupState),
+		CreatedAt:      time.Now(),
+	}
+	if err := s.store.Create(ctx, credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// BeginLogin 生成认证选项
+//
+// userID 非空时作为第二因素，只允许该用户的凭证；为空时为无密码登录，
+// 由认证器选择可发现凭证，并始终要求用户验证。
+func (s *Service) BeginLogin(ctx context.Context, userID string) (*RequestOptions, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          s.cfg.Timeout.Milliseconds(),
+		RPID:             s.cfg.RPID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: UVRequired,
+	}
+	if userID == "" {
+		return opts, nil
+	}
+
+	credentials, err := s.store.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(credentials) == 0 {
+		return nil, ErrCredentialNotFound
+	}
+	opts.AllowCredentials = descriptors(credentials)
+	opts.UserVerification = s.cfg.UserVerification
+	return opts, nil
+}
+
+// FinishLogin 验证认证结果，检查签名计数并更新凭证
+//
+// userID 非空时凭证必须属于该用户；为空时（无密码登录）按凭证确定用户，并要求用户验证。
+func (s *Service) FinishLogin(ctx context.Context, userID, challenge string, resp *AssertionResponse) (*Assertion, error) {
+	if resp.Type != credentialType {
+		return nil, invalid("unexpected credential type")
+	}
+
+	id := resp.RawID
+	if id == "" {
+		id = resp.ID
+	}
+	credential, err := s.store.Get(ctx, strings.TrimRight(id, "="))
+	if err != nil {
+		return nil, err
+	}
+	if userID != "" && credential.UserID != userID {
+		return nil, ErrCredentialNotFound
+	}
+	if resp.Response.UserHandle != "" {
+		handle, err := decode(resp.Response.UserHandle)
+		if err != nil || string(handle) != credential.UserID {
+			return nil, invalid("user handle mismatch")
+		}
+	} else if userID == "" {
+		return nil, invalid("missing user handle")
+	}
+
+	rawClientData, err := decode(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, invalid("malformed clientDataJSON")
+	}
+	if err := s.verifyClientData(rawClientData, typeGet, challenge); err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := decode(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, invalid("malformed authenticatorData")
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, invalid(err.Error())
+	}
+	requireUV := userID == "" || s.cfg.UserVerification == UVRequired
+	if err := s.verifyAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+
+	sig, err := decode(resp.Response.Signature)
+	if err != nil {
+		return nil, invalid("malformed signature")
+	}
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(rawClientData)
+	if err := key.verify(append(append([]byte(nil), rawAuthData...), clientDataHash[:]...), sig); err != nil {
+		return nil, invalid(err.Error())
+	}
+
+	// 签名计数不增加说明凭证可能被克隆；两者都为 0 表示认证器不支持计数
+	now := time.Now()
+	var stored uint32
+	err = s.store.Update(ctx, credential.ID, func(c *Credential) error {
+		stored = c.SignCount
+		if (authData.signCount != 0 || c.SignCount != 0) && authData.signCount <= c.SignCount {
+			return ErrSignCountRegression
+		}
+		c.SignCount = authData.signCount
+		c.BackupState = authData.has(flagBackupState)
+		c.LastUsedAt = &now
+		credential = c.clone()
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrSignCountRegression) {
+			log.WithFields(log.Fields{
+				"event":         "webauthn_sign_count_regression",
+				"user_id":       credential.UserID,
+				"credential_id": credential.ID,
+				"stored_count":  stored,
+				"signed_count":  authData.signCount,
+			}).Warn("security event: webauthn sign count did not increase, authenticator may be cloned")
+		}
+		return nil, err
+	}
+
+	return &Assertion{
+		Credential:   credential,
+		UserVerified: authData.has(flagUserVerified),
+	}, nil
+}
+
+// verifyClientData 校验客户端数据的类型、质询和来源
+func (s *Service) verifyClientData(raw []byte, typ, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return invalid("malformed clientDataJSON")
+	}
+	if cd.Type != typ {
+		return invalid("unexpected client data type")
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(cd.Challenge, "=")), []byte(challenge)) != 1 {
+		return invalid("challenge mismatch")
+	}
+	if cd.CrossOrigin {
+		return invalid("cross-origin requests are not allowed")
+	}
+	for _, origin := range s.cfg.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return invalid(fmt.Sprintf("origin %q is not allowed", cd.Origin))
+}
+
+// verifyAuthenticatorData 校验 RP ID 哈希和用户在场/用户验证标志
+func (s *Service) verifyAuthenticatorData(ad *authenticatorData, requireUV bool) error {
+	if subtle.ConstantTimeCompare(ad.rpIDHash, s.rpIDHash[:]) != 1 {
+		return invalid("rp id hash mismatch")
+	}
+	if !ad.has(flagUserPresent) {
+		return invalid("user presence required")
+	}
+	if requireUV && !ad.has(flagUserVerified) {
+		return invalid("user verification required")
+	}
+	if !ad.has(flagBackupEligible) && ad.has(flagBackupState) {
+		return invalid("invalid backup flags")
+	}
+	return nil
+}
+
+// parseAttestationObject 解析 attestationObject，返回格式、认证器数据和证明声明
+func parseAttestationObject(data []byte) (string, *authenticatorData, map[interface{}]interface{}, error) {
+	v, rest, err := decodeCBOR(data)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if len(rest) != 0 {
+		return "", nil, nil, errors.New("trailing data after attestation object")
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return "", nil, nil, errors.New("attestation object is not a map")
+	}
+
+	format, _ := m["fmt"].(string)
+	rawAuthData, _ := m["authData"].([]byte)
+	attStmt, ok := m["attStmt"].(map[interface{}]interface{})
+	if format == "" || rawAuthData == nil || !ok {
+		return "", nil, nil, errors.New("incomplete attestation object")
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return format, authData, attStmt, nil
+}
+
+// verifyAttestation 校验证明声明
+//
+// 注册时请求 attestation "none"，不评估认证器型号的可信度：
+// "none" 格式要求声明为空；部分认证器仍返回 "packed"，此时只校验签名（自证明或 x5c 叶子证书），
+// 不校验证书链。其他格式拒绝。
+func verifyAttestation(format string, attStmt map[interface{}]interface{}, ad *authenticatorData, clientDataHash []byte, key *publicKey) error {
+	switch format {
+	case "none":
+		if len(attStmt) != 0 {
+			return errors.New("none attestation must have an empty statement")
+		}
+		return nil
+	case "packed":
+		alg, _ := attStmt["alg"].(int64)
+		sig, _ := attStmt["sig"].([]byte)
+		if sig == nil {
+			return errors.New("packed attestation has no signature")
+		}
+		signed := append(append([]byte(nil), ad.raw...), clientDataHash...)
+
+		x5c, ok := attStmt["x5c"].([]interface{})
+		if !ok {
+			if alg != key.alg {
+				return errors.New("packed self attestation algorithm mismatch")
+			}
+			return key.verify(signed, sig)
+		}
+		if len(x5c) == 0 {
+			return errors.New("packed attestation has empty x5c")
+		}
+		der, _ := x5c[0].([]byte)
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("invalid attestation certificate: %w", err)
+		}
+		sigAlg, ok := map[int64]x509.SignatureAlgorithm{
+			AlgES256: x509.ECDSAWithSHA256,
+			AlgEdDSA: x509.PureEd25519,
+			AlgRS256: x509.SHA256WithRSA,
+		}[alg]
+		if !ok {
+			return fmt.Errorf("unsupported attestation algorithm %d", alg)
+		}
+		return cert.CheckSignature(sigAlg, signed, sig)
+	default:
+		return fmt.Errorf("unsupported attestation format %q", format)
+	}
+}
+
+// descriptors 将凭证转换为 allowCredentials/excludeCredentials 描述
+func descriptors(credentials []*Credential) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(credentials))
+	for _, c := range credentials {
+		list = append(list, CredentialDescriptor{
+			Type:       credentialType,
+			ID:         c.ID,
+			Transports: c.Transports,
+		})
+	}
+	return list
+}
+
+// credentialName 规范化用户提供的凭证名称
+func credentialName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "Passkey"
+	}
+	if r := []rune(name); len(r) > maxNameLength {
+		name = string(r[:maxNameLength])
+	}
+	return name
+}
+
+// formatAAGUID 将 AAGUID 格式化为 UUID 字符串，全零表示认证器未提供
+func formatAAGUID(b []byte) string {
+	if len(b) != 16 || bytes.Equal(b, make([]byte, 16)) {
+		return ""
+	}
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// newChallenge 生成随机质询
+func newChallenge() (string, error) {
+	b := make([]byte, challengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
+
+// encode WebAuthn JSON 中的二进制字段使用无填充的 base64url
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decode 解码 base64url，兼容带填充的输入
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// invalid 包装验证失败的原因
+func invalid(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidResponse, reason)
+}
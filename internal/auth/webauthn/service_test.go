@@ -0,0 +1,270 @@
+package webauthn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://login.example.com"
+	testUserID = "user-1"
+)
+
+func newTestService(t *testing.T) (*Service, *MemoryStore) {
+	t.Helper()
+
+	store := NewMemoryStore()
+	return NewService(store, &config.WebAuthnConfig{
+		RPID:             testRPID,
+		RPName:           "Example",
+		Origins:          []string{testOrigin},
+		UserVerification: UVPreferred,
+		Timeout:          time.Minute,
+	}), store
+}
+
+// register 用认证器为 testUserID 完成注册
+func register(t *testing.T, s *Service, a *softAuthenticator) *Credential {
+	t.Helper()
+
+	ctx := context.Background()
+	opts, err := s.BeginRegistration(ctx, testUserID, "alice")
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	credential, err := s.FinishRegistration(ctx, testUserID, opts.Challenge, "laptop", a.register(opts))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	return credential
+}
+
+// beginLogin 为第二因素（userID 非空）或无密码登录发起认证
+func beginLogin(t *testing.T, s *Service, userID string) *RequestOptions {
+	t.Helper()
+
+	opts, err := s.BeginLogin(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	return opts
+}
+
+func TestRegistrationAndLoginRoundTrip(t *testing.T) {
+	s, store := newTestService(t)
+	a := newSoftAuthenticator(t)
+	ctx := context.Background()
+
+	credential := register(t, s, a)
+	if credential.ID != encode(a.credID) || credential.UserID != testUserID || credential.Algorithm != AlgES256 ||
+		credential.Name != "laptop" || credential.SignCount != 0 {
+		t.Fatalf("credential = %+v", credential)
+	}
+
+	// 已注册的认证器在下次注册时被排除
+	opts, err := s.BeginRegistration(ctx, testUserID, "alice")
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	if len(opts.ExcludeCredentials) != 1 || opts.ExcludeCredentials[0].ID != credential.ID {
+		t.Fatalf("excludeCredentials = %+v", opts.ExcludeCredentials)
+	}
+
+	// 第二因素
+	login := beginLogin(t, s, testUserID)
+	if len(login.AllowCredentials) != 1 || login.AllowCredentials[0].ID != credential.ID || login.RPID != testRPID {
+		t.Fatalf("request options = %+v", login)
+	}
+	assertion, err := s.FinishLogin(ctx, testUserID, login.Challenge, a.assert(login))
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if !assertion.UserVerified || assertion.Credential.SignCount != 1 || assertion.Credential.LastUsedAt == nil {
+		t.Fatalf("assertion = %+v", assertion.Credential)
+	}
+
+	// 无密码登录按用户句柄确定用户
+	login = beginLogin(t, s, "")
+	assertion, err = s.FinishLogin(ctx, "", login.Challenge, a.assert(login))
+	if err != nil {
+		t.Fatalf("passwordless FinishLogin: %v", err)
+	}
+	if assertion.Credential.UserID != testUserID {
+		t.Fatalf("passwordless user = %q", assertion.Credential.UserID)
+	}
+
+	stored, err := store.Get(ctx, credential.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if stored.SignCount != 2 {
+		t.Fatalf("stored sign count = %d, want 2", stored.SignCount)
+	}
+
+	// 其他用户不能以该凭证完成第二因素
+	if _, err := s.FinishLogin(ctx, "user-2", login.Challenge, a.assert(login)); !errors.Is(err, ErrCredentialNotFound) {
+		t.Fatalf("FinishLogin for another user error = %v, want %v", err, ErrCredentialNotFound)
+	}
+}
+
+func TestRejectsWrongOriginOrRPID(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(a *softAuthenticator)
+	}{
+		{name: "wrong origin", mutate: func(a *softAuthenticator) { a.origin = "https://login.example.com.evil.test" }},
+		{name: "http origin", mutate: func(a *softAuthenticator) { a.origin = "http://login.example.com" }},
+		{name: "wrong rp id", mutate: func(a *softAuthenticator) { a.rpID = "evil.test" }},
+		{name: "parent rp id", mutate: func(a *softAuthenticator) { a.rpID = "com" }},
+	}
+
+	for _, tt := range tests {
+		t.Run("registration "+tt.name, func(t *testing.T) {
+			s, store := newTestService(t)
+			a := newSoftAuthenticator(t)
+			tt.mutate(a)
+			ctx := context.Background()
+
+			opts, err := s.BeginRegistration(ctx, testUserID, "alice")
+			if err != nil {
+				t.Fatalf("BeginRegistration: %v", err)
+			}
+			if _, err := s.FinishRegistration(ctx, testUserID, opts.Challenge, "", a.register(opts)); !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("FinishRegistration error = %v, want %v", err, ErrInvalidResponse)
+			}
+			if list, _ := store.List(ctx, testUserID); len(list) != 0 {
+				t.Fatalf("rejected credential was stored: %+v", list)
+			}
+		})
+
+		t.Run("login "+tt.name, func(t *testing.T) {
+			s, store := newTestService(t)
+			a := newSoftAuthenticator(t)
+			credential := register(t, s, a)
+			tt.mutate(a)
+			ctx := context.Background()
+
+			login := beginLogin(t, s, testUserID)
+			if _, err := s.FinishLogin(ctx, testUserID, login.Challenge, a.assert(login)); !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("FinishLogin error = %v, want %v", err, ErrInvalidResponse)
+			}
+			if stored, _ := store.Get(ctx, credential.ID); stored.SignCount != 0 || stored.LastUsedAt != nil {
+				t.Fatalf("rejected assertion updated the credential: %+v", stored)
+			}
+		})
+	}
+}
+
+func TestRejectsReplayedChallenge(t *testing.T) {
+	s, _ := newTestService(t)
+	a := newSoftAuthenticator(t)
+	ctx := context.Background()
+
+	// 注册响应不能用于另一次注册仪式
+	first, err := s.BeginRegistration(ctx, testUserID, "alice")
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	resp := a.register(first)
+	second, err := s.BeginRegistration(ctx, testUserID, "alice")
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	if _, err := s.FinishRegistration(ctx, testUserID, second.Challenge, "", resp); !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("FinishRegistration with another challenge error = %v, want %v", err, ErrInvalidResponse)
+	}
+	if _, err := s.FinishRegistration(ctx, testUserID, first.Challenge, "", resp); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+
+	login := beginLogin(t, s, testUserID)
+	assertion := a.assert(login)
+	if _, err := s.FinishLogin(ctx, testUserID, login.Challenge, assertion); err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+
+	// 截获的认证结果不能用于新的仪式
+	next := beginLogin(t, s, testUserID)
+	if _, err := s.FinishLogin(ctx, testUserID, next.Challenge, assertion); !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("FinishLogin with replayed assertion error = %v, want %v", err, ErrInvalidResponse)
+	}
+
+	// 同一仪式重放时签名计数没有增加；仪式状态由调用方在成功后作废
+	if _, err := s.FinishLogin(ctx, testUserID, login.Challenge, assertion); !errors.Is(err, ErrSignCountRegression) {
+		t.Fatalf("FinishLogin replayed in the same ceremony error = %v, want %v", err, ErrSignCountRegression)
+	}
+
+	// 注册响应不能作为认证结果
+	reg := a.assert(next)
+	reg.Response.ClientDataJSON = encode(a.clientData(typeCreate, next.Challenge))
+	if _, err := s.FinishLogin(ctx, testUserID, next.Challenge, reg); !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("FinishLogin with create client data error = %v, want %v", err, ErrInvalidResponse)
+	}
+}
+
+func TestSignCountRegression(t *testing.T) {
+	s, store := newTestService(t)
+	a := newSoftAuthenticator(t)
+	credential := register(t, s, a)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		login := beginLogin(t, s, testUserID)
+		if _, err := s.FinishLogin(ctx, testUserID, login.Challenge, a.assert(login)); err != nil {
+			t.Fatalf("FinishLogin: %v", err)
+		}
+	}
+
+	// 克隆的认证器从较早的计数继续签名
+	tests := []struct {
+		name  string
+		count uint32
+	}{
+		{name: "backwards", count: 1},
+		{name: "unchanged", count: 3},
+		{name: "reset to zero", count: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clone := *a
+			clone.signCount = tt.count - 1
+			if tt.count == 0 {
+				clone.fixedCount, clone.signCount = true, 0
+			}
+			login := beginLogin(t, s, testUserID)
+			if _, err := s.FinishLogin(ctx, testUserID, login.Challenge, clone.assert(login)); !errors.Is(err, ErrSignCountRegression) {
+				t.Fatalf("FinishLogin error = %v, want %v", err, ErrSignCountRegression)
+			}
+			if stored, _ := store.Get(ctx, credential.ID); stored.SignCount != 3 {
+				t.Fatalf("stored sign count = %d, want 3", stored.SignCount)
+			}
+		})
+	}
+
+	// 原认证器继续递增时不受影响
+	login := beginLogin(t, s, testUserID)
+	if _, err := s.FinishLogin(ctx, testUserID, login.Challenge, a.assert(login)); err != nil {
+		t.Fatalf("FinishLogin after rejected clone: %v", err)
+	}
+}
+
+func TestSignCountUnsupported(t *testing.T) {
+	s, _ := newTestService(t)
+	a := newSoftAuthenticator(t)
+	a.fixedCount = true
+	register(t, s, a)
+	ctx := context.Background()
+
+	// 计数始终为 0 的认证器（如部分同步的通行密钥）可以重复使用
+	for i := 0; i < 2; i++ {
+		login := beginLogin(t, s, testUserID)
+		if _, err := s.FinishLogin(ctx, testUserID, login.Challenge, a.assert(login)); err != nil {
+			t.Fatalf("FinishLogin %d: %v", i, err)
+		}
+	}
+}
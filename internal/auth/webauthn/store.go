@@ -0,0 +1,318 @@
+package webauthn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCredentialNotFound = errors.New("webauthn credential not found")
+	ErrCredentialExists   = errors.New("webauthn credential already registered")
+)
+
+// Credential 用户注册的 WebAuthn 凭证（通行密钥或安全密钥）
+type Credential struct {
+	ID             string     `json:"id"` // base64url 编码的凭证 ID
+	UserID         string     `json:"user_id"`
+	Name           string     `json:"name"`
+	PublicKey      []byte     `json:"public_key"` // COSE_Key 编码
+	Algorithm      int64      `json:"algorithm"`
+	SignCount      uint32     `json:"sign_count"`
+	AAGUID         string     `json:"aaguid,omitempty"`
+	Transports     []string   `json:"transports,omitempty"`
+	BackupEligible bool       `json:"backup_eligible"`
+	BackupState    bool       `json:"backup_state"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Store WebAuthn 凭证存储
+type Store interface {
+	// List 列出用户的全部凭证，按注册时间排序
+	List(ctx context.Context, userID string) ([]*Credential, error)
+
+	// Get 按凭证 ID 查询，不存在时返回 ErrCredentialNotFound
+	Get(ctx context.Context, id string) (*Credential, error)
+
+	// Create 保存新凭证，凭证 ID 已存在时返回 ErrCredentialExists
+	Create(ctx context.Context, credential *Credential) error
+
+	// Update 原子地修改凭证，fn 返回错误时放弃修改；不存在时返回 ErrCredentialNotFound
+	Update(ctx context.Context, id string, fn func(*Credential) error) error
+
+	// Delete 删除用户的一个凭证，凭证不属于该用户时返回 ErrCredentialNotFound
+	Delete(ctx context.Context, userID, id string) error
+
+	// DeleteAll 删除用户的全部凭证
+	DeleteAll(ctx context.Context, userID string) error
+}
+
+// MemoryStore 内存 WebAuthn 凭证存储
+type MemoryStore struct {
+	mu          sync.Mutex
+	credentials map[string]*Credential
+}
+
+// NewMemoryStore 创建内存 WebAuthn 凭证存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		credentials: make(map[string]*Credential),
+	}
+}
+
+// List 列出用户的全部凭证，返回副本
+func (s *MemoryStore) List(ctx context.Context, userID string) ([]*Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credentials := []*Credential{}
+	for _, c := range s.credentials {
+		if c.UserID == userID {
+			credentials = append(credentials, c.clone())
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+	return credentials, nil
+}
+
+// Get 按凭证 ID 查询，返回副本
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.credentials[id]
+	if !ok {
+		return nil, ErrCredentialNotFound
+	}
+	return c.clone(), nil
+}
+
+// Create 保存新凭证
+func (s *MemoryStore) Create(ctx context.Context, credential *Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createLocked(credential)
+}
+
+// Update 原子地修改凭证
+func (s *MemoryStore) Update(ctx context.Context, id string, fn func(*Credential) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.updateLocked(id, fn)
+	return err
+}
+
+// Delete 删除用户的一个凭证
+func (s *MemoryStore) Delete(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.deleteLocked(userID, id)
+	return err
+}
+
+// DeleteAll 删除用户的全部凭证
+func (s *MemoryStore) DeleteAll(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteAllLocked(userID)
+	return nil
+}
+
+// createLocked 保存新凭证，调用方需持有锁
+func (s *MemoryStore) createLocked(credential *Credential) error {
+	if _, exists := s.credentials[credential.ID]; exists {
+		return ErrCredentialExists
+	}
+	s.credentials[credential.ID] = credential.clone()
+	return nil
+}
+
+// updateLocked 在副本上执行修改，成功后替换原记录并返回原记录，调用方需持有锁
+func (s *MemoryStore) updateLocked(id string, fn func(*Credential) error) (*Credential, error) {
+	c, ok := s.credentials[id]
+	if !ok {
+		return nil, ErrCredentialNotFound
+	}
+
+	updated := c.clone()
+	if err := fn(updated); err != nil {
+		return nil, err
+	}
+	s.credentials[id] = updated
+	return c, nil
+}
+
+// deleteLocked 删除凭证并返回原记录，调用方需持有锁
+func (s *MemoryStore) deleteLocked(userID, id string) (*Credential, error) {
+	c, ok := s.credentials[id]
+	if !ok || c.UserID != userID {
+		return nil, ErrCredentialNotFound
+	}
+	delete(s.credentials, id)
+	return c, nil
+}
+
+// deleteAllLocked 删除用户的全部凭证并返回被删除的记录，调用方需持有锁
+func (s *MemoryStore) deleteAllLocked(userID string) []*Credential {
+	var removed []*Credential
+	for id, c := range s.credentials {
+		if c.UserID == userID {
+			removed = append(removed, c)
+			delete(s.credentials, id)
+		}
+	}
+	return removed
+}
+
+// FileStore 基于 JSON 文件持久化的 WebAuthn 凭证存储
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore 创建文件 WebAuthn 凭证存储，文件存在时加载已有记录
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read webauthn store: %w", err)
+	}
+
+	var credentials []*Credential
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("decode webauthn store: %w", err)
+	}
+	for _, c := range credentials {
+		s.credentials[c.ID] = c
+	}
+
+	return s, nil
+}
+
+// Create 保存新凭证并持久化
+func (s *FileStore) Create(ctx context.Context, credential *Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.createLocked(credential); err != nil {
+		return err
+	}
+	if err := s.persistLocked(); err != nil {
+		delete(s.credentials, credential.ID)
+		return err
+	}
+	return nil
+}
+
+// Update 原子地修改凭证并持久化
+func (s *FileStore) Update(ctx context.Context, id string, fn func(*Credential) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := s.updateLocked(id, fn)
+	if err != nil {
+		return err
+	}
+	if err := s.persistLocked(); err != nil {
+		s.credentials[id] = previous
+		return err
+	}
+	return nil
+}
+
+// Delete 删除用户的一个凭证并持久化
+func (s *FileStore) Delete(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := s.deleteLocked(userID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.persistLocked(); err != nil {
+		s.credentials[id] = previous
+		return err
+	}
+	return nil
+}
+
+// DeleteAll 删除用户的全部凭证并持久化
+func (s *FileStore) DeleteAll(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := s.deleteAllLocked(userID)
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := s.persistLocked(); err != nil {
+		for _, c := range removed {
+			s.credentials[c.ID] = c
+		}
+		return err
+	}
+	return nil
+}
+
+// persistLocked 先写临时文件再重命名，避免写入中断导致文件损坏
+func (s *FileStore) persistLocked() error {
+	credentials := make([]*Credential, 0, len(s.credentials))
+	for _, c := range s.credentials {
+		credentials = append(credentials, c)
+	}
+
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write webauthn store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write webauthn store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write webauthn store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("write webauthn store: %w", err)
+	}
+	return nil
+}
+
+// clone 返回凭证的深拷贝
+func (c *Credential) clone() *Credential {
+	copied := *c
+	copied.PublicKey = append([]byte(nil), c.PublicKey...)
+	copied.Transports = append([]string(nil), c.Transports...)
+	if c.LastUsedAt != nil {
+		t := *c.LastUsedAt
+		copied.LastUsedAt = &t
+	}
+	return &copied
+}
@@ -0,0 +1,204 @@
+package abac
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+)
+
+// 可在条件中使用的属性；subject.claims.<name> 和 resource.metadata.<key> 取对应的声明和元数据
+const (
+	attributeSubjectID    = "subject.id"           // 用户 ID，服务主体为 client_id
+	attributeRoles        = "subject.roles"        // 令牌中的角色及其继承的全部祖先角色
+	attributeEmail        = "subject.email"        // 小写
+	attributeEmailDomain  = "subject.email_domain" // 小写
+	prefixClaims          = "subject.claims."      // 令牌中的任一声明，见 newSubject
+	attributeResourceID   = "resource.id"
+	attributeResourceType = "resource.type"
+	attributeOwner        = "resource.owner"
+	prefixMetadata        = "resource.metadata."
+	attributeAction       = "action"
+	attributeTime         = "environment.time"    // 策略时区的当日时间，只能用 between / not_between
+	attributeWeekday      = "environment.weekday" // 策略时区的星期，如 monday
+	attributeIP           = "environment.ip"      // 请求来源 IP
+)
+
+// Subject 主体属性
+type Subject struct {
+	ID     string
+	Roles  []string // 评估时按角色继承关系展开
+	Email  string
+	Claims map[string][]string
+}
+
+// Resource 资源属性，由处理器在加载对象后提供
+type Resource struct {
+	ID       string
+	Type     string
+	Owner    string
+	Metadata map[string]string
+}
+
+// Environment 环境属性
+type Environment struct {
+	Time time.Time
+	IP   net.IP
+}
+
+// Request 一次授权请求的全部属性；Resource 为空表示尚未加载资源（如路由上的授权中间件）
+type Request struct {
+	Subject     Subject
+	Resource    *Resource
+	Action      rbac.Permission
+	Environment Environment
+}
+
+// NewRequest 由令牌声明和 HTTP 请求构造授权请求；来源 IP 取自 RemoteAddr（可信代理已由中间件处理）
+func NewRequest(r *http.Request, claims *jwt.CustomClaims, action rbac.Permission, resource *Resource) *Request {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return &Request{
+		Subject:  newSubject(claims),
+		Resource: resource,
+		Action:   action,
+		Environment: Environment{
+			Time: time.Now(),
+			IP:   net.ParseIP(host),
+		},
+	}
+}
+
+// newSubject 提取令牌中可用于策略的主体属性
+//
+// subject.claims 包含令牌中的全部声明：字符串、数字和布尔值转为字符串，数组展开为多个值，
+// 嵌套对象以 . 连接键名（如 act.sub）。另外补充不在令牌中的 key_id，以及 act 表示当前行为方。
+func newSubject(claims *jwt.CustomClaims) Subject {
+	subject := Subject{
+		ID:     claims.UserID,
+		Roles:  claims.Roles,
+		Email:  strings.ToLower(claims.Email),
+		Claims: make(map[string][]string),
+	}
+
+	for name, value := range claims.Raw {
+		flattenClaim(subject.Claims, name, value)
+	}
+
+	// 个人访问令牌等由服务端构造的声明没有原始声明，补充常用字段
+	add := func(name string, values ...string) {
+		if _, ok := subject.Claims[name]; ok {
+			return
+		}
+		for _, v := range values {
+			if v != "" {
+				subject.Claims[name] = append(subject.Claims[name], v)
+			}
+		}
+	}
+	add("username", claims.Username)
+	add("client_id", claims.ClientID)
+	add("amr", claims.AuthMethods...)
+	add("key_id", claims.KeyID)
+	add("iss", claims.Issuer)
+	delete(subject.Claims, "act")
+	add("act", claims.ActorSubject())
+	return subject
+}
+
+// flattenClaim 将声明值转为字符串列表写入 claims
+func flattenClaim(claims map[string][]string, name string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			claims[name] = append(claims[name], v)
+		}
+	case float64:
+		claims[name] = append(claims[name], strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		claims[name] = append(claims[name], strconv.FormatBool(v))
+	case []interface{}:
+		for _, item := range v {
+			flattenClaim(claims, name, item)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			flattenClaim(claims, name+"."+key, item)
+		}
+	}
+}
+
+// knownAttribute 判断条件中的属性名是否受支持
+func knownAttribute(name string) bool {
+	switch name {
+	case attributeSubjectID, attributeRoles, attributeEmail, attributeEmailDomain,
+		attributeResourceID, attributeResourceType, attributeOwner,
+		attributeAction, attributeTime, attributeWeekday, attributeIP:
+		return true
+	}
+	return (strings.HasPrefix(name, prefixClaims) && len(name) > len(prefixClaims)) ||
+		(strings.HasPrefix(name, prefixMetadata) && len(name) > len(prefixMetadata))
+}
+
+// resolve 返回请求中属性的值，属性不存在时返回空
+func resolve(req *Request, name string, loc *time.Location) []string {
+	switch name {
+	case attributeSubjectID:
+		return nonEmpty(req.Subject.ID)
+	case attributeRoles:
+		return req.Subject.Roles
+	case attributeEmail:
+		return nonEmpty(req.Subject.Email)
+	case attributeEmailDomain:
+		if i := strings.LastIndex(req.Subject.Email, "@"); i >= 0 {
+			return nonEmpty(req.Subject.Email[i+1:])
+		}
+		return nil
+	case attributeAction:
+		return []string{string(req.Action)}
+	case attributeWeekday:
+		return []string{strings.ToLower(req.Environment.Time.In(loc).Weekday().String())}
+	case attributeIP:
+		if req.Environment.IP == nil {
+			return nil
+		}
+		return []string{req.Environment.IP.String()}
+	}
+
+	if strings.HasPrefix(name, prefixClaims) {
+		return req.Subject.Claims[strings.TrimPrefix(name, prefixClaims)]
+	}
+
+	if req.Resource == nil {
+		return nil
+	}
+	switch name {
+	case attributeResourceID:
+		return nonEmpty(req.Resource.ID)
+	case attributeResourceType:
+		return nonEmpty(req.Resource.Type)
+	case attributeOwner:
+		return nonEmpty(req.Resource.Owner)
+	}
+	if strings.HasPrefix(name, prefixMetadata) {
+		if v, ok := req.Resource.Metadata[strings.TrimPrefix(name, prefixMetadata)]; ok {
+			return []string{v}
+		}
+	}
+	return nil
+}
+
+// nonEmpty 将非空字符串包装为单值列表
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
@@ -0,0 +1,136 @@
+package abac
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Decision 策略评估结果；Effect 为空表示没有适用的规则
+type Decision struct {
+	Effect Effect
+	RuleID string // 决定结果的规则
+}
+
+// Allows 将策略结果与 RBAC 的判定合并：拒绝规则优先，其次是允许规则，没有适用的规则时沿用 RBAC 的判定
+func (d Decision) Allows(rbacAllowed bool) bool {
+	switch d.Effect {
+	case EffectDeny:
+		return false
+	case EffectAllow:
+		return true
+	default:
+		return rbacAllowed
+	}
+}
+
+// RoleExpander 按角色继承关系展开角色，由 rbac.RBACManager 实现
+type RoleExpander interface {
+	ExpandRoles(roles []string) []string
+}
+
+// Engine 基于属性的访问策略引擎，与 RBACManager 配合使用
+//
+// 规则从 JSON 文件加载，可以定期重新加载；没有配置文件时不包含任何规则，所有判定沿用 RBAC。
+type Engine struct {
+	path     string
+	location *time.Location // 评估 environment.time 和 environment.weekday 的时区
+	roles    RoleExpander   // 评估前展开主体角色，继承自 editor 的角色同样受针对 editor 的规则约束
+
+	mu    sync.RWMutex
+	rules []*compiledRule
+}
+
+// NewEngine 创建策略引擎并加载规则文件，规则无效时返回错误
+func NewEngine(path string, location *time.Location, roles RoleExpander) (*Engine, error) {
+	e := &Engine{
+		path:     path,
+		location: location,
+		roles:    roles,
+	}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Rules 返回已加载的规则数量
+func (e *Engine) Rules() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return len(e.rules)
+}
+
+// Evaluate 按拒绝优先（deny-overrides）评估全部适用的规则
+//
+// 请求尚未加载资源时，引用资源属性的规则不参与评估，由处理器加载资源后再次评估。
+func (e *Engine) Evaluate(req *Request) Decision {
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+	if len(rules) == 0 {
+		return Decision{}
+	}
+
+	expanded := *req
+	expanded.Subject.Roles = e.roles.ExpandRoles(req.Subject.Roles)
+	req = &expanded
+
+	var decision Decision
+	for _, rule := range rules {
+		if rule.needsResource && req.Resource == nil {
+			continue
+		}
+		if !rule.appliesTo(req.Action) || !rule.matches(req, e.location) {
+			continue
+		}
+		if rule.Effect == EffectDeny {
+			return Decision{Effect: EffectDeny, RuleID: rule.ID}
+		}
+		if decision.Effect == "" {
+			decision = Decision{Effect: EffectAllow, RuleID: rule.ID}
+		}
+	}
+	return decision
+}
+
+// Reload 重新加载规则文件，加载失败时保留当前规则
+func (e *Engine) Reload() error {
+	rules, err := LoadFile(e.path)
+	if err != nil {
+		return err
+	}
+	compiled, err := compile(rules)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.rules = compiled
+	e.mu.Unlock()
+	return nil
+}
+
+// Watch 定期重新加载规则文件，修改无需重启即可生效，直到 ctx 取消
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	if e.path == "" || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Reload(); err != nil {
+				log.WithError(err).Warn("failed to reload access policies")
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package abac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+)
+
+// newTestEngine 将规则写入临时文件并创建策略引擎；RBAC 管理器包含继承 editor 的自定义角色 senior-editor
+func newTestEngine(t *testing.T, rules []Rule) *Engine {
+	t.Helper()
+
+	rm := rbac.NewRBACManager(rbac.NewMemoryStore())
+	_, err := rm.CreateRole(context.Background(), &rbac.RoleDefinition{
+		Name:    "senior-editor",
+		Parents: []rbac.Role{rbac.RoleEditor},
+	})
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+
+	data, err := json.Marshal(rules)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "policies.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	e, err := NewEngine(path, time.UTC, rm)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return e
+}
+
+// parseClaims 按令牌载荷解析声明，与验证令牌时的解析方式一致
+func parseClaims(t *testing.T, payload string) *jwt.CustomClaims {
+	t.Helper()
+
+	var claims jwt.CustomClaims
+	if err := json.Unmarshal([]byte(payload), &claims); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return &claims
+}
+
+func TestEvaluateExpandsInheritedRoles(t *testing.T) {
+	e := newTestEngine(t, []Rule{{
+		ID:      "no-editor-deletes",
+		Effect:  EffectDeny,
+		Actions: []string{"resource:delete"},
+		Conditions: []Condition{
+			{Attribute: "subject.roles", Operator: OperatorIn, Values: []string{"editor"}},
+		},
+	}})
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  Effect
+	}{
+		{name: "editor", roles: []string{"editor"}, want: EffectDeny},
+		{name: "role inheriting editor", roles: []string{"senior-editor"}, want: EffectDeny},
+		{name: "viewer", roles: []string{"viewer"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{
+				Subject: Subject{ID: "1", Roles: tt.roles},
+				Action:  rbac.PermissionResourceDelete,
+			}
+			if got := e.Evaluate(req).Effect; got != tt.want {
+				t.Fatalf("Effect = %q, want %q", got, tt.want)
+			}
+			if len(req.Subject.Roles) != len(tt.roles) {
+				t.Fatalf("Evaluate modified the request roles: %v", req.Subject.Roles)
+			}
+		})
+	}
+}
+
+func TestEvaluateCustomClaims(t *testing.T) {
+	e := newTestEngine(t, []Rule{{
+		ID:      "finance-only",
+		Effect:  EffectDeny,
+		Actions: []string{"resource:*"},
+		Conditions: []Condition{
+			{Attribute: "subject.claims.department", Operator: OperatorNotIn, Values: []string{"finance"}},
+		},
+	}, {
+		ID:      "contractor-reads",
+		Effect:  EffectAllow,
+		Actions: []string{"resource:read"},
+		Conditions: []Condition{
+			{Attribute: "subject.claims.org.contractor", Operator: OperatorIn, Values: []string{"true"}},
+		},
+	}})
+
+	tests := []struct {
+		name    string
+		payload string
+		action  rbac.Permission
+		want    Effect
+	}{
+		{
+			name:    "matching claim",
+			payload: `{"user_id":"1","department":"finance"}`,
+			action:  rbac.PermissionResourceWrite,
+			want:    "",
+		},
+		{
+			name:    "claim in array",
+			payload: `{"user_id":"1","department":["sales","finance"]}`,
+			action:  rbac.PermissionResourceWrite,
+			want:    "",
+		},
+		{
+			name:    "other value",
+			payload: `{"user_id":"1","department":"sales"}`,
+			action:  rbac.PermissionResourceWrite,
+			want:    EffectDeny,
+		},
+		{
+			name:    "missing claim",
+			payload: `{"user_id":"1"}`,
+			action:  rbac.PermissionResourceWrite,
+			want:    EffectDeny,
+		},
+		{
+			name:    "nested claim",
+			payload: `{"user_id":"1","department":"finance","org":{"contractor":true}}`,
+			action:  rbac.PermissionResourceRead,
+			want:    EffectAllow,
+		},
+		{
+			name:    "deny overrides allow",
+			payload: `{"user_id":"1","department":"sales","org":{"contractor":true}}`,
+			action:  rbac.PermissionResourceRead,
+			want:    EffectDeny,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/resources", nil)
+			req := NewRequest(r, parseClaims(t, tt.payload), tt.action, nil)
+			if got := e.Evaluate(req).Effect; got != tt.want {
+				t.Fatalf("Effect = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSubjectWithoutRawClaims(t *testing.T) {
+	// 个人访问令牌的声明由服务端构造，没有原始声明
+	subject := newSubject(&jwt.CustomClaims{
+		UserID:      "1",
+		Username:    "alice",
+		AuthMethods: []string{"pwd", "otp"},
+		KeyID:       "pat-1",
+	})
+
+	for name, want := range map[string][]string{
+		"username": {"alice"},
+		"amr":      {"pwd", "otp"},
+		"key_id":   {"pat-1"},
+	} {
+		got := subject.Claims[name]
+		if len(got) != len(want) {
+			t.Errorf("claims[%s] = %v, want %v", name, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("claims[%s] = %v, want %v", name, got, want)
+			}
+		}
+	}
+}
+
+func TestEvaluateTimeWindow(t *testing.T) {
+	e := newTestEngine(t, []Rule{{
+		ID:      "no-night-writes",
+		Effect:  EffectDeny,
+		Actions: []string{"resource:write"},
+		Conditions: []Condition{
+			{Attribute: "environment.time", Operator: OperatorBetween, Values: []string{"22:00", "06:00"}},
+		},
+	}})
+
+	tests := []struct {
+		clock string
+		want  Effect
+	}{
+		{"23:30", EffectDeny},
+		{"05:59", EffectDeny},
+		{"06:00", ""},
+		{"12:00", ""},
+	}
+
+	for _, tt := range tests {
+		now, err := time.Parse("15:04", tt.clock)
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		req := &Request{
+			Subject:     Subject{ID: "1", Roles: []string{"editor"}},
+			Action:      rbac.PermissionResourceWrite,
+			Environment: Environment{Time: now},
+		}
+		if got := e.Evaluate(req).Effect; got != tt.want {
+			t.Errorf("%s: Effect = %q, want %q", tt.clock, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package abac
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+)
+
+// Effect 规则的效果
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// 条件运算符；多值属性（如 subject.roles）在任一值满足时即满足肯定运算符，全部值都不满足时才满足否定运算符
+const (
+	OperatorIn         = "in"          // 属性值在 values 中
+	OperatorNotIn      = "not_in"      // 属性值不在 values 中
+	OperatorInCIDR     = "in_cidr"     // IP 属于 values 中任一网段，只用于 environment.ip
+	OperatorNotInCIDR  = "not_in_cidr" // IP 不属于 values 中任何网段
+	OperatorBetween    = "between"     // 时间在 [values[0], values[1]) 内（HH:MM，可跨午夜），只用于 environment.time
+	OperatorNotBetween = "not_between" // 时间不在该区间内
+)
+
+// weekdays environment.weekday 的取值
+var weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// Rule 访问策略规则
+//
+// 规则适用于 actions 中的权限（可使用通配权限），且 conditions 全部满足时生效。
+// 示例：{"id": "no-after-hours-prod-writes", "effect": "deny", "actions": ["resource:write"],
+// "conditions": [{"attribute": "subject.roles", "operator": "in", "values": ["editor"]},
+// {"attribute": "resource.metadata.env", "operator": "in", "values": ["production"]},
+// {"attribute": "environment.time", "operator": "not_between", "values": ["09:00", "18:00"]}]}
+type Rule struct {
+	ID          string      `json:"id"`
+	Description string      `json:"description,omitempty"`
+	Effect      Effect      `json:"effect"`
+	Actions     []string    `json:"actions"`
+	Conditions  []Condition `json:"conditions,omitempty"`
+}
+
+// Condition 规则条件，attribute 的取值见 resolve
+type Condition struct {
+	Attribute string   `json:"attribute"`
+	Operator  string   `json:"operator"`
+	Values    []string `json:"values"`
+}
+
+// compiledRule 校验并预解析后的规则
+type compiledRule struct {
+	Rule
+	actions       *rbac.PermissionMatcher // 预编译的 actions
+	conditions    []compiledCondition
+	needsResource bool // 引用了资源属性，只在已加载资源时评估
+}
+
+// compiledCondition 预解析网段和时间的条件
+type compiledCondition struct {
+	Condition
+	networks   []*net.IPNet
+	start, end int // 从午夜起的分钟数
+}
+
+// LoadFile 从 JSON 文件加载规则，path 为空时返回空规则集
+func LoadFile(path string) ([]Rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read access policies: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("decode access policies: %w", err)
+	}
+	return rules, nil
+}
+
+// compile 校验规则并预解析条件
+func compile(rules []Rule) ([]*compiledRule, error) {
+	seen := make(map[string]bool, len(rules))
+	compiled := make([]*compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.ID == "" {
+			return nil, fmt.Errorf("rule %d: id is required", i)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("rule %s: duplicate id", rule.ID)
+		}
+		seen[rule.ID] = true
+
+		c, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// compileRule 校验单条规则
+func compileRule(rule Rule) (*compiledRule, error) {
+	if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+		return nil, fmt.Errorf("effect must be allow or deny")
+	}
+	if len(rule.Actions) == 0 {
+		return nil, fmt.Errorf("at least one action is required")
+	}
+	actions := make([]rbac.Permission, len(rule.Actions))
+	for i, action := range rule.Actions {
+		if !rbac.ValidPermission(rbac.Permission(action)) {
+			return nil, fmt.Errorf("invalid action %q", action)
+		}
+		actions[i] = rbac.Permission(action)
+	}
+
+	compiled := &compiledRule{Rule: rule, actions: rbac.NewPermissionMatcher(actions)}
+	for _, cond := range rule.Conditions {
+		c, err := compileCondition(cond)
+		if err != nil {
+			return nil, fmt.Errorf("condition on %s: %w", cond.Attribute, err)
+		}
+		if strings.HasPrefix(cond.Attribute, "resource.") {
+			compiled.needsResource = true
+		}
+		compiled.conditions = append(compiled.conditions, c)
+	}
+	return compiled, nil
+}
+
+// compileCondition 校验属性和运算符，并解析网段和时间
+func compileCondition(cond Condition) (compiledCondition, error) {
+	c := compiledCondition{Condition: cond}
+	if !knownAttribute(cond.Attribute) {
+		return c, fmt.Errorf("unknown attribute")
+	}
+	if len(cond.Values) == 0 {
+		return c, fmt.Errorf("at least one value is required")
+	}
+
+	switch cond.Operator {
+	case OperatorIn, OperatorNotIn:
+		switch cond.Attribute {
+		case attributeTime:
+			return c, fmt.Errorf("use between or not_between for %s", attributeTime)
+		case attributeWeekday:
+			for _, v := range cond.Values {
+				if !containsValue(weekdays, v) {
+					return c, fmt.Errorf("invalid weekday %q", v)
+				}
+			}
+		case attributeEmail, attributeEmailDomain:
+			values := make([]string, len(cond.Values))
+			for i, v := range cond.Values {
+				values[i] = strings.ToLower(v)
+			}
+			c.Values = values
+		}
+	case OperatorInCIDR, OperatorNotInCIDR:
+		if cond.Attribute != attributeIP {
+			return c, fmt.Errorf("%s only applies to %s", cond.Operator, attributeIP)
+		}
+		for _, v := range cond.Values {
+			_, network, err := net.ParseCIDR(v)
+			if err != nil {
+				return c, fmt.Errorf("invalid CIDR %q", v)
+			}
+			c.networks = append(c.networks, network)
+		}
+	case OperatorBetween, OperatorNotBetween:
+		if cond.Attribute != attributeTime {
+			return c, fmt.Errorf("%s only applies to %s", cond.Operator, attributeTime)
+		}
+		if len(cond.Values) != 2 {
+			return c, fmt.Errorf("%s requires a start and an end time", cond.Operator)
+		}
+		var err error
+		if c.start, err = parseClock(cond.Values[0]); err != nil {
+			return c, err
+		}
+		if c.end, err = parseClock(cond.Values[1]); err != nil {
+			return c, err
+		}
+	default:
+		return c, fmt.Errorf("unknown operator %q", cond.Operator)
+	}
+	return c, nil
+}
+
+// parseClock 解析 HH:MM，返回从午夜起的分钟数
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// appliesTo 判断规则是否适用于请求的权限
+func (r *compiledRule) appliesTo(action rbac.Permission) bool {
+	return r.actions.Match(action)
+}
+
+// matches 判断请求是否满足规则的全部条件
+func (r *compiledRule) matches(req *Request, loc *time.Location) bool {
+	for _, c := range r.conditions {
+		if !c.matches(req, loc) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches 判断请求是否满足条件
+func (c compiledCondition) matches(req *Request, loc *time.Location) bool {
+	switch c.Operator {
+	case OperatorInCIDR, OperatorNotInCIDR:
+		ip := req.Environment.IP
+		in := false
+		for _, network := range c.networks {
+			if ip != nil && network.Contains(ip) {
+				in = true
+				break
+			}
+		}
+		return in == (c.Operator == OperatorInCIDR)
+	case OperatorBetween, OperatorNotBetween:
+		now := req.Environment.Time.In(loc)
+		minute := now.Hour()*60 + now.Minute()
+		var in bool
+		if c.start <= c.end {
+			in = minute >= c.start && minute < c.end
+		} else {
+			in = minute >= c.start || minute < c.end // 跨午夜，如 22:00-06:00
+		}
+		return in == (c.Operator == OperatorBetween)
+	default:
+		in := false
+		for _, value := range resolve(req, c.Attribute, loc) {
+			if containsValue(c.Values, value) {
+				in = true
+				break
+			}
+		}
+		return in == (c.Operator == OperatorIn)
+	}
+}
+
+// containsValue 判断切片中是否包含指定值
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
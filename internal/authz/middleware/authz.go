@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/authz/abac"
 	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
 	log "github.com/sirupsen/logrus"
 )
@@ -12,12 +13,14 @@ import (
 // AuthzMiddleware 授权中间件
 type AuthzMiddleware struct {
 	rbacManager *rbac.RBACManager
+	policies    *abac.Engine
 }
 
 // NewAuthzMiddleware 创建授权中间件
-func NewAuthzMiddleware(rbacManager *rbac.RBACManager) *AuthzMiddleware {
+func NewAuthzMiddleware(rbacManager *rbac.RBACManager, policies *abac.Engine) *AuthzMiddleware {
 	return &AuthzMiddleware{
 		rbacManager: rbacManager,
+		policies:    policies,
 	}
 }
 
@@ -31,13 +34,21 @@ func (am *AuthzMiddleware) RequirePermission(permission rbac.Permission) func(ht
 				return
 			}
 
-			// 检查权限
-			if !am.rbacManager.CheckPermission(claims.Roles, permission) {
+			// 检查权限：服务与用户同样按角色授权，访问策略可以拒绝或额外允许，令牌 scope 进一步限制可用权限；
+			// 此时尚未加载资源，引用资源属性的策略由处理器加载资源后评估
+			decision := am.policies.Evaluate(abac.NewRequest(r, claims, permission, nil))
+			if !decision.Allows(am.rbacManager.CheckPermission(claims.Roles, permission)) ||
+				!rbac.ScopeAllows(claims.Scope, permission) {
 				log.WithFields(log.Fields{
 					"user_id":    claims.UserID,
 					"username":   claims.Username,
+					"client_id":  claims.ClientID,
 					"roles":      claims.Roles,
+					"scope":      claims.Scope,
+					"key_id":     claims.KeyID,
+					"actor":      claims.ActorSubject(),
 					"permission": permission,
+					"policy":     decision.RuleID,
 				}).Warn("permission denied")
 
 				am.respondError(w, http.StatusForbidden, "insufficient permissions")
@@ -59,12 +70,14 @@ func (am *AuthzMiddleware) RequireRole(role rbac.Role) func(http.Handler) http.H
 				return
 			}
 
-			// 检查角色
-			if !am.rbacManager.HasRole(claims.Roles, role) {
+			// 检查角色；个人访问令牌和委托令牌的 scope 无法限制角色，只能访问按权限授权的端点
+			if claims.IsAPIKey() || claims.IsDelegated() || !am.rbacManager.HasRole(claims.Roles, role) {
 				log.WithFields(log.Fields{
 					"user_id":       claims.UserID,
 					"username":      claims.Username,
 					"roles":         claims.Roles,
+					"key_id":        claims.KeyID,
+					"actor":         claims.ActorSubject(),
 					"required_role": role,
 				}).Warn("role not found")
 
@@ -87,12 +100,14 @@ func (am *AuthzMiddleware) RequireAnyRole(roles ...rbac.Role) func(http.Handler)
 				return
 			}
 
-			// 检查是否有任一角色
-			if !am.rbacManager.HasAnyRole(claims.Roles, roles) {
+			// 检查是否有任一角色；个人访问令牌和委托令牌只能访问按权限授权的端点
+			if claims.IsAPIKey() || claims.IsDelegated() || !am.rbacManager.HasAnyRole(claims.Roles, roles) {
 				log.WithFields(log.Fields{
 					"user_id":        claims.UserID,
 					"username":       claims.Username,
 					"roles":          claims.Roles,
+					"key_id":         claims.KeyID,
+					"actor":          claims.ActorSubject(),
 					"required_roles": roles,
 				}).Warn("no matching role found")
 
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+)
+
+func TestRequireRoleRejectsDelegatedAndAPIKeyTokens(t *testing.T) {
+	am := NewAuthzMiddleware(rbac.NewRBACManager(rbac.NewMemoryStore()), nil)
+	gateway := &jwt.Actor{Subject: "gateway", ClientID: "gateway"}
+
+	tests := []struct {
+		name   string
+		claims *jwt.CustomClaims
+		want   int
+	}{
+		{name: "admin", claims: &jwt.CustomClaims{UserID: "user-1", Roles: []string{"admin"}}, want: http.StatusOK},
+		{name: "without role", claims: &jwt.CustomClaims{UserID: "user-1", Roles: []string{"viewer"}}, want: http.StatusForbidden},
+		// 委托令牌和个人访问令牌的 scope 无法限制角色，即使主体是管理员也拒绝
+		{name: "delegated admin", claims: &jwt.CustomClaims{UserID: "user-1", Roles: []string{"admin"}, Actor: gateway}, want: http.StatusForbidden},
+		{name: "api key of admin", claims: &jwt.CustomClaims{UserID: "user-1", Roles: []string{"admin"}, KeyID: "key-1"}, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, mw := range map[string]func(http.Handler) http.Handler{
+				"RequireRole":    am.RequireRole(rbac.RoleAdmin),
+				"RequireAnyRole": am.RequireAnyRole(rbac.RoleAdmin, rbac.RoleSupport),
+			} {
+				var called bool
+				r := httptest.NewRequest(http.MethodGet, "/api/v1/admin/users", nil)
+				r = r.WithContext(context.WithValue(r.Context(), authmw.ClaimsContextKey, tt.claims))
+				w := httptest.NewRecorder()
+				mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					called = true
+				})).ServeHTTP(w, r)
+
+				if w.Code != tt.want || called != (tt.want == http.StatusOK) {
+					t.Errorf("%s status = %d, called = %v, want %d", name, w.Code, called, tt.want)
+				}
+			}
+		})
+	}
+}
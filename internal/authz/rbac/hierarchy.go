@@ -0,0 +1,187 @@
+package rbac
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	ErrUnknownParent = errors.New("unknown parent role")
+	ErrRoleCycle     = errors.New("role hierarchy contains a cycle")
+	ErrRoleInUse     = errors.New("role is a parent of other roles")
+)
+
+// PermissionGrant 有效权限的一个来源：Role 直接授予该权限，Path 为从被查询角色沿父角色到 Role 的继承链
+type PermissionGrant struct {
+	Role Role   `json:"role"`
+	Path []Role `json:"path"`
+}
+
+// EffectivePermission 角色的一项有效权限及其全部来源
+type EffectivePermission struct {
+	Permission Permission        `json:"permission"`
+	GrantedBy  []PermissionGrant `json:"granted_by"`
+}
+
+// checkHierarchy 校验 role 的父角色都已定义，且加入 role 后继承关系中没有环
+func checkHierarchy(roles map[Role]*RoleDefinition, role *RoleDefinition) error {
+	for _, parent := range role.Parents {
+		if parent == role.Name {
+			return ErrRoleCycle
+		}
+		if _, ok := roles[parent]; !ok {
+			return ErrUnknownParent
+		}
+	}
+
+	// 从 role 的父角色出发，能回到 role 即存在环
+	visited := make(map[Role]bool)
+	var reaches func(name Role) bool
+	reaches = func(name Role) bool {
+		if name == role.Name {
+			return true
+		}
+		if visited[name] {
+			return false
+		}
+		visited[name] = true
+		if def, ok := roles[name]; ok {
+			for _, parent := range def.Parents {
+				if reaches(parent) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, parent := range role.Parents {
+		if reaches(parent) {
+			return ErrRoleCycle
+		}
+	}
+	return nil
+}
+
+// children 返回以 name 为直接父角色的角色，按名称排序
+func children(roles map[Role]*RoleDefinition, name Role) []Role {
+	var result []Role
+	for _, role := range roles {
+		for _, parent := range role.Parents {
+			if parent == name {
+				result = append(result, role.Name)
+				break
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// effectivePermissions 计算每个角色的有效权限（自身权限与全部祖先角色的权限之并集）
+//
+// 存储文件被手工修改时可能出现未定义的父角色或环：未定义的父角色被忽略，环上的角色各自只计算一次。
+func effectivePermissions(roles map[Role]*RoleDefinition) map[Role][]Permission {
+	result := make(map[Role][]Permission, len(roles))
+	for name := range roles {
+		seen := make(map[Permission]bool)
+		var permissions []Permission
+		walkAncestors(roles, name, func(def *RoleDefinition) {
+			for _, p := range def.Permissions {
+				if !seen[p] {
+					seen[p] = true
+					permissions = append(permissions, p)
+				}
+			}
+		})
+		result[name] = permissions
+	}
+	return result
+}
+
+// compileRoles 计算每个角色的有效权限并预编译为匹配器
+func compileRoles(roles map[Role]*RoleDefinition) map[Role]*PermissionMatcher {
+	matchers := make(map[Role]*PermissionMatcher, len(roles))
+	for name, permissions := range effectivePermissions(roles) {
+		matchers[name] = NewPermissionMatcher(permissions)
+	}
+	return matchers
+}
+
+// ancestorRoles 计算每个角色自身及其全部祖先角色
+func ancestorRoles(roles map[Role]*RoleDefinition) map[Role][]Role {
+	result := make(map[Role][]Role, len(roles))
+	for name := range roles {
+		var ancestors []Role
+		walkAncestors(roles, name, func(def *RoleDefinition) {
+			ancestors = append(ancestors, def.Name)
+		})
+		result[name] = ancestors
+	}
+	return result
+}
+
+// explain 列出角色的每项有效权限及其来源，按权限名排序
+func explain(roles map[Role]*RoleDefinition, name Role) []EffectivePermission {
+	grants := make(map[Permission][]PermissionGrant)
+	walkAllPaths(roles, name, []Role{name}, func(def *RoleDefinition, path []Role) {
+		for _, p := range def.Permissions {
+			grants[p] = append(grants[p], PermissionGrant{
+				Role: def.Name,
+				Path: path,
+			})
+		}
+	})
+
+	result := make([]EffectivePermission, 0, len(grants))
+	for p, g := range grants {
+		result = append(result, EffectivePermission{Permission: p, GrantedBy: g})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Permission < result[j].Permission
+	})
+	return result
+}
+
+// walkAncestors 按深度优先访问角色自身及其全部祖先，每个角色只访问一次
+func walkAncestors(roles map[Role]*RoleDefinition, name Role, visit func(*RoleDefinition)) {
+	visited := make(map[Role]bool)
+	var walk func(name Role)
+	walk = func(name Role) {
+		def, ok := roles[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		visit(def)
+		for _, parent := range def.Parents {
+			walk(parent)
+		}
+	}
+	walk(name)
+}
+
+// walkAllPaths 沿每条继承链访问角色，同一祖先经由不同路径可访问多次；path 包含当前角色
+func walkAllPaths(roles map[Role]*RoleDefinition, name Role, path []Role, visit func(*RoleDefinition, []Role)) {
+	def, ok := roles[name]
+	if !ok {
+		return
+	}
+	visit(def, path)
+	for _, parent := range def.Parents {
+		if containsRole(path, parent) {
+			continue
+		}
+		next := append(append([]Role(nil), path...), parent)
+		walkAllPaths(roles, parent, next, visit)
+	}
+}
+
+// containsRole 判断角色列表中是否包含指定角色
+func containsRole(roles []Role, name Role) bool {
+	for _, r := range roles {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
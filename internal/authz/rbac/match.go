@@ -0,0 +1,132 @@
+package rbac
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 权限由 : 分隔的若干段组成，如 resource:read、resource:metadata:write。
+// 授予的权限中 * 段为通配符：位于中间时匹配任意一段（*:read），位于末尾时匹配剩余的一段或多段
+// （resource:* 匹配 resource:read 和 resource:metadata:write），单独的 * 匹配所有权限。
+// 被检查的权限中的 * 按字面处理，因此 resource:* 只被 resource:*、* 等更宽的授予覆盖，
+// 可以用同一套匹配判断一个通配权限是否为另一个的子集。
+const (
+	permissionSeparator = ":"
+	permissionWildcard  = "*"
+)
+
+// permissionSegmentPattern 权限段只能是小写字母、数字、- 和 _，或单独的 *
+var permissionSegmentPattern = regexp.MustCompile(`^([a-z0-9_-]+|\*)$`)
+
+// PermissionMatcher 预编译的权限集合，按段构成前缀树，检查耗时只与权限的段数有关；编译后只读，可并发使用
+type PermissionMatcher struct {
+	root *matchNode
+}
+
+// matchNode 前缀树节点
+type matchNode struct {
+	children map[string]*matchNode // 下一段 -> 子节点，中间的通配段以 * 为键
+	end      bool                  // 有授予的权限恰好在此结束
+	rest     bool                  // 有授予的权限在此之后以 * 结尾，匹配剩余的一段或多段
+}
+
+// NewPermissionMatcher 编译一组授予的权限，需要反复检查的权限集合应编译一次后复用
+func NewPermissionMatcher(permissions []Permission) *PermissionMatcher {
+	m := &PermissionMatcher{root: &matchNode{}}
+	for _, p := range permissions {
+		m.add(p)
+	}
+	return m
+}
+
+// add 向前缀树中加入一项授予的权限
+func (m *PermissionMatcher) add(permission Permission) {
+	segments := strings.Split(string(permission), permissionSeparator)
+	node := m.root
+	for i, segment := range segments {
+		if segment == permissionWildcard && i == len(segments)-1 {
+			node.rest = true
+			return
+		}
+		child, ok := node.children[segment]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*matchNode)
+			}
+			child = &matchNode{}
+			node.children[segment] = child
+		}
+		node = child
+	}
+	node.end = true
+}
+
+// Match 判断权限是否被集合中的某项授予覆盖
+func (m *PermissionMatcher) Match(permission Permission) bool {
+	return m.root.match(strings.Split(string(permission), permissionSeparator))
+}
+
+// match 在子树中匹配剩余的段
+func (n *matchNode) match(segments []string) bool {
+	if len(segments) == 0 {
+		return n.end
+	}
+	if n.rest {
+		return true
+	}
+	if child, ok := n.children[segments[0]]; ok && child.match(segments[1:]) {
+		return true
+	}
+	if child, ok := n.children[permissionWildcard]; ok && child.match(segments[1:]) {
+		return true
+	}
+	return false
+}
+
+// maxCachedScopes 缓存的 scope 匹配器数量上限；scope 通常只有客户端和个人访问令牌配置的少数几种
+const maxCachedScopes = 1024
+
+// scopeMatchers 按 scope 字符串缓存编译好的匹配器
+var scopeMatchers = struct {
+	sync.RWMutex
+	m map[string]*PermissionMatcher
+}{m: make(map[string]*PermissionMatcher)}
+
+// scopeMatcher 返回 scope 对应的匹配器，首次出现时编译并缓存；缓存满时整体清空，避免任意 scope 撑大内存
+func scopeMatcher(scope string) *PermissionMatcher {
+	scopeMatchers.RLock()
+	m, ok := scopeMatchers.m[scope]
+	scopeMatchers.RUnlock()
+	if ok {
+		return m
+	}
+
+	fields := strings.Fields(scope)
+	permissions := make([]Permission, len(fields))
+	for i, f := range fields {
+		permissions[i] = Permission(f)
+	}
+	m = NewPermissionMatcher(permissions)
+
+	scopeMatchers.Lock()
+	if len(scopeMatchers.m) >= maxCachedScopes {
+		scopeMatchers.m = make(map[string]*PermissionMatcher)
+	}
+	scopeMatchers.m[scope] = m
+	scopeMatchers.Unlock()
+	return m
+}
+
+// ValidPermission 判断权限格式是否合法：至少一段，每段为小写标识符或 *
+func ValidPermission(permission Permission) bool {
+	if permission == "" {
+		return false
+	}
+	for _, segment := range strings.Split(string(permission), permissionSeparator) {
+		if !permissionSegmentPattern.MatchString(segment) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package rbac
+
+import "testing"
+
+func TestPermissionMatcher(t *testing.T) {
+	matcher := NewPermissionMatcher([]Permission{"resource:*", "*:read", "report:metadata:write"})
+
+	tests := []struct {
+		permission Permission
+		want       bool
+	}{
+		{"resource:read", true},
+		{"resource:metadata:write", true},
+		{"resource", false},
+		{"user:read", true},
+		{"user:write", false},
+		{"user:profile:read", false},
+		{"report:metadata:write", true},
+		{"report:metadata", false},
+		{"resource:*", true},
+		{"user:*", false},
+		{"*", false},
+	}
+
+	for _, tt := range tests {
+		if got := matcher.Match(tt.permission); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	tests := []struct {
+		scope      string
+		permission Permission
+		want       bool
+	}{
+		{"", PermissionUserDelete, true},
+		{"resource:read resource:list", PermissionResourceList, true},
+		{"resource:read resource:list", PermissionResourceWrite, false},
+		{"resource:*", PermissionResourceWrite, true},
+		{"*", PermissionUserDelete, true},
+	}
+
+	for _, tt := range tests {
+		// 第二次调用命中缓存，结果必须一致
+		for i := 0; i < 2; i++ {
+			if got := ScopeAllows(tt.scope, tt.permission); got != tt.want {
+				t.Errorf("ScopeAllows(%q, %q) = %v, want %v", tt.scope, tt.permission, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestScopeMatcherCached(t *testing.T) {
+	scope := "resource:read user:read"
+	if scopeMatcher(scope) != scopeMatcher(scope) {
+		t.Fatal("scopeMatcher compiled the same scope twice")
+	}
+}
+
+func BenchmarkScopeAllows(b *testing.B) {
+	scope := "resource:read resource:list user:read"
+	for i := 0; i < b.N; i++ {
+		ScopeAllows(scope, PermissionUserRead)
+	}
+}
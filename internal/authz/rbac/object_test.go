@@ -0,0 +1,87 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+)
+
+// ownedObject 测试用对象
+type ownedObject string
+
+func (o ownedObject) OwnerID() string {
+	return string(o)
+}
+
+// newTestManager 创建包含一个继承 admin 的自定义角色的 RBAC 管理器
+func newTestManager(t *testing.T) *RBACManager {
+	t.Helper()
+
+	rm := NewRBACManager(NewMemoryStore())
+	_, err := rm.CreateRole(context.Background(), &RoleDefinition{
+		Name:    "platform-admin",
+		Parents: []Role{RoleAdmin},
+	})
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	return rm
+}
+
+func TestCheckObjectPermissionOwnership(t *testing.T) {
+	rm := newTestManager(t)
+	policy := ObjectPolicy{
+		PermissionResourceWrite: {Owner(), HasPermission(PermissionResourceManage)},
+	}
+	object := ownedObject("1")
+
+	tests := []struct {
+		name    string
+		subject Subject
+		want    bool
+	}{
+		{name: "owner", subject: Subject{ID: "1", Roles: []string{"editor"}}, want: true},
+		{name: "other editor", subject: Subject{ID: "2", Roles: []string{"editor"}}, want: false},
+		{name: "admin", subject: Subject{ID: "3", Roles: []string{"admin"}}, want: true},
+		{name: "role inheriting admin", subject: Subject{ID: "4", Roles: []string{"platform-admin"}}, want: true},
+		{name: "admin token scoped without manage", subject: Subject{ID: "3", Roles: []string{"admin"}, Scope: "resource:write"}, want: false},
+		{name: "owner without permission", subject: Subject{ID: "1", Roles: []string{"viewer"}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rm.CheckObjectPermission(policy, tt.subject, PermissionResourceWrite, object); got != tt.want {
+				t.Fatalf("CheckObjectPermission = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasRoleFollowsHierarchy(t *testing.T) {
+	rm := newTestManager(t)
+	condition := HasRole(RoleAdmin)
+
+	if !condition(rm, Subject{Roles: []string{"platform-admin"}}, ownedObject("")) {
+		t.Fatal("role inheriting admin should satisfy HasRole(admin)")
+	}
+	if !condition(rm, Subject{Roles: []string{"admin"}}, ownedObject("")) {
+		t.Fatal("admin should satisfy HasRole(admin)")
+	}
+	if condition(rm, Subject{Roles: []string{"editor"}}, ownedObject("")) {
+		t.Fatal("editor should not satisfy HasRole(admin)")
+	}
+}
+
+func TestExpandRoles(t *testing.T) {
+	rm := newTestManager(t)
+
+	got := rm.ExpandRoles([]string{"platform-admin", "unknown"})
+	want := map[string]bool{"platform-admin": true, "admin": true, "editor": true, "support": true, "viewer": true, "unknown": true}
+	if len(got) != len(want) {
+		t.Fatalf("ExpandRoles = %v, want %d roles", got, len(want))
+	}
+	for _, role := range got {
+		if !want[role] {
+			t.Fatalf("unexpected role %q in %v", role, got)
+		}
+	}
+}
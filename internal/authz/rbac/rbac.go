@@ -2,6 +2,7 @@ package rbac
 
 import (
 	"errors"
+	"sync"
 )
 
 var (
@@ -12,10 +13,11 @@ var (
 type Role string
 
 const (
-	RoleAdmin  Role = "admin"
-	RoleEditor Role = "editor"
-	RoleViewer Role = "viewer"
-	RoleUser   Role = "user"
+	RoleAdmin   Role = "admin"
+	RoleEditor  Role = "editor"
+	RoleViewer  Role = "viewer"
+	RoleUser    Role = "user"
+	RoleSupport Role = "support"
 )
 
 // Permission 权限定义
@@ -27,72 +29,121 @@ const (
 	PermissionUserDelete Permission = "user:delete"
 	PermissionUserList   Permission = "user:list"
 
+	// PermissionUserImpersonate 通过令牌交换代表其他用户操作
+	PermissionUserImpersonate Permission = "user:impersonate"
+
 	PermissionResourceRead   Permission = "resource:read"
 	PermissionResourceWrite  Permission = "resource:write"
 	PermissionResourceDelete Permission = "resource:delete"
 	PermissionResourceList   Permission = "resource:list"
+
+	// PermissionResourceManage 修改和删除他人拥有的资源，不受所有权限制
+	PermissionResourceManage Permission = "resource:manage"
 )
 
-// RBACManager RBAC 管理器
+// RBACManager RBAC 管理器，内置角色由代码定义，自定义角色从 Store 加载
 type RBACManager struct {
-	rolePermissions map[Role][]Permission
+	store Store
+
+	mu            sync.RWMutex
+	roleMatchers  map[Role]*PermissionMatcher // 各角色有效权限（包含继承和通配的权限）预编译的匹配器，每次加载时重新计算
+	roleAncestors map[Role][]Role             // 各角色自身及其全部祖先角色，每次加载时重新计算
 }
 
-// NewRBACManager 创建 RBAC 管理器
-func NewRBACManager() *RBACManager {
+// NewRBACManager 创建 RBAC 管理器；调用 Reload 之前只包含内置角色
+func NewRBACManager(store Store) *RBACManager {
+	roles := builtInRoles()
 	return &RBACManager{
-		rolePermissions: map[Role][]Permission{
-			RoleAdmin: {
-				// 管理员拥有所有权限
-				PermissionUserRead,
+		store:         store,
+		roleMatchers:  compileRoles(roles),
+		roleAncestors: ancestorRoles(roles),
+	}
+}
+
+// builtInRoles 返回内置角色的定义，内置角色不能通过管理接口修改或删除
+//
+// 每个角色只列出自身新增的权限，其余权限从父角色继承：admin ⊃ editor ⊃ viewer，admin ⊃ support ⊃ viewer。
+func builtInRoles() map[Role]*RoleDefinition {
+	roles := map[Role]*RoleDefinition{
+		RoleAdmin: {
+			// 管理员拥有所有权限
+			Parents: []Role{RoleEditor, RoleSupport},
+			Permissions: []Permission{
 				PermissionUserWrite,
 				PermissionUserDelete,
-				PermissionUserList,
-				PermissionResourceRead,
-				PermissionResourceWrite,
 				PermissionResourceDelete,
-				PermissionResourceList,
+				PermissionResourceManage,
 			},
-			RoleEditor: {
-				// 编辑者可以读写资源
-				PermissionResourceRead,
+		},
+		RoleEditor: {
+			// 编辑者可以读写资源
+			Parents: []Role{RoleViewer},
+			Permissions: []Permission{
 				PermissionResourceWrite,
-				PermissionResourceList,
 				PermissionUserRead, // 可以读取用户信息
 			},
-			RoleViewer: {
-				// 查看者只能读取
+		},
+		RoleViewer: {
+			// 查看者只能读取
+			Permissions: []Permission{
 				PermissionResourceRead,
 				PermissionResourceList,
 			},
-			RoleUser: {
-				// 普通用户可以读取自己的信息
+		},
+		RoleSupport: {
+			// 支持人员可以查看用户和资源，并代表用户复现问题
+			Parents: []Role{RoleViewer},
+			Permissions: []Permission{
+				PermissionUserRead,
+				PermissionUserList,
+				PermissionUserImpersonate,
+			},
+		},
+		RoleUser: {
+			// 普通用户可以读取自己的信息
+			Permissions: []Permission{
 				PermissionUserRead,
 				PermissionResourceRead,
 			},
 		},
 	}
+	for name, role := range roles {
+		role.Name = name
+		role.BuiltIn = true
+	}
+	return roles
 }
 
-// CheckPermission 检查用户是否有指定权限
+// CheckPermission 检查用户是否有指定权限，角色授予的通配权限（如 resource:*）同样生效
 func (rm *RBACManager) CheckPermission(userRoles []string, permission Permission) bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
 	for _, roleStr := range userRoles {
-		role := Role(roleStr)
-		permissions, exists := rm.rolePermissions[role]
+		matcher, exists := rm.roleMatchers[Role(roleStr)]
 		if !exists {
 			continue
 		}
 
-		for _, perm := range permissions {
-			if perm == permission {
-				return true
-			}
+		if matcher.Match(permission) {
+			return true
 		}
 	}
 
 	return false
 }
 
+// ScopeAllows 检查令牌 scope 是否包含指定权限（scope 中可以使用通配权限）；scope 为空表示不做额外限制
+//
+// 同一 scope 的匹配器只编译一次，之后从缓存中读取。
+func ScopeAllows(scope string, permission Permission) bool {
+	if scope == "" {
+		return true
+	}
+
+	return scopeMatcher(scope).Match(permission)
+}
+
 // HasRole 检查用户是否有指定角色
 func (rm *RBACManager) HasRole(userRoles []string, requiredRole Role) bool {
 	for _, roleStr := range userRoles {
@@ -103,6 +154,28 @@ func (rm *RBACManager) HasRole(userRoles []string, requiredRole Role) bool {
 	return false
 }
 
+// ExpandRoles 返回用户角色及其继承的全部祖先角色（去重），未定义的角色原样保留
+func (rm *RBACManager) ExpandRoles(userRoles []string) []string {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	seen := make(map[string]bool, len(userRoles))
+	expanded := make([]string, 0, len(userRoles))
+	add := func(role string) {
+		if !seen[role] {
+			seen[role] = true
+			expanded = append(expanded, role)
+		}
+	}
+	for _, roleStr := range userRoles {
+		add(roleStr)
+		for _, ancestor := range rm.roleAncestors[Role(roleStr)] {
+			add(string(ancestor))
+		}
+	}
+	return expanded
+}
+
 // HasAnyRole 检查用户是否有任一指定角色
 func (rm *RBACManager) HasAnyRole(userRoles []string, requiredRoles []Role) bool {
 	for _, required := range requiredRoles {
@@ -0,0 +1,251 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrBuiltInRole       = errors.New("built-in roles cannot be modified")
+	ErrInvalidRoleName   = errors.New("invalid role name")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrNoPermissions     = errors.New("role must have at least one permission or parent role")
+)
+
+// roleNamePattern 自定义角色名：小写字母开头，只含小写字母、数字、- 和 _
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+
+// allPermissions 系统定义的全部权限，角色只能由这些权限组成
+var allPermissions = []Permission{
+	PermissionUserRead,
+	PermissionUserWrite,
+	PermissionUserDelete,
+	PermissionUserList,
+	PermissionUserImpersonate,
+	PermissionResourceRead,
+	PermissionResourceWrite,
+	PermissionResourceDelete,
+	PermissionResourceList,
+	PermissionResourceManage,
+}
+
+// Permissions 返回系统定义的全部权限
+func Permissions() []Permission {
+	return append([]Permission(nil), allPermissions...)
+}
+
+// KnownPermission 判断权限是否由系统定义；通配权限须格式合法，且至少覆盖一项系统定义的权限
+func KnownPermission(permission Permission) bool {
+	if !ValidPermission(permission) {
+		return false
+	}
+
+	matcher := NewPermissionMatcher([]Permission{permission})
+	for _, p := range allPermissions {
+		if matcher.Match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBuiltIn 判断是否为内置角色
+func IsBuiltIn(name Role) bool {
+	_, ok := builtInRoles()[name]
+	return ok
+}
+
+// Roles 列出内置角色和自定义角色，按名称排序
+func (rm *RBACManager) Roles(ctx context.Context) ([]*RoleDefinition, error) {
+	definitions, err := rm.definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sortedRoles(definitions), nil
+}
+
+// Role 按名称查找角色，不存在时返回 ErrRoleNotFound
+func (rm *RBACManager) Role(ctx context.Context, name Role) (*RoleDefinition, error) {
+	definitions, err := rm.definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	role, ok := definitions[name]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+	return role, nil
+}
+
+// ExplainRole 列出角色的有效权限，以及每项权限由哪个角色经由哪条继承链授予
+func (rm *RBACManager) ExplainRole(ctx context.Context, name Role) ([]EffectivePermission, error) {
+	definitions, err := rm.definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := definitions[name]; !ok {
+		return nil, ErrRoleNotFound
+	}
+	return explain(definitions, name), nil
+}
+
+// CreateRole 创建自定义角色，名称不能与内置角色相同，父角色必须已存在
+func (rm *RBACManager) CreateRole(ctx context.Context, role *RoleDefinition) (*RoleDefinition, error) {
+	if !roleNamePattern.MatchString(string(role.Name)) {
+		return nil, ErrInvalidRoleName
+	}
+	if IsBuiltIn(role.Name) {
+		return nil, ErrRoleExists
+	}
+	if err := validatePermissions(role); err != nil {
+		return nil, err
+	}
+
+	definitions, err := rm.definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := definitions[role.Name]; exists {
+		return nil, ErrRoleExists
+	}
+	if err := checkHierarchy(definitions, role); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	created := &RoleDefinition{
+		Name:        role.Name,
+		Description: role.Description,
+		Parents:     role.Parents,
+		Permissions: role.Permissions,
+		CreatedAt:   &now,
+		UpdatedAt:   &now,
+	}
+	if err := rm.store.Create(ctx, created); err != nil {
+		return nil, err
+	}
+	return created, rm.Reload(ctx)
+}
+
+// UpdateRole 替换自定义角色的描述、父角色和权限集合
+func (rm *RBACManager) UpdateRole(ctx context.Context, role *RoleDefinition) (*RoleDefinition, error) {
+	if IsBuiltIn(role.Name) {
+		return nil, ErrBuiltInRole
+	}
+	if err := validatePermissions(role); err != nil {
+		return nil, err
+	}
+
+	definitions, err := rm.definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	updated, ok := definitions[role.Name]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+	if err := checkHierarchy(definitions, role); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	updated.Description = role.Description
+	updated.Parents = role.Parents
+	updated.Permissions = role.Permissions
+	updated.UpdatedAt = &now
+	if err := rm.store.Update(ctx, updated); err != nil {
+		return nil, err
+	}
+	return updated, rm.Reload(ctx)
+}
+
+// DeleteRole 删除自定义角色；仍是其他角色父角色时拒绝，仍持有该角色的用户不再获得其权限
+func (rm *RBACManager) DeleteRole(ctx context.Context, name Role) error {
+	if IsBuiltIn(name) {
+		return ErrBuiltInRole
+	}
+
+	definitions, err := rm.definitions(ctx)
+	if err != nil {
+		return err
+	}
+	if len(children(definitions, name)) > 0 {
+		return ErrRoleInUse
+	}
+
+	if err := rm.store.Delete(ctx, name); err != nil {
+		return err
+	}
+	return rm.Reload(ctx)
+}
+
+// Reload 从存储重新加载自定义角色并重新计算有效权限，加载失败时保留当前角色
+func (rm *RBACManager) Reload(ctx context.Context) error {
+	definitions, err := rm.definitions(ctx)
+	if err != nil {
+		return err
+	}
+	roleMatchers := compileRoles(definitions)
+	roleAncestors := ancestorRoles(definitions)
+
+	rm.mu.Lock()
+	rm.roleMatchers = roleMatchers
+	rm.roleAncestors = roleAncestors
+	rm.mu.Unlock()
+	return nil
+}
+
+// definitions 返回内置角色与存储中的自定义角色；内置角色始终以代码为准
+func (rm *RBACManager) definitions(ctx context.Context) (map[Role]*RoleDefinition, error) {
+	custom, err := rm.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := builtInRoles()
+	for _, role := range custom {
+		if _, exists := definitions[role.Name]; exists {
+			continue
+		}
+		definitions[role.Name] = role
+	}
+	return definitions, nil
+}
+
+// Watch 定期重新加载自定义角色，使其他副本的修改无需重启即可生效，直到 ctx 取消
+func (rm *RBACManager) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := rm.Reload(ctx); err != nil {
+				log.WithError(err).Warn("failed to reload roles")
+			}
+		}
+	}
+}
+
+// validatePermissions 校验角色的权限都是系统定义的权限，且角色至少有一项自身权限或一个父角色
+func validatePermissions(role *RoleDefinition) error {
+	if len(role.Permissions) == 0 && len(role.Parents) == 0 {
+		return ErrNoPermissions
+	}
+	for _, p := range role.Permissions {
+		if !KnownPermission(p) {
+			return ErrUnknownPermission
+		}
+	}
+	return nil
+}
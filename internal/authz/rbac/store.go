@@ -0,0 +1,246 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/filestore"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleExists   = errors.New("role already exists")
+)
+
+// RoleDefinition 角色及其权限集合；内置角色由代码定义，自定义角色保存在 Store 中
+type RoleDefinition struct {
+	Name        Role         `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Parents     []Role       `json:"parents,omitempty"` // 父角色，父角色的有效权限全部继承
+	Permissions []Permission `json:"permissions"`       // 角色自身授予的权限，不含继承的权限
+	BuiltIn     bool         `json:"built_in,omitempty"`
+	CreatedAt   *time.Time   `json:"created_at,omitempty"` // 内置角色为空
+	UpdatedAt   *time.Time   `json:"updated_at,omitempty"`
+}
+
+// Store 自定义角色存储
+type Store interface {
+	// List 列出全部自定义角色，按名称排序
+	List(ctx context.Context) ([]*RoleDefinition, error)
+
+	// Create 保存新角色，同名角色已存在时返回 ErrRoleExists
+	Create(ctx context.Context, role *RoleDefinition) error
+
+	// Update 替换已有角色，不存在时返回 ErrRoleNotFound
+	Update(ctx context.Context, role *RoleDefinition) error
+
+	// Delete 删除角色，不存在时返回 ErrRoleNotFound
+	Delete(ctx context.Context, name Role) error
+}
+
+// MemoryStore 内存角色存储，只在单个副本内有效
+type MemoryStore struct {
+	mu    sync.Mutex
+	roles map[Role]*RoleDefinition
+}
+
+// NewMemoryStore 创建内存角色存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		roles: make(map[Role]*RoleDefinition),
+	}
+}
+
+// List 列出全部自定义角色
+func (s *MemoryStore) List(ctx context.Context) ([]*RoleDefinition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedRoles(s.roles), nil
+}
+
+// Create 保存新角色
+func (s *MemoryStore) Create(ctx context.Context, role *RoleDefinition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return createRole(s.roles, role)
+}
+
+// Update 替换已有角色
+func (s *MemoryStore) Update(ctx context.Context, role *RoleDefinition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return updateRole(s.roles, role)
+}
+
+// Delete 删除角色
+func (s *MemoryStore) Delete(ctx context.Context, name Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return deleteRole(s.roles, name)
+}
+
+// FileStore 基于 JSON 文件持久化的角色存储，多个副本挂载同一文件时共享自定义角色
+//
+// 修改持有锁文件读取最新内容、修改后写回，不同副本同时修改角色时不会覆盖彼此的修改；
+// 查询只在文件变化后重新读取。
+type FileStore struct {
+	mu     sync.Mutex
+	file   *filestore.File
+	memory *MemoryStore // 文件内容的缓存
+}
+
+// NewFileStore 创建文件角色存储，并检查已有文件能否解析
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{file: filestore.NewFile(path), memory: NewMemoryStore()}
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List 列出全部自定义角色，包括其他副本写入的角色
+func (s *FileStore) List(ctx context.Context) ([]*RoleDefinition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return s.memory.List(ctx)
+}
+
+// Create 保存新角色并持久化
+func (s *FileStore) Create(ctx context.Context, role *RoleDefinition) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.Create(ctx, role)
+	})
+}
+
+// Update 替换已有角色并持久化
+func (s *FileStore) Update(ctx context.Context, role *RoleDefinition) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.Update(ctx, role)
+	})
+}
+
+// Delete 删除角色并持久化
+func (s *FileStore) Delete(ctx context.Context, name Role) error {
+	return s.modify(func(m *MemoryStore) error {
+		return m.Delete(ctx, name)
+	})
+}
+
+// modify 持有锁文件读取最新内容，应用修改后写回；fn 返回错误时不写回
+func (s *FileStore) modify(fn func(*MemoryStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return fmt.Errorf("lock role store: %w", err)
+	}
+	defer unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return err
+	}
+	if err := fn(s.memory); err != nil {
+		return err
+	}
+	return s.persistLocked()
+}
+
+// refreshLocked 文件变化时重新读取
+func (s *FileStore) refreshLocked() error {
+	data, changed, err := s.file.Read()
+	if err != nil {
+		return fmt.Errorf("read role store: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	memory := NewMemoryStore()
+	if data != nil {
+		var list []*RoleDefinition
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("decode role store: %w", err)
+		}
+		for _, role := range list {
+			memory.roles[role.Name] = role
+		}
+	}
+	s.memory = memory
+	return nil
+}
+
+// persistLocked 写回缓存中的全部角色
+func (s *FileStore) persistLocked() error {
+	s.memory.mu.Lock()
+	data, err := json.Marshal(sortedRoles(s.memory.roles))
+	s.memory.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.file.Write(data); err != nil {
+		return fmt.Errorf("write role store: %w", err)
+	}
+	return nil
+}
+
+// createRole 向集合中加入新角色
+func createRole(roles map[Role]*RoleDefinition, role *RoleDefinition) error {
+	if _, exists := roles[role.Name]; exists {
+		return ErrRoleExists
+	}
+	roles[role.Name] = role.clone()
+	return nil
+}
+
+// updateRole 替换集合中的已有角色
+func updateRole(roles map[Role]*RoleDefinition, role *RoleDefinition) error {
+	if _, exists := roles[role.Name]; !exists {
+		return ErrRoleNotFound
+	}
+	roles[role.Name] = role.clone()
+	return nil
+}
+
+// deleteRole 从集合中删除角色
+func deleteRole(roles map[Role]*RoleDefinition, name Role) error {
+	if _, exists := roles[name]; !exists {
+		return ErrRoleNotFound
+	}
+	delete(roles, name)
+	return nil
+}
+
+// sortedRoles 返回按名称排序的角色副本
+func sortedRoles(roles map[Role]*RoleDefinition) []*RoleDefinition {
+	list := make([]*RoleDefinition, 0, len(roles))
+	for _, role := range roles {
+		list = append(list, role.clone())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// clone 返回角色的深拷贝
+func (d *RoleDefinition) clone() *RoleDefinition {
+	copied := *d
+	copied.Parents = append([]Role(nil), d.Parents...)
+	copied.Permissions = append(make([]Permission, 0, len(d.Permissions)), d.Permissions...)
+	return &copied
+}
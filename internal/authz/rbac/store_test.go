@@ -0,0 +1,122 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// newFileStores 创建挂载同一文件的两个存储，模拟两个副本
+func newFileStores(t *testing.T) (*FileStore, *FileStore, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "roles.json")
+	a, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	b, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return a, b, path
+}
+
+func testRole(name string, permissions ...Permission) *RoleDefinition {
+	return &RoleDefinition{Name: Role(name), Permissions: permissions}
+}
+
+func TestFileStoreSharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	a, b, path := newFileStores(t)
+
+	// b 先读取一次，确认缓存会在另一副本写入后失效
+	if roles, err := b.List(ctx); err != nil || len(roles) != 0 {
+		t.Fatalf("List() = %v, %v, want none", roles, err)
+	}
+
+	if err := a.Create(ctx, testRole("auditor", "audit:read")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// 基于过期缓存的修改不能覆盖其他副本写入的角色
+	if err := b.Create(ctx, testRole("editor", "resource:write")); err != nil {
+		t.Fatalf("Create on another replica: %v", err)
+	}
+	if err := b.Create(ctx, testRole("auditor")); !errors.Is(err, ErrRoleExists) {
+		t.Fatalf("Create() of a role created on another replica error = %v, want %v", err, ErrRoleExists)
+	}
+
+	roles, err := a.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(roles) != 2 || roles[0].Name != "auditor" || roles[1].Name != "editor" {
+		t.Fatalf("List() = %v, want auditor and editor", roles)
+	}
+
+	if err := a.Update(ctx, testRole("editor", "resource:read")); err != nil {
+		t.Fatalf("Update of a role created on another replica: %v", err)
+	}
+	if err := b.Delete(ctx, "auditor"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := a.Delete(ctx, "auditor"); !errors.Is(err, ErrRoleNotFound) {
+		t.Fatalf("Delete() of a role deleted on another replica error = %v, want %v", err, ErrRoleNotFound)
+	}
+
+	// 重启后从文件恢复
+	c, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	roles, err = c.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(roles) != 1 || roles[0].Name != "editor" || len(roles[0].Permissions) != 1 || roles[0].Permissions[0] != "resource:read" {
+		t.Fatalf("List() after restart = %v", roles)
+	}
+}
+
+func TestFileStoreConcurrentCreateAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	a, b, _ := newFileStores(t)
+
+	// 两个副本同时创建不同的角色，所有角色都应保留
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		for j, s := range []*FileStore{a, b} {
+			wg.Add(1)
+			go func(s *FileStore, name string) {
+				defer wg.Done()
+				if err := s.Create(ctx, testRole(name, "resource:read")); err != nil {
+					t.Errorf("Create(%s): %v", name, err)
+				}
+			}(s, fmt.Sprintf("role-%d-%d", j, i))
+		}
+	}
+	wg.Wait()
+
+	roles, err := b.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(roles) != 2*n {
+		t.Fatalf("List() returned %d roles, want %d", len(roles), 2*n)
+	}
+}
+
+func TestNewFileStoreRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roles.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := NewFileStore(path); err == nil {
+		t.Fatal("NewFileStore() accepted a corrupt file")
+	}
+}
@@ -1,35 +1,243 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// DefaultJWTSecret 未设置 JWT_SECRET 时使用的默认密钥，仅用于本地开发
+const DefaultJWTSecret = "your-secret-key-change-in-production"
+
+// EnvironmentProduction 生产环境标识
+const EnvironmentProduction = "production"
+
+var (
+	ErrDefaultJWTSecret   = errors.New("default JWT secret must not be used in production; set JWT_SECRET or JWT_PRIVATE_KEY_PATH")
+	ErrInsecureLDAP       = errors.New("plaintext LDAP must not be used in production; use ldaps:// or set LDAP_START_TLS=true")
+	ErrInvalidUV          = errors.New("WEBAUTHN_USER_VERIFICATION must be required, preferred or discouraged")
+	ErrInvalidMailer      = errors.New("MAIL_DRIVER must be log, file or smtp")
+	ErrInsecureSMTP       = errors.New("plaintext SMTP must not be used in production; set SMTP_TLS to starttls or tls")
+	ErrTLSKeyPair         = errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	ErrInvalidClientAuth  = errors.New("TLS_CLIENT_AUTH must be none, optional or required")
+	ErrClientCAWithoutTLS = errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+	ErrMTLSWithoutCA      = errors.New("client certificate authentication requires TLS_CLIENT_CA_FILE and TLS_CLIENT_AUTH other than none")
+	ErrInvalidTimezone    = errors.New("ABAC_TIMEZONE must be a valid IANA time zone name such as UTC or Asia/Shanghai")
+	ErrLocalRevocations   = errors.New("REVOCATION_STORE_PATH must point to a file shared by all replicas when REPLICAS is greater than 1")
+	ErrLocalLockout       = errors.New("LOGIN_LOCKOUT_STORE_PATH must point to a file shared by all replicas when REPLICAS is greater than 1")
+	ErrLocalRefreshTokens = errors.New("REFRESH_STORE_PATH must point to a file shared by all replicas when REPLICAS is greater than 1")
+	ErrLocalSessions      = errors.New("SESSION_STORE_PATH must point to a file shared by all replicas when REPLICAS is greater than 1")
+	ErrLocalAuthCodes     = errors.New("OAUTH_AUTH_CODE_STORE_PATH must point to a file shared by all replicas when REPLICAS is greater than 1")
+	ErrLocalLoginStates   = errors.New("OIDC_LOGIN_STATE_STORE_PATH must point to a file shared by all replicas when REPLICAS is greater than 1")
+	ErrLocalDPoPReplays   = errors.New("DPOP_REPLAY_STORE_PATH must point to a file shared by all replicas when REPLICAS is greater than 1")
+	ErrLocalRoles         = errors.New("RBAC_ROLE_STORE_PATH must point to a file shared by all replicas when REPLICAS is greater than 1")
+	ErrLocalUsers         = errors.New("USER_STORE_PATH must point to a file shared by all replicas when REPLICAS is greater than 1")
+	ErrLocalAPIKeys       = errors.New("APIKEY_STORE_PATH must point to a file shared by all replicas when REPLICAS is greater than 1")
+)
+
 // Config 应用配置
 type Config struct {
-	Server   ServerConfig
-	Auth     AuthConfig
-	Database DatabaseConfig
-	Log      LogConfig
+	Server     ServerConfig
+	Auth       AuthConfig
+	OAuth      OAuthConfig
+	Federation FederationConfig
+	LDAP       LDAPConfig
+	Password   PasswordConfig
+	Lockout    LockoutConfig
+	MFA        MFAConfig
+	WebAuthn   WebAuthnConfig
+	Account    AccountConfig
+	APIKey     APIKeyConfig
+	RBAC       RBACConfig
+	ABAC       ABACConfig
+	Mail       MailConfig
+	MTLS       MTLSConfig
+	DPoP       DPoPConfig
+	Database   DatabaseConfig
+	Log        LogConfig
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
+	Environment     string // development, staging or production
 	Host            string
 	Port            int
 	ReadTimeout     time.Duration
 	WriteTimeout    time.Duration
 	ShutdownTimeout time.Duration
+	TrustedProxies  []string // 可信反向代理的 IP 或 CIDR，来自这些地址的请求使用 X-Forwarded-For 中的客户端地址
+	Replicas        int      // 部署的副本数，大于 1 时所有需要跨副本一致的状态必须使用共享存储
+
+	TLSCertFile string // 服务端证书（PEM），与 TLSKeyFile 同时设置时由服务直接终止 TLS
+	TLSKeyFile  string // 服务端私钥（PEM）
 }
 
 // AuthConfig 认证配置
 type AuthConfig struct {
-	JWTSecret           string
-	JWTExpiration       time.Duration
-	RefreshExpiration   time.Duration
-	JWTPrivateKeyPath   string
-	JWTPublicKeyPath    string
+	JWTSecret         string
+	JWTExpiration     time.Duration
+	RefreshExpiration time.Duration
+	JWTPrivateKeyPath string // PEM 私钥路径，设置后使用非对称签名
+	JWTPublicKeyPath  string // PEM 公钥路径，仅设置公钥时只能验证令牌
+
+	JWTKeyDir            string        // PEM 密钥目录，最新的私钥用于签名，其余用于验证
+	JWTKeyReloadInterval time.Duration // 密钥目录重新加载间隔
+	JWTPreviousSecrets   []string      // 已轮换的旧 HMAC 密钥，仅用于验证
+	JWTLegacyTypeCutoff  time.Time     // 在此之前签发的 typ=JWT 旧访问令牌仍被接受，零值表示不接受
+
+	RefreshStorePath string // 刷新令牌文件路径，多副本部署时所有副本挂载同一文件；为空时使用内存存储
+	SessionStorePath string // 会话记录文件路径，多副本部署时所有副本挂载同一文件；为空时使用内存存储
+
+	RevocationStorePath string // 访问令牌吊销列表文件路径，多副本部署时所有副本挂载同一文件；为空时使用内存存储
+
+	Backends      []string // 用户名密码认证后端及顺序：local、file、ldap
+	UserStorePath string   // 本地用户库持久化文件路径，为空时使用内存存储
+	UsersFile     string   // 只读用户文件路径（file 后端）
+}
+
+// OAuthConfig OAuth 2.0 配置
+type OAuthConfig struct {
+	ClientsFile        string        // 客户端注册表 JSON 文件路径
+	Issuer             string        // 对外的签发者 URL，用于 OIDC 发现文档和 ID 令牌
+	AuthCodeExpiration time.Duration // 授权码有效期
+	AuthCodeStorePath  string        // 授权码文件路径，多副本部署时所有副本挂载同一文件；为空时使用内存存储
+}
+
+// FederationConfig 外部 OIDC 身份提供方联合登录配置
+type FederationConfig struct {
+	ProvidersFile   string        // 身份提供方配置 JSON 文件路径
+	UsersPath       string        // 即时创建的用户持久化文件路径，为空时使用内存存储
+	StateExpiration time.Duration // 登录请求（state）有效期
+	StateStorePath  string        // 登录请求文件路径，多副本部署时所有副本挂载同一文件；为空时使用内存存储
+	HTTPTimeout     time.Duration // 请求上游身份提供方的超时时间
+}
+
+// LDAPConfig LDAP/Active Directory 认证配置
+type LDAPConfig struct {
+	URL                string // ldap:// 或 ldaps:// 地址，为空时不启用 LDAP 认证
+	StartTLS           bool   // 在 ldap:// 连接上升级 TLS
+	CAFile             string // 校验服务端证书的 CA 证书文件
+	InsecureSkipVerify bool   // 跳过证书校验，仅用于测试
+
+	BindDN       string // 用于搜索的服务账号 DN，为空时匿名搜索
+	BindPassword string
+
+	UserBaseDN     string
+	UserFilter     string // 用户搜索过滤器，%s 替换为转义后的用户名
+	UIDAttribute   string // 用户名属性（OpenLDAP 为 uid，AD 为 sAMAccountName）
+	EmailAttribute string
+
+	GroupBaseDN       string   // 分组搜索基准 DN，为空时读取用户条目的 memberOf 属性
+	GroupFilter       string   // 分组搜索过滤器，%s 替换为转义后的用户 DN
+	GroupRoleMappings string   // 分号分隔的 "分组=角色" 映射
+	DefaultRoles      []string // 所有 LDAP 用户都获得的角色
+
+	PoolSize int           // 最大连接数
+	Timeout  time.Duration // 连接和请求超时时间
+}
+
+// PasswordConfig 密码哈希配置
+type PasswordConfig struct {
+	Algorithm         string // 新哈希使用的算法：argon2id 或 bcrypt
+	Argon2Memory      uint32 // argon2id 内存开销（KiB）
+	Argon2Iterations  uint32 // argon2id 迭代次数
+	Argon2Parallelism uint8  // argon2id 并行度
+	BcryptCost        int    // bcrypt 成本因子
+}
+
+// LockoutConfig 登录失败限制配置
+type LockoutConfig struct {
+	MaxUserFailures  int           // 同一用户名连续失败多少次后锁定，0 表示不限制
+	MaxIPFailures    int           // 同一来源 IP 失败多少次后锁定，0 表示不限制
+	UserBackoffAfter int           // 同一用户名失败多少次后开始要求等待
+	IPBackoffAfter   int           // 同一来源 IP 失败多少次后开始要求等待（NAT 后的多个用户共享 IP，应高于用户名阈值）
+	BackoffBase      time.Duration // 首次等待时间，之后每次失败翻倍
+	BackoffMax       time.Duration // 最长等待时间
+	Duration         time.Duration // 锁定时长
+	FailureWindow    time.Duration // 距上次失败超过该时间后重新计数
+	StorePath        string        // 失败计数共享文件路径，多副本部署时所有副本挂载同一文件；为空时保存在内存中
+}
+
+// MFAConfig 多因素认证配置
+type MFAConfig struct {
+	Issuer                 string        // 验证器应用中显示的签发者名称
+	RequiredRoles          []string      // 必须启用 MFA 的角色
+	PhishingResistantRoles []string      // 第二因素必须使用 WebAuthn 的角色（TOTP 和恢复码不被接受）
+	StorePath              string        // MFA 登记持久化文件路径，为空时使用内存存储
+	ChallengeExpiration    time.Duration // 登录质询令牌有效期
+	RecoveryCodes          int           // 每次生成的恢复码数量
+}
+
+// WebAuthnConfig WebAuthn/通行密钥配置
+type WebAuthnConfig struct {
+	RPID             string        // 依赖方 ID，必须是页面来源的域名或其父域名
+	RPName           string        // 认证器中显示的依赖方名称
+	Origins          []string      // 允许发起仪式的页面来源
+	UserVerification string        // 第二因素的用户验证要求：required、preferred 或 discouraged
+	Timeout          time.Duration // 注册和认证仪式的有效期
+	StorePath        string        // 凭证持久化文件路径，为空时使用内存存储
+}
+
+// AccountConfig 自助找回密码和邮箱验证配置
+type AccountConfig struct {
+	PublicURL             string        // 邮件中链接指向的对外地址，为空时使用 OAUTH_ISSUER
+	PasswordMinLength     int           // 重置密码的最小长度
+	ResetTokenExpiration  time.Duration // 密码重置令牌有效期
+	VerifyTokenExpiration time.Duration // 邮箱验证令牌有效期
+	EmailResendInterval   time.Duration // 同一用户同类邮件的最短发送间隔
+}
+
+// APIKeyConfig 个人访问令牌配置
+type APIKeyConfig struct {
+	StorePath       string        // 令牌文件路径，多副本部署时所有副本挂载同一文件；为空时使用内存存储
+	DefaultLifetime time.Duration // 创建时未指定有效期时使用的有效期
+	MaxLifetime     time.Duration // 允许的最长有效期，0 表示允许永不过期
+	MaxPerUser      int           // 每个用户最多持有的令牌数量，0 表示不限制
+}
+
+// RBACConfig 角色管理配置
+type RBACConfig struct {
+	RoleStorePath  string        // 自定义角色持久化文件路径，为空时使用内存存储；多副本共享该文件
+	ReloadInterval time.Duration // 重新加载自定义角色的间隔，其他副本的修改在此间隔内生效
+}
+
+// ABACConfig 基于属性的访问策略配置
+type ABACConfig struct {
+	PolicyPath     string        // 策略规则 JSON 文件路径，为空时不启用策略
+	Timezone       string        // 评估时间和星期条件的时区
+	ReloadInterval time.Duration // 重新加载策略文件的间隔
+}
+
+// MailConfig 外发邮件配置
+type MailConfig struct {
+	Driver  string // log（写入日志）、file（写入目录）或 smtp
+	From    string // 发件人地址
+	AppName string // 邮件中显示的应用名称
+	Dir     string // file 驱动的输出目录
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPTLS      string        // starttls、tls 或 none
+	SMTPTimeout  time.Duration // 连接和发送超时时间
+}
+
+// MTLSConfig 客户端证书（双向 TLS）认证配置，需要服务直接终止 TLS
+type MTLSConfig struct {
+	ClientCAFile   string // 校验客户端证书的 CA 证书文件（PEM，可包含多个证书）
+	ClientAuth     string // none（不请求证书）、optional（出示时校验）或 required（必须出示）
+	IdentitiesFile string // 证书主题/SAN 到用户或服务的映射规则 JSON 文件，为空时证书不能单独作为身份
+	BindTokens     bool   // 出示证书时签发的令牌绑定证书指纹（RFC 8705 cnf）
+}
+
+// DPoPConfig DPoP 持有证明（RFC 9449）配置
+type DPoPConfig struct {
+	ProofMaxAge     time.Duration // 证明签发（iat）后可被接受的最长时间，重放缓存保留同样长的时间
+	ClockSkew       time.Duration // 允许客户端时钟超前的时间
+	ReplayStorePath string        // 已使用证明的共享文件路径，多副本部署时所有副本挂载同一文件；为空时使用内存缓存
 }
 
 // DatabaseConfig 数据库配置（示例，实际可能使用其他存储）
@@ -51,18 +259,152 @@ type LogConfig struct {
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
+			Environment:     getEnv("APP_ENV", "development"),
 			Host:            getEnv("SERVER_HOST", "0.0.0.0"),
 			Port:            getEnvAsInt("SERVER_PORT", 8080),
 			ReadTimeout:     getEnvAsDuration("SERVER_READ_TIMEOUT", 15*time.Second),
 			WriteTimeout:    getEnvAsDuration("SERVER_WRITE_TIMEOUT", 15*time.Second),
 			ShutdownTimeout: getEnvAsDuration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second),
+			TrustedProxies:  getEnvAsSlice("TRUSTED_PROXIES", nil),
+			Replicas:        getEnvAsInt("REPLICAS", 1),
+			TLSCertFile:     getEnv("TLS_CERT_FILE", ""),
+			TLSKeyFile:      getEnv("TLS_KEY_FILE", ""),
 		},
 		Auth: AuthConfig{
-			JWTSecret:           getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-			JWTExpiration:       getEnvAsDuration("JWT_EXPIRATION", 15*time.Minute),
-			RefreshExpiration:   getEnvAsDuration("REFRESH_EXPIRATION", 7*24*time.Hour),
-			JWTPrivateKeyPath:   getEnv("JWT_PRIVATE_KEY_PATH", ""),
-			JWTPublicKeyPath:    getEnv("JWT_PUBLIC_KEY_PATH", ""),
+			JWTSecret:         getEnv("JWT_SECRET", DefaultJWTSecret),
+			JWTExpiration:     getEnvAsDuration("JWT_EXPIRATION", 15*time.Minute),
+			RefreshExpiration: getEnvAsDuration("REFRESH_EXPIRATION", 7*24*time.Hour),
+			JWTPrivateKeyPath: getEnv("JWT_PRIVATE_KEY_PATH", ""),
+			JWTPublicKeyPath:  getEnv("JWT_PUBLIC_KEY_PATH", ""),
+
+			JWTKeyDir:            getEnv("JWT_KEY_DIR", ""),
+			JWTKeyReloadInterval: getEnvAsDuration("JWT_KEY_RELOAD_INTERVAL", time.Minute),
+			JWTPreviousSecrets:   getEnvAsSlice("JWT_PREVIOUS_SECRETS", nil),
+			JWTLegacyTypeCutoff:  getEnvAsTime("JWT_LEGACY_TYPE_CUTOFF", time.Time{}),
+
+			RefreshStorePath: getEnv("REFRESH_STORE_PATH", ""),
+			SessionStorePath: getEnv("SESSION_STORE_PATH", ""),
+
+			RevocationStorePath: getEnv("REVOCATION_STORE_PATH", ""),
+
+			Backends:      getEnvAsSlice("AUTH_BACKENDS", []string{"local", "file", "ldap"}),
+			UserStorePath: getEnv("USER_STORE_PATH", ""),
+			UsersFile:     getEnv("USERS_FILE", ""),
+		},
+		OAuth: OAuthConfig{
+			ClientsFile:        getEnv("OAUTH_CLIENTS_FILE", ""),
+			Issuer:             getEnv("OAUTH_ISSUER", "http://localhost:8080"),
+			AuthCodeExpiration: getEnvAsDuration("OAUTH_AUTH_CODE_EXPIRATION", time.Minute),
+			AuthCodeStorePath:  getEnv("OAUTH_AUTH_CODE_STORE_PATH", ""),
+		},
+		Federation: FederationConfig{
+			ProvidersFile:   getEnv("OIDC_PROVIDERS_FILE", ""),
+			UsersPath:       getEnv("FEDERATED_USERS_PATH", ""),
+			StateExpiration: getEnvAsDuration("OIDC_LOGIN_STATE_EXPIRATION", 10*time.Minute),
+			StateStorePath:  getEnv("OIDC_LOGIN_STATE_STORE_PATH", ""),
+			HTTPTimeout:     getEnvAsDuration("OIDC_HTTP_TIMEOUT", 10*time.Second),
+		},
+		LDAP: LDAPConfig{
+			URL:                getEnv("LDAP_URL", ""),
+			StartTLS:           getEnvAsBool("LDAP_START_TLS", false),
+			CAFile:             getEnv("LDAP_CA_FILE", ""),
+			InsecureSkipVerify: getEnvAsBool("LDAP_INSECURE_SKIP_VERIFY", false),
+
+			BindDN:       getEnv("LDAP_BIND_DN", ""),
+			BindPassword: getEnv("LDAP_BIND_PASSWORD", ""),
+
+			UserBaseDN:     getEnv("LDAP_USER_BASE_DN", ""),
+			UserFilter:     getEnv("LDAP_USER_FILTER", "(uid=%s)"),
+			UIDAttribute:   getEnv("LDAP_UID_ATTRIBUTE", "uid"),
+			EmailAttribute: getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+
+			GroupBaseDN:       getEnv("LDAP_GROUP_BASE_DN", ""),
+			GroupFilter:       getEnv("LDAP_GROUP_FILTER", "(member=%s)"),
+			GroupRoleMappings: getEnv("LDAP_GROUP_ROLE_MAPPINGS", ""),
+			DefaultRoles:      getEnvAsSlice("LDAP_DEFAULT_ROLES", nil),
+
+			PoolSize: getEnvAsInt("LDAP_POOL_SIZE", 10),
+			Timeout:  getEnvAsDuration("LDAP_TIMEOUT", 5*time.Second),
+		},
+		Password: PasswordConfig{
+			Algorithm:         getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+			Argon2Memory:      uint32(getEnvAsUint("PASSWORD_ARGON2_MEMORY", 64*1024, 32)),
+			Argon2Iterations:  uint32(getEnvAsUint("PASSWORD_ARGON2_ITERATIONS", 3, 32)),
+			Argon2Parallelism: uint8(getEnvAsUint("PASSWORD_ARGON2_PARALLELISM", 2, 8)),
+			BcryptCost:        getEnvAsInt("PASSWORD_BCRYPT_COST", 12),
+		},
+		Lockout: LockoutConfig{
+			MaxUserFailures:  getEnvAsInt("LOGIN_MAX_USER_FAILURES", 5),
+			MaxIPFailures:    getEnvAsInt("LOGIN_MAX_IP_FAILURES", 50),
+			UserBackoffAfter: getEnvAsInt("LOGIN_USER_BACKOFF_AFTER", 2),
+			IPBackoffAfter:   getEnvAsInt("LOGIN_IP_BACKOFF_AFTER", 10),
+			BackoffBase:      getEnvAsDuration("LOGIN_BACKOFF_BASE", time.Second),
+			BackoffMax:       getEnvAsDuration("LOGIN_BACKOFF_MAX", 30*time.Second),
+			Duration:         getEnvAsDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			FailureWindow:    getEnvAsDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			StorePath:        getEnv("LOGIN_LOCKOUT_STORE_PATH", ""),
+		},
+		MFA: MFAConfig{
+			Issuer:                 getEnv("MFA_ISSUER", "API Server"),
+			RequiredRoles:          getEnvAsOptionalSlice("MFA_REQUIRED_ROLES", []string{"admin"}),
+			PhishingResistantRoles: getEnvAsOptionalSlice("MFA_PHISHING_RESISTANT_ROLES", []string{"admin"}),
+			StorePath:              getEnv("MFA_STORE_PATH", ""),
+			ChallengeExpiration:    getEnvAsDuration("MFA_CHALLENGE_EXPIRATION", 5*time.Minute),
+			RecoveryCodes:          getEnvAsInt("MFA_RECOVERY_CODES", 10),
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:             getEnv("WEBAUTHN_RP_ID", "localhost"),
+			RPName:           getEnv("WEBAUTHN_RP_NAME", "API Server"),
+			Origins:          getEnvAsSlice("WEBAUTHN_ORIGINS", []string{"http://localhost:8080"}),
+			UserVerification: getEnv("WEBAUTHN_USER_VERIFICATION", "preferred"),
+			Timeout:          getEnvAsDuration("WEBAUTHN_TIMEOUT", 5*time.Minute),
+			StorePath:        getEnv("WEBAUTHN_STORE_PATH", ""),
+		},
+		Account: AccountConfig{
+			PublicURL:             getEnv("ACCOUNT_PUBLIC_URL", ""),
+			PasswordMinLength:     getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+			ResetTokenExpiration:  getEnvAsDuration("PASSWORD_RESET_EXPIRATION", 15*time.Minute),
+			VerifyTokenExpiration: getEnvAsDuration("EMAIL_VERIFICATION_EXPIRATION", 24*time.Hour),
+			EmailResendInterval:   getEnvAsDuration("ACCOUNT_EMAIL_RESEND_INTERVAL", time.Minute),
+		},
+		APIKey: APIKeyConfig{
+			StorePath:       getEnv("APIKEY_STORE_PATH", ""),
+			DefaultLifetime: getEnvAsDuration("APIKEY_DEFAULT_LIFETIME", 90*24*time.Hour),
+			MaxLifetime:     getEnvAsDuration("APIKEY_MAX_LIFETIME", 365*24*time.Hour),
+			MaxPerUser:      getEnvAsInt("APIKEY_MAX_PER_USER", 20),
+		},
+		RBAC: RBACConfig{
+			RoleStorePath:  getEnv("RBAC_ROLE_STORE_PATH", ""),
+			ReloadInterval: getEnvAsDuration("RBAC_RELOAD_INTERVAL", 30*time.Second),
+		},
+		ABAC: ABACConfig{
+			PolicyPath:     getEnv("ABAC_POLICY_PATH", ""),
+			Timezone:       getEnv("ABAC_TIMEZONE", "UTC"),
+			ReloadInterval: getEnvAsDuration("ABAC_RELOAD_INTERVAL", 30*time.Second),
+		},
+		Mail: MailConfig{
+			Driver:  getEnv("MAIL_DRIVER", "log"),
+			From:    getEnv("MAIL_FROM", "API Server <no-reply@localhost>"),
+			AppName: getEnv("MAIL_APP_NAME", "API Server"),
+			Dir:     getEnv("MAIL_DIR", "mail"),
+
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			SMTPTLS:      getEnv("SMTP_TLS", "starttls"),
+			SMTPTimeout:  getEnvAsDuration("SMTP_TIMEOUT", 10*time.Second),
+		},
+		MTLS: MTLSConfig{
+			ClientCAFile:   getEnv("TLS_CLIENT_CA_FILE", ""),
+			ClientAuth:     getEnv("TLS_CLIENT_AUTH", "optional"),
+			IdentitiesFile: getEnv("MTLS_IDENTITIES_FILE", ""),
+			BindTokens:     getEnvAsBool("MTLS_BIND_TOKENS", false),
+		},
+		DPoP: DPoPConfig{
+			ProofMaxAge:     getEnvAsDuration("DPOP_PROOF_MAX_AGE", 5*time.Minute),
+			ClockSkew:       getEnvAsDuration("DPOP_CLOCK_SKEW", 30*time.Second),
+			ReplayStorePath: getEnv("DPOP_REPLAY_STORE_PATH", ""),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -78,6 +420,91 @@ func Load() *Config {
 	}
 }
 
+// Validate 校验配置，拒绝在生产环境使用不安全的默认值
+func (c *Config) Validate() error {
+	if c.Server.Environment == EnvironmentProduction &&
+		c.Auth.JWTKeyDir == "" && c.Auth.JWTPrivateKeyPath == "" && c.Auth.JWTPublicKeyPath == "" &&
+		c.Auth.JWTSecret == DefaultJWTSecret {
+		return ErrDefaultJWTSecret
+	}
+	if c.Server.Environment == EnvironmentProduction &&
+		strings.HasPrefix(strings.ToLower(c.LDAP.URL), "ldap://") && !c.LDAP.StartTLS {
+		return ErrInsecureLDAP
+	}
+	switch c.WebAuthn.UserVerification {
+	case "required", "preferred", "discouraged":
+	default:
+		return ErrInvalidUV
+	}
+	switch c.Mail.Driver {
+	case "log", "file", "smtp":
+	default:
+		return ErrInvalidMailer
+	}
+	if c.Server.Environment == EnvironmentProduction && c.Mail.Driver == "smtp" && c.Mail.SMTPTLS == "none" {
+		return ErrInsecureSMTP
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		return ErrTLSKeyPair
+	}
+	switch c.MTLS.ClientAuth {
+	case "none", "optional", "required":
+	default:
+		return ErrInvalidClientAuth
+	}
+	if c.MTLS.ClientCAFile != "" && c.Server.TLSCertFile == "" {
+		return ErrClientCAWithoutTLS
+	}
+	if (c.MTLS.IdentitiesFile != "" || c.MTLS.BindTokens || c.MTLS.ClientAuth == "required") &&
+		(c.MTLS.ClientCAFile == "" || c.MTLS.ClientAuth == "none") {
+		return ErrMTLSWithoutCA
+	}
+	if _, err := time.LoadLocation(c.ABAC.Timezone); err != nil {
+		return ErrInvalidTimezone
+	}
+	// 内存吊销列表只在本副本生效，退出登录或禁用用户后令牌在其他副本上仍然有效
+	if c.Server.Replicas > 1 && c.Auth.RevocationStorePath == "" {
+		return ErrLocalRevocations
+	}
+	// 每个副本独立计数时，攻击者轮流访问各副本即可获得副本数倍的尝试次数
+	if c.Server.Replicas > 1 && c.Lockout.StorePath == "" {
+		return ErrLocalLockout
+	}
+	// 刷新令牌只在签发它的副本上记录时，重放到其他副本既不会被识别为重用，也无法兑换合法令牌
+	if c.Server.Replicas > 1 && c.Auth.RefreshStorePath == "" {
+		return ErrLocalRefreshTokens
+	}
+	// 会话只在创建它的副本上可见时，会话列表不完整，在其他副本上登出或强制下线找不到会话
+	if c.Server.Replicas > 1 && c.Auth.SessionStorePath == "" {
+		return ErrLocalSessions
+	}
+	// 授权端点和令牌端点落在不同副本时，内存中的授权码无法兑换；各副本独立删除时同一授权码可在多个副本上各兑换一次
+	if c.Server.Replicas > 1 && c.OAuth.AuthCodeStorePath == "" {
+		return ErrLocalAuthCodes
+	}
+	// 上游回调落在未发起登录的副本时找不到登录状态，联合登录失败
+	if c.Server.Replicas > 1 && c.Federation.StateStorePath == "" {
+		return ErrLocalLoginStates
+	}
+	// 各副本独立记录已使用的证明时，截获的证明可在每个副本上各重放一次
+	if c.Server.Replicas > 1 && c.DPoP.ReplayStorePath == "" {
+		return ErrLocalDPoPReplays
+	}
+	// 内存中的自定义角色只在本副本生效，在一个副本上创建或删除的角色在其他副本上不可见，授权结果随请求落到的副本而不同
+	if c.Server.Replicas > 1 && c.RBAC.RoleStorePath == "" {
+		return ErrLocalRoles
+	}
+	// 内存用户库只在本副本生效，在一个副本上创建、修改用户或重置密码后其他副本仍使用旧记录
+	if c.Server.Replicas > 1 && c.Auth.UserStorePath == "" {
+		return ErrLocalUsers
+	}
+	// 各副本的内存令牌互不可见，在一个副本上创建的令牌在其他副本上无法使用，吊销的令牌在其他副本上仍然有效
+	if c.Server.Replicas > 1 && c.APIKey.StorePath == "" {
+		return ErrLocalAPIKeys
+	}
+	return nil
+}
+
 // getEnv 获取环境变量，如果不存在则返回默认值
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -95,6 +522,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsUint 获取无符号整型环境变量，超出 bitSize 位范围时使用默认值而不是截断
+func getEnvAsUint(key string, defaultValue uint64, bitSize int) uint64 {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseUint(valueStr, 10, bitSize); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
 // getEnvAsDuration 获取时间间隔环境变量
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	valueStr := getEnv(key, "")
@@ -103,3 +539,45 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+// getEnvAsTime 获取 RFC 3339 格式的时间环境变量
+func getEnvAsTime(key string, defaultValue time.Time) time.Time {
+	valueStr := getEnv(key, "")
+	if value, err := time.Parse(time.RFC3339, valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsBool 获取布尔环境变量
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsSlice 获取逗号分隔的列表环境变量
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	var values []string
+	for _, value := range strings.Split(valueStr, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvAsOptionalSlice 与 getEnvAsSlice 相同，但显式设置为空时返回空列表而不是默认值
+func getEnvAsOptionalSlice(key string, defaultValue []string) []string {
+	if value, ok := os.LookupEnv(key); ok && strings.TrimSpace(value) == "" {
+		return nil
+	}
+	return getEnvAsSlice(key, defaultValue)
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+// sharedConfig 多副本部署且所有状态都使用共享文件的配置
+func sharedConfig(t *testing.T) *Config {
+	t.Helper()
+
+	cfg := Load()
+	cfg.Server.Replicas = 3
+	cfg.Auth.RevocationStorePath = "/var/lib/api-server/revocations.json"
+	cfg.Auth.RefreshStorePath = "/var/lib/api-server/refresh_tokens.json"
+	cfg.Auth.SessionStorePath = "/var/lib/api-server/sessions.json"
+	cfg.Lockout.StorePath = "/var/lib/api-server/lockout.json"
+	cfg.OAuth.AuthCodeStorePath = "/var/lib/api-server/auth_codes.json"
+	cfg.Federation.StateStorePath = "/var/lib/api-server/login_states.json"
+	cfg.DPoP.ReplayStorePath = "/var/lib/api-server/dpop_replays.json"
+	cfg.RBAC.RoleStorePath = "/var/lib/api-server/roles.json"
+	cfg.Auth.UserStorePath = "/var/lib/api-server/users.json"
+	cfg.APIKey.StorePath = "/var/lib/api-server/api_keys.json"
+	return cfg
+}
+
+func TestValidateRequiresSharedStoresForReplicas(t *testing.T) {
+	tests := []struct {
+		name  string
+		clear func(cfg *Config)
+		want  error
+	}{
+		{name: "revocations", clear: func(cfg *Config) { cfg.Auth.RevocationStorePath = "" }, want: ErrLocalRevocations},
+		{name: "lockout", clear: func(cfg *Config) { cfg.Lockout.StorePath = "" }, want: ErrLocalLockout},
+		{name: "refresh tokens", clear: func(cfg *Config) { cfg.Auth.RefreshStorePath = "" }, want: ErrLocalRefreshTokens},
+		{name: "sessions", clear: func(cfg *Config) { cfg.Auth.SessionStorePath = "" }, want: ErrLocalSessions},
+		{name: "authorization codes", clear: func(cfg *Config) { cfg.OAuth.AuthCodeStorePath = "" }, want: ErrLocalAuthCodes},
+		{name: "federated login states", clear: func(cfg *Config) { cfg.Federation.StateStorePath = "" }, want: ErrLocalLoginStates},
+		{name: "dpop replays", clear: func(cfg *Config) { cfg.DPoP.ReplayStorePath = "" }, want: ErrLocalDPoPReplays},
+		{name: "custom roles", clear: func(cfg *Config) { cfg.RBAC.RoleStorePath = "" }, want: ErrLocalRoles},
+		{name: "local users", clear: func(cfg *Config) { cfg.Auth.UserStorePath = "" }, want: ErrLocalUsers},
+		{name: "personal access tokens", clear: func(cfg *Config) { cfg.APIKey.StorePath = "" }, want: ErrLocalAPIKeys},
+	}
+
+	if err := sharedConfig(t).Validate(); err != nil {
+		t.Fatalf("Validate() with shared stores = %v, want nil", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := sharedConfig(t)
+			tt.clear(cfg)
+			if err := cfg.Validate(); !errors.Is(err, tt.want) {
+				t.Fatalf("Validate() = %v, want %v", err, tt.want)
+			}
+
+			// 单副本可以使用内存存储
+			cfg.Server.Replicas = 1
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate() with one replica = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestLoadPasswordParamsOutOfRange(t *testing.T) {
+	// 超出字段类型范围的值回退到默认值，不能被截断成另一个合法值
+	t.Setenv("PASSWORD_ARGON2_PARALLELISM", "257")
+	t.Setenv("PASSWORD_ARGON2_MEMORY", "4294968320")
+	t.Setenv("PASSWORD_ARGON2_ITERATIONS", "-1")
+
+	cfg := Load().Password
+	if cfg.Argon2Parallelism != 2 || cfg.Argon2Memory != 64*1024 || cfg.Argon2Iterations != 3 {
+		t.Fatalf("Load() password = %+v, want defaults", cfg)
+	}
+}
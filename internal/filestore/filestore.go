@@ -0,0 +1,111 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 跨副本写入锁的等待时间，以及超过多久视为持有者已崩溃的遗留锁
+const (
+	LockTimeout  = 5 * time.Second
+	LockStaleAge = 30 * time.Second
+)
+
+// File 多个副本通过共享卷读写的文件，记录上次读取或写入时的文件信息
+//
+// 写入方持有 Lock 返回的锁，Read 最新内容、修改后 Write；读取方只在 Read 报告变化时重新解码。
+// File 不是并发安全的，调用方需用自己的互斥锁保护。
+type File struct {
+	path   string
+	loaded os.FileInfo // 缓存对应的文件信息，文件不存在时为空
+}
+
+// NewFile 创建共享文件
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Path 文件路径
+func (f *File) Path() string {
+	return f.path
+}
+
+// Read 文件自上次 Read 或 Write 后有变化时返回新内容和 true；文件被删除时返回 nil 和 true
+//
+// 每次写入都会重命名出新文件，比较文件本身、修改时间和大小即可发现其他副本的修改。
+func (f *File) Read() ([]byte, bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, false, err
+		}
+		changed := f.loaded != nil
+		f.loaded = nil
+		return nil, changed, nil
+	}
+	if f.loaded != nil && os.SameFile(f.loaded, info) &&
+		f.loaded.ModTime().Equal(info.ModTime()) && f.loaded.Size() == info.Size() {
+		return nil, false, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, false, err
+	}
+	f.loaded = info
+	return data, true, nil
+}
+
+// Write 先写临时文件再重命名，避免写入中断导致文件损坏
+func (f *File) Write(data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	f.loaded = info
+	return nil
+}
+
+// Lock 创建锁文件独占写入，返回释放锁的函数；超过 LockStaleAge 的锁文件视为崩溃遗留并删除
+func (f *File) Lock() (func(), error) {
+	lockPath := f.path + ".lock"
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		lf, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			lf.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > LockStaleAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
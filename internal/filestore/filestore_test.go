@@ -0,0 +1,97 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadReportsChangesFromOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	a, b := NewFile(path), NewFile(path)
+
+	if data, changed, err := a.Read(); err != nil || changed || data != nil {
+		t.Fatalf("Read of missing file = %q, %v, %v", data, changed, err)
+	}
+
+	if err := b.Write([]byte(`{"v":1}`)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if data, changed, err := a.Read(); err != nil || !changed || string(data) != `{"v":1}` {
+		t.Fatalf("Read after other writer = %q, %v, %v", data, changed, err)
+	}
+	if _, changed, err := a.Read(); err != nil || changed {
+		t.Fatalf("Read without changes = %v, %v", changed, err)
+	}
+
+	// 自己写入的内容不需要重新读取
+	if err := a.Write([]byte(`{"v":2}`)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, changed, err := a.Read(); err != nil || changed {
+		t.Fatalf("Read after own write = %v, %v", changed, err)
+	}
+
+	// 相同大小的内容也能发现
+	if err := b.Write([]byte(`{"v":3}`)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if data, changed, err := a.Read(); err != nil || !changed || string(data) != `{"v":3}` {
+		t.Fatalf("Read after same-size write = %q, %v, %v", data, changed, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if data, changed, err := a.Read(); err != nil || !changed || data != nil {
+		t.Fatalf("Read after removal = %q, %v, %v", data, changed, err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	a, b := NewFile(path), NewFile(path)
+
+	unlock, err := a.Lock()
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlockB, err := b.Lock()
+		if err != nil {
+			t.Errorf("Lock: %v", err)
+			return
+		}
+		unlockB()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while held by another writer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock not acquired after release")
+	}
+
+	// 崩溃遗留的锁文件被忽略
+	if err := os.WriteFile(path+".lock", nil, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	stale := time.Now().Add(-2 * LockStaleAge)
+	if err := os.Chtimes(path+".lock", stale, stale); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	unlock, err = a.Lock()
+	if err != nil {
+		t.Fatalf("Lock with stale lock file: %v", err)
+	}
+	unlock()
+}
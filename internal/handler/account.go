@@ -0,0 +1,526 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/apikey"
+	"github.com/jason0730/claude-code-demo/internal/auth/identity"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/config"
+	"github.com/jason0730/claude-code-demo/internal/mail"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxPasswordLength 密码最大字节数，避免超长输入放大哈希开销
+const maxPasswordLength = 1024
+
+var errInvalidActionToken = errors.New("invalid or expired token")
+
+var accountTemplate = template.Must(template.ParseFS(templateFS, "templates/account.html"))
+
+// AccountHandler 自助找回密码和邮箱验证处理器
+//
+// 令牌通过邮件发送，只有本地用户库中的账户可以使用；LDAP 和联合登录用户的密码和邮箱由上游管理。
+type AccountHandler struct {
+	config    *config.AccountConfig
+	publicURL string
+	appName   string
+	accounts  identity.Store
+	mailer    mail.Mailer
+	auth      *AuthHandler    // 令牌签发、吊销和会话管理与登录接口共用
+	apiKeys   *apikey.Service // 重置密码时一并吊销个人访问令牌
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time // 用途:用户 ID -> 上次发送时间
+}
+
+// NewAccountHandler 创建自助找回密码和邮箱验证处理器，publicURL 为空时使用 issuer
+func NewAccountHandler(
+	cfg *config.AccountConfig,
+	issuer string,
+	appName string,
+	accounts identity.Store,
+	mailer mail.Mailer,
+	auth *AuthHandler,
+	apiKeys *apikey.Service,
+) *AccountHandler {
+	publicURL := cfg.PublicURL
+	if publicURL == "" {
+		publicURL = issuer
+	}
+	return &AccountHandler{
+		config:    cfg,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		appName:   appName,
+		accounts:  accounts,
+		mailer:    mailer,
+		auth:      auth,
+		apiKeys:   apiKeys,
+		lastSent:  make(map[string]time.Time),
+	}
+}
+
+// ForgotPassword 向邮箱对应的本地账户发送密码重置邮件
+//
+// 无论邮箱是否存在都返回 202，邮件在后台发送，避免通过响应内容或耗时枚举邮箱。
+func (h *AccountHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req model.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		respondError(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	users, err := h.accounts.FindByEmail(r.Context(), email)
+	if err != nil {
+		log.WithError(err).Error("user lookup by email failed")
+		respondError(w, http.StatusInternalServerError, "failed to process request")
+		return
+	}
+
+	for _, user := range users {
+		if wait := h.throttle(jwt.ActionPasswordReset, user.ID); wait > 0 {
+			log.WithField("user_id", user.ID).Info("password reset email throttled")
+			continue
+		}
+		if err := h.sendPasswordReset(r.Context(), user); err != nil {
+			log.WithError(err).WithField("user_id", user.ID).Error("failed to send password reset email")
+			continue
+		}
+		log.WithFields(log.Fields{
+			"event":       "password_reset_requested",
+			"user_id":     user.ID,
+			"remote_addr": clientIP(r),
+		}).Info("security event: password reset requested")
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "if an account with that email exists, a password reset link has been sent",
+	})
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码，并吊销用户的全部会话
+func (h *AccountHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req model.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.resetPassword(r, req.Token, req.Password); err != nil {
+		h.respondAccountError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SendVerification 向当前用户的邮箱发送验证邮件
+func (h *AccountHandler) SendVerification(w http.ResponseWriter, r *http.Request) {
+	claims, _ := authmw.GetClaims(r.Context())
+	if claims.IsService() {
+		respondError(w, http.StatusForbidden, "not available for service principals")
+		return
+	}
+
+	user, err := h.accounts.GetUser(r.Context(), claims.Subject)
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			respondError(w, http.StatusForbidden, "email is managed by an external identity provider")
+			return
+		}
+		log.WithError(err).WithField("user_id", claims.Subject).Error("user lookup failed")
+		respondError(w, http.StatusInternalServerError, "failed to send verification email")
+		return
+	}
+	if user.Email == "" {
+		respondError(w, http.StatusBadRequest, "account has no email address")
+		return
+	}
+	if user.EmailVerified {
+		respondError(w, http.StatusConflict, "email already verified")
+		return
+	}
+	if wait := h.throttle(jwt.ActionVerifyEmail, user.ID); wait > 0 {
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		respondError(w, http.StatusTooManyRequests, "verification email recently sent, try again later")
+		return
+	}
+
+	if err := h.sendVerification(r.Context(), user); err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("failed to send verification email")
+		respondError(w, http.StatusInternalServerError, "failed to send verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmail 使用邮件中的令牌将邮箱标记为已验证
+func (h *AccountHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req model.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.verifyEmail(r, req.Token); err != nil {
+		h.respondAccountError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// accountPage 邮件链接打开的页面
+type accountPage struct {
+	Action    string // reset-password 或 verify-email
+	Token     string
+	MinLength int
+	Error     string
+	Fatal     bool // 令牌无效，不再显示表单
+	Done      string
+}
+
+// ResetPasswordPage 邮件中密码重置链接打开的页面，GET 显示表单，POST 提交新密码
+func (h *AccountHandler) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	page := accountPage{Action: "reset-password", MinLength: h.config.PasswordMinLength}
+
+	if r.Method == http.MethodGet {
+		page.Token = r.URL.Query().Get("token")
+		if _, err := h.validateActionToken(r.Context(), page.Token, jwt.ActionPasswordReset); err != nil {
+			page.Fatal, page.Error = true, "This password reset link is invalid or has expired."
+			renderAccount(w, http.StatusBadRequest, page)
+			return
+		}
+		renderAccount(w, http.StatusOK, page)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		page.Fatal, page.Error = true, "Invalid request."
+		renderAccount(w, http.StatusBadRequest, page)
+		return
+	}
+	page.Token = r.PostForm.Get("token")
+	password := r.PostForm.Get("password")
+	if password != r.PostForm.Get("password_confirm") {
+		page.Error = "The passwords do not match."
+		renderAccount(w, http.StatusBadRequest, page)
+		return
+	}
+
+	err := h.resetPassword(r, page.Token, password)
+	switch {
+	case err == nil:
+		page.Done = "Your password has been changed and you have been signed out of all devices."
+		renderAccount(w, http.StatusOK, page)
+	case errors.Is(err, errInvalidActionToken):
+		page.Fatal, page.Error = true, "This password reset link is invalid or has expired."
+		renderAccount(w, http.StatusBadRequest, page)
+	case isPasswordPolicyError(err):
+		page.Error = err.Error()
+		renderAccount(w, http.StatusBadRequest, page)
+	default:
+		page.Error = "Failed to reset password, please try again."
+		renderAccount(w, http.StatusInternalServerError, page)
+	}
+}
+
+// VerifyEmailPage 邮件中验证链接打开的页面；GET 只显示确认按钮，避免邮件扫描器预取链接时完成验证
+func (h *AccountHandler) VerifyEmailPage(w http.ResponseWriter, r *http.Request) {
+	page := accountPage{Action: "verify-email"}
+
+	if r.Method == http.MethodGet {
+		page.Token = r.URL.Query().Get("token")
+		if _, err := h.validateActionToken(r.Context(), page.Token, jwt.ActionVerifyEmail); err != nil {
+			page.Fatal, page.Error = true, "This verification link is invalid or has expired."
+			renderAccount(w, http.StatusBadRequest, page)
+			return
+		}
+		renderAccount(w, http.StatusOK, page)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		page.Fatal, page.Error = true, "Invalid request."
+		renderAccount(w, http.StatusBadRequest, page)
+		return
+	}
+
+	err := h.verifyEmail(r, r.PostForm.Get("token"))
+	switch {
+	case err == nil:
+		page.Done = "Your email address has been verified."
+		renderAccount(w, http.StatusOK, page)
+	case errors.Is(err, errInvalidActionToken):
+		page.Fatal, page.Error = true, "This verification link is invalid or has expired."
+		renderAccount(w, http.StatusBadRequest, page)
+	default:
+		page.Fatal, page.Error = true, "Failed to verify email address, please try again."
+		renderAccount(w, http.StatusInternalServerError, page)
+	}
+}
+
+// resetPassword 校验令牌和新密码，保存密码后使令牌失效并吊销全部会话
+func (h *AccountHandler) resetPassword(r *http.Request, token, password string) error {
+	ctx := r.Context()
+	claims, err := h.validateActionToken(ctx, token, jwt.ActionPasswordReset)
+	if err != nil {
+		return err
+	}
+	if err := h.validatePassword(password); err != nil {
+		return err
+	}
+
+	if err := h.accounts.ResetPassword(ctx, claims.Subject, claims.PasswordStamp, password); err != nil {
+		if errors.Is(err, identity.ErrStaleStamp) || errors.Is(err, identity.ErrUserNotFound) {
+			return errInvalidActionToken
+		}
+		log.WithError(err).WithField("user_id", claims.Subject).Error("failed to reset password")
+		return err
+	}
+	h.consumeActionToken(ctx, claims)
+
+	// 密码已经修改，吊销失败时不回滚，只记录错误
+	if err := h.auth.revokeAllSessions(ctx, claims.Subject); err != nil {
+		log.WithError(err).WithField("user_id", claims.Subject).Error("failed to revoke sessions after password reset")
+	}
+	if err := h.apiKeys.RevokeAll(ctx, claims.Subject); err != nil {
+		log.WithError(err).WithField("user_id", claims.Subject).Error("failed to revoke api keys after password reset")
+	}
+	if user, err := h.accounts.GetUser(ctx, claims.Subject); err == nil {
+		h.auth.lockout.Succeed(user.Username)
+	}
+
+	log.WithFields(log.Fields{
+		"event":       "password_reset",
+		"user_id":     claims.Subject,
+		"remote_addr": clientIP(r),
+	}).Warn("security event: password reset, all sessions and api keys revoked")
+	return nil
+}
+
+// verifyEmail 校验令牌并将令牌中的邮箱标记为已验证
+func (h *AccountHandler) verifyEmail(r *http.Request, token string) error {
+	ctx := r.Context()
+	claims, err := h.validateActionToken(ctx, token, jwt.ActionVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	if err := h.accounts.VerifyEmail(ctx, claims.Subject, claims.Email); err != nil {
+		if errors.Is(err, identity.ErrEmailChanged) || errors.Is(err, identity.ErrUserNotFound) {
+			return errInvalidActionToken
+		}
+		log.WithError(err).WithField("user_id", claims.Subject).Error("failed to verify email")
+		return err
+	}
+	h.consumeActionToken(ctx, claims)
+
+	log.WithFields(log.Fields{
+		"event":       "email_verified",
+		"user_id":     claims.Subject,
+		"remote_addr": clientIP(r),
+	}).Info("security event: email verified")
+	return nil
+}
+
+// validateActionToken 校验账户操作令牌的签名、用途和吊销状态
+func (h *AccountHandler) validateActionToken(ctx context.Context, token, purpose string) (*jwt.ActionClaims, error) {
+	if token == "" {
+		return nil, errInvalidActionToken
+	}
+	claims, err := h.auth.tokenManager.ValidateActionToken(token)
+	if err != nil || claims.Purpose != purpose || claims.Subject == "" {
+		return nil, errInvalidActionToken
+	}
+
+	revoked, err := h.auth.revocations.IsRevoked(ctx, claims.ID, claims.Subject, jwt.TimeOf(claims.IssuedAt))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errInvalidActionToken
+	}
+	return claims, nil
+}
+
+// consumeActionToken 使账户操作令牌失效，每个令牌只能使用一次
+func (h *AccountHandler) consumeActionToken(ctx context.Context, claims *jwt.ActionClaims) {
+	if err := h.auth.revocations.RevokeToken(ctx, claims.ID, jwt.TimeOf(claims.ExpiresAt)); err != nil {
+		log.WithError(err).Warn("failed to revoke account action token")
+	}
+}
+
+// validatePassword 校验新密码的长度
+func (h *AccountHandler) validatePassword(password string) error {
+	if len([]rune(password)) < h.config.PasswordMinLength {
+		return passwordPolicyError{fmt.Sprintf("password must be at least %d characters", h.config.PasswordMinLength)}
+	}
+	if len(password) > maxPasswordLength {
+		return passwordPolicyError{fmt.Sprintf("password must be at most %d bytes", maxPasswordLength)}
+	}
+	return nil
+}
+
+// passwordPolicyError 新密码不满足要求，错误信息可以直接返回给用户
+type passwordPolicyError struct {
+	message string
+}
+
+// Error 实现 error 接口
+func (e passwordPolicyError) Error() string {
+	return e.message
+}
+
+// isPasswordPolicyError 判断是否为新密码不满足要求
+func isPasswordPolicyError(err error) bool {
+	var policy passwordPolicyError
+	return errors.As(err, &policy)
+}
+
+// sendPasswordReset 签发绑定当前密码的重置令牌并发送邮件
+func (h *AccountHandler) sendPasswordReset(ctx context.Context, user *model.User) error {
+	stamp, err := h.accounts.PasswordStamp(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	ttl := h.config.ResetTokenExpiration
+	token, err := h.auth.tokenManager.GenerateActionToken(user.ID, ttl, jwt.ActionClaims{
+		Purpose:       jwt.ActionPasswordReset,
+		PasswordStamp: stamp,
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.send(user.Email, mail.TemplatePasswordReset, &mail.AccountData{
+		AppName:   h.appName,
+		Username:  user.Username,
+		Email:     user.Email,
+		Link:      h.link("/account/reset-password", token),
+		ExpiresIn: formatTTL(ttl),
+	})
+}
+
+// sendVerification 签发绑定当前邮箱的验证令牌并发送邮件
+func (h *AccountHandler) sendVerification(ctx context.Context, user *model.User) error {
+	ttl := h.config.VerifyTokenExpiration
+	token, err := h.auth.tokenManager.GenerateActionToken(user.ID, ttl, jwt.ActionClaims{
+		Purpose: jwt.ActionVerifyEmail,
+		Email:   user.Email,
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.send(user.Email, mail.TemplateVerifyEmail, &mail.AccountData{
+		AppName:   h.appName,
+		Username:  user.Username,
+		Email:     user.Email,
+		Link:      h.link("/account/verify-email", token),
+		ExpiresIn: formatTTL(ttl),
+	})
+}
+
+// send 渲染邮件并在后台发送，发送耗时不影响响应时间
+func (h *AccountHandler) send(to, name string, data *mail.AccountData) error {
+	msg, err := mail.Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+
+	go func() {
+		if err := h.mailer.Send(context.Background(), msg); err != nil {
+			log.WithError(err).WithField("template", name).Error("failed to send mail")
+		}
+	}()
+	return nil
+}
+
+// throttle 限制同一用户同类邮件的发送频率，返回还需等待的时间；允许发送时记录本次发送
+func (h *AccountHandler) throttle(purpose, userID string) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	interval := h.config.EmailResendInterval
+	for key, sentAt := range h.lastSent {
+		if now.Sub(sentAt) >= interval {
+			delete(h.lastSent, key)
+		}
+	}
+
+	key := purpose + ":" + userID
+	if sentAt, ok := h.lastSent[key]; ok {
+		return interval - now.Sub(sentAt)
+	}
+	h.lastSent[key] = now
+	return 0
+}
+
+// link 生成邮件中的页面链接
+func (h *AccountHandler) link(path, token string) string {
+	return h.publicURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
+
+// respondAccountError 将账户操作错误映射为 HTTP 响应
+func (h *AccountHandler) respondAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidActionToken):
+		respondError(w, http.StatusBadRequest, errInvalidActionToken.Error())
+	case isPasswordPolicyError(err):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "failed to process request")
+	}
+}
+
+// renderAccount 渲染账户页面；令牌在 URL 中，禁止通过 Referer 泄露
+func renderAccount(w http.ResponseWriter, code int, page accountPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.WriteHeader(code)
+
+	if err := accountTemplate.Execute(w, page); err != nil {
+		log.WithError(err).Error("failed to render account page")
+	}
+}
+
+// formatTTL 将有效期格式化为邮件中显示的文字
+func formatTTL(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return plural(int(d/time.Hour), "hour")
+	case d >= time.Minute && d%time.Minute == 0:
+		return plural(int(d/time.Minute), "minute")
+	default:
+		return d.String()
+	}
+}
+
+// plural 返回带单位的数量，如 "1 hour"、"24 hours"
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jason0730/claude-code-demo/internal/auth/apikey"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxAPIKeyNameLength 令牌名称最大长度
+const maxAPIKeyNameLength = 100
+
+// apiKeyResponse 令牌信息，不包含哈希；token 只在创建时返回
+type apiKeyResponse struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Permissions []string   `json:"permissions"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP  string     `json:"last_used_ip,omitempty"`
+	Token       string     `json:"token,omitempty"`
+}
+
+// APIKeyHandler 个人访问令牌处理器
+type APIKeyHandler struct {
+	keys        *apikey.Service
+	rbacManager *rbac.RBACManager
+}
+
+// NewAPIKeyHandler 创建个人访问令牌处理器
+func NewAPIKeyHandler(keys *apikey.Service, rbacManager *rbac.RBACManager) *APIKeyHandler {
+	return &APIKeyHandler{
+		keys:        keys,
+		rbacManager: rbacManager,
+	}
+}
+
+// ListKeys 列出当前用户的个人访问令牌
+func (h *APIKeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	claims, _ := authmw.GetClaims(r.Context())
+	if claims.IsService() {
+		respondError(w, http.StatusForbidden, "not available for service principals")
+		return
+	}
+
+	keys, err := h.keys.List(r.Context(), claims.Subject)
+	if err != nil {
+		log.WithError(err).WithField("user_id", claims.Subject).Error("failed to list api keys")
+		respondError(w, http.StatusInternalServerError, "failed to list api keys")
+		return
+	}
+
+	resp := make([]apiKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, newAPIKeyResponse(k, ""))
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// CreateKey 创建个人访问令牌，权限必须是当前用户角色所授予权限的子集
+func (h *APIKeyHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	claims, _ := authmw.GetClaims(r.Context())
+	if claims.IsService() {
+		respondError(w, http.StatusForbidden, "not available for service principals")
+		return
+	}
+
+	var req model.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAPIKeyNameLength {
+		respondError(w, http.StatusBadRequest, "name is required and must be at most 100 characters")
+		return
+	}
+	if req.ExpiresIn < 0 {
+		respondError(w, http.StatusBadRequest, "expires_in must not be negative")
+		return
+	}
+
+	permissions, ok := h.grantablePermissions(w, claims.Roles, claims.Scope, req.Permissions)
+	if !ok {
+		return
+	}
+
+	key, token, err := h.keys.Create(r.Context(), claims.Subject, req.Name, permissions, time.Duration(req.ExpiresIn)*time.Second)
+	switch {
+	case errors.Is(err, apikey.ErrLifetimeTooLong):
+		respondError(w, http.StatusBadRequest, "expires_in exceeds the maximum token lifetime")
+		return
+	case errors.Is(err, apikey.ErrTooManyKeys):
+		respondError(w, http.StatusConflict, "too many personal access tokens; revoke an unused token first")
+		return
+	case err != nil:
+		log.WithError(err).WithField("user_id", claims.Subject).Error("failed to create api key")
+		respondError(w, http.StatusInternalServerError, "failed to create api key")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"event":       "apikey_created",
+		"user_id":     claims.Subject,
+		"key_id":      key.ID,
+		"permissions": key.Permissions,
+		"expires_at":  key.ExpiresAt,
+		"remote_addr": clientIP(r),
+	}).Info("security event: personal access token created")
+
+	respondJSON(w, http.StatusCreated, newAPIKeyResponse(key, token))
+}
+
+// RevokeKey 吊销当前用户的一个个人访问令牌
+func (h *APIKeyHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	claims, _ := authmw.GetClaims(r.Context())
+	if claims.IsService() {
+		respondError(w, http.StatusForbidden, "not available for service principals")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if err := h.keys.Revoke(r.Context(), claims.Subject, id); err != nil {
+		if errors.Is(err, apikey.ErrKeyNotFound) {
+			respondError(w, http.StatusNotFound, "api key not found")
+			return
+		}
+		log.WithError(err).WithField("key_id", id).Error("failed to revoke api key")
+		respondError(w, http.StatusInternalServerError, "failed to revoke api key")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"event":       "apikey_revoked",
+		"user_id":     claims.Subject,
+		"key_id":      id,
+		"remote_addr": clientIP(r),
+	}).Info("security event: personal access token revoked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// grantablePermissions 校验请求的权限均由创建者的角色授予（且在当前令牌 scope 内），
+// 去重后返回；失败时写入响应并返回 false
+//
+// 至少需要一项权限：令牌上的权限列表作为 scope 使用，空 scope 表示不做限制。
+func (h *APIKeyHandler) grantablePermissions(w http.ResponseWriter, roles []string, scope string, requested []string) ([]string, bool) {
+	if len(requested) == 0 {
+		respondError(w, http.StatusBadRequest, "at least one permission is required")
+		return nil, false
+	}
+
+	seen := make(map[string]bool, len(requested))
+	permissions := make([]string, 0, len(requested))
+	for _, p := range requested {
+		if seen[p] {
+			continue
+		}
+		perm := rbac.Permission(p)
+		if !h.rbacManager.CheckPermission(roles, perm) || !rbac.ScopeAllows(scope, perm) {
+			respondError(w, http.StatusForbidden, "cannot grant permission not held by the current user: "+p)
+			return nil, false
+		}
+		seen[p] = true
+		permissions = append(permissions, p)
+	}
+	return permissions, true
+}
+
+// newAPIKeyResponse 转换令牌记录，token 为空时不返回明文令牌
+func newAPIKeyResponse(k *apikey.Key, token string) apiKeyResponse {
+	return apiKeyResponse{
+		ID:          k.ID,
+		Name:        k.Name,
+		Prefix:      k.Prefix,
+		Permissions: k.Permissions,
+		CreatedAt:   k.CreatedAt,
+		ExpiresAt:   k.ExpiresAt,
+		LastUsedAt:  k.LastUsedAt,
+		LastUsedIP:  k.LastUsedIP,
+		Token:       token,
+	}
+}
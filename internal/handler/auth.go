@@ -1,24 +1,75 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/jason0730/claude-code-demo/internal/auth/certauth"
+	"github.com/jason0730/claude-code-demo/internal/auth/dpop"
+	"github.com/jason0730/claude-code-demo/internal/auth/federation"
+	"github.com/jason0730/claude-code-demo/internal/auth/identity"
 	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/auth/lockout"
+	"github.com/jason0730/claude-code-demo/internal/auth/mfa"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/auth/refresh"
+	"github.com/jason0730/claude-code-demo/internal/auth/revocation"
+	"github.com/jason0730/claude-code-demo/internal/auth/webauthn"
+	"github.com/jason0730/claude-code-demo/internal/config"
 	"github.com/jason0730/claude-code-demo/internal/model"
 	log "github.com/sirupsen/logrus"
 )
 
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
 // AuthHandler 认证处理器
 type AuthHandler struct {
-	tokenManager *jwt.TokenManager
+	tokenManager   *jwt.TokenManager
+	refreshManager *refresh.Manager
+	revocations    revocation.Store
+	authenticator  identity.Authenticator
+	users          identity.UserStore
+	federation     *federation.Service
+	lockout        *lockout.Guard
+	mfa            *mfa.Service
+	webauthn       *webauthn.Service
+	mfaConfig      *config.MFAConfig
+	mtlsConfig     *config.MTLSConfig
+	dpop           *dpop.Verifier
 }
 
 // NewAuthHandler 创建认证处理器
-func NewAuthHandler(tokenManager *jwt.TokenManager) *AuthHandler {
+func NewAuthHandler(
+	tokenManager *jwt.TokenManager,
+	refreshManager *refresh.Manager,
+	revocations revocation.Store,
+	authenticator identity.Authenticator,
+	users identity.UserStore,
+	federation *federation.Service,
+	lockout *lockout.Guard,
+	mfa *mfa.Service,
+	webauthn *webauthn.Service,
+	mfaConfig *config.MFAConfig,
+	mtlsConfig *config.MTLSConfig,
+	dpopVerifier *dpop.Verifier,
+) *AuthHandler {
 	return &AuthHandler{
-		tokenManager: tokenManager,
+		tokenManager:   tokenManager,
+		refreshManager: refreshManager,
+		revocations:    revocations,
+		authenticator:  authenticator,
+		users:          users,
+		federation:     federation,
+		lockout:        lockout,
+		mfa:            mfa,
+		webauthn:       webauthn,
+		mfaConfig:      mfaConfig,
+		mtlsConfig:     mtlsConfig,
+		dpop:           dpopVerifier,
 	}
 }
 
@@ -30,33 +81,48 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证用户名和密码（这里是示例，实际应该查询数据库）
-	user := h.authenticateUser(req.Username, req.Password)
+	// 验证用户名和密码
+	user, wait := h.authenticateUser(r, req.Username, req.Password)
+	if wait > 0 {
+		respondTooManyAttempts(w, wait)
+		return
+	}
 	if user == nil {
-		log.WithField("username", req.Username).Warn("login failed: invalid credentials")
+		log.WithField("username", req.Username).Warn("login failed")
 		respondError(w, http.StatusUnauthorized, "invalid username or password")
 		return
 	}
 
-	// 生成 token
-	accessToken, refreshToken, err := h.tokenManager.GenerateToken(user)
+	// 启用 MFA 或角色要求 MFA 时返回质询令牌，完成第二因素后才签发令牌
+	amr := []string{amrPassword}
+	challenge, err := h.mfaChallenge(r.Context(), user, amr)
 	if err != nil {
-		log.WithError(err).Error("failed to generate token")
+		log.WithError(err).Error("failed to check mfa")
 		respondError(w, http.StatusInternalServerError, "failed to generate token")
 		return
 	}
+	if challenge != nil {
+		log.WithFields(log.Fields{
+			"user_id": user.ID,
+			"status":  challenge.Status,
+		}).Info("password accepted, mfa challenge issued")
+		respondJSON(w, http.StatusOK, challenge)
+		return
+	}
+
+	// 生成 token，开始新的刷新令牌家族
+	pair, err := h.issueTokens(r, user, jwt.TokenOptions{AuthMethods: amr})
+	if err != nil {
+		respondIssueError(w, err)
+		return
+	}
 
 	log.WithFields(log.Fields{
 		"user_id":  user.ID,
 		"username": user.Username,
 	}).Info("user logged in successfully")
 
-	respondJSON(w, http.StatusOK, model.LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    900, // 15 minutes in seconds
-		TokenType:    "Bearer",
-	})
+	respondJSON(w, http.StatusOK, loginResponse(pair))
 }
 
 // Refresh 刷新令牌
@@ -67,109 +133,294 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pair, user, err := h.rotateRefreshToken(r, req.RefreshToken, "")
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) {
+			respondError(w, http.StatusUnauthorized, "invalid refresh token")
+			return
+		}
+		respondIssueError(w, err)
+		return
+	}
+
+	log.WithField("user_id", user.ID).Info("token refreshed successfully")
+
+	respondJSON(w, http.StatusOK, loginResponse(pair))
+}
+
+// rotateRefreshToken 验证并兑换刷新令牌，在原家族中签发新的令牌对
+//
+// clientID 非空时要求刷新令牌签发给该客户端（OAuth 刷新授权）。
+// 客户端可见的失败统一返回 errInvalidRefreshToken，DPoP 证明无效时返回 dpop.ErrInvalidProof。
+// 绑定了证书或 DPoP 公钥的刷新令牌必须出示同一证书或由同一公钥签名的证明才能兑换。
+func (h *AuthHandler) rotateRefreshToken(r *http.Request, refreshToken, clientID string) (*jwt.TokenPair, *model.User, error) {
 	// 验证刷新令牌
-	userID, err := h.tokenManager.ValidateRefreshToken(req.RefreshToken)
+	claims, err := h.tokenManager.ValidateRefreshToken(refreshToken)
 	if err != nil {
 		log.WithError(err).Warn("invalid refresh token")
-		respondError(w, http.StatusUnauthorized, "invalid refresh token")
-		return
+		return nil, nil, errInvalidRefreshToken
+	}
+	if clientID != "" && claims.ClientID != clientID {
+		log.WithField("client_id", clientID).Warn("refresh token was issued to another client")
+		return nil, nil, errInvalidRefreshToken
 	}
 
-	// 获取用户信息（这里是示例，实际应该查询数据库）
-	user := h.getUserByID(userID)
+	// 在兑换前校验持有证明，无效的证明不会消耗刷新令牌
+	cnf, err := h.confirmation(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bound := claims.Confirmation.CertThumbprint(); bound != "" && certauth.RequestThumbprint(r) != bound {
+		log.WithField("user_id", claims.Subject).Warn("certificate-bound refresh token presented without the bound client certificate")
+		return nil, nil, errInvalidRefreshToken
+	}
+	if bound := claims.Confirmation.KeyThumbprint(); bound != "" && cnf.KeyThumbprint() != bound {
+		log.WithField("user_id", claims.Subject).Warn("DPoP-bound refresh token presented without a proof from the bound key")
+		return nil, nil, errInvalidRefreshToken
+	}
+
+	// 兑换刷新令牌，每个刷新令牌只能使用一次
+	token, err := h.refreshManager.Redeem(r.Context(), claims)
+	if err != nil {
+		if errors.Is(err, refresh.ErrTokenReused) {
+			// 家族中的刷新令牌已被吊销，同时吊销该会话尚未过期的访问令牌
+			if revokeErr := h.revocations.RevokeSession(r.Context(), token.FamilyID, time.Now().Add(h.tokenManager.AccessTokenTTL())); revokeErr != nil {
+				log.WithError(revokeErr).Error("failed to revoke access tokens of reused token family")
+			}
+			log.WithFields(log.Fields{
+				"event":       "refresh_token_reuse",
+				"user_id":     token.UserID,
+				"family_id":   token.FamilyID,
+				"token_id":    token.ID,
+				"used_at":     token.UsedAt,
+				"remote_addr": r.RemoteAddr,
+				"user_agent":  r.UserAgent(),
+			}).Error("security event: refresh token reused, token family revoked")
+		} else {
+			log.WithError(err).Warn("refresh token rejected")
+		}
+		return nil, nil, errInvalidRefreshToken
+	}
+
+	// 重新获取用户信息，角色变更在刷新时生效
+	user := h.getUserByID(r.Context(), token.UserID)
 	if user == nil {
-		respondError(w, http.StatusUnauthorized, "user not found")
+		log.WithField("user_id", token.UserID).Warn("refresh token user not found")
+		return nil, nil, errInvalidRefreshToken
+	}
+
+	// 在原家族中生成新的 token，保留客户端和 scope
+	pair, err := h.issueTokens(r, user, jwt.TokenOptions{
+		FamilyID:     token.FamilyID,
+		ClientID:     claims.ClientID,
+		Scope:        claims.Scope,
+		AuthMethods:  claims.AuthMethods,
+		Confirmation: cnf,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
+
+// Logout 登出当前会话：吊销当前访问令牌和该会话签发的所有令牌
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, _ := authmw.GetClaims(r.Context())
+
+	if claims.ID != "" {
+		if err := h.revocations.RevokeToken(r.Context(), claims.ID, jwt.TimeOf(claims.ExpiresAt)); err != nil {
+			log.WithError(err).Error("failed to revoke access token")
+			respondError(w, http.StatusInternalServerError, "failed to logout")
+			return
+		}
+	}
+	if claims.SessionID != "" {
+		if err := h.revokeSession(r.Context(), claims.SessionID); err != nil {
+			log.WithError(err).Error("failed to revoke session")
+			respondError(w, http.StatusInternalServerError, "failed to logout")
+			return
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":    claims.UserID,
+		"session_id": claims.SessionID,
+	}).Info("user logged out")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll 登出当前用户的所有会话
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	claims, _ := authmw.GetClaims(r.Context())
+
+	if err := h.revokeAllSessions(r.Context(), claims.Subject); err != nil {
+		log.WithError(err).Error("failed to revoke sessions")
+		respondError(w, http.StatusInternalServerError, "failed to logout")
 		return
 	}
 
-	// 生成新的 token
-	accessToken, refreshToken, err := h.tokenManager.GenerateToken(user)
+	log.WithField("user_id", claims.UserID).Info("user logged out of all sessions")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutUser 管理员强制登出指定用户的所有会话
+func (h *AuthHandler) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	claims, _ := authmw.GetClaims(r.Context())
+
+	if err := h.revokeAllSessions(r.Context(), userID); err != nil {
+		log.WithError(err).Error("failed to revoke sessions")
+		respondError(w, http.StatusInternalServerError, "failed to revoke sessions")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"admin_id":  claims.UserID,
+		"target_id": userID,
+	}).Warn("all sessions of user revoked by admin")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAllSessions 吊销用户此前签发的所有访问令牌和刷新令牌
+func (h *AuthHandler) revokeAllSessions(ctx context.Context, userID string) error {
+	expiresAt := time.Now().Add(h.tokenManager.AccessTokenTTL())
+	if err := h.revocations.RevokeSubject(ctx, userID, expiresAt); err != nil {
+		return err
+	}
+	return h.refreshManager.RevokeUser(ctx, userID)
+}
+
+// issueTokens 签发令牌对，记录刷新令牌和请求来源所在的会话
+func (h *AuthHandler) issueTokens(r *http.Request, user *model.User, opts jwt.TokenOptions) (*jwt.TokenPair, error) {
+	if opts.Confirmation == nil {
+		cnf, err := h.confirmation(r)
+		if err != nil {
+			return nil, err
+		}
+		opts.Confirmation = cnf
+	}
+	pair, err := h.tokenManager.GenerateToken(user, opts)
 	if err != nil {
-		log.WithError(err).Error("failed to generate token")
-		respondError(w, http.StatusInternalServerError, "failed to generate token")
+		return nil, err
+	}
+
+	device := refresh.Device{UserAgent: r.UserAgent(), IP: clientIP(r)}
+	if err := h.refreshManager.Register(r.Context(), pair.Refresh, device); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// confirmation 返回新令牌要绑定的持有证明，请求未出示任何证明时返回 nil
+//
+// 启用证书绑定且请求出示了客户端证书时绑定证书指纹；请求携带 DPoP 证明时校验证明并绑定其公钥，
+// 证明无效时返回 dpop.ErrInvalidProof。
+func (h *AuthHandler) confirmation(r *http.Request) (*jwt.Confirmation, error) {
+	var cnf jwt.Confirmation
+	if h.mtlsConfig.BindTokens {
+		cnf.X5TS256 = certauth.RequestThumbprint(r)
+	}
+	if dpop.Present(r) {
+		jkt, err := h.dpop.Verify(r, "")
+		if err != nil {
+			return nil, err
+		}
+		cnf.JKT = jkt
+	}
+
+	if cnf == (jwt.Confirmation{}) {
+		return nil, nil
+	}
+	return &cnf, nil
+}
+
+// respondIssueError 签发令牌失败时的响应：DPoP 证明无效返回 400，其他错误返回 500
+func respondIssueError(w http.ResponseWriter, err error) {
+	if errors.Is(err, dpop.ErrInvalidProof) {
+		log.WithError(err).Warn("DPoP proof rejected")
+		respondError(w, http.StatusBadRequest, "invalid DPoP proof")
 		return
 	}
+	log.WithError(err).Error("failed to generate token")
+	respondError(w, http.StatusInternalServerError, "failed to generate token")
+}
 
-	log.WithField("user_id", userID).Info("token refreshed successfully")
+// tokenType 返回令牌响应中的 token_type：绑定 DPoP 公钥的令牌为 DPoP，其余为 Bearer
+func tokenType(cnf *jwt.Confirmation) string {
+	if cnf.KeyThumbprint() != "" {
+		return dpop.Scheme
+	}
+	return "Bearer"
+}
 
-	respondJSON(w, http.StatusOK, model.LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    900,
-		TokenType:    "Bearer",
-	})
+// loginResponse 将令牌对转换为登录响应
+func loginResponse(pair *jwt.TokenPair) model.LoginResponse {
+	return model.LoginResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
+		TokenType:    tokenType(pair.Refresh.Confirmation),
+	}
 }
 
-// authenticateUser 验证用户（示例实现，实际应该查询数据库）
-func (h *AuthHandler) authenticateUser(username, password string) *model.User {
-	// 这是一个示例用户，实际应该从数据库查询并验证密码哈希
-	// 密码应该使用 bcrypt 等算法加密存储
-	mockUsers := map[string]*model.User{
-		"admin": {
-			ID:       "1",
-			Username: "admin",
-			Email:    "admin@example.com",
-			Password: "admin123", // 实际应该是加密后的密码
-			Roles:    []string{"admin"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		"editor": {
-			ID:       "2",
-			Username: "editor",
-			Email:    "editor@example.com",
-			Password: "editor123",
-			Roles:    []string{"editor"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		"viewer": {
-			ID:       "3",
-			Username: "viewer",
-			Email:    "viewer@example.com",
-			Password: "viewer123",
-			Roles:    []string{"viewer"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-	}
-
-	user, exists := mockUsers[username]
-	if !exists || user.Password != password {
-		return nil
+// authenticateUser 通过身份后端验证用户名和密码
+//
+// 具体失败原因（用户不存在、密码错误、没有角色、后端不可用）只记录在日志中，
+// 调用方统一向客户端返回 401。用户名或来源 IP 失败次数过多时不进行认证，
+// 返回需要等待的时间，调用方应返回 429。
+func (h *AuthHandler) authenticateUser(r *http.Request, username, password string) (*model.User, time.Duration) {
+	ip := clientIP(r)
+	attempt, wait, err := h.lockout.Begin(username, ip)
+	if err != nil {
+		log.WithError(err).WithField("username", username).Error("failed to check login failures")
+		return nil, 0
+	}
+	if wait > 0 {
+		log.WithFields(log.Fields{
+			"username":    username,
+			"remote_addr": ip,
+			"retry_after": wait.String(),
+		}).Warn("login attempt throttled")
+		return nil, wait
 	}
 
-	return user
+	user, err := h.authenticator.Authenticate(r.Context(), username, password)
+	if err == nil {
+		attempt.Succeed()
+		return user, 0
+	}
+
+	fields := log.Fields{
+		"username": username,
+		"reason":   err.Error(),
+	}
+	var failure *identity.Failure
+	if errors.As(err, &failure) {
+		fields["backend"] = failure.Backend
+	}
+
+	if errors.Is(err, identity.ErrUnavailable) {
+		// 后端故障不计入失败次数
+		attempt.Cancel()
+		log.WithFields(fields).Error("authentication failed: identity backend unavailable")
+	} else {
+		attempt.Fail()
+		log.WithFields(fields).Info("authentication rejected")
+	}
+	return nil, 0
 }
 
-// getUserByID 根据 ID 获取用户（示例实现）
-func (h *AuthHandler) getUserByID(userID string) *model.User {
-	mockUsers := map[string]*model.User{
-		"1": {
-			ID:       "1",
-			Username: "admin",
-			Email:    "admin@example.com",
-			Roles:    []string{"admin"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		"2": {
-			ID:       "2",
-			Username: "editor",
-			Email:    "editor@example.com",
-			Roles:    []string{"editor"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		"3": {
-			ID:       "3",
-			Username: "viewer",
-			Email:    "viewer@example.com",
-			Roles:    []string{"viewer"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-	}
-
-	return mockUsers[userID]
+// getUserByID 根据 ID 获取用户
+func (h *AuthHandler) getUserByID(ctx context.Context, userID string) *model.User {
+	user, err := h.users.GetUser(ctx, userID)
+	if err != nil {
+		if !errors.Is(err, identity.ErrUserNotFound) {
+			log.WithError(err).WithField("user_id", userID).Error("user lookup failed")
+		}
+		return nil
+	}
+	return user
 }
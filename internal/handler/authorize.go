@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/authz/abac"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+	log "github.com/sirupsen/logrus"
+)
+
+// objectAuthorizer 对已加载对象的授权：先按对象级策略判定，再由访问策略按资源属性拒绝或额外允许
+type objectAuthorizer struct {
+	rbacManager *rbac.RBACManager
+	policies    *abac.Engine
+	policy      rbac.ObjectPolicy
+}
+
+// authorize 检查当前主体能否对已加载的对象使用权限；拒绝时写入 403 响应并返回 false
+func (a *objectAuthorizer) authorize(w http.ResponseWriter, r *http.Request, permission rbac.Permission, object rbac.Object, resource *abac.Resource) bool {
+	claims, ok := authmw.GetClaims(r.Context())
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return false
+	}
+
+	subject := rbac.Subject{
+		ID:    claims.UserID,
+		Roles: claims.Roles,
+		Scope: claims.Scope,
+	}
+	decision := a.policies.Evaluate(abac.NewRequest(r, claims, permission, resource))
+	if !decision.Allows(a.rbacManager.CheckObjectPermission(a.policy, subject, permission, object)) ||
+		!rbac.ScopeAllows(claims.Scope, permission) {
+		log.WithFields(log.Fields{
+			"user_id":    claims.UserID,
+			"username":   claims.Username,
+			"roles":      claims.Roles,
+			"scope":      claims.Scope,
+			"key_id":     claims.KeyID,
+			"actor":      claims.ActorSubject(),
+			"permission": permission,
+			"object_id":  resource.ID,
+			"owner":      object.OwnerID(),
+			"policy":     decision.RuleID,
+		}).Warn("object permission denied")
+
+		respondError(w, http.StatusForbidden, "insufficient permissions")
+		return false
+	}
+	return true
+}
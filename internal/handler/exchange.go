@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/certauth"
+	"github.com/jason0730/claude-code-demo/internal/auth/client"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/auth/revocation"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// 令牌类型标识（RFC 8693 第 3 节），令牌交换只接受和签发访问令牌
+const tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+var errExchangeScope = errors.New("requested scope exceeds what the exchanged token allows")
+
+// tokenExchange 令牌交换授权（RFC 8693），签发代表其他主体行事、带 act 声明的访问令牌
+//
+// 委托：下游服务以 subject_token 提交用户的访问令牌，新令牌的行为方为 actor_token 的主体，
+// 未提供 actor_token 时为客户端本身。
+// 模拟：支持人员以 actor_token 提交自己的访问令牌，并以 requested_subject 指定用户 ID，
+// 行为方必须拥有 user:impersonate 权限，授予的 scope 不能超出行为方自身的权限。
+//
+// 新令牌的 scope 只包含主体实际拥有、原令牌 scope 与客户端都允许的权限，且总是非空；不签发刷新令牌。
+func (h *OAuthHandler) tokenExchange(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	form := r.PostForm
+	if t := form.Get("requested_token_type"); t != "" && t != tokenTypeAccessToken {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "only access tokens can be requested")
+		return
+	}
+
+	subjectToken := form.Get("subject_token")
+	requestedSubject := form.Get("requested_subject")
+	actorToken := form.Get("actor_token")
+
+	switch {
+	case subjectToken != "" && requestedSubject != "":
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "subject_token and requested_subject are mutually exclusive")
+		return
+	case subjectToken == "" && requestedSubject == "":
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "subject_token is required")
+		return
+	case requestedSubject != "" && actorToken == "":
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "actor_token is required for impersonation")
+		return
+	}
+
+	// 持有证明只能验证一次（DPoP 证明防重放），同时用于校验输入令牌的绑定和绑定新令牌
+	cnf, err := h.auth.confirmation(r)
+	if err != nil {
+		respondOAuthIssueError(w, err)
+		return
+	}
+
+	var actorClaims *jwt.CustomClaims
+	if actorToken != "" {
+		claims, ok := h.exchangeInput(w, r, cnf, actorToken, form.Get("actor_token_type"), "actor")
+		if !ok {
+			return
+		}
+		if claims.IsDelegated() {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "actor_token must not be a delegated token")
+			return
+		}
+		actorClaims = claims
+	}
+
+	// 新令牌的主体：委托时来自 subject_token，模拟时来自用户目录
+	var subject, impersonator *jwt.CustomClaims
+	if subjectToken != "" {
+		claims, ok := h.exchangeInput(w, r, cnf, subjectToken, form.Get("subject_token_type"), "subject")
+		if !ok {
+			return
+		}
+		subject = claims
+	} else {
+		if !h.rbacManager.CheckPermission(actorClaims.Roles, rbac.PermissionUserImpersonate) ||
+			!rbac.ScopeAllows(actorClaims.Scope, rbac.PermissionUserImpersonate) {
+			log.WithFields(log.Fields{
+				"event":     "token_exchange_denied",
+				"client_id": c.ID,
+				"actor":     actorClaims.Subject,
+				"user_id":   requestedSubject,
+			}).Warn("security event: impersonation denied")
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "actor is not allowed to impersonate users")
+			return
+		}
+		user := h.auth.getUserByID(r.Context(), requestedSubject)
+		if user == nil {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "requested subject not found")
+			return
+		}
+		subject = &jwt.CustomClaims{
+			UserID:   user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			Roles:    user.Roles,
+			// 模拟令牌随支持人员的会话一起失效
+			SessionID: actorClaims.SessionID,
+		}
+		subject.Subject = user.ID
+		impersonator = actorClaims
+	}
+
+	scope, err := h.exchangeScope(form.Get("scope"), c, subject, impersonator)
+	if err != nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+
+	// 行为方：提供 actor_token 时为其主体，否则为客户端本身；已有的委托链嵌套在内
+	actor := &jwt.Actor{Subject: c.ID, ClientID: c.ID, Actor: subject.Actor}
+	if actorClaims != nil {
+		actor.Subject = actorClaims.Subject
+		actor.ClientID = actorClaims.ClientID
+	}
+
+	claims := &jwt.CustomClaims{
+		UserID:       subject.UserID,
+		Username:     subject.Username,
+		Email:        subject.Email,
+		Roles:        subject.Roles,
+		SessionID:    subject.SessionID,
+		ClientID:     c.ID,
+		Scope:        scope,
+		AuthMethods:  subject.AuthMethods,
+		Confirmation: cnf,
+		Actor:        actor,
+	}
+	claims.Subject = subject.Subject
+
+	accessToken, err := h.tokenManager.GenerateAccessToken(claims)
+	if err != nil {
+		respondOAuthIssueError(w, err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"event":         "token_exchange",
+		"client_id":     c.ID,
+		"user_id":       subject.UserID,
+		"username":      subject.Username,
+		"actor":         actor.Subject,
+		"impersonation": requestedSubject != "",
+		"scope":         scope,
+	}).Info("security event: token exchanged")
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, model.TokenResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: tokenTypeAccessToken,
+		TokenType:       tokenType(cnf),
+		ExpiresIn:       int64(h.tokenManager.AccessTokenTTL().Seconds()),
+		Scope:           scope,
+	})
+}
+
+// exchangeInput 验证交换请求中的主体或行为方令牌：必须是未吊销的访问令牌，
+// 绑定了持有证明的令牌只能由其持有者交换
+func (h *OAuthHandler) exchangeInput(w http.ResponseWriter, r *http.Request, cnf *jwt.Confirmation, token, tokenTypeParam, role string) (*jwt.CustomClaims, bool) {
+	if tokenTypeParam != tokenTypeAccessToken {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", role+"_token_type must be "+tokenTypeAccessToken)
+		return nil, false
+	}
+
+	claims, err := h.tokenManager.ValidateToken(token)
+	if err != nil {
+		log.WithError(err).WithField("token", role).Warn("token exchange input rejected")
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", role+"_token is invalid")
+		return nil, false
+	}
+
+	revoked, err := revocation.IsAccessTokenRevoked(r.Context(), h.revocations, claims.ID, claims.Subject, claims.SessionID, jwt.TimeOf(claims.IssuedAt))
+	if err != nil {
+		log.WithError(err).Error("failed to check token revocation")
+		respondOAuthError(w, http.StatusServiceUnavailable, "server_error", "")
+		return nil, false
+	}
+	if revoked {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", role+"_token is invalid")
+		return nil, false
+	}
+
+	if thumbprint := claims.Confirmation.CertThumbprint(); thumbprint != "" && thumbprint != certauth.RequestThumbprint(r) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", role+"_token is bound to another client certificate")
+		return nil, false
+	}
+	if jkt := claims.Confirmation.KeyThumbprint(); jkt != "" && jkt != cnf.KeyThumbprint() {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", role+"_token is bound to another DPoP key")
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// exchangeScope 计算交换后令牌的 scope
+//
+// 未请求时取客户端允许的 scope 中主体实际拥有的权限；请求的每一项都必须同时被客户端允许、
+// 主体的角色拥有并在原令牌 scope 之内。模拟时以行为方自身的权限为上限。
+// 结果为空时拒绝，避免签发不受限的令牌。
+func (h *OAuthHandler) exchangeScope(requested string, c *client.Client, subject, impersonator *jwt.CustomClaims) (string, error) {
+	allowed := func(s string) bool {
+		p := rbac.Permission(s)
+		if !h.rbacManager.CheckPermission(subject.Roles, p) || !rbac.ScopeAllows(subject.Scope, p) {
+			return false
+		}
+		if impersonator != nil {
+			return h.rbacManager.CheckPermission(impersonator.Roles, p) && rbac.ScopeAllows(impersonator.Scope, p)
+		}
+		return true
+	}
+
+	var scopes []string
+	if requested == "" {
+		for _, s := range c.Scopes {
+			if allowed(s) {
+				scopes = append(scopes, s)
+			}
+		}
+	} else {
+		granted, err := c.GrantScope(requested)
+		if err != nil {
+			return "", err
+		}
+		for _, s := range strings.Fields(granted) {
+			if !allowed(s) {
+				return "", errExchangeScope
+			}
+			scopes = append(scopes, s)
+		}
+	}
+
+	if len(scopes) == 0 {
+		return "", errExchangeScope
+	}
+	return strings.Join(scopes, " "), nil
+}
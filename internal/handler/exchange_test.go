@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/client"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/model"
+)
+
+// accessToken 为用户签发不经 OAuth 客户端的访问令牌，scope 为空时不额外限制
+func (f *oauthFixture) accessToken(t *testing.T, user *model.User, scope string) string {
+	t.Helper()
+
+	pair, err := f.tokenManager.GenerateToken(user, jwt.TokenOptions{Scope: scope})
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return pair.AccessToken
+}
+
+// exchangeToken 以 gateway 客户端调用令牌交换，成功时返回新令牌的声明，失败时返回 OAuth 错误码
+func (f *oauthFixture) exchangeToken(t *testing.T, form url.Values) (*jwt.CustomClaims, string) {
+	t.Helper()
+
+	form.Set("grant_type", client.GrantTokenExchange)
+	rec := f.post(f.handler.Token, "gateway", "gateway-secret", form)
+	if rec.Code != http.StatusOK {
+		var resp model.OAuthError
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode error response: %v", err)
+		}
+		return nil, resp.Error
+	}
+
+	var resp model.TokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode token response: %v", err)
+	}
+	if resp.IssuedTokenType != tokenTypeAccessToken || resp.RefreshToken != "" {
+		t.Fatalf("token response = %+v, want an access token only", resp)
+	}
+	claims, err := f.tokenManager.ValidateToken(resp.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.Scope != resp.Scope {
+		t.Fatalf("token scope = %q, response scope = %q", claims.Scope, resp.Scope)
+	}
+	return claims, ""
+}
+
+// mustSign 重新签发声明对应的访问令牌，用于把交换结果作为下一次交换的输入
+func mustSign(t *testing.T, f *oauthFixture, claims *jwt.CustomClaims) string {
+	t.Helper()
+
+	token, err := f.tokenManager.GenerateAccessToken(claims)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	return token
+}
+
+// subjectForm 以 subject_token 委托交换的表单
+func subjectForm(token string) url.Values {
+	return url.Values{
+		"subject_token":      {token},
+		"subject_token_type": {tokenTypeAccessToken},
+	}
+}
+
+func TestTokenExchangeDelegation(t *testing.T) {
+	f := newOAuthFixture(t)
+	billing, err := f.tokenManager.GenerateServiceToken("billing", []string{"viewer"}, "", nil)
+	if err != nil {
+		t.Fatalf("GenerateServiceToken: %v", err)
+	}
+
+	// 提供 actor_token 时行为方为其主体
+	form := subjectForm(f.accessToken(t, f.user, ""))
+	form.Set("actor_token", billing)
+	form.Set("actor_token_type", tokenTypeAccessToken)
+	first, errCode := f.exchangeToken(t, form)
+	if errCode != "" {
+		t.Fatalf("exchange error = %s", errCode)
+	}
+	if first.Subject != f.user.ID || first.ClientID != "gateway" || first.ActorSubject() != "billing" || first.Actor.Actor != nil {
+		t.Fatalf("delegated claims = %+v, act = %+v", first, first.Actor)
+	}
+
+	// 再次交换时行为方为客户端本身，原有的行为方嵌套在内
+	second, errCode := f.exchangeToken(t, subjectForm(mustSign(t, f, first)))
+	if errCode != "" {
+		t.Fatalf("second exchange error = %s", errCode)
+	}
+	if second.Subject != f.user.ID || second.ActorSubject() != "gateway" ||
+		second.Actor.Actor == nil || second.Actor.Actor.Subject != "billing" || second.Actor.Actor.Actor != nil {
+		t.Fatalf("nested act = %+v", second.Actor)
+	}
+
+	// 委托令牌不能作为行为方
+	form = subjectForm(f.accessToken(t, f.user, ""))
+	form.Set("actor_token", mustSign(t, f, first))
+	form.Set("actor_token_type", tokenTypeAccessToken)
+	if _, errCode := f.exchangeToken(t, form); errCode != "invalid_grant" {
+		t.Fatalf("delegated actor_token error = %q, want invalid_grant", errCode)
+	}
+}
+
+func TestTokenExchangeScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		subject   string // 主体令牌的 scope
+		requested string
+		want      string
+		errCode   string
+	}{
+		// user 角色拥有 resource:read 和 user:read，客户端还允许 resource:write
+		{name: "default is client and role intersection", want: "resource:read user:read"},
+		{name: "limited by subject token scope", subject: "resource:read", want: "resource:read"},
+		{name: "requested subset", requested: "user:read", want: "user:read"},
+		{name: "requested beyond subject roles", requested: "resource:write", errCode: "invalid_scope"},
+		{name: "requested beyond subject token scope", subject: "resource:read", requested: "user:read", errCode: "invalid_scope"},
+		{name: "requested beyond client", requested: "user:delete", errCode: "invalid_scope"},
+		{name: "empty intersection", subject: "resource:delete", errCode: "invalid_scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOAuthFixture(t)
+			form := subjectForm(f.accessToken(t, f.user, tt.subject))
+			if tt.requested != "" {
+				form.Set("scope", tt.requested)
+			}
+
+			claims, errCode := f.exchangeToken(t, form)
+			if errCode != tt.errCode {
+				t.Fatalf("exchange error = %q, want %q", errCode, tt.errCode)
+			}
+			if errCode == "" && claims.Scope != tt.want {
+				t.Fatalf("scope = %q, want %q", claims.Scope, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenExchangeImpersonation(t *testing.T) {
+	support := &model.User{ID: "support-1", Username: "sam", Roles: []string{"support"}}
+	viewer := &model.User{ID: "viewer-1", Username: "vic", Roles: []string{"viewer"}}
+
+	tests := []struct {
+		name       string
+		actor      *model.User
+		actorScope string
+		requested  string
+		want       string
+		errCode    string
+	}{
+		// support 拥有 user:read、resource:read 和 user:impersonate，主体 user 角色拥有 user:read 和 resource:read
+		{name: "support", actor: support, want: "resource:read user:read"},
+		{name: "limited by actor scope", actor: support, actorScope: "resource:read user:impersonate", want: "resource:read"},
+		{name: "actor without user:impersonate", actor: viewer, errCode: "invalid_grant"},
+		{name: "actor scope without user:impersonate", actor: support, actorScope: "resource:read user:read", errCode: "invalid_grant"},
+		{name: "requested beyond actor scope", actor: support, actorScope: "resource:read user:impersonate", requested: "user:read", errCode: "invalid_scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOAuthFixture(t)
+			form := url.Values{
+				"requested_subject": {f.user.ID},
+				"actor_token":       {f.accessToken(t, tt.actor, tt.actorScope)},
+				"actor_token_type":  {tokenTypeAccessToken},
+			}
+			if tt.requested != "" {
+				form.Set("scope", tt.requested)
+			}
+
+			claims, errCode := f.exchangeToken(t, form)
+			if errCode != tt.errCode {
+				t.Fatalf("exchange error = %q, want %q", errCode, tt.errCode)
+			}
+			if errCode != "" {
+				return
+			}
+			if claims.Subject != f.user.ID || claims.ActorSubject() != tt.actor.ID || claims.Scope != tt.want {
+				t.Fatalf("impersonation claims = %+v, act = %+v", claims, claims.Actor)
+			}
+		})
+	}
+
+	f := newOAuthFixture(t)
+	form := url.Values{
+		"requested_subject": {"missing"},
+		"actor_token":       {f.accessToken(t, support, "")},
+		"actor_token_type":  {tokenTypeAccessToken},
+	}
+	if _, errCode := f.exchangeToken(t, form); errCode != "invalid_grant" {
+		t.Fatalf("unknown requested_subject error = %q, want invalid_grant", errCode)
+	}
+}
+
+func TestTokenExchangeRejectsNonAccessTokens(t *testing.T) {
+	f := newOAuthFixture(t)
+	pair := f.issue(t, "app")
+	idToken, err := f.tokenManager.GenerateIDToken(f.user, "https://api.example.com", "app", pair.AccessToken, jwt.IDTokenClaims{})
+	if err != nil {
+		t.Fatalf("GenerateIDToken: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "refresh token", token: pair.RefreshToken},
+		{name: "id token", token: idToken},
+		{name: "garbage", token: "not-a-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, errCode := f.exchangeToken(t, subjectForm(tt.token)); errCode != "invalid_grant" {
+				t.Fatalf("exchange error = %q, want invalid_grant", errCode)
+			}
+		})
+	}
+
+	// 只签发访问令牌，输入令牌类型必须声明为访问令牌
+	form := subjectForm(f.accessToken(t, f.user, ""))
+	form.Set("subject_token_type", "urn:ietf:params:oauth:token-type:refresh_token")
+	if _, errCode := f.exchangeToken(t, form); errCode != "invalid_request" {
+		t.Fatalf("refresh subject_token_type error = %q, want invalid_request", errCode)
+	}
+	form = subjectForm(f.accessToken(t, f.user, ""))
+	form.Set("requested_token_type", "urn:ietf:params:oauth:token-type:refresh_token")
+	if _, errCode := f.exchangeToken(t, form); errCode != "invalid_request" {
+		t.Fatalf("refresh requested_token_type error = %q, want invalid_request", errCode)
+	}
+}
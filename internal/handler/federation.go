@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jason0730/claude-code-demo/internal/auth/federation"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	log "github.com/sirupsen/logrus"
+)
+
+// federationStateCookie 将联合登录 state 绑定到发起登录的浏览器，防止登录 CSRF
+const federationStateCookie = "federation_state"
+
+// ListProviders 列出可用的外部身份提供方
+func (h *AuthHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"providers": h.federation.Providers(),
+	})
+}
+
+// FederatedLogin 发起联合登录，重定向到上游身份提供方
+func (h *AuthHandler) FederatedLogin(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+
+	authURL, state, err := h.federation.Begin(r.Context(), provider)
+	if err != nil {
+		if errors.Is(err, federation.ErrProviderNotFound) {
+			respondError(w, http.StatusNotFound, "identity provider not found")
+			return
+		}
+		log.WithError(err).WithField("provider", provider).Error("failed to start federated login")
+		respondError(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     federationStateCookie,
+		Value:    state,
+		Path:     "/api/v1/auth/federated/" + provider,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// FederatedCallback 处理上游回调，验证身份后签发本地令牌
+func (h *AuthHandler) FederatedCallback(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+	query := r.URL.Query()
+
+	// 无论成功与否，state 只能使用一次
+	http.SetCookie(w, &http.Cookie{
+		Name:     federationStateCookie,
+		Path:     "/api/v1/auth/federated/" + provider,
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	if upstreamErr := query.Get("error"); upstreamErr != "" {
+		log.WithFields(log.Fields{
+			"provider":          provider,
+			"error":             upstreamErr,
+			"error_description": query.Get("error_description"),
+		}).Warn("federated login rejected by identity provider")
+		respondError(w, http.StatusUnauthorized, "federated login failed")
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(federationStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		log.WithFields(log.Fields{
+			"provider":    provider,
+			"remote_addr": r.RemoteAddr,
+		}).Warn("federated login state does not match browser session")
+		respondError(w, http.StatusBadRequest, "invalid login state")
+		return
+	}
+
+	user, identity, err := h.federation.Complete(r.Context(), provider, state, query.Get("code"))
+	if err != nil {
+		fields := log.Fields{"provider": provider}
+		if identity != nil {
+			fields["subject"] = identity.Subject
+		}
+
+		switch {
+		case errors.Is(err, federation.ErrProviderNotFound):
+			respondError(w, http.StatusNotFound, "identity provider not found")
+		case errors.Is(err, federation.ErrStateNotFound):
+			log.WithFields(fields).Warn("federated login failed: unknown or expired state")
+			respondError(w, http.StatusBadRequest, "invalid login state")
+		case errors.Is(err, federation.ErrNoRoles):
+			log.WithFields(fields).Warn("federated login denied: no role mapping matched")
+			respondError(w, http.StatusForbidden, "account is not authorized to use this service")
+		case errors.Is(err, federation.ErrInvalidIDToken):
+			log.WithError(err).WithFields(fields).Warn("federated login failed: invalid id token")
+			respondError(w, http.StatusUnauthorized, "federated login failed")
+		default:
+			log.WithError(err).WithFields(fields).Error("federated login failed")
+			respondError(w, http.StatusBadGateway, "identity provider unavailable")
+		}
+		return
+	}
+
+	// 本地 MFA 同样适用于联合登录用户
+	challenge, err := h.mfaChallenge(r.Context(), user, nil)
+	if err != nil {
+		log.WithError(err).Error("failed to check mfa")
+		respondError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	if challenge != nil {
+		w.Header().Set("Cache-Control", "no-store")
+		respondJSON(w, http.StatusOK, challenge)
+		return
+	}
+
+	pair, err := h.issueTokens(r, user, jwt.TokenOptions{})
+	if err != nil {
+		respondIssueError(w, err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"provider": provider,
+		"subject":  identity.Subject,
+		"roles":    user.Roles,
+	}).Info("user logged in via federated identity provider")
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, loginResponse(pair))
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+// KeyHandler 签名密钥处理器
+type KeyHandler struct {
+	tokenManager *jwt.TokenManager
+}
+
+// NewKeyHandler 创建签名密钥处理器
+func NewKeyHandler(tokenManager *jwt.TokenManager) *KeyHandler {
+	return &KeyHandler{
+		tokenManager: tokenManager,
+	}
+}
+
+// JWKS 发布用于验证令牌的公钥（/.well-known/jwks.json）
+func (h *KeyHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, http.StatusOK, h.tokenManager.JWKS())
+}
+
+// ListKeys 列出所有签名密钥的元数据
+func (h *KeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.tokenManager.Keys())
+}
+
+// RotateKey 生成并启用新的签名密钥，旧密钥保留用于验证；未配置 JWT_KEY_DIR 时返回 409
+func (h *KeyHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	claims, _ := authmw.GetClaims(r.Context())
+
+	info, err := h.tokenManager.RotateKey()
+	if errors.Is(err, jwt.ErrRotationUnsupported) {
+		respondError(w, http.StatusConflict, "key rotation requires JWT_KEY_DIR; rotate the configured key instead")
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to rotate signing key")
+		respondError(w, http.StatusInternalServerError, "failed to rotate signing key")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"user_id": claims.UserID,
+		"kid":     info.ID,
+		"alg":     info.Algorithm,
+	}).Info("signing key rotated")
+
+	respondJSON(w, http.StatusCreated, info)
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/config"
+)
+
+func TestRotateKeyWithoutKeyDir(t *testing.T) {
+	tm, err := jwt.NewTokenManager(&config.AuthConfig{
+		JWTSecret:         "test-secret",
+		JWTExpiration:     time.Minute,
+		RefreshExpiration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewTokenManager: %v", err)
+	}
+	h := NewKeyHandler(tm)
+
+	rec := httptest.NewRecorder()
+	h.RotateKey(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/keys/rotate", nil))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+	if keys := tm.Keys(); len(keys) != 1 {
+		t.Fatalf("Keys() = %+v, want the configured key only", keys)
+	}
+}
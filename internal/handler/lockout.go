@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jason0730/claude-code-demo/internal/auth/lockout"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListLockouts 列出登录失败计数中和被锁定的用户名、IP
+func (h *AuthHandler) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	locks, err := h.lockout.Locks()
+	if err != nil {
+		log.WithError(err).Error("failed to list lockouts")
+		respondError(w, http.StatusInternalServerError, "failed to list lockouts")
+		return
+	}
+	respondJSON(w, http.StatusOK, locks)
+}
+
+// Unlock 管理员解除用户名或 IP 的登录锁定
+func (h *AuthHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scope := lockout.Scope(vars["scope"])
+	key := vars["key"]
+	claims, _ := authmw.GetClaims(r.Context())
+
+	if scope != lockout.ScopeUser && scope != lockout.ScopeIP {
+		respondError(w, http.StatusBadRequest, "scope must be user or ip")
+		return
+	}
+
+	found, err := h.lockout.Unlock(scope, key)
+	if err != nil {
+		log.WithError(err).Error("failed to clear lockout")
+		respondError(w, http.StatusInternalServerError, "failed to clear lockout")
+		return
+	}
+	if !found {
+		respondError(w, http.StatusNotFound, "no lockout found")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"event":    "login_unlock",
+		"scope":    scope,
+		"key":      key,
+		"admin_id": claims.UserID,
+	}).Warn("security event: login lockout cleared by admin")
+
+	w.WriteHeader(http.StatusNoContent)
+}
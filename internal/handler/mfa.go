@@ -0,0 +1,524 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/auth/mfa"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/auth/webauthn"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// 登录质询状态
+const (
+	statusMFARequired           = "mfa_required"
+	statusMFAEnrollmentRequired = "mfa_enrollment_required"
+)
+
+// 认证方式（RFC 8176）
+const (
+	amrPassword = "pwd"
+	amrMFA      = "mfa"
+)
+
+var (
+	errInvalidChallenge = errors.New("invalid or expired challenge")
+	errInvalidMFACode   = errors.New("invalid mfa code")
+)
+
+// VerifyMFA 提交质询令牌和验证码（TOTP 或恢复码），换取正式令牌
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req model.MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, amr, wait, err := h.completeMFA(r, req.ChallengeToken, req.Code)
+	if wait > 0 {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+
+	pair, err := h.issueTokens(r, user, jwt.TokenOptions{AuthMethods: amr})
+	if err != nil {
+		respondIssueError(w, err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"amr":      amr,
+	}).Info("user logged in successfully")
+
+	respondJSON(w, http.StatusOK, loginResponse(pair))
+}
+
+// EnrollMFA 使用登记质询令牌开始登记 TOTP（角色要求 MFA 但尚未登记的用户）
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	var req model.MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	_, user, err := h.parseChallenge(r.Context(), req.ChallengeToken, jwt.ChallengeMFAEnroll)
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+	if h.phishingResistantRequired(user) {
+		h.respondMFAError(w, errPhishingResistantRequired)
+		return
+	}
+
+	h.beginMFA(w, r, user)
+}
+
+// ConfirmMFAEnrollment 使用登记质询令牌和第一个验证码完成登记，返回恢复码和正式令牌
+func (h *AuthHandler) ConfirmMFAEnrollment(w http.ResponseWriter, r *http.Request) {
+	var req model.MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	claims, user, err := h.parseChallenge(r.Context(), req.ChallengeToken, jwt.ChallengeMFAEnroll)
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+	if h.phishingResistantRequired(user) {
+		h.respondMFAError(w, errPhishingResistantRequired)
+		return
+	}
+
+	codes, wait, err := h.confirmMFA(r, user, req.Code)
+	if wait > 0 {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+	h.consumeChallenge(r.Context(), claims)
+
+	amr := append(append([]string(nil), claims.AuthMethods...), mfa.MethodOTP, amrMFA)
+	pair, err := h.issueTokens(r, user, jwt.TokenOptions{AuthMethods: amr})
+	if err != nil {
+		respondIssueError(w, err)
+		return
+	}
+
+	resp := loginResponse(pair)
+	respondJSON(w, http.StatusOK, model.MFAEnrollResponse{
+		RecoveryCodes: codes,
+		LoginResponse: &resp,
+	})
+}
+
+// GetMFAStatus 查询当前用户的 MFA 状态
+func (h *AuthHandler) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.mfa.Status(r.Context(), user.ID)
+	if err != nil {
+		log.WithError(err).Error("failed to get mfa status")
+		respondError(w, http.StatusInternalServerError, "failed to get mfa status")
+		return
+	}
+	respondJSON(w, http.StatusOK, status)
+}
+
+// BeginMFA 当前用户开始登记 TOTP，返回密钥和 otpauth:// URI
+func (h *AuthHandler) BeginMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	h.beginMFA(w, r, user)
+}
+
+// ConfirmMFA 当前用户用第一个验证码确认登记，返回恢复码
+func (h *AuthHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	codes, wait, err := h.confirmMFA(r, user, req.Code)
+	if wait > 0 {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.MFAEnrollResponse{RecoveryCodes: codes})
+}
+
+// DisableMFA 当前用户提交有效验证码后关闭 TOTP；角色要求 MFA 且没有其他第二因素时不允许关闭
+func (h *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	passkeys, err := h.webauthn.Credentials(r.Context(), user.ID)
+	if err != nil {
+		log.WithError(err).Error("failed to list webauthn credentials")
+		respondError(w, http.StatusInternalServerError, "failed to disable mfa")
+		return
+	}
+	if !h.canRemoveFactor(user, false, len(passkeys)) {
+		respondError(w, http.StatusForbidden, "mfa is required for your role")
+		return
+	}
+
+	ip := clientIP(r)
+	attempt, wait, err := h.lockout.Begin(user.Username, ip)
+	if err != nil {
+		log.WithError(err).Error("failed to check login failures")
+		respondError(w, http.StatusInternalServerError, "failed to disable mfa")
+		return
+	}
+	if wait > 0 {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	if _, err := h.mfa.Verify(r.Context(), user.ID, req.Code); err != nil {
+		if errors.Is(err, mfa.ErrInvalidCode) {
+			attempt.Fail()
+			err = errInvalidMFACode
+		} else {
+			attempt.Cancel()
+		}
+		h.respondMFAError(w, err)
+		return
+	}
+	attempt.Succeed()
+
+	if err := h.mfa.Disable(r.Context(), user.ID); err != nil {
+		log.WithError(err).Error("failed to disable mfa")
+		respondError(w, http.StatusInternalServerError, "failed to disable mfa")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"event":       "mfa_disabled",
+		"user_id":     user.ID,
+		"remote_addr": ip,
+	}).Warn("security event: mfa disabled by user")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetMFA 管理员删除用户的 TOTP 登记和全部 WebAuthn 凭证（如用户丢失设备）；角色要求 MFA 的用户下次登录时需重新登记
+func (h *AuthHandler) ResetMFA(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	claims, _ := authmw.GetClaims(r.Context())
+
+	if err := h.mfa.Disable(r.Context(), userID); err != nil {
+		log.WithError(err).Error("failed to reset mfa")
+		respondError(w, http.StatusInternalServerError, "failed to reset mfa")
+		return
+	}
+	if err := h.webauthn.RemoveAll(r.Context(), userID); err != nil {
+		log.WithError(err).Error("failed to reset mfa")
+		respondError(w, http.StatusInternalServerError, "failed to reset mfa")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"event":     "mfa_reset",
+		"admin_id":  claims.UserID,
+		"target_id": userID,
+	}).Warn("security event: mfa reset by admin")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mfaChallenge 判断用户是否需要第二因素，需要时签发质询令牌；不需要时返回 nil
+func (h *AuthHandler) mfaChallenge(ctx context.Context, user *model.User, amr []string) (*model.MFAChallengeResponse, error) {
+	methods, err := h.secondFactors(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	purpose, status := jwt.ChallengeMFA, statusMFARequired
+	if len(methods) == 0 {
+		if !h.mfaRequired(user) {
+			return nil, nil
+		}
+		purpose, status = jwt.ChallengeMFAEnroll, statusMFAEnrollmentRequired
+		methods = []string{methodWebAuthn}
+		if !h.phishingResistantRequired(user) {
+			methods = []string{methodTOTP, methodWebAuthn}
+		}
+	}
+
+	ttl := h.mfaConfig.ChallengeExpiration
+	token, err := h.tokenManager.GenerateChallengeToken(user.ID, ttl, jwt.ChallengeClaims{
+		Purpose:     purpose,
+		AuthMethods: amr,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.MFAChallengeResponse{
+		Status:         status,
+		ChallengeToken: token,
+		ExpiresIn:      int64(ttl.Seconds()),
+		Methods:        methods,
+	}, nil
+}
+
+// secondFactors 列出用户已登记且其角色接受的第二因素；要求防钓鱼认证的角色只接受 WebAuthn
+func (h *AuthHandler) secondFactors(ctx context.Context, user *model.User) ([]string, error) {
+	totp, err := h.mfa.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	passkey, err := h.webauthn.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var methods []string
+	if totp && !h.phishingResistantRequired(user) {
+		methods = append(methods, methodTOTP)
+	}
+	if passkey {
+		methods = append(methods, methodWebAuthn)
+	}
+	return methods, nil
+}
+
+// challengeMethods 返回质询令牌对应用户可用的第二因素，质询无效时返回 nil
+func (h *AuthHandler) challengeMethods(ctx context.Context, token string) []string {
+	_, user, err := h.parseChallenge(ctx, token, jwt.ChallengeMFA)
+	if err != nil {
+		return nil
+	}
+	methods, err := h.secondFactors(ctx, user)
+	if err != nil {
+		log.WithError(err).Warn("failed to list second factors")
+	}
+	return methods
+}
+
+// mfaRequired 判断用户的角色是否要求启用 MFA；要求防钓鱼认证的角色同样要求 MFA
+func (h *AuthHandler) mfaRequired(user *model.User) bool {
+	return hasAnyRole(user, h.mfaConfig.RequiredRoles) || h.phishingResistantRequired(user)
+}
+
+// phishingResistantRequired 判断用户的角色是否要求使用 WebAuthn 作为第二因素
+func (h *AuthHandler) phishingResistantRequired(user *model.User) bool {
+	return hasAnyRole(user, h.mfaConfig.PhishingResistantRoles)
+}
+
+// canRemoveFactor 判断删除一个第二因素后，剩余的因素是否仍满足角色的要求
+func (h *AuthHandler) canRemoveFactor(user *model.User, totpRemaining bool, passkeysRemaining int) bool {
+	switch {
+	case h.phishingResistantRequired(user):
+		return passkeysRemaining > 0
+	case h.mfaRequired(user):
+		return totpRemaining || passkeysRemaining > 0
+	default:
+		return true
+	}
+}
+
+// hasAnyRole 判断用户是否拥有任一角色
+func hasAnyRole(user *model.User, roles []string) bool {
+	for _, required := range roles {
+		for _, role := range user.Roles {
+			if role == required {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// completeMFA 校验质询令牌和验证码，成功后使质询令牌失效，返回用户和完整的认证方式
+func (h *AuthHandler) completeMFA(r *http.Request, token, code string) (*model.User, []string, time.Duration, error) {
+	claims, user, err := h.parseChallenge(r.Context(), token, jwt.ChallengeMFA)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if h.phishingResistantRequired(user) {
+		return nil, nil, 0, errPhishingResistantRequired
+	}
+
+	ip := clientIP(r)
+	attempt, wait, err := h.lockout.Begin(user.Username, ip)
+	if err != nil || wait > 0 {
+		return nil, nil, wait, err
+	}
+
+	method, err := h.mfa.Verify(r.Context(), user.ID, code)
+	if err != nil {
+		if !errors.Is(err, mfa.ErrInvalidCode) && !errors.Is(err, mfa.ErrNotEnrolled) {
+			attempt.Cancel()
+			return nil, nil, 0, err
+		}
+		attempt.Fail()
+		log.WithFields(log.Fields{
+			"user_id":     user.ID,
+			"remote_addr": ip,
+		}).Info("mfa verification failed")
+		return nil, nil, 0, errInvalidMFACode
+	}
+	attempt.Succeed()
+	h.consumeChallenge(r.Context(), claims)
+
+	amr := append([]string(nil), claims.AuthMethods...)
+	if method == mfa.MethodOTP {
+		amr = append(amr, mfa.MethodOTP)
+	} else {
+		log.WithFields(log.Fields{
+			"event":       "mfa_recovery_code_used",
+			"user_id":     user.ID,
+			"remote_addr": ip,
+		}).Warn("security event: mfa recovery code used")
+	}
+	return user, append(amr, amrMFA), 0, nil
+}
+
+// confirmMFA 用第一个验证码确认登记，失败计入登录失败次数
+func (h *AuthHandler) confirmMFA(r *http.Request, user *model.User, code string) ([]string, time.Duration, error) {
+	ip := clientIP(r)
+	attempt, wait, err := h.lockout.Begin(user.Username, ip)
+	if err != nil || wait > 0 {
+		return nil, wait, err
+	}
+
+	codes, err := h.mfa.Confirm(r.Context(), user.ID, code)
+	if err != nil {
+		if errors.Is(err, mfa.ErrInvalidCode) {
+			attempt.Fail()
+			return nil, 0, errInvalidMFACode
+		}
+		attempt.Cancel()
+		return nil, 0, err
+	}
+	attempt.Succeed()
+
+	log.WithFields(log.Fields{
+		"event":       "mfa_enabled",
+		"user_id":     user.ID,
+		"remote_addr": ip,
+	}).Info("security event: mfa enabled")
+	return codes, 0, nil
+}
+
+// beginMFA 开始登记 TOTP
+func (h *AuthHandler) beginMFA(w http.ResponseWriter, r *http.Request, user *model.User) {
+	setup, err := h.mfa.Begin(r.Context(), user.ID, user.Username)
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, setup)
+}
+
+// parseChallenge 验证质询令牌的用途、是否已使用，并重新加载用户
+func (h *AuthHandler) parseChallenge(ctx context.Context, token, purpose string) (*jwt.ChallengeClaims, *model.User, error) {
+	claims, err := h.tokenManager.ValidateChallengeToken(token)
+	if err != nil || claims.Purpose != purpose {
+		return nil, nil, errInvalidChallenge
+	}
+
+	revoked, err := h.revocations.IsRevoked(ctx, claims.ID, claims.Subject, jwt.TimeOf(claims.IssuedAt))
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		return nil, nil, errInvalidChallenge
+	}
+
+	user := h.getUserByID(ctx, claims.Subject)
+	if user == nil {
+		return nil, nil, errInvalidChallenge
+	}
+	return claims, user, nil
+}
+
+// consumeChallenge 使质询令牌失效，每个质询只能换取一次令牌
+func (h *AuthHandler) consumeChallenge(ctx context.Context, claims *jwt.ChallengeClaims) {
+	if err := h.revocations.RevokeToken(ctx, claims.ID, jwt.TimeOf(claims.ExpiresAt)); err != nil {
+		log.WithError(err).Warn("failed to revoke mfa challenge")
+	}
+}
+
+// currentUser 加载访问令牌对应的用户，服务主体没有 MFA
+func (h *AuthHandler) currentUser(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	claims, _ := authmw.GetClaims(r.Context())
+	if claims.IsService() {
+		respondError(w, http.StatusForbidden, "not available for service principals")
+		return nil, false
+	}
+
+	user := h.getUserByID(r.Context(), claims.Subject)
+	if user == nil {
+		respondError(w, http.StatusNotFound, "user not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// respondMFAError 将 MFA 错误映射为 HTTP 响应
+func (h *AuthHandler) respondMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidChallenge):
+		respondError(w, http.StatusUnauthorized, "invalid or expired challenge")
+	case errors.Is(err, errInvalidMFACode):
+		respondError(w, http.StatusUnauthorized, "invalid mfa code")
+	case errors.Is(err, errWebAuthnFailed):
+		respondError(w, http.StatusUnauthorized, "webauthn verification failed")
+	case errors.Is(err, errPhishingResistantRequired):
+		respondError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, webauthn.ErrCredentialExists):
+		respondError(w, http.StatusConflict, "credential already registered")
+	case errors.Is(err, mfa.ErrAlreadyEnabled):
+		respondError(w, http.StatusConflict, "mfa already enabled")
+	case errors.Is(err, mfa.ErrNotEnrolled):
+		respondError(w, http.StatusBadRequest, "mfa enrollment not started")
+	default:
+		log.WithError(err).Error("mfa operation failed")
+		respondError(w, http.StatusInternalServerError, "mfa operation failed")
+	}
+}
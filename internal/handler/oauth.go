@@ -0,0 +1,370 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/authcode"
+	"github.com/jason0730/claude-code-demo/internal/auth/client"
+	"github.com/jason0730/claude-code-demo/internal/auth/dpop"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/auth/refresh"
+	"github.com/jason0730/claude-code-demo/internal/auth/revocation"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+	"github.com/jason0730/claude-code-demo/internal/config"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// 令牌类型提示（RFC 7009 / RFC 7662）
+const (
+	tokenTypeHintAccess  = "access_token"
+	tokenTypeHintRefresh = "refresh_token"
+)
+
+// OAuthHandler OAuth 2.0 / OpenID Connect 端点处理器
+type OAuthHandler struct {
+	config         *config.OAuthConfig
+	tokenManager   *jwt.TokenManager
+	refreshManager *refresh.Manager
+	revocations    revocation.Store
+	clients        client.Registry
+	codes          authcode.Store
+	auth           *AuthHandler // 用户认证与令牌签发与登录接口共用
+	rbacManager    *rbac.RBACManager
+}
+
+// NewOAuthHandler 创建 OAuth 2.0 / OpenID Connect 端点处理器
+func NewOAuthHandler(
+	cfg *config.OAuthConfig,
+	tokenManager *jwt.TokenManager,
+	refreshManager *refresh.Manager,
+	revocations revocation.Store,
+	clients client.Registry,
+	codes authcode.Store,
+	auth *AuthHandler,
+	rbacManager *rbac.RBACManager,
+) *OAuthHandler {
+	return &OAuthHandler{
+		config:         cfg,
+		tokenManager:   tokenManager,
+		refreshManager: refreshManager,
+		revocations:    revocations,
+		clients:        clients,
+		codes:          codes,
+		auth:           auth,
+		rbacManager:    rbacManager,
+	}
+}
+
+// Token OAuth 2.0 令牌端点，按 grant_type 分发
+func (h *OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	if !c.AllowsGrant(grantType) {
+		respondOAuthError(w, http.StatusBadRequest, "unauthorized_client", "grant type not allowed for client")
+		return
+	}
+
+	switch grantType {
+	case client.GrantClientCredentials:
+		h.clientCredentials(w, r, c)
+	case client.GrantAuthorizationCode:
+		h.authorizationCode(w, r, c)
+	case client.GrantRefreshToken:
+		h.refreshToken(w, r, c)
+	case client.GrantTokenExchange:
+		h.tokenExchange(w, r, c)
+	default:
+		respondOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+// clientCredentials 客户端凭证授权（RFC 6749 第 4.4 节），为服务本身签发访问令牌
+func (h *OAuthHandler) clientCredentials(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	scope, err := c.GrantScope(r.PostForm.Get("scope"))
+	if err != nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+
+	cnf, err := h.auth.confirmation(r)
+	if err != nil {
+		respondOAuthIssueError(w, err)
+		return
+	}
+
+	accessToken, err := h.tokenManager.GenerateServiceToken(c.ID, c.Roles, scope, cnf)
+	if err != nil {
+		log.WithError(err).Error("failed to generate service token")
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"client_id": c.ID,
+		"scope":     scope,
+		"roles":     c.Roles,
+	}).Info("service token issued")
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, model.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   tokenType(cnf),
+		ExpiresIn:   int64(h.tokenManager.AccessTokenTTL().Seconds()),
+		Scope:       scope,
+	})
+}
+
+// Introspect 令牌内省（RFC 7662），返回令牌是否有效及其声明，仅限机密客户端
+func (h *OAuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	if c.Public {
+		respondOAuthError(w, http.StatusUnauthorized, "invalid_client", "public clients cannot introspect tokens")
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	resp, err := h.introspect(r.Context(), token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		log.WithError(err).Error("token introspection failed")
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"client_id": c.ID,
+		"active":    resp.Active,
+		"sub":       resp.Sub,
+	}).Debug("token introspected")
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// Revoke 令牌吊销（RFC 7009）；无效或未知令牌同样返回 200
+func (h *OAuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	revoked, err := h.revoke(r.Context(), c, token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		log.WithError(err).Error("token revocation failed")
+		respondOAuthError(w, http.StatusServiceUnavailable, "server_error", "")
+		return
+	}
+
+	if revoked {
+		log.WithField("client_id", c.ID).Info("token revoked by client")
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// introspect 依次尝试按访问令牌和刷新令牌解析，顺序由 hint 决定
+func (h *OAuthHandler) introspect(ctx context.Context, token, hint string) (*model.IntrospectionResponse, error) {
+	inactive := &model.IntrospectionResponse{Active: false}
+
+	if hint != tokenTypeHintRefresh {
+		if claims, err := h.tokenManager.ValidateToken(token); err == nil {
+			return h.introspectAccess(ctx, claims)
+		}
+	}
+
+	if claims, err := h.tokenManager.ValidateRefreshToken(token); err == nil {
+		active, err := h.refreshManager.Active(ctx, claims)
+		if err != nil || !active {
+			return inactive, err
+		}
+		return &model.IntrospectionResponse{
+			Active:    true,
+			Sub:       claims.Subject,
+			Iss:       claims.Issuer,
+			Jti:       claims.ID,
+			Exp:       jwt.UnixOf(claims.ExpiresAt),
+			Iat:       jwt.UnixOf(claims.IssuedAt),
+			SessionID: claims.FamilyID,
+		}, nil
+	}
+
+	if hint == tokenTypeHintRefresh {
+		if claims, err := h.tokenManager.ValidateToken(token); err == nil {
+			return h.introspectAccess(ctx, claims)
+		}
+	}
+
+	return inactive, nil
+}
+
+// introspectAccess 生成访问令牌的内省结果，已吊销的令牌视为无效
+func (h *OAuthHandler) introspectAccess(ctx context.Context, claims *jwt.CustomClaims) (*model.IntrospectionResponse, error) {
+	revoked, err := revocation.IsAccessTokenRevoked(ctx, h.revocations, claims.ID, claims.Subject, claims.SessionID, jwt.TimeOf(claims.IssuedAt))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return &model.IntrospectionResponse{Active: false}, nil
+	}
+
+	return &model.IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Username,
+		TokenType: tokenType(claims.Confirmation),
+		Exp:       jwt.UnixOf(claims.ExpiresAt),
+		Iat:       jwt.UnixOf(claims.IssuedAt),
+		Nbf:       jwt.UnixOf(claims.NotBefore),
+		Sub:       claims.Subject,
+		Aud:       claims.Audience,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		Email:     claims.Email,
+		Roles:     claims.Roles,
+		SessionID: claims.SessionID,
+		Cnf:       confirmationClaim(claims.Confirmation),
+		Act:       actorClaim(claims.Actor),
+	}, nil
+}
+
+// revoke 吊销访问令牌（按 jti）或刷新令牌（整个家族）
+//
+// 签发给其他客户端的令牌不会被吊销（RFC 7009 第 2.1 节），但按 RFC 7009 仍返回成功，
+// 不向请求方透露令牌属于哪个客户端。
+func (h *OAuthHandler) revoke(ctx context.Context, c *client.Client, token, hint string) (bool, error) {
+	revokeAccess := func() (bool, bool, error) {
+		claims, err := h.tokenManager.ValidateToken(token)
+		if err != nil || claims.ID == "" {
+			return false, false, nil
+		}
+		if claims.ClientID != "" && claims.ClientID != c.ID {
+			return true, false, nil
+		}
+		return true, true, h.revocations.RevokeToken(ctx, claims.ID, jwt.TimeOf(claims.ExpiresAt))
+	}
+
+	if hint != tokenTypeHintRefresh {
+		if matched, revoked, err := revokeAccess(); matched {
+			return revoked, err
+		}
+	}
+
+	if claims, err := h.tokenManager.ValidateRefreshToken(token); err == nil {
+		if claims.ClientID != "" && claims.ClientID != c.ID {
+			log.WithFields(log.Fields{
+				"event":     "token_revocation_client_mismatch",
+				"client_id": c.ID,
+				"user_id":   claims.Subject,
+			}).Warn("security event: client tried to revoke a refresh token issued to another client")
+			return false, nil
+		}
+		return true, h.refreshManager.RevokeFamily(ctx, claims.FamilyID)
+	}
+
+	if hint == tokenTypeHintRefresh {
+		_, revoked, err := revokeAccess()
+		return revoked, err
+	}
+
+	return false, nil
+}
+
+// authenticateClient 使用 HTTP Basic（client_secret_basic）或表单参数（client_secret_post）认证客户端
+func (h *OAuthHandler) authenticateClient(w http.ResponseWriter, r *http.Request) (*client.Client, bool) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return nil, false
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		// RFC 6749 第 2.3.1 节要求凭证先经过 form-urlencoded 编码
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	c, err := client.Authenticate(r.Context(), h.clients, id, secret)
+	if err != nil {
+		log.WithError(err).WithField("client_id", id).Warn("client authentication failed")
+		w.Header().Set("WWW-Authenticate", `Basic realm="api-server"`)
+		respondOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return nil, false
+	}
+
+	return c, true
+}
+
+// respondOAuthError 返回 OAuth 2.0 错误响应
+func respondOAuthError(w http.ResponseWriter, code int, errCode, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, code, model.OAuthError{
+		Error:            errCode,
+		ErrorDescription: description,
+	})
+}
+
+// confirmationClaim 将持有证明转换为内省响应中的 cnf 成员，未绑定时返回 nil
+func confirmationClaim(c *jwt.Confirmation) map[string]string {
+	cnf := make(map[string]string)
+	if thumbprint := c.CertThumbprint(); thumbprint != "" {
+		cnf["x5t#S256"] = thumbprint
+	}
+	if jkt := c.KeyThumbprint(); jkt != "" {
+		cnf["jkt"] = jkt
+	}
+	if len(cnf) == 0 {
+		return nil
+	}
+	return cnf
+}
+
+// actorClaim 将委托链转换为内省响应中的 act 成员，不是委托令牌时返回 nil
+func actorClaim(a *jwt.Actor) map[string]interface{} {
+	if a == nil {
+		return nil
+	}
+	act := map[string]interface{}{"sub": a.Subject}
+	if a.ClientID != "" {
+		act["client_id"] = a.ClientID
+	}
+	if a.Actor != nil {
+		act["act"] = actorClaim(a.Actor)
+	}
+	return act
+}
+
+// respondOAuthIssueError 令牌端点签发失败时的响应：DPoP 证明无效返回 invalid_dpop_proof（RFC 9449 第 5 节）
+func respondOAuthIssueError(w http.ResponseWriter, err error) {
+	if errors.Is(err, dpop.ErrInvalidProof) {
+		log.WithError(err).Warn("DPoP proof rejected")
+		respondOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", "")
+		return
+	}
+	log.WithError(err).Error("failed to generate token")
+	respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+}
@@ -0,0 +1,452 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/authcode"
+	"github.com/jason0730/claude-code-demo/internal/auth/client"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/auth/refresh"
+	"github.com/jason0730/claude-code-demo/internal/auth/revocation"
+	"github.com/jason0730/claude-code-demo/internal/auth/session"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+	"github.com/jason0730/claude-code-demo/internal/config"
+	"github.com/jason0730/claude-code-demo/internal/model"
+)
+
+// testRedirectURI 测试客户端注册的回调地址
+const testRedirectURI = "https://app.example.com/callback"
+
+// oauthFixture OAuth 端点及其依赖，注册了机密客户端 app、other、只能交换令牌的 gateway 和公开客户端 spa
+type oauthFixture struct {
+	handler        *OAuthHandler
+	auth           *AuthHandler
+	tokenManager   *jwt.TokenManager
+	refreshManager *refresh.Manager
+	revocations    revocation.Store
+	codes          *authcode.MemoryStore
+	user           *model.User
+}
+
+func newOAuthFixture(t *testing.T) *oauthFixture {
+	t.Helper()
+
+	tokenManager, err := jwt.NewTokenManager(&config.AuthConfig{
+		JWTSecret:         "test-secret",
+		JWTExpiration:     15 * time.Minute,
+		RefreshExpiration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewTokenManager: %v", err)
+	}
+	grants := []string{client.GrantAuthorizationCode, client.GrantRefreshToken}
+	redirects := []string{testRedirectURI}
+	clients := client.NewStaticRegistry([]*client.Client{
+		{ID: "app", SecretHash: client.HashSecret("app-secret"), GrantTypes: grants, RedirectURIs: redirects},
+		{ID: "other", SecretHash: client.HashSecret("other-secret"), GrantTypes: grants, RedirectURIs: redirects},
+		{ID: "spa", Public: true, GrantTypes: grants, RedirectURIs: redirects},
+		{
+			ID:         "gateway",
+			SecretHash: client.HashSecret("gateway-secret"),
+			GrantTypes: []string{client.GrantTokenExchange},
+			Scopes:     []string{"resource:read", "resource:write", "user:read"},
+		},
+	})
+
+	f := &oauthFixture{
+		tokenManager:   tokenManager,
+		refreshManager: refresh.NewManager(refresh.NewMemoryStore(), session.NewMemoryStore()),
+		revocations:    revocation.NewMemoryStore(),
+		codes:          authcode.NewMemoryStore(),
+		user:           &model.User{ID: "user-1", Username: "alice", Email: "alice@example.com", Roles: []string{"user"}},
+	}
+	f.auth = NewAuthHandler(tokenManager, f.refreshManager, f.revocations, nil, fakeDirectory{f.user.ID: f.user},
+		nil, nil, nil, nil, &config.MFAConfig{}, &config.MTLSConfig{}, nil)
+	f.handler = NewOAuthHandler(
+		&config.OAuthConfig{Issuer: "https://api.example.com", AuthCodeExpiration: time.Minute},
+		tokenManager, f.refreshManager, f.revocations, clients, f.codes,
+		f.auth, rbac.NewRBACManager(rbac.NewMemoryStore()),
+	)
+	return f
+}
+
+// issue 为 clientID 签发并登记一对令牌
+func (f *oauthFixture) issue(t *testing.T, clientID string) *jwt.TokenPair {
+	t.Helper()
+
+	pair, err := f.tokenManager.GenerateToken(f.user, jwt.TokenOptions{ClientID: clientID, Scope: "openid"})
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if err := f.refreshManager.Register(context.Background(), pair.Refresh, refresh.Device{}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	return pair
+}
+
+// post 以 client_secret_basic 认证调用 OAuth 端点；secret 为空时以公开客户端身份提交 client_id
+func (f *oauthFixture) post(endpoint http.HandlerFunc, clientID, secret string, form url.Values) *httptest.ResponseRecorder {
+	if secret == "" {
+		form.Set("client_id", clientID)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/oauth", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+	rec := httptest.NewRecorder()
+	endpoint(rec, req)
+	return rec
+}
+
+// accessRevoked 访问令牌是否已被吊销
+func (f *oauthFixture) accessRevoked(t *testing.T, token string) bool {
+	t.Helper()
+
+	claims, err := f.tokenManager.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	revoked, err := revocation.IsAccessTokenRevoked(context.Background(), f.revocations,
+		claims.ID, claims.Subject, claims.SessionID, jwt.TimeOf(claims.IssuedAt))
+	if err != nil {
+		t.Fatalf("IsAccessTokenRevoked: %v", err)
+	}
+	return revoked
+}
+
+// refreshActive 刷新令牌是否仍可使用
+func (f *oauthFixture) refreshActive(t *testing.T, token string) bool {
+	t.Helper()
+
+	claims, err := f.tokenManager.ValidateRefreshToken(token)
+	if err != nil {
+		t.Fatalf("ValidateRefreshToken: %v", err)
+	}
+	active, err := f.refreshManager.Active(context.Background(), claims)
+	if err != nil {
+		t.Fatalf("Active: %v", err)
+	}
+	return active
+}
+
+func TestRevokeChecksClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		refresh bool
+		hint    string
+		client  string
+		secret  string
+		revoked bool
+	}{
+		{name: "access token by owner", client: "app", secret: "app-secret", revoked: true},
+		{name: "access token by owner with refresh hint", hint: "refresh_token", client: "app", secret: "app-secret", revoked: true},
+		{name: "access token by another client", client: "other", secret: "other-secret"},
+		{name: "access token by public client", client: "spa"},
+		{name: "refresh token by owner", refresh: true, client: "app", secret: "app-secret", revoked: true},
+		{name: "refresh token by owner with hint", refresh: true, hint: "refresh_token", client: "app", secret: "app-secret", revoked: true},
+		{name: "refresh token by another client", refresh: true, client: "other", secret: "other-secret"},
+		{name: "refresh token by another client with hint", refresh: true, hint: "refresh_token", client: "other", secret: "other-secret"},
+		{name: "refresh token by public client", refresh: true, client: "spa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOAuthFixture(t)
+			pair := f.issue(t, "app")
+
+			token := pair.AccessToken
+			if tt.refresh {
+				token = pair.RefreshToken
+			}
+			form := url.Values{"token": {token}}
+			if tt.hint != "" {
+				form.Set("token_type_hint", tt.hint)
+			}
+
+			// RFC 7009：无论是否吊销都返回 200，不透露令牌属于哪个客户端
+			rec := f.post(f.handler.Revoke, tt.client, tt.secret, form)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+
+			if tt.refresh {
+				if active := f.refreshActive(t, pair.RefreshToken); active == tt.revoked {
+					t.Fatalf("refresh token active = %v, want %v", active, !tt.revoked)
+				}
+				if f.accessRevoked(t, pair.AccessToken) {
+					t.Fatal("revoking a refresh token revoked the access token by jti")
+				}
+				return
+			}
+			if revoked := f.accessRevoked(t, pair.AccessToken); revoked != tt.revoked {
+				t.Fatalf("access token revoked = %v, want %v", revoked, tt.revoked)
+			}
+			if !f.refreshActive(t, pair.RefreshToken) {
+				t.Fatal("revoking an access token revoked the refresh token family")
+			}
+		})
+	}
+}
+
+// testVerifier 测试授权码绑定的 PKCE code_verifier
+const testVerifier = "dBjftJeZ4CVP-mJ92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+// saveCode 为 app 保存一个绑定 testVerifier 的授权码
+func (f *oauthFixture) saveCode(t *testing.T, expiresAt time.Time) string {
+	t.Helper()
+
+	id, err := authcode.NewCode()
+	if err != nil {
+		t.Fatalf("NewCode: %v", err)
+	}
+	sum := sha256.Sum256([]byte(testVerifier))
+	code := &authcode.Code{
+		Code:                id,
+		ClientID:            "app",
+		RedirectURI:         testRedirectURI,
+		UserID:              f.user.ID,
+		Scope:               "resource:read",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: authcode.MethodS256,
+		AuthTime:            time.Now(),
+		ExpiresAt:           expiresAt,
+	}
+	if err := f.codes.Save(context.Background(), code); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return code.Code
+}
+
+// exchange 以授权码授权调用令牌端点，返回状态码和 OAuth 错误码
+func (f *oauthFixture) exchange(t *testing.T, clientID, secret, code, redirectURI, verifier string) (int, string) {
+	t.Helper()
+
+	form := url.Values{
+		"grant_type":   {client.GrantAuthorizationCode},
+		"code":         {code},
+		"redirect_uri": {redirectURI},
+	}
+	if verifier != "" {
+		form.Set("code_verifier", verifier)
+	}
+	rec := f.post(f.handler.Token, clientID, secret, form)
+
+	var resp model.OAuthError
+	if rec.Code != http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode error response: %v", err)
+		}
+	}
+	return rec.Code, resp.Error
+}
+
+func TestAuthorizationCodeExchange(t *testing.T) {
+	f := newOAuthFixture(t)
+
+	code := f.saveCode(t, time.Now().Add(time.Minute))
+	if status, errCode := f.exchange(t, "app", "app-secret", code, testRedirectURI, testVerifier); status != http.StatusOK {
+		t.Fatalf("exchange = %d %s, want %d", status, errCode, http.StatusOK)
+	}
+
+	// 授权码只能兑换一次
+	if status, errCode := f.exchange(t, "app", "app-secret", code, testRedirectURI, testVerifier); status != http.StatusBadRequest || errCode != "invalid_grant" {
+		t.Fatalf("second exchange = %d %s, want %d invalid_grant", status, errCode, http.StatusBadRequest)
+	}
+}
+
+func TestAuthorizationCodeExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      string
+		secret      string
+		redirectURI string
+		verifier    string
+		expired     bool
+	}{
+		{name: "another client", client: "other", secret: "other-secret", redirectURI: testRedirectURI, verifier: testVerifier},
+		{name: "different redirect_uri", client: "app", secret: "app-secret", redirectURI: testRedirectURI + "/other", verifier: testVerifier},
+		{name: "missing redirect_uri", client: "app", secret: "app-secret", verifier: testVerifier},
+		{name: "missing code_verifier", client: "app", secret: "app-secret", redirectURI: testRedirectURI},
+		{name: "wrong code_verifier", client: "app", secret: "app-secret", redirectURI: testRedirectURI, verifier: strings.Repeat("a", 43)},
+		{name: "challenge sent as verifier", client: "app", secret: "app-secret", redirectURI: testRedirectURI, verifier: "ngF5GsXcbwljx6u133FFr3Xht9xooA_DuaX_3QwODtc"},
+		{name: "expired", client: "app", secret: "app-secret", redirectURI: testRedirectURI, verifier: testVerifier, expired: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOAuthFixture(t)
+			expiresAt := time.Now().Add(time.Minute)
+			if tt.expired {
+				expiresAt = time.Now().Add(-time.Second)
+			}
+			code := f.saveCode(t, expiresAt)
+
+			status, errCode := f.exchange(t, tt.client, tt.secret, code, tt.redirectURI, tt.verifier)
+			if status != http.StatusBadRequest || errCode != "invalid_grant" {
+				t.Fatalf("exchange = %d %s, want %d invalid_grant", status, errCode, http.StatusBadRequest)
+			}
+
+			// 失败的兑换同样消耗授权码，截获者无法反复尝试
+			status, errCode = f.exchange(t, "app", "app-secret", code, testRedirectURI, testVerifier)
+			if status != http.StatusBadRequest || errCode != "invalid_grant" {
+				t.Fatalf("exchange after rejected attempt = %d %s, want %d invalid_grant", status, errCode, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// refresh 调用 /api/v1/auth/refresh 兑换刷新令牌
+func (f *oauthFixture) refresh(t *testing.T, token string) (int, model.LoginResponse) {
+	t.Helper()
+
+	body, _ := json.Marshal(model.RefreshRequest{RefreshToken: token})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	f.auth.Refresh(rec, req)
+
+	var resp model.LoginResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode refresh response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	f := newOAuthFixture(t)
+	pair := f.issue(t, "")
+
+	status, rotated := f.refresh(t, pair.RefreshToken)
+	if status != http.StatusOK || rotated.RefreshToken == "" || rotated.RefreshToken == pair.RefreshToken {
+		t.Fatalf("refresh = %d %+v, want a new refresh token", status, rotated)
+	}
+	if f.accessRevoked(t, rotated.AccessToken) {
+		t.Fatal("rotated access token is revoked before reuse")
+	}
+
+	// 重放已兑换的刷新令牌：拒绝，并吊销整个家族和该会话签发的访问令牌
+	if status, _ := f.refresh(t, pair.RefreshToken); status != http.StatusUnauthorized {
+		t.Fatalf("replayed refresh = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if f.refreshActive(t, rotated.RefreshToken) {
+		t.Fatal("rotated refresh token is still active after reuse")
+	}
+	if status, _ := f.refresh(t, rotated.RefreshToken); status != http.StatusUnauthorized {
+		t.Fatalf("refresh with the rotated token after reuse = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if !f.accessRevoked(t, rotated.AccessToken) || !f.accessRevoked(t, pair.AccessToken) {
+		t.Fatal("access tokens of the reused family are still valid")
+	}
+}
+
+// refreshGrant 以 refresh_token 授权调用令牌端点，返回状态码、OAuth 错误码和新的刷新令牌
+func (f *oauthFixture) refreshGrant(t *testing.T, clientID, secret, token string) (int, string, string) {
+	t.Helper()
+
+	rec := f.post(f.handler.Token, clientID, secret, url.Values{
+		"grant_type":    {client.GrantRefreshToken},
+		"refresh_token": {token},
+	})
+	if rec.Code != http.StatusOK {
+		var resp model.OAuthError
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode error response: %v", err)
+		}
+		return rec.Code, resp.Error, ""
+	}
+	var resp model.TokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode token response: %v", err)
+	}
+	return rec.Code, "", resp.RefreshToken
+}
+
+func TestRefreshGrantChecksClientAndReuse(t *testing.T) {
+	f := newOAuthFixture(t)
+	pair := f.issue(t, "app")
+
+	// 其他客户端不能兑换，失败的尝试不消耗刷新令牌
+	if status, errCode, _ := f.refreshGrant(t, "other", "other-secret", pair.RefreshToken); status != http.StatusBadRequest || errCode != "invalid_grant" {
+		t.Fatalf("refresh by another client = %d %s, want %d invalid_grant", status, errCode, http.StatusBadRequest)
+	}
+	if status, _ := f.refresh(t, pair.RefreshToken); status != http.StatusOK {
+		t.Fatalf("refresh after a rejected client = %d, want %d", status, http.StatusOK)
+	}
+
+	// 上面的兑换已使用令牌，客户端再次兑换被识别为重用
+	if status, errCode, _ := f.refreshGrant(t, "app", "app-secret", pair.RefreshToken); status != http.StatusBadRequest || errCode != "invalid_grant" {
+		t.Fatalf("replayed refresh grant = %d %s, want %d invalid_grant", status, errCode, http.StatusBadRequest)
+	}
+	if !f.accessRevoked(t, pair.AccessToken) {
+		t.Fatal("access token of the reused family is still valid")
+	}
+
+	// 新的登录不受影响
+	fresh := f.issue(t, "app")
+	status, errCode, rotated := f.refreshGrant(t, "app", "app-secret", fresh.RefreshToken)
+	if status != http.StatusOK || rotated == "" {
+		t.Fatalf("refresh grant = %d %s, want %d", status, errCode, http.StatusOK)
+	}
+	if !f.refreshActive(t, rotated) || f.refreshActive(t, fresh.RefreshToken) {
+		t.Fatal("refresh grant did not rotate the refresh token")
+	}
+}
+
+// introspect 调用内省端点，返回状态码和内省结果
+func (f *oauthFixture) introspect(t *testing.T, clientID, secret, token string) (int, model.IntrospectionResponse) {
+	t.Helper()
+
+	rec := f.post(f.handler.Introspect, clientID, secret, url.Values{"token": {token}})
+	var resp model.IntrospectionResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode introspection response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestIntrospectChecksClient(t *testing.T) {
+	f := newOAuthFixture(t)
+	pair := f.issue(t, "app")
+
+	// 公开客户端没有密钥，不能内省令牌
+	if status, _ := f.introspect(t, "spa", "", pair.AccessToken); status != http.StatusUnauthorized {
+		t.Fatalf("introspect by public client = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := f.introspect(t, "app", "wrong-secret", pair.AccessToken); status != http.StatusUnauthorized {
+		t.Fatalf("introspect with a wrong secret = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	status, resp := f.introspect(t, "other", "other-secret", pair.AccessToken)
+	if status != http.StatusOK || !resp.Active || resp.ClientID != "app" || resp.Sub != f.user.ID {
+		t.Fatalf("introspect access token = %d %+v", status, resp)
+	}
+	if status, resp := f.introspect(t, "app", "app-secret", pair.RefreshToken); status != http.StatusOK || !resp.Active || resp.SessionID != pair.Refresh.FamilyID {
+		t.Fatalf("introspect refresh token = %d %+v", status, resp)
+	}
+
+	// 其他客户端吊销无效，令牌仍为活动状态；所属客户端吊销后变为无效
+	f.post(f.handler.Revoke, "other", "other-secret", url.Values{"token": {pair.AccessToken}})
+	if _, resp := f.introspect(t, "app", "app-secret", pair.AccessToken); !resp.Active {
+		t.Fatal("access token revoked by another client")
+	}
+	f.post(f.handler.Revoke, "app", "app-secret", url.Values{"token": {pair.RefreshToken}})
+	if _, resp := f.introspect(t, "app", "app-secret", pair.RefreshToken); resp.Active {
+		t.Fatal("refresh token is active after revocation by its client")
+	}
+	if _, resp := f.introspect(t, "app", "app-secret", "not-a-token"); resp.Active {
+		t.Fatal("unknown token is active")
+	}
+}
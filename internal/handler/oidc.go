@@ -0,0 +1,532 @@
+package handler
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jason0730/claude-code-demo/internal/auth/authcode"
+	"github.com/jason0730/claude-code-demo/internal/auth/client"
+	"github.com/jason0730/claude-code-demo/internal/auth/dpop"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// OpenID Connect 标准 scope
+const (
+	scopeOpenID  = "openid"
+	scopeProfile = "profile"
+	scopeEmail   = "email"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var authorizeTemplate = template.Must(template.ParseFS(templateFS, "templates/authorize.html"))
+
+// authorizeRequest 已校验的授权请求
+type authorizeRequest struct {
+	client              *client.Client
+	redirectURI         string
+	scope               string
+	state               string
+	nonce               string
+	codeChallenge       string
+	codeChallengeMethod string
+}
+
+// authorizeError 授权请求错误；redirect 为 false 时不能回调客户端，只能展示错误页
+type authorizeError struct {
+	code        string
+	description string
+	redirect    bool
+}
+
+// authorizePage 登录/授权页面数据
+type authorizePage struct {
+	Fatal      bool
+	Error      string
+	ClientName string
+	Scopes     []string
+	Params     map[string]string
+	Username   string
+
+	ChallengeToken string // 非空时显示第二因素输入
+	TOTP           bool   // 第二因素可使用验证码
+	WebAuthn       bool   // 第二因素可使用通行密钥
+}
+
+// Authorize 授权端点（GET 展示登录/授权页面，POST 提交登录并签发授权码）
+func (h *OAuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.renderAuthorize(w, http.StatusBadRequest, authorizePage{Fatal: true, Error: "invalid request"})
+		return
+	}
+
+	req, authErr := h.parseAuthorizeRequest(r)
+	if authErr != nil {
+		if !authErr.redirect {
+			h.renderAuthorize(w, http.StatusBadRequest, authorizePage{Fatal: true, Error: authErr.description})
+			return
+		}
+		h.redirectAuthorize(w, r, req, url.Values{
+			"error":             {authErr.code},
+			"error_description": {authErr.description},
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.renderAuthorize(w, http.StatusOK, h.authorizePage(req, "", ""))
+		return
+	}
+
+	if r.PostForm.Get("action") != "allow" {
+		log.WithField("client_id", req.client.ID).Info("authorization denied by user")
+		h.redirectAuthorize(w, r, req, url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	var (
+		user *model.User
+		amr  []string
+	)
+	challenge := r.PostForm.Get("challenge_token")
+	switch {
+	case r.PostForm.Get("webauthn_credential") != "":
+		user, amr = h.authorizeWebAuthn(w, r, req, challenge)
+	case challenge != "":
+		user, amr = h.authorizeMFA(w, r, req, challenge)
+	default:
+		user, amr = h.authorizeLogin(w, r, req)
+	}
+	if user == nil {
+		return
+	}
+
+	code, err := authcode.NewCode()
+	if err != nil {
+		log.WithError(err).Error("failed to generate authorization code")
+		h.redirectAuthorize(w, r, req, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	now := time.Now()
+	err = h.codes.Save(r.Context(), &authcode.Code{
+		Code:                code,
+		ClientID:            req.client.ID,
+		RedirectURI:         req.redirectURI,
+		UserID:              user.ID,
+		Scope:               req.scope,
+		Nonce:               req.nonce,
+		CodeChallenge:       req.codeChallenge,
+		CodeChallengeMethod: req.codeChallengeMethod,
+		AuthTime:            now,
+		AuthMethods:         amr,
+		ExpiresAt:           now.Add(h.config.AuthCodeExpiration),
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to save authorization code")
+		h.redirectAuthorize(w, r, req, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":   user.ID,
+		"client_id": req.client.ID,
+		"scope":     req.scope,
+	}).Info("authorization code issued")
+
+	h.redirectAuthorize(w, r, req, url.Values{"code": {code}})
+}
+
+// authorizeLogin 校验登录表单中的用户名和密码；需要第二因素时展示验证码页面并返回 nil
+func (h *OAuthHandler) authorizeLogin(w http.ResponseWriter, r *http.Request, req *authorizeRequest) (*model.User, []string) {
+	username := r.PostForm.Get("username")
+	user, wait := h.auth.authenticateUser(r, username, r.PostForm.Get("password"))
+	if wait > 0 {
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		h.renderAuthorize(w, http.StatusTooManyRequests, h.authorizePage(req, username, "too many failed login attempts, try again later"))
+		return nil, nil
+	}
+	if user == nil {
+		log.WithFields(log.Fields{
+			"username":  username,
+			"client_id": req.client.ID,
+		}).Warn("authorization login failed")
+		h.renderAuthorize(w, http.StatusUnauthorized, h.authorizePage(req, username, "invalid username or password"))
+		return nil, nil
+	}
+
+	amr := []string{amrPassword}
+	challenge, err := h.auth.mfaChallenge(r.Context(), user, amr)
+	if err != nil {
+		log.WithError(err).Error("failed to check mfa")
+		h.redirectAuthorize(w, r, req, url.Values{"error": {"server_error"}})
+		return nil, nil
+	}
+	if challenge == nil {
+		return user, amr
+	}
+
+	if challenge.Status == statusMFAEnrollmentRequired {
+		log.WithFields(log.Fields{
+			"user_id":   user.ID,
+			"client_id": req.client.ID,
+		}).Warn("authorization denied: mfa enrollment required")
+		h.renderAuthorize(w, http.StatusForbidden, authorizePage{
+			Fatal: true,
+			Error: "multi-factor authentication must be set up before signing in to applications",
+		})
+		return nil, nil
+	}
+
+	h.renderAuthorize(w, http.StatusOK, h.mfaPage(req, challenge.ChallengeToken, challenge.Methods, ""))
+	return nil, nil
+}
+
+// authorizeMFA 校验第二因素验证码；质询失效时回到登录表单
+func (h *OAuthHandler) authorizeMFA(w http.ResponseWriter, r *http.Request, req *authorizeRequest, challenge string) (*model.User, []string) {
+	user, amr, wait, err := h.auth.completeMFA(r, challenge, r.PostForm.Get("code"))
+	return h.authorizeSecondFactor(w, r, req, challenge, user, amr, wait, err)
+}
+
+// authorizeWebAuthn 校验通行密钥认证结果；challenge 为空时为无密码登录
+func (h *OAuthHandler) authorizeWebAuthn(w http.ResponseWriter, r *http.Request, req *authorizeRequest, challenge string) (*model.User, []string) {
+	user, amr, wait, err := h.auth.completeWebAuthn(r, challenge,
+		r.PostForm.Get("webauthn_ceremony"), json.RawMessage(r.PostForm.Get("webauthn_credential")))
+	if challenge != "" {
+		return h.authorizeSecondFactor(w, r, req, challenge, user, amr, wait, err)
+	}
+
+	switch {
+	case wait > 0:
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		h.renderAuthorize(w, http.StatusTooManyRequests, h.authorizePage(req, "", "too many failed login attempts, try again later"))
+	case errors.Is(err, errWebAuthnFailed), errors.Is(err, errInvalidChallenge):
+		h.renderAuthorize(w, http.StatusUnauthorized, h.authorizePage(req, "", "passkey sign-in failed"))
+	case err != nil:
+		log.WithError(err).Error("webauthn verification failed")
+		h.redirectAuthorize(w, r, req, url.Values{"error": {"server_error"}})
+	default:
+		return user, amr
+	}
+	return nil, nil
+}
+
+// authorizeSecondFactor 处理第二因素的校验结果，失败时重新展示第二因素页面
+func (h *OAuthHandler) authorizeSecondFactor(w http.ResponseWriter, r *http.Request, req *authorizeRequest, challenge string,
+	user *model.User, amr []string, wait time.Duration, err error) (*model.User, []string) {
+	methods := h.auth.challengeMethods(r.Context(), challenge)
+
+	switch {
+	case wait > 0:
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		h.renderAuthorize(w, http.StatusTooManyRequests, h.mfaPage(req, challenge, methods, "too many failed attempts, try again later"))
+	case errors.Is(err, errInvalidMFACode):
+		h.renderAuthorize(w, http.StatusUnauthorized, h.mfaPage(req, challenge, methods, "invalid verification code"))
+	case errors.Is(err, errWebAuthnFailed):
+		h.renderAuthorize(w, http.StatusUnauthorized, h.mfaPage(req, challenge, methods, "security key verification failed"))
+	case errors.Is(err, errPhishingResistantRequired):
+		h.renderAuthorize(w, http.StatusForbidden, h.mfaPage(req, challenge, methods, err.Error()))
+	case errors.Is(err, errInvalidChallenge):
+		h.renderAuthorize(w, http.StatusUnauthorized, h.authorizePage(req, "", "sign-in expired, please sign in again"))
+	case err != nil:
+		log.WithError(err).Error("mfa verification failed")
+		h.redirectAuthorize(w, r, req, url.Values{"error": {"server_error"}})
+	default:
+		return user, amr
+	}
+	return nil, nil
+}
+
+// mfaPage 生成第二因素页面数据
+func (h *OAuthHandler) mfaPage(req *authorizeRequest, challenge string, methods []string, errMsg string) authorizePage {
+	page := h.authorizePage(req, "", errMsg)
+	page.ChallengeToken = challenge
+	for _, m := range methods {
+		switch m {
+		case methodTOTP:
+			page.TOTP = true
+		case methodWebAuthn:
+			page.WebAuthn = true
+		}
+	}
+	return page
+}
+
+// parseAuthorizeRequest 校验授权请求参数
+//
+// client_id 或 redirect_uri 无效时不得回调，其余错误按 RFC 6749 第 4.1.2.1 节回调客户端。
+func (h *OAuthHandler) parseAuthorizeRequest(r *http.Request) (*authorizeRequest, *authorizeError) {
+	c, err := h.clients.Get(r.Context(), r.Form.Get("client_id"))
+	if err != nil {
+		return nil, &authorizeError{code: "invalid_request", description: "unknown client"}
+	}
+
+	redirectURI := r.Form.Get("redirect_uri")
+	if !c.ValidRedirectURI(redirectURI) {
+		return nil, &authorizeError{code: "invalid_request", description: "redirect_uri is not registered for this client"}
+	}
+
+	req := &authorizeRequest{
+		client:              c,
+		redirectURI:         redirectURI,
+		state:               r.Form.Get("state"),
+		nonce:               r.Form.Get("nonce"),
+		codeChallenge:       r.Form.Get("code_challenge"),
+		codeChallengeMethod: r.Form.Get("code_challenge_method"),
+	}
+
+	if !c.AllowsGrant(client.GrantAuthorizationCode) {
+		return req, &authorizeError{code: "unauthorized_client", description: "authorization_code grant not allowed", redirect: true}
+	}
+	if r.Form.Get("response_type") != "code" {
+		return req, &authorizeError{code: "unsupported_response_type", description: "only response_type=code is supported", redirect: true}
+	}
+	if err := authcode.ValidateChallenge(req.codeChallenge, req.codeChallengeMethod); err != nil {
+		return req, &authorizeError{code: "invalid_request", description: "PKCE with code_challenge_method=S256 is required", redirect: true}
+	}
+
+	scope, err := c.GrantScope(r.Form.Get("scope"))
+	if err != nil {
+		return req, &authorizeError{code: "invalid_scope", description: err.Error(), redirect: true}
+	}
+	req.scope = scope
+
+	return req, nil
+}
+
+// authorizePage 生成登录/授权页面数据，授权请求参数以隐藏字段回传
+func (h *OAuthHandler) authorizePage(req *authorizeRequest, username, errMsg string) authorizePage {
+	name := req.client.Name
+	if name == "" {
+		name = req.client.ID
+	}
+
+	return authorizePage{
+		Error:      errMsg,
+		ClientName: name,
+		Scopes:     strings.Fields(req.scope),
+		Username:   username,
+		Params: map[string]string{
+			"response_type":         "code",
+			"client_id":             req.client.ID,
+			"redirect_uri":          req.redirectURI,
+			"scope":                 req.scope,
+			"state":                 req.state,
+			"nonce":                 req.nonce,
+			"code_challenge":        req.codeChallenge,
+			"code_challenge_method": req.codeChallengeMethod,
+		},
+	}
+}
+
+// renderAuthorize 渲染登录/授权页面，禁止被嵌入框架和缓存
+func (h *OAuthHandler) renderAuthorize(w http.ResponseWriter, code int, page authorizePage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.WriteHeader(code)
+
+	if err := authorizeTemplate.Execute(w, page); err != nil {
+		log.WithError(err).Error("failed to render authorize page")
+	}
+}
+
+// redirectAuthorize 携带结果参数回调客户端 redirect_uri
+func (h *OAuthHandler) redirectAuthorize(w http.ResponseWriter, r *http.Request, req *authorizeRequest, params url.Values) {
+	target, err := url.Parse(req.redirectURI)
+	if err != nil {
+		h.renderAuthorize(w, http.StatusBadRequest, authorizePage{Fatal: true, Error: "invalid redirect_uri"})
+		return
+	}
+
+	query := target.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	if req.state != "" {
+		query.Set("state", req.state)
+	}
+	// RFC 9207：在响应中标识签发者，防止混淆攻击
+	query.Set("iss", h.config.Issuer)
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// authorizationCode 授权码授权（RFC 6749 第 4.1.3 节 + RFC 7636 PKCE）
+func (h *OAuthHandler) authorizationCode(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	code, err := h.codes.Consume(r.Context(), r.PostForm.Get("code"))
+	if err != nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+		return
+	}
+
+	if code.ClientID != c.ID || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		log.WithField("client_id", c.ID).Warn("authorization code presented by wrong client or redirect_uri")
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code was not issued to this client")
+		return
+	}
+
+	if err := authcode.VerifyPKCE(code.CodeChallenge, code.CodeChallengeMethod, r.PostForm.Get("code_verifier")); err != nil {
+		log.WithError(err).WithField("client_id", c.ID).Warn("PKCE verification failed")
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	user := h.auth.getUserByID(r.Context(), code.UserID)
+	if user == nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "user not found")
+		return
+	}
+
+	pair, err := h.auth.issueTokens(r, user, jwt.TokenOptions{
+		ClientID:    c.ID,
+		Scope:       code.Scope,
+		AuthMethods: code.AuthMethods,
+	})
+	if err != nil {
+		respondOAuthIssueError(w, err)
+		return
+	}
+
+	resp := model.TokenResponse{
+		AccessToken: pair.AccessToken,
+		TokenType:   tokenType(pair.Refresh.Confirmation),
+		ExpiresIn:   pair.ExpiresIn,
+		Scope:       code.Scope,
+	}
+	if c.AllowsGrant(client.GrantRefreshToken) {
+		resp.RefreshToken = pair.RefreshToken
+	}
+
+	if hasScope(code.Scope, scopeOpenID) {
+		idClaims := jwt.IDTokenClaims{
+			Nonce:       code.Nonce,
+			AuthTime:    code.AuthTime.Unix(),
+			AuthMethods: code.AuthMethods,
+		}
+		if hasScope(code.Scope, scopeProfile) {
+			idClaims.PreferredUsername = user.Username
+			idClaims.Roles = user.Roles
+		}
+		if hasScope(code.Scope, scopeEmail) {
+			idClaims.Email = user.Email
+			idClaims.EmailVerified = &user.EmailVerified
+		}
+
+		resp.IDToken, err = h.tokenManager.GenerateIDToken(user, h.config.Issuer, c.ID, pair.AccessToken, idClaims)
+		if err != nil {
+			log.WithError(err).Error("failed to generate id token")
+			respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":   user.ID,
+		"client_id": c.ID,
+		"scope":     code.Scope,
+	}).Info("authorization code exchanged")
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// refreshToken 刷新令牌授权（RFC 6749 第 6 节），刷新令牌必须签发给当前客户端
+func (h *OAuthHandler) refreshToken(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	pair, _, err := h.auth.rotateRefreshToken(r, r.PostForm.Get("refresh_token"), c.ID)
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+		respondOAuthIssueError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, model.TokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    tokenType(pair.Refresh.Confirmation),
+		ExpiresIn:    pair.ExpiresIn,
+		RefreshToken: pair.RefreshToken,
+		Scope:        pair.Refresh.Scope,
+	})
+}
+
+// UserInfo OpenID Connect UserInfo 端点，返回内容由访问令牌的 scope 决定
+func (h *OAuthHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	claims, _ := authmw.GetClaims(r.Context())
+
+	if !hasScope(claims.Scope, scopeOpenID) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		respondOAuthError(w, http.StatusForbidden, "insufficient_scope", "openid scope is required")
+		return
+	}
+
+	info := map[string]interface{}{
+		"sub": claims.Subject,
+	}
+	if hasScope(claims.Scope, scopeProfile) {
+		info["preferred_username"] = claims.Username
+		info["roles"] = claims.Roles
+	}
+	if hasScope(claims.Scope, scopeEmail) {
+		info["email"] = claims.Email
+		if user := h.auth.getUserByID(r.Context(), claims.Subject); user != nil {
+			info["email_verified"] = user.EmailVerified
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, info)
+}
+
+// Discovery OpenID Connect 发现文档（/.well-known/openid-configuration）
+func (h *OAuthHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := strings.TrimSuffix(h.config.Issuer, "/")
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                         issuer,
+		"authorization_endpoint":                         issuer + "/oauth/authorize",
+		"token_endpoint":                                 issuer + "/oauth/token",
+		"userinfo_endpoint":                              issuer + "/userinfo",
+		"jwks_uri":                                       issuer + "/.well-known/jwks.json",
+		"introspection_endpoint":                         issuer + "/oauth/introspect",
+		"revocation_endpoint":                            issuer + "/oauth/revoke",
+		"response_types_supported":                       []string{"code"},
+		"response_modes_supported":                       []string{"query"},
+		"grant_types_supported":                          []string{client.GrantAuthorizationCode, client.GrantRefreshToken, client.GrantClientCredentials, client.GrantTokenExchange},
+		"subject_types_supported":                        []string{"public"},
+		"id_token_signing_alg_values_supported":          []string{h.tokenManager.Algorithm()},
+		"scopes_supported":                               []string{scopeOpenID, scopeProfile, scopeEmail},
+		"claims_supported":                               []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "preferred_username", "email", "email_verified", "roles"},
+		"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":               []string{authcode.MethodS256},
+		"authorization_response_iss_parameter_supported": true,
+		"tls_client_certificate_bound_access_tokens":     h.auth.mtlsConfig.BindTokens,
+		"dpop_signing_alg_values_supported":              dpop.SigningAlgorithms,
+	})
+}
+
+// hasScope 判断空格分隔的 scope 中是否包含指定值
+func hasScope(scope, value string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -3,23 +3,44 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/authz/abac"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
 	"github.com/jason0730/claude-code-demo/internal/model"
 	log "github.com/sirupsen/logrus"
 )
 
+// resourcePolicy 资源的对象级授权策略：只有所有者或拥有 resource:manage 权限（如 admin 及继承 admin 的角色）
+// 的主体可以修改和删除资源
+var resourcePolicy = rbac.ObjectPolicy{
+	rbac.PermissionResourceWrite:  {rbac.Owner(), rbac.HasPermission(rbac.PermissionResourceManage)},
+	rbac.PermissionResourceDelete: {rbac.Owner(), rbac.HasPermission(rbac.PermissionResourceManage)},
+}
+
 // ResourceHandler 资源处理器
-type ResourceHandler struct{}
+type ResourceHandler struct {
+	authz *objectAuthorizer
+}
 
 // NewResourceHandler 创建资源处理器
-func NewResourceHandler() *ResourceHandler {
-	return &ResourceHandler{}
+func NewResourceHandler(rbacManager *rbac.RBACManager, policies *abac.Engine) *ResourceHandler {
+	return &ResourceHandler{
+		authz: &objectAuthorizer{
+			rbacManager: rbacManager,
+			policies:    policies,
+			policy:      resourcePolicy,
+		},
+	}
 }
 
 // 模拟资源存储
+var mockResourcesMu sync.RWMutex
+
 var mockResources = []model.Resource{
 	{
 		ID:          "res-1",
@@ -58,7 +79,28 @@ func (h *ResourceHandler) ListResources(w http.ResponseWriter, r *http.Request)
 		"username": claims.Username,
 	}).Info("listing resources")
 
-	respondJSON(w, http.StatusOK, mockResources)
+	mockResourcesMu.RLock()
+	resources := append([]model.Resource(nil), mockResources...)
+	mockResourcesMu.RUnlock()
+
+	respondJSON(w, http.StatusOK, resources)
+}
+
+// GetResource 获取资源详情
+func (h *ResourceHandler) GetResource(w http.ResponseWriter, r *http.Request) {
+	resourceID := mux.Vars(r)["id"]
+
+	resource, ok := findResource(resourceID)
+	if !ok {
+		respondError(w, http.StatusNotFound, "resource not found")
+		return
+	}
+
+	if !h.authz.authorize(w, r, rbac.PermissionResourceRead, &resource, resourceAttributes(&resource)) {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resource)
 }
 
 // CreateResource 创建资源
@@ -83,8 +125,15 @@ func (h *ResourceHandler) CreateResource(w http.ResponseWriter, r *http.Request)
 		UpdatedAt:   time.Now(),
 	}
 
+	// 访问策略按新资源的属性评估，如不允许在非工作时间创建生产环境资源
+	if !h.authz.authorize(w, r, rbac.PermissionResourceWrite, &resource, resourceAttributes(&resource)) {
+		return
+	}
+
 	// 添加到模拟存储
+	mockResourcesMu.Lock()
 	mockResources = append(mockResources, resource)
+	mockResourcesMu.Unlock()
 
 	log.WithFields(log.Fields{
 		"user_id":     claims.UserID,
@@ -94,3 +143,112 @@ func (h *ResourceHandler) CreateResource(w http.ResponseWriter, r *http.Request)
 
 	respondJSON(w, http.StatusCreated, resource)
 }
+
+// UpdateResource 更新资源，只有所有者或拥有 resource:manage 权限的主体可以修改
+func (h *ResourceHandler) UpdateResource(w http.ResponseWriter, r *http.Request) {
+	resourceID := mux.Vars(r)["id"]
+
+	var req model.UpdateResourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	mockResourcesMu.Lock()
+	defer mockResourcesMu.Unlock()
+
+	i := resourceIndexLocked(resourceID)
+	if i < 0 {
+		respondError(w, http.StatusNotFound, "resource not found")
+		return
+	}
+
+	if !h.authz.authorize(w, r, rbac.PermissionResourceWrite, &mockResources[i], resourceAttributes(&mockResources[i])) {
+		return
+	}
+
+	// 更新后的属性同样要满足访问策略，避免把资源改成策略不允许修改的状态
+	updated := mockResources[i]
+	updated.Name = req.Name
+	updated.Description = req.Description
+	updated.Type = req.Type
+	updated.Metadata = req.Metadata
+	updated.UpdatedAt = time.Now()
+	if !h.authz.authorize(w, r, rbac.PermissionResourceWrite, &updated, resourceAttributes(&updated)) {
+		return
+	}
+
+	mockResources[i] = updated
+	resource := &mockResources[i]
+
+	claims, _ := authmw.GetClaims(r.Context())
+	log.WithFields(log.Fields{
+		"user_id":     claims.UserID,
+		"resource_id": resource.ID,
+		"owner":       resource.Owner,
+	}).Info("resource updated")
+
+	respondJSON(w, http.StatusOK, resource)
+}
+
+// DeleteResource 删除资源，只有所有者或拥有 resource:manage 权限的主体可以删除
+func (h *ResourceHandler) DeleteResource(w http.ResponseWriter, r *http.Request) {
+	resourceID := mux.Vars(r)["id"]
+
+	mockResourcesMu.Lock()
+	defer mockResourcesMu.Unlock()
+
+	i := resourceIndexLocked(resourceID)
+	if i < 0 {
+		respondError(w, http.StatusNotFound, "resource not found")
+		return
+	}
+
+	if !h.authz.authorize(w, r, rbac.PermissionResourceDelete, &mockResources[i], resourceAttributes(&mockResources[i])) {
+		return
+	}
+
+	owner := mockResources[i].Owner
+	mockResources = append(mockResources[:i], mockResources[i+1:]...)
+
+	claims, _ := authmw.GetClaims(r.Context())
+	log.WithFields(log.Fields{
+		"user_id":     claims.UserID,
+		"resource_id": resourceID,
+		"owner":       owner,
+	}).Info("resource deleted")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resourceAttributes 返回访问策略使用的资源属性
+func resourceAttributes(resource *model.Resource) *abac.Resource {
+	return &abac.Resource{
+		ID:       resource.ID,
+		Type:     resource.Type,
+		Owner:    resource.Owner,
+		Metadata: resource.Metadata,
+	}
+}
+
+// findResource 按 ID 查找资源，返回副本
+func findResource(id string) (model.Resource, bool) {
+	mockResourcesMu.RLock()
+	defer mockResourcesMu.RUnlock()
+
+	i := resourceIndexLocked(id)
+	if i < 0 {
+		return model.Resource{}, false
+	}
+	return mockResources[i], true
+}
+
+// resourceIndexLocked 返回资源在模拟存储中的下标，不存在时返回 -1；调用方需持有锁
+func resourceIndexLocked(id string) int {
+	for i := range mockResources {
+		if mockResources[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRoleDescriptionLength 角色描述最大长度
+const maxRoleDescriptionLength = 200
+
+// RoleHandler 角色管理处理器
+type RoleHandler struct {
+	rbacManager *rbac.RBACManager
+}
+
+// NewRoleHandler 创建角色管理处理器
+func NewRoleHandler(rbacManager *rbac.RBACManager) *RoleHandler {
+	return &RoleHandler{
+		rbacManager: rbacManager,
+	}
+}
+
+// ListRoles 列出内置角色和自定义角色
+func (h *RoleHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.rbacManager.Roles(r.Context())
+	if err != nil {
+		log.WithError(err).Error("failed to list roles")
+		respondError(w, http.StatusInternalServerError, "failed to list roles")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, roles)
+}
+
+// GetRole 获取角色详情
+func (h *RoleHandler) GetRole(w http.ResponseWriter, r *http.Request) {
+	name := rbac.Role(mux.Vars(r)["role"])
+
+	role, err := h.rbacManager.Role(r.Context(), name)
+	if err != nil {
+		h.respondRoleError(w, name, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, role)
+}
+
+// ExplainRole 列出角色的有效权限及每项权限的来源（直接授予的角色和继承链）
+func (h *RoleHandler) ExplainRole(w http.ResponseWriter, r *http.Request) {
+	name := rbac.Role(mux.Vars(r)["role"])
+
+	permissions, err := h.rbacManager.ExplainRole(r.Context(), name)
+	if err != nil {
+		h.respondRoleError(w, name, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"role":        name,
+		"permissions": permissions,
+	})
+}
+
+// CreateRole 创建自定义角色
+func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRoleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	role, err := h.rbacManager.CreateRole(r.Context(), newRoleDefinition(rbac.Role(req.Name), req))
+	if err != nil {
+		h.respondRoleError(w, rbac.Role(req.Name), err)
+		return
+	}
+
+	h.audit(r, "role_created", "security event: role created", role)
+	respondJSON(w, http.StatusCreated, role)
+}
+
+// UpdateRole 替换自定义角色的描述和权限集合
+func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	name := rbac.Role(mux.Vars(r)["role"])
+
+	req, ok := decodeRoleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	role, err := h.rbacManager.UpdateRole(r.Context(), newRoleDefinition(name, req))
+	if err != nil {
+		h.respondRoleError(w, name, err)
+		return
+	}
+
+	h.audit(r, "role_updated", "security event: role updated", role)
+	respondJSON(w, http.StatusOK, role)
+}
+
+// DeleteRole 删除自定义角色，内置角色不能删除
+func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	name := rbac.Role(mux.Vars(r)["role"])
+
+	if err := h.rbacManager.DeleteRole(r.Context(), name); err != nil {
+		h.respondRoleError(w, name, err)
+		return
+	}
+
+	h.audit(r, "role_deleted", "security event: role deleted", &rbac.RoleDefinition{Name: name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// audit 记录角色变更的安全事件
+func (h *RoleHandler) audit(r *http.Request, event, message string, role *rbac.RoleDefinition) {
+	claims, _ := authmw.GetClaims(r.Context())
+	log.WithFields(log.Fields{
+		"event":       event,
+		"user_id":     claims.UserID,
+		"username":    claims.Username,
+		"role":        role.Name,
+		"parents":     role.Parents,
+		"permissions": role.Permissions,
+		"remote_addr": clientIP(r),
+	}).Info(message)
+}
+
+// respondRoleError 将角色管理错误转换为响应
+func (h *RoleHandler) respondRoleError(w http.ResponseWriter, name rbac.Role, err error) {
+	switch {
+	case errors.Is(err, rbac.ErrRoleNotFound):
+		respondError(w, http.StatusNotFound, "role not found")
+	case errors.Is(err, rbac.ErrRoleExists):
+		respondError(w, http.StatusConflict, "role already exists")
+	case errors.Is(err, rbac.ErrBuiltInRole):
+		respondError(w, http.StatusForbidden, "built-in roles cannot be modified or deleted")
+	case errors.Is(err, rbac.ErrInvalidRoleName):
+		respondError(w, http.StatusBadRequest, "role name must start with a lowercase letter and contain only a-z, 0-9, - and _")
+	case errors.Is(err, rbac.ErrUnknownPermission), errors.Is(err, rbac.ErrNoPermissions),
+		errors.Is(err, rbac.ErrUnknownParent), errors.Is(err, rbac.ErrRoleCycle):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, rbac.ErrRoleInUse):
+		respondError(w, http.StatusConflict, "role is a parent of other roles; update or delete them first")
+	default:
+		log.WithError(err).WithField("role", name).Error("role management failed")
+		respondError(w, http.StatusInternalServerError, "role management failed")
+	}
+}
+
+// decodeRoleRequest 解析并校验角色请求体；失败时写入响应并返回 false
+func decodeRoleRequest(w http.ResponseWriter, r *http.Request) (*model.RoleRequest, bool) {
+	var req model.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return nil, false
+	}
+
+	req.Description = strings.TrimSpace(req.Description)
+	if len(req.Description) > maxRoleDescriptionLength {
+		respondError(w, http.StatusBadRequest, "description must be at most 200 characters")
+		return nil, false
+	}
+	return &req, true
+}
+
+// newRoleDefinition 根据请求构造角色定义，父角色和权限均去重
+func newRoleDefinition(name rbac.Role, req *model.RoleRequest) *rbac.RoleDefinition {
+	var parents []rbac.Role
+	seen := make(map[string]bool, len(req.Parents))
+	for _, parent := range req.Parents {
+		if !seen[parent] {
+			seen[parent] = true
+			parents = append(parents, rbac.Role(parent))
+		}
+	}
+
+	return &rbac.RoleDefinition{
+		Name:        name,
+		Description: req.Description,
+		Parents:     parents,
+		Permissions: toPermissions(req.Permissions),
+	}
+}
+
+// toPermissions 去重后转换为权限列表
+func toPermissions(names []string) []rbac.Permission {
+	seen := make(map[string]bool, len(names))
+	permissions := make([]rbac.Permission, 0, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		permissions = append(permissions, rbac.Permission(name))
+	}
+	return permissions
+}
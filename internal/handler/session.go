@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/auth/session"
+	log "github.com/sirupsen/logrus"
+)
+
+// sessionResponse 会话信息，current 表示发起请求的会话
+type sessionResponse struct {
+	*session.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions 列出当前用户登录的会话和设备
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims, _ := authmw.GetClaims(r.Context())
+	if claims.IsService() {
+		respondError(w, http.StatusForbidden, "not available for service principals")
+		return
+	}
+
+	h.respondSessions(w, r, claims.Subject, claims.SessionID)
+}
+
+// RevokeSession 登出当前用户的一个会话，可以是当前会话
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims, _ := authmw.GetClaims(r.Context())
+	if claims.IsService() {
+		respondError(w, http.StatusForbidden, "not available for service principals")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if !h.deleteSession(w, r, claims.Subject, id) {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":    claims.Subject,
+		"session_id": id,
+	}).Info("session revoked by user")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUserSessions 管理员列出指定用户的会话
+func (h *AuthHandler) ListUserSessions(w http.ResponseWriter, r *http.Request) {
+	h.respondSessions(w, r, mux.Vars(r)["id"], "")
+}
+
+// RevokeUserSession 管理员强制登出指定用户的一个会话
+func (h *AuthHandler) RevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, id := vars["id"], vars["session"]
+	claims, _ := authmw.GetClaims(r.Context())
+
+	if !h.deleteSession(w, r, userID, id) {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"admin_id":   claims.UserID,
+		"target_id":  userID,
+		"session_id": id,
+	}).Warn("session revoked by admin")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondSessions 返回用户的会话列表，current 为发起请求的会话 ID
+func (h *AuthHandler) respondSessions(w http.ResponseWriter, r *http.Request, userID, current string) {
+	sessions, err := h.refreshManager.Sessions(r.Context(), userID)
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("failed to list sessions")
+		respondError(w, http.StatusInternalServerError, "failed to list sessions")
+		return
+	}
+
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, sessionResponse{Session: s, Current: s.ID == current})
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// deleteSession 吊销属于用户的会话，失败时写入响应并返回 false
+func (h *AuthHandler) deleteSession(w http.ResponseWriter, r *http.Request, userID, id string) bool {
+	s, err := h.refreshManager.Session(r.Context(), id)
+	if err != nil && !errors.Is(err, session.ErrSessionNotFound) {
+		log.WithError(err).WithField("session_id", id).Error("session lookup failed")
+		respondError(w, http.StatusInternalServerError, "failed to revoke session")
+		return false
+	}
+	// 不属于该用户的会话同样返回 404，避免探测其他用户的会话 ID
+	if err != nil || s.UserID != userID {
+		respondError(w, http.StatusNotFound, "session not found")
+		return false
+	}
+
+	if err := h.revokeSession(r.Context(), id); err != nil {
+		log.WithError(err).WithField("session_id", id).Error("failed to revoke session")
+		respondError(w, http.StatusInternalServerError, "failed to revoke session")
+		return false
+	}
+	return true
+}
+
+// revokeSession 吊销会话签发的所有访问令牌和刷新令牌
+func (h *AuthHandler) revokeSession(ctx context.Context, id string) error {
+	expiresAt := time.Now().Add(h.tokenManager.AccessTokenTTL())
+	if err := h.revocations.RevokeSession(ctx, id, expiresAt); err != nil {
+		return err
+	}
+	return h.refreshManager.RevokeFamily(ctx, id)
+}
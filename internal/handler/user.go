@@ -1,21 +1,39 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
-	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/jason0730/claude-code-demo/internal/auth/identity"
 	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/authz/abac"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
 	"github.com/jason0730/claude-code-demo/internal/model"
 	log "github.com/sirupsen/logrus"
 )
 
+// userPolicy 用户记录的对象级授权策略：用户只能读取自己的信息，能列出全部用户的主体可以读取任一用户
+var userPolicy = rbac.ObjectPolicy{
+	rbac.PermissionUserRead: {rbac.Owner(), rbac.HasPermission(rbac.PermissionUserList)},
+}
+
 // UserHandler 用户处理器
-type UserHandler struct{}
+type UserHandler struct {
+	users identity.Directory
+	authz *objectAuthorizer
+}
 
 // NewUserHandler 创建用户处理器
-func NewUserHandler() *UserHandler {
-	return &UserHandler{}
+func NewUserHandler(users identity.Directory, rbacManager *rbac.RBACManager, policies *abac.Engine) *UserHandler {
+	return &UserHandler{
+		users: users,
+		authz: &objectAuthorizer{
+			rbacManager: rbacManager,
+			policies:    policies,
+			policy:      userPolicy,
+		},
+	}
 }
 
 // ListUsers 列出所有用户
@@ -27,32 +45,11 @@ func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		"username": claims.Username,
 	}).Info("listing users")
 
-	// 模拟用户列表
-	users := []model.User{
-		{
-			ID:       "1",
-			Username: "admin",
-			Email:    "admin@example.com",
-			Roles:    []string{"admin"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		{
-			ID:       "2",
-			Username: "editor",
-			Email:    "editor@example.com",
-			Roles:    []string{"editor"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		{
-			ID:       "3",
-			Username: "viewer",
-			Email:    "viewer@example.com",
-			Roles:    []string{"viewer"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
+	users, err := h.users.ListUsers(r.Context())
+	if err != nil {
+		log.WithError(err).Error("failed to list users")
+		respondError(w, http.StatusInternalServerError, "failed to list users")
+		return
 	}
 
 	respondJSON(w, http.StatusOK, users)
@@ -70,37 +67,20 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		"target_id":    userID,
 	}).Info("getting user details")
 
-	// 模拟用户数据
-	mockUsers := map[string]*model.User{
-		"1": {
-			ID:       "1",
-			Username: "admin",
-			Email:    "admin@example.com",
-			Roles:    []string{"admin"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		"2": {
-			ID:       "2",
-			Username: "editor",
-			Email:    "editor@example.com",
-			Roles:    []string{"editor"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		"3": {
-			ID:       "3",
-			Username: "viewer",
-			Email:    "viewer@example.com",
-			Roles:    []string{"viewer"},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
+	// 用户记录的所有者就是 ID 本身，先按 ID 授权再查找，不能读取他人信息的调用方无法据 404 判断 ID 是否存在
+	target := &model.User{ID: userID}
+	if !h.authz.authorize(w, r, rbac.PermissionUserRead, target, &abac.Resource{ID: userID, Owner: userID}) {
+		return
 	}
 
-	user, exists := mockUsers[userID]
-	if !exists {
-		respondError(w, http.StatusNotFound, "user not found")
+	user, err := h.users.GetUser(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			respondError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		log.WithError(err).WithField("target_id", userID).Error("failed to get user")
+		respondError(w, http.StatusInternalServerError, "failed to get user")
 		return
 	}
 
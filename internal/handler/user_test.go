@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jason0730/claude-code-demo/internal/auth/identity"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	authmw "github.com/jason0730/claude-code-demo/internal/auth/middleware"
+	"github.com/jason0730/claude-code-demo/internal/authz/abac"
+	"github.com/jason0730/claude-code-demo/internal/authz/rbac"
+	"github.com/jason0730/claude-code-demo/internal/model"
+)
+
+// fakeDirectory 只包含固定用户的目录
+type fakeDirectory map[string]*model.User
+
+func (d fakeDirectory) Name() string {
+	return "fake"
+}
+
+func (d fakeDirectory) GetUser(ctx context.Context, id string) (*model.User, error) {
+	user, ok := d[id]
+	if !ok {
+		return nil, identity.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (d fakeDirectory) ListUsers(ctx context.Context) ([]*model.User, error) {
+	users := make([]*model.User, 0, len(d))
+	for _, u := range d {
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// getUser 以指定身份请求 GET /users/{id}，返回状态码
+func getUser(t *testing.T, h *UserHandler, claims *jwt.CustomClaims, id string) int {
+	t.Helper()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", h.GetUser)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/"+id, nil)
+	req = req.WithContext(context.WithValue(req.Context(), authmw.ClaimsContextKey, claims))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestGetUserDoesNotRevealExistence(t *testing.T) {
+	rbacManager := rbac.NewRBACManager(rbac.NewMemoryStore())
+	policies, err := abac.NewEngine("", time.UTC, rbacManager)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	h := NewUserHandler(fakeDirectory{
+		"1": {ID: "1", Username: "admin", Roles: []string{"admin"}},
+		"4": {ID: "4", Username: "alice", Roles: []string{"user"}},
+	}, rbacManager, policies)
+
+	user := &jwt.CustomClaims{UserID: "4", Username: "alice", Roles: []string{"user"}}
+	admin := &jwt.CustomClaims{UserID: "1", Username: "admin", Roles: []string{"admin"}}
+
+	tests := []struct {
+		name   string
+		claims *jwt.CustomClaims
+		id     string
+		want   int
+	}{
+		{name: "own record", claims: user, id: "4", want: http.StatusOK},
+		{name: "existing other user", claims: user, id: "1", want: http.StatusForbidden},
+		{name: "missing other user", claims: user, id: "999", want: http.StatusForbidden},
+		{name: "admin reads other user", claims: admin, id: "4", want: http.StatusOK},
+		{name: "admin reads missing user", claims: admin, id: "999", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getUser(t, h, tt.claims, tt.id); got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
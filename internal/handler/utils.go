@@ -2,7 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // respondJSON 返回 JSON 响应
@@ -18,3 +21,23 @@ func respondError(w http.ResponseWriter, code int, message string) {
 		"error": message,
 	})
 }
+
+// respondTooManyAttempts 返回 429 并通过 Retry-After 告知需要等待的秒数
+func respondTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", retryAfterSeconds(wait))
+	respondError(w, http.StatusTooManyRequests, "too many failed login attempts, try again later")
+}
+
+// retryAfterSeconds 将等待时间向上取整为秒
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int((wait + time.Second - 1) / time.Second))
+}
+
+// clientIP 返回请求的来源 IP（可信代理的 X-Forwarded-For 已由中间件处理）
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,431 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jason0730/claude-code-demo/internal/auth/jwt"
+	"github.com/jason0730/claude-code-demo/internal/auth/webauthn"
+	"github.com/jason0730/claude-code-demo/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// 第二因素方式，登录质询响应中列出
+const (
+	methodTOTP     = "totp"
+	methodWebAuthn = "webauthn"
+)
+
+// 认证方式（RFC 8176）：可备份（同步）的通行密钥视为软件密钥
+const (
+	amrHardwareKey = "hwk"
+	amrSoftwareKey = "swk"
+)
+
+var (
+	errWebAuthnFailed            = errors.New("webauthn verification failed")
+	errPhishingResistantRequired = errors.New("a security key or passkey is required for your role")
+)
+
+// BeginWebAuthnLogin 开始 WebAuthn 认证仪式
+//
+// 提交登录质询令牌时作为第二因素，只允许该用户的凭证；不提交时为无密码登录。
+func (h *AuthHandler) BeginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	var req model.WebAuthnBeginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var (
+		userID string
+		amr    []string
+	)
+	if req.ChallengeToken != "" {
+		claims, user, err := h.parseChallenge(r.Context(), req.ChallengeToken, jwt.ChallengeMFA)
+		if err != nil {
+			h.respondMFAError(w, err)
+			return
+		}
+		userID, amr = user.ID, claims.AuthMethods
+	}
+
+	opts, err := h.webauthn.BeginLogin(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrCredentialNotFound) {
+			respondError(w, http.StatusBadRequest, "no passkey registered")
+			return
+		}
+		log.WithError(err).Error("failed to begin webauthn login")
+		respondError(w, http.StatusInternalServerError, "failed to begin webauthn login")
+		return
+	}
+
+	h.respondCeremony(w, opts, userID, jwt.ChallengeWebAuthnLogin, opts.Challenge, amr)
+}
+
+// FinishWebAuthnLogin 完成 WebAuthn 认证仪式，验证通过后签发令牌
+func (h *AuthHandler) FinishWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	var req model.WebAuthnFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, amr, wait, err := h.completeWebAuthn(r, req.ChallengeToken, req.CeremonyToken, req.Credential)
+	if wait > 0 {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+
+	pair, err := h.issueTokens(r, user, jwt.TokenOptions{AuthMethods: amr})
+	if err != nil {
+		respondIssueError(w, err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"amr":      amr,
+	}).Info("user logged in successfully")
+
+	respondJSON(w, http.StatusOK, loginResponse(pair))
+}
+
+// EnrollWebAuthn 使用登记质询令牌开始注册通行密钥（角色要求 MFA 但尚未登记的用户）
+func (h *AuthHandler) EnrollWebAuthn(w http.ResponseWriter, r *http.Request) {
+	var req model.WebAuthnBeginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	claims, user, err := h.parseChallenge(r.Context(), req.ChallengeToken, jwt.ChallengeMFAEnroll)
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+
+	h.beginWebAuthnRegistration(w, r, user, claims.AuthMethods)
+}
+
+// ConfirmWebAuthnEnrollment 使用登记质询令牌完成注册，返回正式令牌
+func (h *AuthHandler) ConfirmWebAuthnEnrollment(w http.ResponseWriter, r *http.Request) {
+	var req model.WebAuthnFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	claims, user, err := h.parseChallenge(r.Context(), req.ChallengeToken, jwt.ChallengeMFAEnroll)
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+
+	credential, err := h.finishWebAuthnRegistration(r, user, &req)
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+	h.consumeChallenge(r.Context(), claims)
+
+	amr := append(append([]string(nil), claims.AuthMethods...), keyAuthMethod(credential), amrMFA)
+	pair, err := h.issueTokens(r, user, jwt.TokenOptions{AuthMethods: amr})
+	if err != nil {
+		respondIssueError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, loginResponse(pair))
+}
+
+// BeginWebAuthnRegistration 当前用户开始注册通行密钥或安全密钥
+func (h *AuthHandler) BeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	h.beginWebAuthnRegistration(w, r, user, nil)
+}
+
+// FinishWebAuthnRegistration 当前用户完成注册，返回新凭证
+func (h *AuthHandler) FinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.WebAuthnFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	credential, err := h.finishWebAuthnRegistration(r, user, &req)
+	if err != nil {
+		h.respondMFAError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, credential)
+}
+
+// ListWebAuthnCredentials 列出当前用户注册的凭证
+func (h *AuthHandler) ListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	credentials, err := h.webauthn.Credentials(r.Context(), user.ID)
+	if err != nil {
+		log.WithError(err).Error("failed to list webauthn credentials")
+		respondError(w, http.StatusInternalServerError, "failed to list webauthn credentials")
+		return
+	}
+	respondJSON(w, http.StatusOK, credentials)
+}
+
+// DeleteWebAuthnCredential 当前用户删除一个凭证；删除后不再满足角色的 MFA 要求时不允许
+func (h *AuthHandler) DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	credentials, err := h.webauthn.Credentials(r.Context(), user.ID)
+	if err != nil {
+		log.WithError(err).Error("failed to list webauthn credentials")
+		respondError(w, http.StatusInternalServerError, "failed to delete webauthn credential")
+		return
+	}
+	owned := false
+	for _, c := range credentials {
+		owned = owned || c.ID == id
+	}
+	if !owned {
+		respondError(w, http.StatusNotFound, "credential not found")
+		return
+	}
+	totp, err := h.mfa.Enabled(r.Context(), user.ID)
+	if err != nil {
+		log.WithError(err).Error("failed to check mfa")
+		respondError(w, http.StatusInternalServerError, "failed to delete webauthn credential")
+		return
+	}
+	if !h.canRemoveFactor(user, totp, len(credentials)-1) {
+		respondError(w, http.StatusForbidden, "mfa is required for your role")
+		return
+	}
+
+	if err := h.webauthn.Remove(r.Context(), user.ID, id); err != nil {
+		if errors.Is(err, webauthn.ErrCredentialNotFound) {
+			respondError(w, http.StatusNotFound, "credential not found")
+			return
+		}
+		log.WithError(err).Error("failed to delete webauthn credential")
+		respondError(w, http.StatusInternalServerError, "failed to delete webauthn credential")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"event":         "webauthn_removed",
+		"user_id":       user.ID,
+		"credential_id": id,
+		"remote_addr":   clientIP(r),
+	}).Warn("security event: webauthn credential removed")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeWebAuthn 校验仪式令牌和认证结果，成功后使令牌失效，返回用户和完整的认证方式
+//
+// challengeToken 非空时为第二因素，必须与仪式属于同一用户；为空时为无密码登录。
+func (h *AuthHandler) completeWebAuthn(r *http.Request, challengeToken, ceremonyToken string, raw json.RawMessage) (*model.User, []string, time.Duration, error) {
+	ctx := r.Context()
+	ceremony, err := h.parseCeremony(ctx, ceremonyToken, jwt.ChallengeWebAuthnLogin)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	var (
+		challenge *jwt.ChallengeClaims
+		user      *model.User
+	)
+	if ceremony.Subject != "" {
+		challenge, user, err = h.parseChallenge(ctx, challengeToken, jwt.ChallengeMFA)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if challenge.Subject != ceremony.Subject {
+			return nil, nil, 0, errInvalidChallenge
+		}
+	}
+
+	var resp webauthn.AssertionResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, nil, 0, errWebAuthnFailed
+	}
+
+	// 无密码登录在找到凭证后才知道用户，先只检查来源 IP
+	ip := clientIP(r)
+	username := ""
+	if user != nil {
+		username = user.Username
+	}
+	attempt, wait, err := h.lockout.Begin(username, ip)
+	if err != nil || wait > 0 {
+		return nil, nil, wait, err
+	}
+
+	assertion, err := h.webauthn.FinishLogin(ctx, ceremony.Subject, ceremony.Challenge, &resp)
+	if err == nil && user == nil {
+		user = h.getUserByID(ctx, assertion.Credential.UserID)
+		if user == nil {
+			err = webauthn.ErrCredentialNotFound
+		} else if wait, err := attempt.AddUser(user.Username, ip); err != nil || wait > 0 {
+			return nil, nil, wait, err
+		}
+	}
+	if err != nil {
+		if !errors.Is(err, webauthn.ErrInvalidResponse) &&
+			!errors.Is(err, webauthn.ErrCredentialNotFound) &&
+			!errors.Is(err, webauthn.ErrSignCountRegression) {
+			attempt.Cancel()
+			return nil, nil, 0, err
+		}
+		attempt.Fail()
+		log.WithFields(log.Fields{
+			"user_id":       ceremony.Subject,
+			"credential_id": resp.RawID,
+			"remote_addr":   ip,
+			"reason":        err.Error(),
+		}).Info("webauthn verification failed")
+		return nil, nil, 0, errWebAuthnFailed
+	}
+
+	attempt.Succeed()
+	h.consumeChallenge(ctx, ceremony)
+	if challenge != nil {
+		h.consumeChallenge(ctx, challenge)
+	}
+
+	var amr []string
+	if challenge != nil {
+		amr = append(amr, challenge.AuthMethods...)
+	}
+	amr = append(amr, keyAuthMethod(assertion.Credential))
+	if challenge != nil || assertion.UserVerified {
+		amr = append(amr, amrMFA)
+	}
+	return user, amr, 0, nil
+}
+
+// beginWebAuthnRegistration 生成注册选项和仪式令牌
+func (h *AuthHandler) beginWebAuthnRegistration(w http.ResponseWriter, r *http.Request, user *model.User, amr []string) {
+	opts, err := h.webauthn.BeginRegistration(r.Context(), user.ID, user.Username)
+	if err != nil {
+		log.WithError(err).Error("failed to begin webauthn registration")
+		respondError(w, http.StatusInternalServerError, "failed to begin webauthn registration")
+		return
+	}
+
+	h.respondCeremony(w, opts, user.ID, jwt.ChallengeWebAuthnRegister, opts.Challenge, amr)
+}
+
+// finishWebAuthnRegistration 校验仪式令牌并保存新凭证
+func (h *AuthHandler) finishWebAuthnRegistration(r *http.Request, user *model.User, req *model.WebAuthnFinishRequest) (*webauthn.Credential, error) {
+	ceremony, err := h.parseCeremony(r.Context(), req.CeremonyToken, jwt.ChallengeWebAuthnRegister)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.Subject != user.ID {
+		return nil, errInvalidChallenge
+	}
+
+	var resp webauthn.RegistrationResponse
+	if err := json.Unmarshal(req.Credential, &resp); err != nil {
+		return nil, errWebAuthnFailed
+	}
+
+	ip := clientIP(r)
+	credential, err := h.webauthn.FinishRegistration(r.Context(), user.ID, ceremony.Challenge, req.Name, &resp)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrInvalidResponse) {
+			log.WithFields(log.Fields{
+				"user_id":     user.ID,
+				"remote_addr": ip,
+				"reason":      err.Error(),
+			}).Info("webauthn registration failed")
+			return nil, errWebAuthnFailed
+		}
+		return nil, err
+	}
+	h.consumeChallenge(r.Context(), ceremony)
+
+	log.WithFields(log.Fields{
+		"event":         "webauthn_registered",
+		"user_id":       user.ID,
+		"credential_id": credential.ID,
+		"aaguid":        credential.AAGUID,
+		"remote_addr":   ip,
+	}).Info("security event: webauthn credential registered")
+	return credential, nil
+}
+
+// respondCeremony 签发保存仪式状态的令牌并返回仪式选项
+func (h *AuthHandler) respondCeremony(w http.ResponseWriter, opts interface{}, userID, purpose, challenge string, amr []string) {
+	ttl := h.webauthn.Timeout()
+	token, err := h.tokenManager.GenerateChallengeToken(userID, ttl, jwt.ChallengeClaims{
+		Purpose:     purpose,
+		AuthMethods: amr,
+		Challenge:   challenge,
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to generate ceremony token")
+		respondError(w, http.StatusInternalServerError, "failed to begin webauthn ceremony")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model.WebAuthnCeremonyResponse{
+		PublicKey:     opts,
+		CeremonyToken: token,
+		ExpiresIn:     int64(ttl.Seconds()),
+	})
+}
+
+// parseCeremony 验证仪式令牌的用途和是否已使用；无密码登录的仪式没有用户
+func (h *AuthHandler) parseCeremony(ctx context.Context, token, purpose string) (*jwt.ChallengeClaims, error) {
+	claims, err := h.tokenManager.ValidateChallengeToken(token)
+	if err != nil || claims.Purpose != purpose || claims.Challenge == "" {
+		return nil, errInvalidChallenge
+	}
+
+	revoked, err := h.revocations.IsRevoked(ctx, claims.ID, claims.Subject, jwt.TimeOf(claims.IssuedAt))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errInvalidChallenge
+	}
+	return claims, nil
+}
+
+// keyAuthMethod 返回凭证对应的 amr 取值
+func keyAuthMethod(c *webauthn.Credential) string {
+	if c.BackupEligible {
+		return amrSoftwareKey
+	}
+	return amrHardwareKey
+}
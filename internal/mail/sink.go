@@ -0,0 +1,74 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FileMailer 将邮件写入目录下的 .eml 文件，用于本地开发和测试
+type FileMailer struct {
+	dir  string
+	from *mail.Address
+}
+
+// NewFileMailer 创建文件邮件发送器，目录不存在时自动创建
+func NewFileMailer(dir string, from *mail.Address) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create mail dir: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send 将邮件写入 <时间戳>-<随机串>.eml，文件按名称排序即为发送顺序
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := encode(m.from, msg)
+	if err != nil {
+		return err
+	}
+	suffix, err := randomHex(4)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), suffix)
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write mail: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"path":    path,
+	}).Info("mail written to file")
+	return nil
+}
+
+// LogMailer 将邮件正文写入日志，用于本地开发
+//
+// 邮件中包含重置链接等敏感内容，不应在生产环境使用。
+type LogMailer struct {
+	from *mail.Address
+}
+
+// NewLogMailer 创建日志邮件发送器
+func NewLogMailer(from *mail.Address) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+// Send 将纯文本正文写入日志
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	log.WithFields(log.Fields{
+		"from":    m.from.String(),
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Text,
+	}).Info("mail not sent: logged by MAIL_DRIVER=log")
+	return nil
+}
@@ -0,0 +1,81 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// 邮件模板名称
+const (
+	TemplatePasswordReset = "password_reset"
+	TemplateVerifyEmail   = "verify_email"
+)
+
+// AccountData 账户类邮件（密码重置、邮箱验证）的模板数据
+type AccountData struct {
+	AppName   string
+	Username  string
+	Email     string
+	Link      string
+	ExpiresIn string // 链接有效期，如 "15 minutes"
+}
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// template 单个邮件模板，subject 和 text 按纯文本渲染，html 按 HTML 转义渲染
+type template struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// templates 启动时解析的全部邮件模板，按名称索引
+var templates = mustParseTemplates()
+
+// mustParseTemplates 解析内嵌的邮件模板，每个文件定义 subject、text 和 html 三个块
+func mustParseTemplates() map[string]*template {
+	files, err := templateFS.ReadDir("templates")
+	if err != nil {
+		panic(err)
+	}
+
+	parsed := make(map[string]*template, len(files))
+	for _, f := range files {
+		file := path.Join("templates", f.Name())
+		parsed[strings.TrimSuffix(f.Name(), ".tmpl")] = &template{
+			text: texttemplate.Must(texttemplate.ParseFS(templateFS, file)),
+			html: htmltemplate.Must(htmltemplate.ParseFS(templateFS, file)),
+		}
+	}
+	return parsed
+}
+
+// Render 渲染邮件模板，返回的邮件未设置收件人
+func Render(name string, data interface{}) (*Message, error) {
+	t, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mail template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := t.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return nil, err
+	}
+	if err := t.html.ExecuteTemplate(&html, "html", data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    strings.TrimSpace(html.String()) + "\n",
+	}, nil
+}
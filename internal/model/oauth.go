@@ -0,0 +1,39 @@
+package model
+
+// TokenResponse OAuth 2.0 令牌端点响应（RFC 6749 第 5.1 节）
+type TokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"` // 令牌交换签发的令牌类型（RFC 8693）
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	IDToken         string `json:"id_token,omitempty"`
+}
+
+// IntrospectionResponse 令牌内省响应（RFC 7662）
+type IntrospectionResponse struct {
+	Active    bool                   `json:"active"`
+	Scope     string                 `json:"scope,omitempty"`
+	ClientID  string                 `json:"client_id,omitempty"`
+	Username  string                 `json:"username,omitempty"`
+	TokenType string                 `json:"token_type,omitempty"`
+	Exp       int64                  `json:"exp,omitempty"`
+	Iat       int64                  `json:"iat,omitempty"`
+	Nbf       int64                  `json:"nbf,omitempty"`
+	Sub       string                 `json:"sub,omitempty"`
+	Aud       []string               `json:"aud,omitempty"`
+	Iss       string                 `json:"iss,omitempty"`
+	Jti       string                 `json:"jti,omitempty"`
+	Email     string                 `json:"email,omitempty"`
+	Roles     []string               `json:"roles,omitempty"`
+	SessionID string                 `json:"sid,omitempty"`
+	Cnf       map[string]string      `json:"cnf,omitempty"` // 令牌绑定的持有证明（RFC 8705 x5t#S256）
+	Act       map[string]interface{} `json:"act,omitempty"` // 委托令牌的行为方（RFC 8693）
+}
+
+// OAuthError OAuth 2.0 错误响应（RFC 6749 第 5.2 节）
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
@@ -21,3 +21,16 @@ type CreateResourceRequest struct {
 	Type        string            `json:"type"`
 	Metadata    map[string]string `json:"metadata,omitempty"`
 }
+
+// UpdateResourceRequest 更新资源请求，替换资源的名称、描述、类型和元数据
+type UpdateResourceRequest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Type        string            `json:"type"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// OwnerID 返回资源所有者的用户 ID
+func (r *Resource) OwnerID() string {
+	return r.Owner
+}
@@ -1,16 +1,25 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // User 用户模型
 type User struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"` // 密码不返回给客户端
-	Roles     []string  `json:"roles"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Password      string    `json:"-"` // 密码不返回给客户端
+	Roles         []string  `json:"roles"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// OwnerID 用户记录归用户本人所有
+func (u *User) OwnerID() string {
+	return u.ID
 }
 
 // LoginRequest 登录请求
@@ -27,6 +36,82 @@ type LoginResponse struct {
 	TokenType    string `json:"token_type"`
 }
 
+// MFAChallengeResponse 密码认证通过但需要第二因素时的登录响应
+type MFAChallengeResponse struct {
+	Status         string   `json:"status"` // mfa_required 或 mfa_enrollment_required
+	ChallengeToken string   `json:"challenge_token"`
+	ExpiresIn      int64    `json:"expires_in"`
+	Methods        []string `json:"methods"` // 可用（或需要登记）的第二因素：totp、webauthn
+}
+
+// MFAVerifyRequest 提交质询令牌和验证码（TOTP 或恢复码）
+type MFAVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// MFACodeRequest 提交验证码
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAEnrollResponse 确认登记后返回的恢复码，质询登记时同时返回令牌
+type MFAEnrollResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	*LoginResponse
+}
+
+// WebAuthnBeginRequest 开始 WebAuthn 仪式；质询令牌为空时表示无密码登录
+type WebAuthnBeginRequest struct {
+	ChallengeToken string `json:"challenge_token,omitempty"`
+}
+
+// WebAuthnCeremonyResponse WebAuthn 仪式选项，ceremony_token 在完成仪式时原样提交
+type WebAuthnCeremonyResponse struct {
+	PublicKey     interface{} `json:"public_key"` // 传给 navigator.credentials.create/get 的 publicKey 选项
+	CeremonyToken string      `json:"ceremony_token"`
+	ExpiresIn     int64       `json:"expires_in"`
+}
+
+// WebAuthnFinishRequest 完成 WebAuthn 仪式，credential 为 PublicKeyCredential.toJSON() 的结果
+type WebAuthnFinishRequest struct {
+	CeremonyToken  string          `json:"ceremony_token"`
+	ChallengeToken string          `json:"challenge_token,omitempty"`
+	Name           string          `json:"name,omitempty"` // 注册时的凭证名称
+	Credential     json.RawMessage `json:"credential"`
+}
+
+// ForgotPasswordRequest 申请通过邮件重置密码
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest 使用邮件中的令牌设置新密码
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// VerifyEmailRequest 提交邮件中的邮箱验证令牌
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// CreateAPIKeyRequest 创建个人访问令牌
+type CreateAPIKeyRequest struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`          // 令牌可以使用的权限，必须是创建者当前拥有的权限
+	ExpiresIn   int64    `json:"expires_in,omitempty"` // 有效期（秒），为 0 时使用默认有效期
+}
+
+// RoleRequest 创建或更新自定义角色；更新时忽略 Name，以路径中的角色名为准
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Parents     []string `json:"parents,omitempty"` // 父角色，继承其全部有效权限
+	Permissions []string `json:"permissions"`       // 角色自身授予的权限
+}
+
 // RefreshRequest 刷新令牌请求
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token"`